@@ -0,0 +1,92 @@
+package aad
+
+import (
+	"encoding/binary"
+)
+
+/*
+Type tags of the canonical encoding. Every component is encoded as
+
+	tag (1 byte) || length of value (8 bytes, big endian) || value
+
+so a string "1" and an integer 1 or a byte slice with the same content never produce
+the same associated data string.
+*/
+const (
+	TagBytes       = 0x01
+	TagString      = 0x02
+	TagInt         = 0x03
+	TagUint        = 0x04
+	TagBool        = 0x05
+	TagJSON        = 0x06
+	TagCBOR        = 0x07
+	TagHTTPRequest = 0x08
+
+	headerSize = 9
+)
+
+/*
+Builder collects typed components and produces the associated data vector for
+SealWithMultipleAAD/OpenWithMultipleAAD. Every component becomes a separate S2V string,
+so producers and consumers written independently agree on the vector as long as they
+add the same components in the same order.
+*/
+type Builder struct {
+	components  [][]byte
+	normalizers []Normalizer
+}
+
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+func (b *Builder) Bytes(p []byte) *Builder {
+	return b.add(TagBytes, p)
+}
+
+func (b *Builder) String(s string) *Builder {
+	return b.add(TagString, []byte(b.normalize(s)))
+}
+
+func (b *Builder) Int(i int64) *Builder {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(i))
+	return b.add(TagInt, v)
+}
+
+func (b *Builder) Uint(u uint64) *Builder {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, u)
+	return b.add(TagUint, v)
+}
+
+func (b *Builder) Bool(v bool) *Builder {
+	if v {
+		return b.add(TagBool, []byte{1})
+	}
+	return b.add(TagBool, []byte{0})
+}
+
+func (b *Builder) Len() int {
+	return len(b.components)
+}
+
+/*
+Build returns the associated data vector. The builder can be used further,
+the returned vector isn't affected by subsequent calls.
+*/
+func (b *Builder) Build() [][]byte {
+	result := make([][]byte, len(b.components))
+	copy(result, b.components)
+	return result
+}
+
+func (b *Builder) add(tag byte, value []byte) *Builder {
+	component := make([]byte, headerSize+len(value))
+	component[0] = tag
+	binary.BigEndian.PutUint64(component[1:headerSize], uint64(len(value)))
+	copy(component[headerSize:], value)
+
+	b.components = append(b.components, component)
+	return b
+}
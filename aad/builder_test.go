@@ -0,0 +1,165 @@
+package aad
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/luc-lynx/siv/siv"
+	"strings"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	t.Run("deterministic", testDeterministic)
+	t.Run("type tags", testTypeTags)
+	t.Run("build copy", testBuildCopy)
+	t.Run("seal/open", testSealOpen)
+	t.Run("normalization", testNormalize)
+	t.Run("typed tuples", testTuples)
+}
+
+func equalVectors(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func testDeterministic(t *testing.T) {
+	a := NewBuilder().String("user").Int(-42).Uint(42).Bytes([]byte{1, 2, 3}).Bool(true).Build()
+	b := NewBuilder().String("user").Int(-42).Uint(42).Bytes([]byte{1, 2, 3}).Bool(true).Build()
+	if !equalVectors(a, b) {
+		t.Fail()
+	}
+
+	expected := []byte{TagString, 0, 0, 0, 0, 0, 0, 0, 4, 'u', 's', 'e', 'r'}
+	if !bytes.Equal(a[0], expected) {
+		t.Errorf("unexpected encoding %x", a[0])
+	}
+}
+
+func testTypeTags(t *testing.T) {
+	vectors := [][][]byte{
+		NewBuilder().String("\x00\x00\x00\x00\x00\x00\x00\x01").Build(),
+		NewBuilder().Bytes([]byte("\x00\x00\x00\x00\x00\x00\x00\x01")).Build(),
+		NewBuilder().Int(1).Build(),
+		NewBuilder().Uint(1).Build(),
+	}
+
+	for i := range vectors {
+		for j := i + 1; j < len(vectors); j++ {
+			if equalVectors(vectors[i], vectors[j]) {
+				t.Errorf("vectors %d and %d are equal", i, j)
+			}
+		}
+	}
+}
+
+func testBuildCopy(t *testing.T) {
+	b := NewBuilder().String("a")
+	v := b.Build()
+	b.String("b")
+
+	if len(v) != 1 || b.Len() != 2 {
+		t.Fail()
+	}
+}
+
+func testSealOpen(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := siv.NewAesSIV(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := []byte("some secret value")
+	ct := s.SealWithMultipleAAD(nil, plaintext, NewBuilder().String("table").Int(7).Build())
+
+	pt, err := s.OpenWithMultipleAAD(nil, ct, NewBuilder().String("table").Int(7).Build())
+	if err != nil || !bytes.Equal(pt, plaintext) {
+		t.Fatal("failed to open", err)
+	}
+
+	if _, err := s.OpenWithMultipleAAD(nil, ct, NewBuilder().String("table").Uint(7).Build()); err == nil {
+		t.Fail()
+	}
+}
+
+func testNormalize(t *testing.T) {
+	// NFD form of "é" followed by the NFC one, a stand-in for norm.NFC.String
+	nfc := func(s string) string { return strings.ReplaceAll(s, "e\u0301", "\u00e9") }
+
+	a := NewBuilder().Normalize(nfc, CaseFold).String("Jose\u0301").Bytes([]byte("Jose")).Build()
+	b := NewBuilder().Normalize(nfc, CaseFold).String("JOS\u00c9").Bytes([]byte("Jose")).Build()
+	if !equalVectors(a, b) {
+		t.Error("normalized strings differ")
+	}
+
+	// bytes components and builders without normalizers aren't affected
+	c := NewBuilder().String("Jose\u0301").Normalize().String("Jose").Build()
+	if string(c[0][headerSize:]) != "Jose\u0301" || string(c[1][headerSize:]) != "Jose" {
+		t.Errorf("unexpected components %q", c)
+	}
+
+	for in, expected := range map[string]string{
+		"ΣΑΣ":        "σασ",
+		"ς":          "σ",
+		"\u212a":     "k", // Kelvin sign
+		"Straße":     "straße",
+		"a\xffB\xfe": "a\xffb\xfe",
+	} {
+		if got := CaseFold(in); got != expected {
+			t.Errorf("CaseFold(%q) = %q, expected %q", in, got, expected)
+		}
+	}
+}
+
+type tenantID string
+
+func testTuples(t *testing.T) {
+	expected := NewBuilder().String("acme").Int(-1).Uint(7).Build()
+	if !equalVectors(Tuple3(tenantID("acme"), -1, uint8(7)), expected) {
+		t.Error("tuple differs from the builder")
+	}
+	if !equalVectors(Tuple2([]byte{1}, true), NewBuilder().Bytes([]byte{1}).Bool(true).Build()) {
+		t.Error("tuple differs from the builder")
+	}
+
+	k, err := siv.NewAesSIV(append(bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := Seal2(k, nil, []byte("record"), tenantID("acme"), int64(3))
+	if pt, err := Open2(k, nil, ct, tenantID("acme"), int64(3)); err != nil || string(pt) != "record" {
+		t.Fatal("doesn't round trip", err)
+	}
+	if pt, err := k.OpenWithMultipleAAD(nil, ct, NewBuilder().String("acme").Int(3).Build()); err != nil || string(pt) != "record" {
+		t.Error("Builder can't open a tuple", err)
+	}
+
+	// same values, different kinds
+	if _, err := Open2(k, nil, ct, tenantID("acme"), uint64(3)); err == nil {
+		t.Error("opened with an unsigned instead of a signed integer")
+	}
+	if _, err := Open2(k, nil, ct, []byte("acme"), int64(3)); err == nil {
+		t.Error("opened with bytes instead of a string")
+	}
+
+	ct = Seal1(k, nil, []byte("one"), "a")
+	if _, err := Open1(k, nil, ct, "a"); err != nil {
+		t.Error(err)
+	}
+	ct = Seal3(k, nil, []byte("three"), "a", false, 0)
+	if _, err := Open3(k, nil, ct, "a", false, 0); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,233 @@
+package aad
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+)
+
+/*
+Deterministically encoded CBOR as defined in https://tools.ietf.org/html/rfc8949#section-4.2.1
+Integers, lengths and floating point values use the shortest form, all the lengths are definite
+and map entries are sorted by the bytewise lexicographic order of the encoded keys.
+
+Supported values are nil, booleans, integers, floats, strings, byte slices,
+slices/arrays and maps of those values (including integer keys used by COSE).
+*/
+
+const (
+	majorUnsigned = 0
+	majorNegative = 1
+	majorBytes    = 2
+	majorText     = 3
+	majorArray    = 4
+	majorMap      = 5
+	majorSimple   = 7
+
+	simpleFalse   = 0xf4
+	simpleTrue    = 0xf5
+	simpleNull    = 0xf6
+	simpleFloat16 = 0xf9
+	simpleFloat32 = 0xfa
+	simpleFloat64 = 0xfb
+)
+
+var (
+	errUnsupportedCBORType = errors.New("type can't be encoded as deterministic CBOR")
+	errDuplicateMapKey     = errors.New("map has duplicate keys after encoding")
+)
+
+type mapEntry struct {
+	key   []byte
+	value []byte
+}
+
+func EncodeCBOR(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeCBOR(&buf, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+/*
+CBOR encodes the value deterministically and adds it as a single component.
+*/
+func (b *Builder) CBOR(v interface{}) error {
+	encoded, err := EncodeCBOR(v)
+	if err != nil {
+		return err
+	}
+
+	b.add(TagCBOR, encoded)
+	return nil
+}
+
+func encodeCBOR(buf *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() {
+		buf.WriteByte(simpleNull)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			buf.WriteByte(simpleNull)
+			return nil
+		}
+		return encodeCBOR(buf, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte(simpleTrue)
+		} else {
+			buf.WriteByte(simpleFalse)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := v.Int()
+		if i < 0 {
+			writeCBORHeader(buf, majorNegative, uint64(-1-i))
+		} else {
+			writeCBORHeader(buf, majorUnsigned, uint64(i))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeCBORHeader(buf, majorUnsigned, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		writeCBORFloat(buf, v.Float())
+	case reflect.String:
+		writeCBORHeader(buf, majorText, uint64(v.Len()))
+		buf.WriteString(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			writeCBORHeader(buf, majorBytes, uint64(v.Len()))
+			for i := 0; i < v.Len(); i++ {
+				buf.WriteByte(byte(v.Index(i).Uint()))
+			}
+			return nil
+		}
+
+		writeCBORHeader(buf, majorArray, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeCBOR(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		return encodeCBORMap(buf, v)
+	default:
+		return errUnsupportedCBORType
+	}
+
+	return nil
+}
+
+func encodeCBORMap(buf *bytes.Buffer, v reflect.Value) error {
+	entries := make([]mapEntry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		var key, value bytes.Buffer
+		if err := encodeCBOR(&key, iter.Key()); err != nil {
+			return err
+		}
+		if err := encodeCBOR(&value, iter.Value()); err != nil {
+			return err
+		}
+		entries = append(entries, mapEntry{key: key.Bytes(), value: value.Bytes()})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+
+	writeCBORHeader(buf, majorMap, uint64(len(entries)))
+	for i := range entries {
+		if i > 0 && bytes.Equal(entries[i-1].key, entries[i].key) {
+			return errDuplicateMapKey
+		}
+		buf.Write(entries[i].key)
+		buf.Write(entries[i].value)
+	}
+	return nil
+}
+
+func writeCBORHeader(buf *bytes.Buffer, major byte, arg uint64) {
+	major <<= 5
+	switch {
+	case arg < 24:
+		buf.WriteByte(major | byte(arg))
+	case arg <= math.MaxUint8:
+		buf.WriteByte(major | 24)
+		buf.WriteByte(byte(arg))
+	case arg <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		binary.Write(buf, binary.BigEndian, uint16(arg))
+	case arg <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		binary.Write(buf, binary.BigEndian, uint32(arg))
+	default:
+		buf.WriteByte(major | 27)
+		binary.Write(buf, binary.BigEndian, arg)
+	}
+}
+
+/*
+Floats are written in the shortest of the half, single and double precision forms that
+preserves the value, NaN is always encoded as the canonical half precision quiet NaN.
+*/
+func writeCBORFloat(buf *bytes.Buffer, f float64) {
+	if math.IsNaN(f) {
+		buf.Write([]byte{simpleFloat16, 0x7e, 0x00})
+		return
+	}
+
+	f32 := float32(f)
+	if float64(f32) != f {
+		buf.WriteByte(simpleFloat64)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+		return
+	}
+
+	if half, ok := float16Bits(f32); ok {
+		buf.WriteByte(simpleFloat16)
+		binary.Write(buf, binary.BigEndian, half)
+		return
+	}
+
+	buf.WriteByte(simpleFloat32)
+	binary.Write(buf, binary.BigEndian, math.Float32bits(f32))
+}
+
+/*
+float16Bits returns the IEEE 754 half precision representation of f if it's exact.
+*/
+func float16Bits(f float32) (uint16, bool) {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23&0xff) - 127
+	mant := bits & 0x7fffff
+
+	switch {
+	case bits&0x7fffffff == 0:
+		return sign, true
+	case exp == 128:
+		// infinity, NaN is handled by the caller
+		return sign | 0x7c00, mant == 0
+	case exp >= -14 && exp <= 15:
+		if mant&0x1fff != 0 {
+			return 0, false
+		}
+		return sign | uint16(exp+15)<<10 | uint16(mant>>13), true
+	case exp >= -24 && exp < -14:
+		// subnormal half precision value
+		significand := mant | 0x800000
+		shift := uint(-(exp + 1))
+		if significand&(1<<shift-1) != 0 {
+			return 0, false
+		}
+		return sign | uint16(significand>>shift), true
+	}
+
+	return 0, false
+}
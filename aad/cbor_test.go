@@ -0,0 +1,105 @@
+package aad
+
+import (
+	"encoding/hex"
+	"math"
+	"testing"
+)
+
+/*
+Examples are taken from https://tools.ietf.org/html/rfc8949#appendix-A
+*/
+func TestEncodeCBOR(t *testing.T) {
+	testCases := []struct {
+		in  interface{}
+		out string
+	}{
+		{0, "00"},
+		{23, "17"},
+		{24, "1818"},
+		{100, "1864"},
+		{1000, "1903e8"},
+		{1000000, "1a000f4240"},
+		{uint64(1000000000000), "1b000000e8d4a51000"},
+		{-1, "20"},
+		{-100, "3863"},
+		{-1000, "3903e7"},
+		{0.0, "f90000"},
+		{math.Copysign(0, -1), "f98000"},
+		{1.0, "f93c00"},
+		{1.1, "fb3ff199999999999a"},
+		{1.5, "f93e00"},
+		{65504.0, "f97bff"},
+		{100000.0, "fa47c35000"},
+		{3.4028234663852886e+38, "fa7f7fffff"},
+		{1.0e+300, "fb7e37e43c8800759c"},
+		{5.960464477539063e-8, "f90001"},
+		{0.00006103515625, "f90400"},
+		{-4.0, "f9c400"},
+		{-4.1, "fbc010666666666666"},
+		{math.Inf(1), "f97c00"},
+		{math.NaN(), "f97e00"},
+		{math.Inf(-1), "f9fc00"},
+		{false, "f4"},
+		{true, "f5"},
+		{nil, "f6"},
+		{"", "60"},
+		{"a", "6161"},
+		{"IETF", "6449455446"},
+		{[]byte{}, "40"},
+		{[]byte{1, 2, 3, 4}, "4401020304"},
+		{[]interface{}{}, "80"},
+		{[]int{1, 2, 3}, "83010203"},
+		{map[string]interface{}{}, "a0"},
+		{map[int]int{1: 2, 3: 4}, "a201020304"},
+		{map[string]interface{}{"a": 1, "b": []int{2, 3}}, "a26161016162820203"},
+		{
+			map[interface{}]interface{}{
+				10: 1, 100: 2, -1: 3, "z": 4, "aa": 5, false: 6,
+			},
+			"a60a011864022003617a0462616105f406",
+		},
+	}
+
+	for i := range testCases {
+		result, err := EncodeCBOR(testCases[i].in)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if hex.EncodeToString(result) != testCases[i].out {
+			t.Errorf("test case %d (%v): got %x", i, testCases[i].in, result)
+		}
+	}
+}
+
+func TestEncodeCBORErrors(t *testing.T) {
+	invalid := []interface{}{
+		struct{}{},
+		map[interface{}]int{1: 1, uint(1): 2},
+		[]interface{}{func() {}},
+	}
+
+	for i := range invalid {
+		if _, err := EncodeCBOR(invalid[i]); err == nil {
+			t.Errorf("value %d was accepted", i)
+		}
+	}
+}
+
+func TestBuilderCBOR(t *testing.T) {
+	a := NewBuilder()
+	if err := a.CBOR(map[interface{}]interface{}{1: "kid", 3: -7}); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBuilder()
+	if err := b.CBOR(map[int64]interface{}{3: int8(-7), 1: "kid"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !equalVectors(a.Build(), b.Build()) {
+		t.Fail()
+	}
+}
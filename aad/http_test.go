@@ -0,0 +1,70 @@
+package aad
+
+import (
+	"net/http"
+	"testing"
+)
+
+func newRequest(t *testing.T, method, url string, headers map[string]string) *http.Request {
+	r, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	return r
+}
+
+func TestCanonicalHTTPRequest(t *testing.T) {
+	r := newRequest(t, "post", "https://example.com/a b/c?z=1&a=2&a=1", map[string]string{
+		"Content-Type": "  application/json;   charset=utf-8 ",
+		"X-Ignored":    "value",
+	})
+
+	expected := "POST\n" +
+		"/a%20b/c\n" +
+		"a=1&a=2&z=1\n" +
+		"content-type:application/json; charset=utf-8\n" +
+		"host:example.com\n" +
+		"x-tenant:\n" +
+		"\n" +
+		"content-type;host;x-tenant\n" +
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	result := CanonicalHTTPRequest(r, nil, "X-Tenant", "Content-Type", "host", "content-type")
+	if string(result) != expected {
+		t.Errorf("unexpected canonical request:\n%s", result)
+	}
+}
+
+func TestBuilderHTTPRequest(t *testing.T) {
+	body := []byte(`{"amount": 100}`)
+	headers := map[string]string{"X-Tenant": "acme"}
+
+	base := NewBuilder().HTTPRequest(newRequest(t, "PUT", "https://example.com/v1/pay", headers), body, "x-tenant").Build()
+
+	same := NewBuilder().HTTPRequest(newRequest(t, "PUT", "https://example.com/v1/pay", headers), body, "X-Tenant").Build()
+	if !equalVectors(base, same) {
+		t.Fail()
+	}
+
+	different := []*http.Request{
+		newRequest(t, "POST", "https://example.com/v1/pay", headers),
+		newRequest(t, "PUT", "https://example.com/v1/refund", headers),
+		newRequest(t, "PUT", "https://example.com/v1/pay?dry=1", headers),
+		newRequest(t, "PUT", "https://example.com/v1/pay", map[string]string{"X-Tenant": "other"}),
+	}
+
+	for i := range different {
+		v := NewBuilder().HTTPRequest(different[i], body, "x-tenant").Build()
+		if equalVectors(base, v) {
+			t.Errorf("request %d has the same canonical form", i)
+		}
+	}
+
+	v := NewBuilder().HTTPRequest(newRequest(t, "PUT", "https://example.com/v1/pay", headers), []byte("{}"), "x-tenant").Build()
+	if equalVectors(base, v) {
+		t.Error("body isn't bound")
+	}
+}
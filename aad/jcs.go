@@ -0,0 +1,301 @@
+package aad
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+/*
+JSON canonicalization scheme defined in https://tools.ietf.org/html/rfc8785
+Object members are sorted by the UTF-16 code units of their names, numbers are serialized
+the way ECMAScript does it and strings are escaped minimally, so two serializers that differ
+in key order, whitespace or number formatting produce the same associated data.
+*/
+
+const (
+	hexDigits = "0123456789abcdef"
+)
+
+var (
+	errInvalidUTF8     = errors.New("json document is not valid UTF-8")
+	errDuplicateMember = errors.New("json object has duplicate member names")
+	errTrailingData    = errors.New("json document has trailing data")
+	errInvalidNumber   = errors.New("json number can't be represented as IEEE 754 double")
+)
+
+type member struct {
+	name  string
+	value interface{}
+}
+
+func CanonicalizeJSON(data []byte) ([]byte, error) {
+	if !utf8.Valid(data) {
+		return nil, errInvalidUTF8
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	value, err := parseJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errTrailingData
+	}
+
+	var buf bytes.Buffer
+	if err := writeJSONValue(&buf, value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+/*
+JSON canonicalizes the document and adds it as a single component.
+*/
+func (b *Builder) JSON(doc []byte) error {
+	canonical, err := CanonicalizeJSON(doc)
+	if err != nil {
+		return err
+	}
+
+	b.add(TagJSON, canonical)
+	return nil
+}
+
+func parseJSONValue(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	switch v := token.(type) {
+	case json.Delim:
+		switch v {
+		case '{':
+			return parseJSONObject(dec)
+		case '[':
+			return parseJSONArray(dec)
+		}
+	case json.Number:
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return nil, errInvalidNumber
+		}
+		return f, nil
+	}
+
+	// string, bool or nil
+	return token, nil
+}
+
+func parseJSONObject(dec *json.Decoder) (interface{}, error) {
+	var members []member
+	names := make(map[string]bool)
+
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		name := token.(string)
+		if names[name] {
+			return nil, errDuplicateMember
+		}
+		names[name] = true
+
+		value, err := parseJSONValue(dec)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member{name: name, value: value})
+	}
+
+	// closing brace
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func parseJSONArray(dec *json.Decoder) (interface{}, error) {
+	values := []interface{}{}
+	for dec.More() {
+		value, err := parseJSONValue(dec)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	// closing bracket
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func writeJSONValue(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case float64:
+		s, err := formatJSONNumber(v)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(s)
+	case string:
+		writeJSONString(buf, v)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSONValue(buf, v[i]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case []member:
+		sort.Slice(v, func(i, j int) bool {
+			return lessUTF16(v[i].name, v[j].name)
+		})
+
+		buf.WriteByte('{')
+		for i := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, v[i].name)
+			buf.WriteByte(':')
+			if err := writeJSONValue(buf, v[i].value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	}
+
+	return nil
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hexDigits[r>>4])
+				buf.WriteByte(hexDigits[r&0x0f])
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+/*
+Number serialization follows Number.prototype.toString of ECMAScript,
+see https://tools.ietf.org/html/rfc8785#section-3.2.2.3
+*/
+func formatJSONNumber(v float64) (string, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "", errInvalidNumber
+	}
+
+	if v == 0 {
+		return "0", nil
+	}
+
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+
+	// shortest representation d.ddde±xx gives the digits and the exponent
+	e := strconv.FormatFloat(v, 'e', -1, 64)
+	mantissa, exponent := e[:strings.IndexByte(e, 'e')], e[strings.IndexByte(e, 'e')+1:]
+	digits := strings.Replace(mantissa, ".", "", 1)
+	exp, err := strconv.Atoi(exponent)
+	if err != nil {
+		return "", err
+	}
+
+	k := len(digits)
+	n := exp + 1
+
+	var result string
+	switch {
+	case k <= n && n <= 21:
+		result = digits + strings.Repeat("0", n-k)
+	case 0 < n && n <= 21:
+		result = digits[:n] + "." + digits[n:]
+	case -6 < n && n <= 0:
+		result = "0." + strings.Repeat("0", -n) + digits
+	default:
+		expSign := "+"
+		if n-1 < 0 {
+			expSign = "-"
+		}
+		result = digits[:1]
+		if k > 1 {
+			result += "." + digits[1:]
+		}
+		result += "e" + expSign + strconv.Itoa(abs(n-1))
+	}
+
+	return sign + result, nil
+}
+
+func lessUTF16(a, b string) bool {
+	ua := utf16.Encode([]rune(a))
+	ub := utf16.Encode([]rune(b))
+
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
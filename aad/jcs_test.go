@@ -0,0 +1,81 @@
+package aad
+
+import (
+	"testing"
+)
+
+/*
+Examples are taken from https://tools.ietf.org/html/rfc8785#section-3.2
+*/
+func TestCanonicalizeJSON(t *testing.T) {
+	testCases := []struct {
+		in  string
+		out string
+	}{
+		{
+			in: `{
+				"numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+				"string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+				"literals": [null, true, false]
+			}`,
+			out: `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],` +
+				`"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+		},
+		{
+			in: `{"\u20ac": "Euro Sign", "\r": "Carriage Return", "\ufb33": "Hebrew Letter Dalet With Dagesh",
+				"1": "One", "\ud83d\ude00": "Emoji: Grinning Face", "\u0080": "Control",
+				"\u00f6": "Latin Small Letter O With Diaeresis"}`,
+			out: "{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\"," +
+				"\"ö\":\"Latin Small Letter O With Diaeresis\",\"€\":\"Euro Sign\"," +
+				"\"😀\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}",
+		},
+		{
+			in:  `[-0, 1e21, 1e20, 1e-7, 1e-6, 123.456, -1.5e-10, 9007199254740993, {}, []]`,
+			out: `[0,1e+21,100000000000000000000,1e-7,0.000001,123.456,-1.5e-10,9007199254740992,{},[]]`,
+		},
+	}
+
+	for i := range testCases {
+		result, err := CanonicalizeJSON([]byte(testCases[i].in))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if string(result) != testCases[i].out {
+			t.Errorf("test case %d: got %s", i, result)
+		}
+	}
+}
+
+func TestCanonicalizeJSONErrors(t *testing.T) {
+	invalid := []string{
+		`{"a": 1, "a": 2}`,
+		`{"a": 1} {}`,
+		`[1e400]`,
+		`{"a": `,
+		"\"\xff\"",
+	}
+
+	for i := range invalid {
+		if _, err := CanonicalizeJSON([]byte(invalid[i])); err == nil {
+			t.Errorf("document %q was accepted", invalid[i])
+		}
+	}
+}
+
+func TestBuilderJSON(t *testing.T) {
+	a := NewBuilder()
+	if err := a.JSON([]byte(`{"b": 2, "a": 1.0}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBuilder()
+	if err := b.JSON([]byte(`{ "a":1, "b":2 }`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !equalVectors(a.Build(), b.Build()) {
+		t.Fail()
+	}
+}
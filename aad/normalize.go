@@ -0,0 +1,56 @@
+package aad
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+Normalizer canonicalizes string components, so producers and consumers that
+got the same text in different Unicode forms or cases build the same vector.
+
+aad itself doesn't depend on golang.org/x/text, the Unicode normalization forms are
+in aad/unicodenorm, e.g. Normalize(unicodenorm.NFC, CaseFold). Any other
+func(string) string works too.
+*/
+type Normalizer func(string) string
+
+/*
+Normalize makes String apply the normalizers, in order, to every following string
+component. Both sides must use the same normalizers. Calling it again replaces them,
+without arguments it turns normalization off.
+*/
+func (b *Builder) Normalize(normalizers ...Normalizer) *Builder {
+	b.normalizers = normalizers
+	return b
+}
+
+func (b *Builder) normalize(s string) string {
+	for _, n := range b.normalizers {
+		s = n(s)
+	}
+	return s
+}
+
+/*
+CaseFold maps every rune to the lower case of its upper case, a rune by rune
+approximation of Unicode simple case folding: "Σ", "σ" and "ς" fold the same way
+while "Straße" and "STRASSE" still differ. Invalid UTF-8 is kept as it is rather
+than replaced, so distinct inputs don't collapse.
+*/
+func CaseFold(s string) string {
+	var sb strings.Builder
+	sb.Grow(len(s))
+
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		if r == utf8.RuneError && size <= 1 {
+			sb.WriteString(s[:size])
+		} else {
+			sb.WriteRune(unicode.ToLower(unicode.ToUpper(r)))
+		}
+		s = s[size:]
+	}
+	return sb.String()
+}
@@ -0,0 +1,83 @@
+package aad
+
+import "reflect"
+
+/*
+Typed tuples of associated data with the arity checked at compile time:
+
+	ct := aad.Seal2(k, nil, plaintext, tenantID, recordVersion)
+	pt, err := aad.Open2(k, nil, ct, tenantID, recordVersion)
+
+Every value is encoded like the Builder method of its kind, so Seal2(k, nil, p, "a", int64(1))
+and a Builder with String("a").Int(1) produce the same vector. Types with a string,
+byte slice, integer or bool underlying type are accepted, so named types work too.
+*/
+
+type Component interface {
+	~string | ~[]byte | ~bool |
+		~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+/*
+AEAD is implemented by the siv AEADs
+*/
+type AEAD interface {
+	SealWithMultipleAAD(dst, plaintext []byte, additionalData [][]byte) []byte
+	OpenWithMultipleAAD(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error)
+}
+
+func Tuple1[A Component](a A) [][]byte {
+	return add(NewBuilder(), a).Build()
+}
+
+func Tuple2[A, B Component](a A, b B) [][]byte {
+	return add(add(NewBuilder(), a), b).Build()
+}
+
+func Tuple3[A, B, C Component](a A, b B, c C) [][]byte {
+	return add(add(add(NewBuilder(), a), b), c).Build()
+}
+
+func Seal1[A Component](k AEAD, dst, plaintext []byte, a A) []byte {
+	return k.SealWithMultipleAAD(dst, plaintext, Tuple1(a))
+}
+
+func Open1[A Component](k AEAD, dst, ciphertext []byte, a A) ([]byte, error) {
+	return k.OpenWithMultipleAAD(dst, ciphertext, Tuple1(a))
+}
+
+func Seal2[A, B Component](k AEAD, dst, plaintext []byte, a A, b B) []byte {
+	return k.SealWithMultipleAAD(dst, plaintext, Tuple2(a, b))
+}
+
+func Open2[A, B Component](k AEAD, dst, ciphertext []byte, a A, b B) ([]byte, error) {
+	return k.OpenWithMultipleAAD(dst, ciphertext, Tuple2(a, b))
+}
+
+func Seal3[A, B, C Component](k AEAD, dst, plaintext []byte, a A, b B, c C) []byte {
+	return k.SealWithMultipleAAD(dst, plaintext, Tuple3(a, b, c))
+}
+
+func Open3[A, B, C Component](k AEAD, dst, ciphertext []byte, a A, b B, c C) ([]byte, error) {
+	return k.OpenWithMultipleAAD(dst, ciphertext, Tuple3(a, b, c))
+}
+
+/*
+add encodes v by its underlying kind, the constraint rules out everything else
+*/
+func add[T Component](b *Builder, v T) *Builder {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return b.String(rv.String())
+	case reflect.Slice:
+		return b.Bytes(rv.Bytes())
+	case reflect.Bool:
+		return b.Bool(rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return b.Int(rv.Int())
+	default:
+		return b.Uint(rv.Uint())
+	}
+}
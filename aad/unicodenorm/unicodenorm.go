@@ -0,0 +1,22 @@
+/*
+Package unicodenorm provides the Unicode normalization forms as aad.Normalizer
+functions. It is separate from aad so only code that normalizes pulls in
+golang.org/x/text:
+
+	b := aad.NewBuilder().Normalize(unicodenorm.NFC, aad.CaseFold)
+
+NFC is the form to agree on for text typed or stored by different systems, NFKC
+also folds compatibility characters such as ligatures and full-width forms, which
+suits identifiers but changes what is displayed.
+*/
+package unicodenorm
+
+import "golang.org/x/text/unicode/norm"
+
+func NFC(s string) string {
+	return norm.NFC.String(s)
+}
+
+func NFKC(s string) string {
+	return norm.NFKC.String(s)
+}
@@ -0,0 +1,32 @@
+package unicodenorm
+
+import (
+	"bytes"
+	"github.com/luc-lynx/siv/aad"
+	"testing"
+)
+
+func TestNormalizers(t *testing.T) {
+	for _, c := range []struct {
+		f            aad.Normalizer
+		in, expected string
+	}{
+		{NFC, "Jose\u0301", "Jos\u00e9"},
+		{NFC, "Jos\u00e9", "Jos\u00e9"},
+		{NFC, "\ufb01le", "\ufb01le"},
+		{NFKC, "\ufb01le", "file"},
+		{NFKC, "e\u0301", "\u00e9"},
+	} {
+		if got := c.f(c.in); got != c.expected {
+			t.Errorf("%q: got %q, expected %q", c.in, got, c.expected)
+		}
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	a := aad.NewBuilder().Normalize(NFC, aad.CaseFold).String("Jose\u0301").Build()
+	b := aad.NewBuilder().Normalize(NFC, aad.CaseFold).String("JOS\u00c9").Build()
+	if len(a) != 1 || !bytes.Equal(a[0], b[0]) {
+		t.Errorf("normalized components differ: %q, %q", a, b)
+	}
+}
@@ -0,0 +1,253 @@
+package acvp
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/luc-lynx/siv/cmac"
+	"strings"
+)
+
+/*
+Minimal harness for NIST ACVP (https://pages.nist.gov/ACVP/) request files.
+Supported algorithms are CMAC-AES (generation and verification) and the AFT tests of ACVP-AES-CTR,
+which is the keystream construction used by SIV. A request is either a single vector set object
+or an array with a version object followed by vector sets, the response has the same shape.
+*/
+
+const (
+	algorithmCmacAes = "CMAC-AES"
+	algorithmAesCtr  = "ACVP-AES-CTR"
+
+	testTypeAFT = "AFT"
+)
+
+var (
+	errNoVectorSets = errors.New("request doesn't contain vector sets")
+)
+
+type testCase struct {
+	TcID    int    `json:"tcId"`
+	Key     string `json:"key"`
+	Message string `json:"message"`
+	Mac     string `json:"mac"`
+	IV      string `json:"iv"`
+	PT      string `json:"pt"`
+	CT      string `json:"ct"`
+}
+
+type testGroup struct {
+	TgID      int        `json:"tgId"`
+	TestType  string     `json:"testType"`
+	Direction string     `json:"direction"`
+	MacLen    int        `json:"macLen"`
+	Tests     []testCase `json:"tests"`
+}
+
+type vectorSet struct {
+	VsID       int         `json:"vsId"`
+	Algorithm  string      `json:"algorithm"`
+	Revision   string      `json:"revision"`
+	TestGroups []testGroup `json:"testGroups"`
+}
+
+type testResult struct {
+	TcID       int    `json:"tcId"`
+	Mac        string `json:"mac,omitempty"`
+	CT         string `json:"ct,omitempty"`
+	PT         string `json:"pt,omitempty"`
+	TestPassed *bool  `json:"testPassed,omitempty"`
+}
+
+type groupResult struct {
+	TgID  int          `json:"tgId"`
+	Tests []testResult `json:"tests"`
+}
+
+type vectorSetResult struct {
+	VsID       int           `json:"vsId"`
+	Algorithm  string        `json:"algorithm,omitempty"`
+	Revision   string        `json:"revision,omitempty"`
+	TestGroups []groupResult `json:"testGroups"`
+}
+
+/*
+Process computes the response for an ACVP request file.
+*/
+func Process(request []byte) ([]byte, error) {
+	request = bytes.TrimSpace(request)
+	if len(request) > 0 && request[0] == '{' {
+		var vs vectorSet
+		if err := json.Unmarshal(request, &vs); err != nil {
+			return nil, err
+		}
+
+		result, err := processVectorSet(&vs)
+		if err != nil {
+			return nil, err
+		}
+		return json.MarshalIndent(result, "", "  ")
+	}
+
+	var elements []json.RawMessage
+	if err := json.Unmarshal(request, &elements); err != nil {
+		return nil, err
+	}
+
+	var response []interface{}
+	found := false
+	for _, element := range elements {
+		var vs vectorSet
+		if err := json.Unmarshal(element, &vs); err != nil {
+			return nil, err
+		}
+
+		if vs.Algorithm == "" {
+			// version header is copied as is
+			response = append(response, element)
+			continue
+		}
+
+		result, err := processVectorSet(&vs)
+		if err != nil {
+			return nil, err
+		}
+		response = append(response, result)
+		found = true
+	}
+
+	if !found {
+		return nil, errNoVectorSets
+	}
+	return json.MarshalIndent(response, "", "  ")
+}
+
+func processVectorSet(vs *vectorSet) (*vectorSetResult, error) {
+	result := &vectorSetResult{
+		VsID:      vs.VsID,
+		Algorithm: vs.Algorithm,
+		Revision:  vs.Revision,
+	}
+
+	for i := range vs.TestGroups {
+		group := &vs.TestGroups[i]
+		if group.TestType != testTypeAFT {
+			return nil, fmt.Errorf("test group %d: unsupported test type %q", group.TgID, group.TestType)
+		}
+
+		var tests []testResult
+		var err error
+		switch vs.Algorithm {
+		case algorithmCmacAes:
+			tests, err = processCmac(group)
+		case algorithmAesCtr:
+			tests, err = processCtr(group)
+		default:
+			return nil, fmt.Errorf("unsupported algorithm %q", vs.Algorithm)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("test group %d: %w", group.TgID, err)
+		}
+		result.TestGroups = append(result.TestGroups, groupResult{TgID: group.TgID, Tests: tests})
+	}
+
+	return result, nil
+}
+
+func processCmac(group *testGroup) ([]testResult, error) {
+	if group.MacLen <= 0 || group.MacLen > 128 || group.MacLen%8 != 0 {
+		return nil, fmt.Errorf("unsupported mac length %d", group.MacLen)
+	}
+
+	var results []testResult
+	for _, tc := range group.Tests {
+		key, message, err := decodeHex(tc.Key, tc.Message)
+		if err != nil {
+			return nil, fmt.Errorf("test case %d: %w", tc.TcID, err)
+		}
+
+		c, err := cmac.NewCmac(key)
+		if err != nil {
+			return nil, fmt.Errorf("test case %d: %w", tc.TcID, err)
+		}
+		c.Write(message)
+		mac := c.Sum(nil)[:group.MacLen/8]
+
+		switch group.Direction {
+		case "gen":
+			results = append(results, testResult{TcID: tc.TcID, Mac: encodeHex(mac)})
+		case "ver":
+			expected, err := hex.DecodeString(tc.Mac)
+			if err != nil {
+				return nil, fmt.Errorf("test case %d: %w", tc.TcID, err)
+			}
+			passed := subtle.ConstantTimeCompare(mac, expected) == 1
+			results = append(results, testResult{TcID: tc.TcID, TestPassed: &passed})
+		default:
+			return nil, fmt.Errorf("unsupported direction %q", group.Direction)
+		}
+	}
+	return results, nil
+}
+
+func processCtr(group *testGroup) ([]testResult, error) {
+	var results []testResult
+	for _, tc := range group.Tests {
+		input := tc.PT
+		if group.Direction == "decrypt" {
+			input = tc.CT
+		}
+
+		key, iv, err := decodeHex(tc.Key, tc.IV)
+		if err != nil {
+			return nil, fmt.Errorf("test case %d: %w", tc.TcID, err)
+		}
+		data, err := hex.DecodeString(input)
+		if err != nil {
+			return nil, fmt.Errorf("test case %d: %w", tc.TcID, err)
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("test case %d: %w", tc.TcID, err)
+		}
+		if len(iv) != block.BlockSize() {
+			return nil, fmt.Errorf("test case %d: invalid iv length", tc.TcID)
+		}
+
+		output := make([]byte, len(data))
+		cipher.NewCTR(block, iv).XORKeyStream(output, data)
+
+		switch group.Direction {
+		case "encrypt":
+			results = append(results, testResult{TcID: tc.TcID, CT: encodeHex(output)})
+		case "decrypt":
+			results = append(results, testResult{TcID: tc.TcID, PT: encodeHex(output)})
+		default:
+			return nil, fmt.Errorf("unsupported direction %q", group.Direction)
+		}
+	}
+	return results, nil
+}
+
+func decodeHex(a, b string) ([]byte, []byte, error) {
+	x, err := hex.DecodeString(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	y, err := hex.DecodeString(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	return x, y, nil
+}
+
+func encodeHex(b []byte) string {
+	return strings.ToUpper(hex.EncodeToString(b))
+}
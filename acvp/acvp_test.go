@@ -0,0 +1,112 @@
+package acvp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+/*
+CMAC vectors are taken from https://tools.ietf.org/html/rfc4493#section-4,
+CTR vector is F.5.1 of NIST SP 800-38A
+*/
+const request = `[
+	{"acvVersion": "1.0"},
+	{
+		"vsId": 42,
+		"algorithm": "CMAC-AES",
+		"revision": "1.0",
+		"testGroups": [
+			{
+				"tgId": 1, "testType": "AFT", "direction": "gen", "keyLen": 128, "macLen": 128,
+				"tests": [
+					{"tcId": 1, "key": "2B7E151628AED2A6ABF7158809CF4F3C", "message": ""},
+					{"tcId": 2, "key": "2B7E151628AED2A6ABF7158809CF4F3C", "message": "6BC1BEE22E409F96E93D7E117393172A"}
+				]
+			},
+			{
+				"tgId": 2, "testType": "AFT", "direction": "ver", "keyLen": 128, "macLen": 64,
+				"tests": [
+					{"tcId": 3, "key": "2B7E151628AED2A6ABF7158809CF4F3C", "message": "", "mac": "BB1D6929E9593728"},
+					{"tcId": 4, "key": "2B7E151628AED2A6ABF7158809CF4F3C", "message": "", "mac": "BB1D6929E9593729"}
+				]
+			}
+		]
+	},
+	{
+		"vsId": 43,
+		"algorithm": "ACVP-AES-CTR",
+		"revision": "1.0",
+		"testGroups": [
+			{
+				"tgId": 1, "testType": "AFT", "direction": "encrypt",
+				"tests": [
+					{"tcId": 1, "key": "2B7E151628AED2A6ABF7158809CF4F3C", "iv": "F0F1F2F3F4F5F6F7F8F9FAFBFCFDFEFF",
+					 "pt": "6BC1BEE22E409F96E93D7E117393172A"}
+				]
+			},
+			{
+				"tgId": 2, "testType": "AFT", "direction": "decrypt",
+				"tests": [
+					{"tcId": 2, "key": "2B7E151628AED2A6ABF7158809CF4F3C", "iv": "F0F1F2F3F4F5F6F7F8F9FAFBFCFDFEFF",
+					 "ct": "874D6191B620E3261BEF6864990DB6CE"}
+				]
+			}
+		]
+	}
+]`
+
+func TestProcess(t *testing.T) {
+	response, err := Process([]byte(request))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var elements []json.RawMessage
+	if err := json.Unmarshal(response, &elements); err != nil {
+		t.Fatal(err)
+	}
+	if len(elements) != 3 {
+		t.Fatalf("unexpected number of elements %d", len(elements))
+	}
+
+	var cmacResult, ctrResult vectorSetResult
+	if err := json.Unmarshal(elements[1], &cmacResult); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(elements[2], &ctrResult); err != nil {
+		t.Fatal(err)
+	}
+
+	gen := cmacResult.TestGroups[0].Tests
+	if gen[0].Mac != "BB1D6929E95937287FA37D129B756746" || gen[1].Mac != "070A16B46B4D4144F79BDD9DD04A287C" {
+		t.Errorf("unexpected generated macs %+v", gen)
+	}
+
+	ver := cmacResult.TestGroups[1].Tests
+	if ver[0].TestPassed == nil || !*ver[0].TestPassed || ver[1].TestPassed == nil || *ver[1].TestPassed {
+		t.Errorf("unexpected verification results %+v", ver)
+	}
+
+	if ctrResult.TestGroups[0].Tests[0].CT != "874D6191B620E3261BEF6864990DB6CE" {
+		t.Errorf("unexpected ciphertext %+v", ctrResult.TestGroups[0].Tests[0])
+	}
+	if ctrResult.TestGroups[1].Tests[0].PT != "6BC1BEE22E409F96E93D7E117393172A" {
+		t.Errorf("unexpected plaintext %+v", ctrResult.TestGroups[1].Tests[0])
+	}
+}
+
+func TestProcessErrors(t *testing.T) {
+	invalid := []string{
+		`[{"acvVersion": "1.0"}]`,
+		`{"vsId": 1, "algorithm": "ACVP-AES-GCM", "testGroups": [{"tgId": 1, "testType": "AFT"}]}`,
+		`{"vsId": 1, "algorithm": "CMAC-AES", "testGroups": [{"tgId": 1, "testType": "MCT", "macLen": 128}]}`,
+		`{"vsId": 1, "algorithm": "CMAC-AES", "testGroups": [{"tgId": 1, "testType": "AFT", "direction": "gen",
+			"macLen": 128, "tests": [{"tcId": 1, "key": "00", "message": ""}]}]}`,
+	}
+
+	for i := range invalid {
+		if _, err := Process([]byte(invalid[i])); err == nil {
+			t.Errorf("request %d was processed", i)
+		}
+	}
+}
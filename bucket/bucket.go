@@ -0,0 +1,151 @@
+/*
+Package bucket maps ordered values of an encrypted column to coarse keyed tokens,
+so bounded range filters can run on the database without the plaintext.
+
+The value is stored sealed with AES-SIV next to its token
+
+	token = AES-CMAC(K, len(column) || column || floor(value / width))
+
+and a range query becomes a lookup of the tokens of all buckets the range touches,
+with the exact filter applied after decryption.
+
+Leakage, in addition to that of the deterministic column itself:
+  - rows in the same bucket have equal tokens, so the stored tokens show the
+    histogram of the column at the resolution of width
+  - a query shows how many buckets it spans and, over many queries, the overlap
+    of ranges lets an observer put buckets in order and learn their neighbours
+  - the width is a tradeoff: wide buckets hide more and return more false
+    positives, narrow ones approach order-revealing encryption
+
+Use it only where the distribution of the column at bucket resolution isn't
+sensitive, and a separate key per column.
+*/
+package bucket
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/luc-lynx/siv/cmac"
+	"math"
+)
+
+const DefaultMaxTokens = 256
+
+var (
+	errZeroWidth     = errors.New("bucket: width must be positive")
+	errEmptyRange    = errors.New("bucket: range is empty")
+	errTooManyTokens = errors.New("bucket: range spans too many buckets")
+)
+
+type Index struct {
+	key    []byte
+	column []byte
+	width  uint64
+
+	// MaxTokens limits the buckets of a range, so a wide query fails instead
+	// of producing a huge token list and revealing its width, 0 means no limit
+	MaxTokens int
+}
+
+/*
+New returns the index of a column, key is an AES-CMAC key (16, 24 or 32 bytes)
+and width the number of consecutive values sharing a bucket
+*/
+func New(key []byte, column string, width uint64) (*Index, error) {
+	if _, err := cmac.NewCmac(key); err != nil {
+		return nil, err
+	}
+	if width == 0 {
+		return nil, errZeroWidth
+	}
+
+	prefix := make([]byte, 8, 8+len(column))
+	binary.BigEndian.PutUint64(prefix, uint64(len(column)))
+	return &Index{
+		key:       append([]byte{}, key...),
+		column:    append(prefix, column...),
+		width:     width,
+		MaxTokens: DefaultMaxTokens,
+	}, nil
+}
+
+/*
+Token returns the token of the bucket holding v
+*/
+func (x *Index) Token(v uint64) []byte {
+	return x.token(v / x.width)
+}
+
+/*
+TokenInt is Token for signed values, buckets are aligned to zero
+*/
+func (x *Index) TokenInt(v int64) []byte {
+	return x.token(flipSign(x.bucketInt(v)))
+}
+
+/*
+Range returns the tokens of all buckets intersecting [lo, hi], both ends included
+*/
+func (x *Index) Range(lo, hi uint64) ([][]byte, error) {
+	if lo > hi {
+		return nil, errEmptyRange
+	}
+	return x.tokens(lo/x.width, hi/x.width)
+}
+
+/*
+RangeInt is Range for signed values
+*/
+func (x *Index) RangeInt(lo, hi int64) ([][]byte, error) {
+	if lo > hi {
+		return nil, errEmptyRange
+	}
+	return x.tokens(flipSign(x.bucketInt(lo)), flipSign(x.bucketInt(hi)))
+}
+
+func (x *Index) tokens(first, last uint64) ([][]byte, error) {
+	if x.MaxTokens > 0 && last-first >= uint64(x.MaxTokens) {
+		return nil, errTooManyTokens
+	}
+
+	tokens := make([][]byte, 0, last-first+1)
+	for b := first; ; b++ {
+		tokens = append(tokens, x.token(b))
+		if b == last {
+			return tokens, nil
+		}
+	}
+}
+
+func (x *Index) token(bucket uint64) []byte {
+	msg := make([]byte, len(x.column)+8)
+	copy(msg, x.column)
+	binary.BigEndian.PutUint64(msg[len(x.column):], bucket)
+	return cmac.Sum(x.key, msg)
+}
+
+/*
+bucketInt divides rounding towards minus infinity, so -1 and 0 are in different buckets
+*/
+func (x *Index) bucketInt(v int64) int64 {
+	if x.width > math.MaxInt64 {
+		if v < 0 {
+			return -1
+		}
+		return 0
+	}
+
+	w := int64(x.width)
+	b := v / w
+	if v%w < 0 {
+		b--
+	}
+	return b
+}
+
+/*
+flipSign maps int64 to uint64 keeping the order, math.MinInt64 becomes 0
+*/
+func flipSign(v int64) uint64 {
+	return uint64(v) ^ 1<<63
+}
@@ -0,0 +1,73 @@
+package bucket
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+var key = bytes.Repeat([]byte{0x2b}, 16)
+
+func TestBuckets(t *testing.T) {
+	x, err := New(key, "salary", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(x.Token(1000), x.Token(1999)) {
+		t.Error("values of one bucket have different tokens")
+	}
+	if bytes.Equal(x.Token(999), x.Token(1000)) {
+		t.Error("values of neighbouring buckets have equal tokens")
+	}
+
+	other, _ := New(key, "age", 1000)
+	if bytes.Equal(x.Token(5), other.Token(5)) {
+		t.Error("columns share tokens")
+	}
+
+	tokens, err := x.Range(1500, 3200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 3 || !bytes.Equal(tokens[0], x.Token(1500)) || !bytes.Equal(tokens[2], x.Token(3999)) {
+		t.Errorf("unexpected tokens for 1500..3200: %d", len(tokens))
+	}
+
+	if tokens, err := x.Range(math.MaxUint64-1, math.MaxUint64); err != nil || len(tokens) != 1 {
+		t.Error("range at the top of the domain", err)
+	}
+	if _, err := x.Range(2, 1); err != errEmptyRange {
+		t.Errorf("expected %v, got %v", errEmptyRange, err)
+	}
+	if _, err := x.Range(0, 1000*DefaultMaxTokens); err != errTooManyTokens {
+		t.Errorf("expected %v, got %v", errTooManyTokens, err)
+	}
+}
+
+func TestSigned(t *testing.T) {
+	x, err := New(key, "temperature", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := x.RangeInt(-15, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 3 || !bytes.Equal(tokens[0], x.TokenInt(-20)) || !bytes.Equal(tokens[2], x.TokenInt(9)) {
+		t.Errorf("unexpected tokens for -15..5: %d", len(tokens))
+	}
+	if _, err := x.RangeInt(math.MinInt64, math.MinInt64+5); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	if _, err := New(key[:5], "c", 1); err == nil {
+		t.Error("invalid key accepted")
+	}
+	if _, err := New(key, "c", 0); err != errZeroWidth {
+		t.Errorf("expected %v, got %v", errZeroWidth, err)
+	}
+}
@@ -3,13 +3,18 @@ package cmac
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/subtle"
 	"errors"
-	"github.com/luc-lynx/siv/common"
+	"fmt"
+	"github.com/luc-lynx/siv/internal/common"
 	"hash"
+	"io"
+	"sync"
 )
 
 const (
-	blockSize = 16
+	blockSize          = 16
+	sumIntoShortBuffer = "cmac: SumInto destination is shorter than a block"
 )
 
 var (
@@ -18,86 +23,106 @@ var (
 		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
 	}
 
-	rb = []byte{
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x87,
-	}
-
-	errUnsupportedKeySize = errors.New("key size is not supported")
-	errAlreadyFinished    = errors.New("the processing has been finalized, reset call is needed")
+	errUnsupportedKeySize   = common.KeySizeError("key size is not supported")
+	errUnsupportedBlockSize = errors.New("cmac: block size must be 128 bits")
 )
 
 type cmac struct {
 	aesEncryptor cipher.Block
 	state        []byte
 	key          []byte
-	accumulator  []byte
-	finished     bool
 	hadData      bool
 
+	// last is the final block candidate, it's processed only when more data comes
+	last    [blockSize]byte
+	nLast   int
+	scratch [blockSize]byte
+
 	k1 []byte
 	k2 []byte
 }
 
 func (c *cmac) Write(p []byte) (n int, err error) {
-	if c.finished {
-		return 0, errAlreadyFinished
-	}
-
 	if len(p) == 0 {
 		return 0, nil
 	}
 
 	c.hadData = true
-	c.accumulator = append(c.accumulator, p...)
-	numFullBlocks := len(c.accumulator) / blockSize
+	n = len(p)
+
+	if c.nLast > 0 {
+		copied := copy(c.last[c.nLast:], p)
+		c.nLast += copied
+		p = p[copied:]
+		if len(p) == 0 {
+			return n, nil
+		}
 
-	// For the final stage we need some more data than one block
-	if numFullBlocks <= 1 {
-		return len(p), nil
+		// more data follows, so the buffered block isn't the last one
+		c.writeFullBlock(c.last[:])
+		c.nLast = 0
 	}
 
-	// Leaving last block for final stage
-	for i := 0; i < numFullBlocks-1; i++ {
-		c.writeFullBlock(c.accumulator[0:blockSize])
-		c.accumulator = c.accumulator[blockSize:]
+	// full blocks are processed straight from the caller's slice,
+	// the last one is kept for the final stage
+	for len(p) > blockSize {
+		c.writeFullBlock(p[:blockSize])
+		p = p[blockSize:]
 	}
 
-	return len(p), nil
+	c.nLast = copy(c.last[:], p)
+	return n, nil
 }
 
 func (c *cmac) writeFullBlock(block []byte) {
-	c.state = common.Xor(c.state, block)
+	subtle.XORBytes(c.state, c.state, block)
 	c.aesEncryptor.Encrypt(c.state, c.state)
 }
 
-func (c cmac) Sum(b []byte) []byte {
-	if c.hadData {
-		if len(c.accumulator) == blockSize {
-			c.accumulator = common.Xor(c.accumulator, c.k1)
-		} else {
-			// we've got a bit more than one block
-			if len(c.accumulator) > blockSize {
-				c.writeFullBlock(c.accumulator[0:blockSize])
-				c.accumulator = c.accumulator[blockSize:]
-			}
-			c.accumulator = common.Xor(common.Padding(c.accumulator), c.k2)
-		}
+func (c *cmac) Sum(b []byte) []byte {
+	n := len(b)
+	if cap(b)-n < blockSize {
+		b = append(b, make([]byte, blockSize)...)
 	} else {
-		// nil array corner case
-		c.accumulator = common.Xor(common.Padding([]byte{}), c.k2)
+		b = b[:n+blockSize]
 	}
 
-	// Y = M_last XOR X
-	y := common.Xor(c.accumulator, c.state)
-	c.aesEncryptor.Encrypt(y, y)
+	c.SumInto(b[n:])
+	return b
+}
 
-	c.finished = true
-	return append(b, y...)
+/*
+SumInto writes the tag into the first 16 bytes of dst without allocating.
+Like Sum it doesn't change the state, so more data can be written afterwards.
+The value returned by NewCmac can be asserted to interface{ SumInto([]byte) }.
+*/
+func (c *cmac) SumInto(dst []byte) {
+	if len(dst) < blockSize {
+		panic(sumIntoShortBuffer)
+	}
+
+	last := c.scratch[:]
+	if c.hadData && c.nLast == blockSize {
+		subtle.XORBytes(last, c.last[:], c.k1)
+	} else {
+		// incomplete last block or the nil array corner case
+		common.Padding(last, c.last[:c.nLast])
+		subtle.XORBytes(last, last, c.k2)
+	}
+
+	// Y = M_last XOR X
+	subtle.XORBytes(last, last, c.state)
+	c.aesEncryptor.Encrypt(dst[:blockSize], last)
 }
 
+/*
+Reset starts a new message, the subkeys are kept
+*/
 func (c *cmac) Reset() {
-	c.init()
+	clear(c.state)
+	clear(c.last[:])
+	c.nLast = 0
+	c.hadData = false
 }
 
 func (c cmac) Size() int {
@@ -108,32 +133,38 @@ func (c cmac) BlockSize() int {
 	return blockSize
 }
 
-func (c *cmac) generateSubKey() ([]byte, []byte) {
-	var k1 []byte
-	var k2 []byte
+/*
+Algorithm returns AES-CMAC-128, AES-CMAC-192 or AES-CMAC-256 depending on the key size.
+The value returned by NewCmac can be asserted to interface{ Algorithm() string }.
+*/
+func (c *cmac) Algorithm() string {
+	if c.key == nil {
+		// keyed by NewKeyedCipher, the cipher is unknown
+		return "CMAC"
+	}
+	return fmt.Sprintf("AES-CMAC-%d", len(c.key)*8)
+}
 
+/*
+String identifies the algorithm and never includes the key
+*/
+func (c *cmac) String() string {
+	return fmt.Sprintf("%s (tag %d bits)", c.Algorithm(), blockSize*8)
+}
+
+func (c *cmac) generateSubKey() ([]byte, []byte) {
 	l := make([]byte, blockSize)
 	c.aesEncryptor.Encrypt(l, zero)
 
-	k1 = common.ShiftLeft(l)
-	// MSB(l)
-	if l[0]&common.Msb == common.Msb {
-		k1 = common.Xor(k1, rb)
-	}
-
-	k2 = common.ShiftLeft(k1)
-	if k1[0]&common.Msb == common.Msb {
-		k2 = common.Xor(k2, rb)
-	}
+	k1 := common.Dbl(l)
+	k2 := common.Dbl(k1)
 	return k1, k2
 }
 
 func (c *cmac) init() {
 	c.k1, c.k2 = c.generateSubKey()
-	c.accumulator = []byte{}
-	c.state = make([]byte, 16)
-	c.finished = false
-	c.hadData = false
+	c.state = make([]byte, blockSize)
+	c.Reset()
 }
 
 func NewCmac(key []byte) (hash.Hash, error) {
@@ -158,16 +189,185 @@ func NewCmac(key []byte) (hash.Hash, error) {
 	return result, nil
 }
 
+type autoReset struct {
+	*cmac
+}
+
+/*
+NewAutoResetCmac returns a CMAC whose Sum also resets it, so one instance can
+MAC a sequence of messages in a loop. With NewCmac, as with any hash.Hash,
+writing after Sum continues the same message.
+*/
+func NewAutoResetCmac(key []byte) (hash.Hash, error) {
+	h, err := NewCmac(key)
+	if err != nil {
+		return nil, err
+	}
+	return autoReset{h.(*cmac)}, nil
+}
+
+func (a autoReset) Sum(b []byte) []byte {
+	b = a.cmac.Sum(b)
+	a.Reset()
+	return b
+}
+
+func (a autoReset) SumInto(dst []byte) {
+	a.cmac.SumInto(dst)
+	a.Reset()
+}
+
+/*
+SumBatch returns the tags of msgs computed with a single key schedule and
+subkey derivation. With workers > 1 the messages are split between that many
+goroutines, each with its own MAC state sharing the key schedule.
+*/
+func SumBatch(key []byte, msgs [][]byte, workers int) ([][]byte, error) {
+	h, err := NewCmac(key)
+	if err != nil {
+		return nil, err
+	}
+	base := h.(*cmac)
+
+	tags := make([][]byte, len(msgs))
+	backing := make([]byte, len(msgs)*blockSize)
+	for i := range tags {
+		tags[i] = backing[i*blockSize : (i+1)*blockSize : (i+1)*blockSize]
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+	workers = min(workers, len(msgs))
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		c := base
+		if w > 0 {
+			c = base.clone()
+		}
+
+		wg.Add(1)
+		go func(c *cmac, w int) {
+			defer wg.Done()
+			for i := w; i < len(msgs); i += workers {
+				c.Reset()
+				c.Write(msgs[i])
+				c.SumInto(tags[i])
+			}
+		}(c, w)
+	}
+	wg.Wait()
+
+	return tags, nil
+}
+
+/*
+clone returns a fresh MAC state sharing the key schedule and the subkeys, which are read only
+*/
+func (c *cmac) clone() *cmac {
+	return &cmac{
+		aesEncryptor: c.aesEncryptor,
+		key:          c.key,
+		state:        make([]byte, blockSize),
+		k1:           c.k1,
+		k2:           c.k2,
+	}
+}
+
+/*
+Keyed is a CMAC key with its key schedule and subkeys K1, K2 computed once. New
+returns MAC states sharing them, so code MACing many messages under one key pays
+for the subkey derivation only at construction. It's safe for concurrent use.
+*/
+type Keyed struct {
+	base *cmac
+}
+
+func NewKeyed(key []byte) (*Keyed, error) {
+	h, err := NewCmac(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Keyed{base: h.(*cmac)}, nil
+}
+
+/*
+NewKeyedCipher is NewKeyed for a block cipher keyed by the caller, CMAC is defined
+here for 128-bit blocks only. It's meant for SIV over other block ciphers; the
+result isn't AES-CMAC unless the cipher is AES.
+*/
+func NewKeyedCipher(b cipher.Block) (*Keyed, error) {
+	if b.BlockSize() != blockSize {
+		return nil, errUnsupportedBlockSize
+	}
+
+	c := &cmac{aesEncryptor: b}
+	c.init()
+	return &Keyed{base: c}, nil
+}
+
+/*
+New returns a fresh MAC state, it can be asserted to interface{ SumInto([]byte) }
+like the value returned by NewCmac
+*/
+func (k *Keyed) New() hash.Hash {
+	return k.base.clone()
+}
+
+/*
+Destroy wipes the subkeys, shared with the states returned by New, and drops the
+key schedule. Neither the Keyed nor its states can be used afterwards. The key
+passed to NewKeyed belongs to the caller and isn't touched.
+*/
+func (k *Keyed) Destroy() {
+	clear(k.base.k1)
+	clear(k.base.k2)
+	clear(k.base.state)
+	k.base.aesEncryptor = nil
+}
+
+/*
+Sum panics if the key isn't 16, 24 or 32 bytes long, which is a programming error
+for keys of a fixed size. Use Tag for keys that come from configuration or users.
+*/
 func Sum(key, data []byte) []byte {
-	c, err := NewCmac(key)
+	tag, err := Tag(key, data)
 	if err != nil {
 		panic(err.Error())
 	}
+	return tag
+}
 
-	_, err = c.Write(data)
+/*
+Tag is Sum returning an error for invalid keys
+*/
+func Tag(key, data []byte) ([]byte, error) {
+	c, err := NewCmac(key)
 	if err != nil {
-		panic(err.Error())
+		return nil, err
+	}
+
+	c.Write(data)
+	return c.Sum(nil), nil
+}
+
+/*
+VerifyReader MACs everything read from r and compares the tag with expected in
+constant time. Memory use doesn't depend on the length of the stream; a read error
+is returned together with false.
+*/
+func VerifyReader(key []byte, r io.Reader, expected []byte) (bool, error) {
+	c, err := NewCmac(key)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := io.Copy(c, r); err != nil {
+		return false, err
 	}
 
-	return c.Sum(nil)
+	var tag [blockSize]byte
+	c.(*cmac).SumInto(tag[:])
+	return subtle.ConstantTimeCompare(tag[:], expected) == 1, nil
 }
@@ -1,10 +1,13 @@
 package cmac
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/subtle"
+	"errors"
 	"fmt"
 	"testing"
+	"testing/iotest"
 )
 
 type inout struct {
@@ -99,6 +102,230 @@ func testNewCmac(t *testing.T) {
 	}
 }
 
+func testSelfTest(t *testing.T) {
+	if err := SelfTest(); err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+}
+
+func testAlgorithm(t *testing.T) {
+	c, err := NewCmac(rfcTestData.Key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	alg, ok := c.(interface{ Algorithm() string })
+	if !ok || alg.Algorithm() != "AES-CMAC-128" {
+		t.Errorf("unexpected algorithm %v", c)
+		t.Fail()
+	}
+}
+
+func testChunkedWrites(t *testing.T) {
+	message := make([]byte, 100)
+	for i := range message {
+		message[i] = byte(i)
+	}
+
+	for size := 0; size <= len(message); size++ {
+		expected := Sum(rfcTestData.Key, message[:size])
+
+		for chunk := 1; chunk <= 33; chunk++ {
+			c, _ := NewCmac(rfcTestData.Key)
+			for i := 0; i < size; i += chunk {
+				c.Write(message[i:min(i+chunk, size)])
+			}
+
+			if subtle.ConstantTimeCompare(c.Sum(nil), expected) != 1 {
+				t.Errorf("message of %d bytes written by %d: wrong tag", size, chunk)
+				t.Fail()
+				return
+			}
+		}
+	}
+}
+
+func testAlignedWriteAllocs(t *testing.T) {
+	c, _ := NewCmac(rfcTestData.Key)
+	data := make([]byte, 64*blockSize)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		c.Write(data)
+	})
+	if allocs != 0 {
+		t.Errorf("%v allocations per Write", allocs)
+		t.Fail()
+	}
+}
+
+func testSumIntoAllocs(t *testing.T) {
+	h, _ := NewCmac(rfcTestData.Key)
+	h.Write(rfcTestData.InputOutput[2].M)
+	c := h.(interface{ SumInto([]byte) })
+
+	tag := make([]byte, blockSize)
+	buf := make([]byte, 0, blockSize)
+	allocs := testing.AllocsPerRun(100, func() {
+		c.SumInto(tag)
+		buf = h.Sum(buf[:0])
+	})
+	if allocs != 0 {
+		t.Errorf("%v allocations per SumInto and Sum", allocs)
+		t.Fail()
+	}
+
+	if subtle.ConstantTimeCompare(tag, rfcTestData.InputOutput[2].CmacResult) != 1 ||
+		subtle.ConstantTimeCompare(buf, rfcTestData.InputOutput[2].CmacResult) != 1 {
+		t.Error("wrong tag")
+		t.Fail()
+	}
+}
+
+func testAutoReset(t *testing.T) {
+	c, err := NewAutoResetCmac(rfcTestData.Key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	for _, v := range rfcTestData.InputOutput {
+		c.Write(v.M)
+		if subtle.ConstantTimeCompare(c.Sum(nil), v.CmacResult) != 1 {
+			t.Errorf("wrong tag for a %d byte message", len(v.M))
+			t.Fail()
+		}
+	}
+
+	// a plain CMAC continues the message after Sum
+	h, _ := NewCmac(rfcTestData.Key)
+	h.Write(rfcTestData.InputOutput[1].M)
+	h.Sum(nil)
+	h.Write(rfcTestData.InputOutput[2].M[blockSize:])
+	if subtle.ConstantTimeCompare(h.Sum(nil), rfcTestData.InputOutput[2].CmacResult) != 1 {
+		t.Error("Sum changed the state")
+		t.Fail()
+	}
+}
+
+func testSumBatch(t *testing.T) {
+	msgs := make([][]byte, 0, 40)
+	for i := 0; i < 10; i++ {
+		for _, v := range rfcTestData.InputOutput {
+			msgs = append(msgs, v.M)
+		}
+	}
+
+	for _, workers := range []int{0, 1, 3, 100} {
+		tags, err := SumBatch(rfcTestData.Key, msgs, workers)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+			return
+		}
+
+		for i := range msgs {
+			expected := rfcTestData.InputOutput[i%len(rfcTestData.InputOutput)].CmacResult
+			if subtle.ConstantTimeCompare(tags[i], expected) != 1 {
+				t.Errorf("%d workers: wrong tag %d", workers, i)
+				t.Fail()
+				return
+			}
+		}
+	}
+
+	if _, err := SumBatch(rfcTestData.Key[:5], msgs, 1); err != errUnsupportedKeySize {
+		t.Errorf("expected %v, got %v", errUnsupportedKeySize, err)
+		t.Fail()
+	}
+}
+
+func testKeyed(t *testing.T) {
+	k, err := NewKeyed(rfcTestData.Key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	// the states share the subkeys but not the chaining value
+	a, b := k.New(), k.New()
+	for i, v := range rfcTestData.InputOutput {
+		a.Write(v.M)
+		b.Write(v.M)
+		if subtle.ConstantTimeCompare(a.Sum(nil), v.CmacResult) != 1 || subtle.ConstantTimeCompare(b.Sum(nil), v.CmacResult) != 1 {
+			t.Errorf("wrong tag %d", i)
+			t.Fail()
+		}
+		a.Reset()
+		b.Reset()
+	}
+
+	k.Destroy()
+	if subtle.ConstantTimeCompare(k.base.k1, zero) != 1 || subtle.ConstantTimeCompare(k.base.k2, zero) != 1 {
+		t.Error("subkeys aren't wiped")
+		t.Fail()
+	}
+
+	if _, err := NewKeyed(rfcTestData.Key[:5]); err != errUnsupportedKeySize {
+		t.Errorf("expected %v, got %v", errUnsupportedKeySize, err)
+		t.Fail()
+	}
+}
+
+func testInvalidKeys(t *testing.T) {
+	tag, err := Tag(rfcTestData.Key, rfcTestData.InputOutput[0].M)
+	if err != nil || subtle.ConstantTimeCompare(tag, rfcTestData.InputOutput[0].CmacResult) != 1 {
+		t.Errorf("unexpected tag %x: %v", tag, err)
+		t.Fail()
+	}
+
+	if _, err := Tag(rfcTestData.Key[:5], nil); err == nil {
+		t.Error("invalid key accepted")
+		t.Fail()
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Sum accepted an invalid key")
+			t.Fail()
+		}
+	}()
+	Sum(rfcTestData.Key[:5], nil)
+}
+
+func testVerifyReader(t *testing.T) {
+	for _, v := range rfcTestData.InputOutput {
+		ok, err := VerifyReader(rfcTestData.Key, iotest.OneByteReader(bytes.NewReader(v.M)), v.CmacResult)
+		if err != nil || !ok {
+			t.Errorf("valid tag rejected, len = %d, err = %v", len(v.M), err)
+			t.Fail()
+		}
+
+		tag := append([]byte{}, v.CmacResult...)
+		tag[len(tag)-1] ^= 1
+		if ok, _ := VerifyReader(rfcTestData.Key, bytes.NewReader(v.M), tag); ok {
+			t.Errorf("modified tag accepted, len = %d", len(v.M))
+			t.Fail()
+		}
+
+		if ok, _ := VerifyReader(rfcTestData.Key, bytes.NewReader(v.M), v.CmacResult[:8]); ok {
+			t.Errorf("truncated tag accepted, len = %d", len(v.M))
+			t.Fail()
+		}
+	}
+
+	errRead := errors.New("read failed")
+	ok, err := VerifyReader(rfcTestData.Key, iotest.ErrReader(errRead), rfcTestData.InputOutput[0].CmacResult)
+	if ok || err != errRead {
+		t.Errorf("expected %v, got %v, %v", errRead, ok, err)
+		t.Fail()
+	}
+}
+
 func testCmacGenSubkeys(t *testing.T) {
 	enc, err := aes.NewCipher(rfcTestData.Key)
 	if err != nil {
@@ -145,6 +372,16 @@ func testRfcData(t *testing.T, key, in, out []byte) {
 func TestCmac(t *testing.T) {
 	t.Run("generate subkeys check", testCmacGenSubkeys)
 	t.Run("create cmac test", testNewCmac)
+	t.Run("self-test", testSelfTest)
+	t.Run("algorithm identifier", testAlgorithm)
+	t.Run("chunked writes", testChunkedWrites)
+	t.Run("aligned writes don't allocate", testAlignedWriteAllocs)
+	t.Run("SumInto doesn't allocate", testSumIntoAllocs)
+	t.Run("auto reset", testAutoReset)
+	t.Run("batch", testSumBatch)
+	t.Run("keyed context", testKeyed)
+	t.Run("verify reader", testVerifyReader)
+	t.Run("invalid keys", testInvalidKeys)
 
 	for i := range rfcTestData.InputOutput {
 		t.Run(fmt.Sprintf("rfc test %d, input len = %d", i, len(rfcTestData.InputOutput[i].M)), func(t *testing.T) {
@@ -0,0 +1,66 @@
+package cmac
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+)
+
+/*
+Known answer tests from https://tools.ietf.org/html/rfc4493#section-4
+*/
+var knownAnswers = []struct {
+	name    string
+	key     string
+	message string
+	tag     string
+}{
+	{
+		name:    "RFC 4493 example 1",
+		key:     "2b7e151628aed2a6abf7158809cf4f3c",
+		message: "",
+		tag:     "bb1d6929e95937287fa37d129b756746",
+	},
+	{
+		name:    "RFC 4493 example 2",
+		key:     "2b7e151628aed2a6abf7158809cf4f3c",
+		message: "6bc1bee22e409f96e93d7e117393172a",
+		tag:     "070a16b46b4d4144f79bdd9dd04a287c",
+	},
+	{
+		name:    "RFC 4493 example 3",
+		key:     "2b7e151628aed2a6abf7158809cf4f3c",
+		message: "6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411",
+		tag:     "dfa66747de9ae63030ca32611497c827",
+	},
+	{
+		name: "RFC 4493 example 4",
+		key:  "2b7e151628aed2a6abf7158809cf4f3c",
+		message: "6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51" +
+			"30c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710",
+		tag: "51f0bebf7e3b9d92fc49741779363cfe",
+	},
+}
+
+/*
+SelfTest runs the known answer tests and returns an error naming the first failed one.
+It's meant for deployments requiring power-on self-tests, call it at startup.
+*/
+func SelfTest() error {
+	for _, ka := range knownAnswers {
+		key, _ := hex.DecodeString(ka.key)
+		message, _ := hex.DecodeString(ka.message)
+		tag, _ := hex.DecodeString(ka.tag)
+
+		c, err := NewCmac(key)
+		if err != nil {
+			return fmt.Errorf("cmac: self-test %s failed: %w", ka.name, err)
+		}
+
+		c.Write(message)
+		if subtle.ConstantTimeCompare(c.Sum(nil), tag) != 1 {
+			return fmt.Errorf("cmac: self-test %s failed", ka.name)
+		}
+	}
+	return nil
+}
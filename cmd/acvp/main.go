@@ -0,0 +1,46 @@
+/*
+Command acvp answers NIST ACVP request files for the algorithms supported by package acvp.
+
+	acvp [-o response.json] request.json
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/luc-lynx/siv/acvp"
+	"os"
+)
+
+func main() {
+	out := flag.String("o", "", "response file (default stdout)")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: acvp [-o response.json] request.json")
+		os.Exit(2)
+	}
+
+	request, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "acvp:", err)
+		os.Exit(1)
+	}
+
+	response, err := acvp.Process(request)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "acvp:", err)
+		os.Exit(1)
+	}
+	response = append(response, '\n')
+
+	if *out == "" {
+		os.Stdout.Write(response)
+		return
+	}
+
+	if err := os.WriteFile(*out, response, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "acvp:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,225 @@
+/*
+Command cmac computes AES-CMAC of files and verifies manifests, as a keyed alternative to sha256sum.
+
+	cmac -key file [-o manifest] paths...
+	cmac -key file -c manifest [-quiet]
+
+Directories are walked recursively. The manifest has the sha256sum layout,
+one "hex-tag  path" line per file.
+
+Exit codes:
+
+	0 - all the files have been processed (and verified)
+	1 - some files are missing, can't be read or have a tag mismatch
+	2 - invalid usage, key or manifest
+*/
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/luc-lynx/siv/cmac"
+	"github.com/luc-lynx/siv/ct"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	exitOK      = 0
+	exitFailed  = 1
+	exitInvalid = 2
+
+	tagHexSize = 32
+)
+
+var (
+	errNoKey          = errors.New("-key is required")
+	errNoPaths        = errors.New("no files to process")
+	errManifestFormat = errors.New("invalid manifest line")
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("cmac", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	keyFile := flags.String("key", "", "file with hex encoded AES key (128, 192 or 256 bits)")
+	check := flags.String("c", "", "verify files listed in the manifest")
+	out := flags.String("o", "", "write the manifest to the file instead of stdout")
+	quiet := flags.Bool("quiet", false, "don't print OK for each successfully verified file")
+	if err := flags.Parse(args); err != nil {
+		return exitInvalid
+	}
+
+	key, err := loadKey(*keyFile)
+	if err != nil {
+		fmt.Fprintln(stderr, "cmac:", err)
+		return exitInvalid
+	}
+
+	if *check != "" {
+		return verify(key, *check, *quiet, stdout, stderr)
+	}
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(stderr, "cmac:", errNoPaths)
+		return exitInvalid
+	}
+
+	w := stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(stderr, "cmac:", err)
+			return exitInvalid
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return generate(key, flags.Args(), w, stderr)
+}
+
+func loadKey(name string) ([]byte, error) {
+	if name == "" {
+		return nil, errNoKey
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer clear(data)
+	key, err := ct.DecodeHex(bytes.TrimSpace(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// check the key size early, before any file is processed
+	if _, err := cmac.NewCmac(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func generate(key []byte, paths []string, stdout, stderr io.Writer) int {
+	code := exitOK
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+
+			tag, err := fileTag(key, path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%s  %s\n", hex.EncodeToString(tag), filepath.ToSlash(path))
+			return nil
+		})
+
+		if err != nil {
+			fmt.Fprintln(stderr, "cmac:", err)
+			code = exitFailed
+		}
+	}
+	return code
+}
+
+func verify(key []byte, manifest string, quiet bool, stdout, stderr io.Writer) int {
+	f, err := os.Open(manifest)
+	if err != nil {
+		fmt.Fprintln(stderr, "cmac:", err)
+		return exitInvalid
+	}
+	defer f.Close()
+
+	failed := 0
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if scanner.Text() == "" {
+			continue
+		}
+
+		expected, path, err := parseManifestLine(scanner.Text())
+		if err != nil {
+			fmt.Fprintf(stderr, "cmac: %s:%d: %v\n", manifest, line, err)
+			return exitInvalid
+		}
+
+		ok, err := fileVerify(key, filepath.FromSlash(path), expected)
+		switch {
+		case err != nil:
+			fmt.Fprintf(stdout, "%s: FAILED open or read\n", path)
+			failed++
+		case !ok:
+			fmt.Fprintf(stdout, "%s: FAILED\n", path)
+			failed++
+		case !quiet:
+			fmt.Fprintf(stdout, "%s: OK\n", path)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(stderr, "cmac:", err)
+		return exitInvalid
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(stderr, "cmac: WARNING: %d files failed verification\n", failed)
+		return exitFailed
+	}
+	return exitOK
+}
+
+func parseManifestLine(line string) ([]byte, string, error) {
+	if len(line) < tagHexSize+3 || line[tagHexSize:tagHexSize+2] != "  " {
+		return nil, "", errManifestFormat
+	}
+
+	tag, err := hex.DecodeString(line[:tagHexSize])
+	if err != nil {
+		return nil, "", errManifestFormat
+	}
+	return tag, line[tagHexSize+2:], nil
+}
+
+func fileVerify(key []byte, path string, expected []byte) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	return cmac.VerifyReader(key, f, expected)
+}
+
+func fileTag(key []byte, path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c, err := cmac.NewCmac(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(c, f); err != nil {
+		return nil, err
+	}
+	return c.Sum(nil), nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/luc-lynx/siv/cmac"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, name string, data []byte) {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	key := bytes.Repeat([]byte{0x2b}, 16)
+	keyFile := filepath.Join(dir, "key")
+	writeFile(t, keyFile, []byte(hex.EncodeToString(key)+"\n"))
+
+	data := filepath.Join(dir, "data")
+	writeFile(t, filepath.Join(data, "a.txt"), []byte("first file"))
+	writeFile(t, filepath.Join(data, "sub", "b.bin"), bytes.Repeat([]byte{1}, 100))
+
+	manifest := filepath.Join(dir, "manifest")
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-key", keyFile, "-o", manifest, data}, &stdout, &stderr); code != exitOK {
+		t.Fatal("generation failed:", stderr.String())
+	}
+
+	content, err := os.ReadFile(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := hex.EncodeToString(cmac.Sum(key, []byte("first file"))) + "  " + filepath.ToSlash(filepath.Join(data, "a.txt"))
+	if !strings.Contains(string(content), expected+"\n") {
+		t.Fatalf("manifest doesn't contain %q:\n%s", expected, content)
+	}
+
+	stdout.Reset()
+	if code := run([]string{"-key", keyFile, "-c", manifest}, &stdout, &stderr); code != exitOK {
+		t.Fatal("verification failed:", stdout.String())
+	}
+	if strings.Count(stdout.String(), ": OK\n") != 2 {
+		t.Errorf("unexpected output %q", stdout.String())
+	}
+
+	writeFile(t, filepath.Join(data, "a.txt"), []byte("first file!"))
+	stdout.Reset()
+	if code := run([]string{"-key", keyFile, "-c", manifest, "-quiet"}, &stdout, &stderr); code != exitFailed {
+		t.Error("modified file passed verification")
+	}
+	if stdout.String() != filepath.ToSlash(filepath.Join(data, "a.txt"))+": FAILED\n" {
+		t.Errorf("unexpected output %q", stdout.String())
+	}
+
+	os.Remove(filepath.Join(data, "sub", "b.bin"))
+	stdout.Reset()
+	if code := run([]string{"-key", keyFile, "-c", manifest}, &stdout, &stderr); code != exitFailed {
+		t.Error("missing file passed verification")
+	}
+	if !strings.Contains(stdout.String(), "FAILED open or read") {
+		t.Errorf("unexpected output %q", stdout.String())
+	}
+}
+
+func TestInvalidUsage(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	writeFile(t, keyFile, []byte(hex.EncodeToString(make([]byte, 20))))
+
+	manifest := filepath.Join(dir, "manifest")
+	writeFile(t, manifest, []byte("not a manifest\n"))
+
+	goodKey := filepath.Join(dir, "good")
+	writeFile(t, goodKey, []byte(hex.EncodeToString(make([]byte, 16))))
+
+	testCases := [][]string{
+		{dir},
+		{"-key", keyFile, dir},
+		{"-key", goodKey},
+		{"-key", goodKey, "-c", manifest},
+	}
+
+	for i := range testCases {
+		var stdout, stderr bytes.Buffer
+		if code := run(testCases[i], &stdout, &stderr); code != exitInvalid {
+			t.Errorf("%v: unexpected exit code %d", testCases[i], code)
+		}
+	}
+}
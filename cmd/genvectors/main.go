@@ -0,0 +1,156 @@
+/*
+Command genvectors writes JSON test vectors for every mode supported by the module,
+so implementations in other languages can be checked against this one.
+
+	genvectors [-seed string] [-o file]
+
+All the keys and inputs are derived from the seed, so the output is reproducible.
+*/
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/luc-lynx/siv/cmac"
+	"github.com/luc-lynx/siv/siv"
+	"io"
+	"os"
+)
+
+const (
+	defaultSeed = "github.com/luc-lynx/siv test vectors"
+)
+
+var (
+	// lengths around block boundaries and the xorend/padding switch of S2V
+	messageLengths = []int{0, 1, 15, 16, 17, 31, 32, 33, 64, 100}
+	aadLengths     = [][]int{nil, {0}, {16}, {1, 24}, {0, 15, 16, 17}}
+)
+
+type cmacVector struct {
+	KeySize int    `json:"keySize"`
+	Key     string `json:"key"`
+	Message string `json:"message"`
+	Tag     string `json:"tag"`
+}
+
+type sivVector struct {
+	KeySize    int      `json:"keySize"`
+	Key        string   `json:"key"`
+	AAD        []string `json:"aad"`
+	Plaintext  string   `json:"plaintext"`
+	Ciphertext string   `json:"ciphertext"`
+}
+
+type vectors struct {
+	Seed   string       `json:"seed"`
+	CMAC   []cmacVector `json:"aesCmac"`
+	AesSIV []sivVector  `json:"aesSiv"`
+}
+
+/*
+generator is a deterministic byte source: CMAC of a counter under a key derived from the seed
+*/
+type generator struct {
+	key     []byte
+	counter uint64
+}
+
+func newGenerator(seed string) *generator {
+	return &generator{key: cmac.Sum(make([]byte, 16), []byte(seed))}
+}
+
+func (g *generator) bytes(n int) []byte {
+	result := make([]byte, 0, n+16)
+	for len(result) < n {
+		var block [8]byte
+		binary.BigEndian.PutUint64(block[:], g.counter)
+		g.counter++
+		result = append(result, cmac.Sum(g.key, block[:])...)
+	}
+	return result[:n]
+}
+
+func main() {
+	seed := flag.String("seed", defaultSeed, "seed all the keys and inputs are derived from")
+	out := flag.String("o", "", "output file (default stdout)")
+	flag.Parse()
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "genvectors:", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := write(w, *seed); err != nil {
+		fmt.Fprintln(os.Stderr, "genvectors:", err)
+		os.Exit(1)
+	}
+}
+
+func write(w io.Writer, seed string) error {
+	v, err := generate(seed)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func generate(seed string) (*vectors, error) {
+	g := newGenerator(seed)
+	v := &vectors{Seed: seed}
+
+	for _, keySize := range []int{16, 24, 32} {
+		key := g.bytes(keySize)
+		for _, n := range messageLengths {
+			message := g.bytes(n)
+			v.CMAC = append(v.CMAC, cmacVector{
+				KeySize: keySize * 8,
+				Key:     hex.EncodeToString(key),
+				Message: hex.EncodeToString(message),
+				Tag:     hex.EncodeToString(cmac.Sum(key, message)),
+			})
+		}
+	}
+
+	for _, keySize := range []int{32, 48, 64} {
+		key := g.bytes(keySize)
+		aead, err := siv.NewAesSIV(key)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, lengths := range aadLengths {
+			aad := make([][]byte, len(lengths))
+			aadHex := make([]string, len(lengths))
+			for i, n := range lengths {
+				aad[i] = g.bytes(n)
+				aadHex[i] = hex.EncodeToString(aad[i])
+			}
+
+			for _, n := range messageLengths {
+				plaintext := g.bytes(n)
+				v.AesSIV = append(v.AesSIV, sivVector{
+					KeySize:    keySize * 8,
+					Key:        hex.EncodeToString(key),
+					AAD:        aadHex,
+					Plaintext:  hex.EncodeToString(plaintext),
+					Ciphertext: hex.EncodeToString(aead.SealWithMultipleAAD(nil, plaintext, aad)),
+				})
+			}
+		}
+	}
+
+	return v, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/luc-lynx/siv/cmac"
+	"github.com/luc-lynx/siv/siv"
+	"testing"
+)
+
+func decodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestReproducible(t *testing.T) {
+	var a, b bytes.Buffer
+	if err := write(&a, defaultSeed); err != nil {
+		t.Fatal(err)
+	}
+	if err := write(&b, defaultSeed); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Error("output isn't reproducible")
+	}
+
+	var c bytes.Buffer
+	if err := write(&c, "other seed"); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(a.Bytes(), c.Bytes()) {
+		t.Error("output doesn't depend on the seed")
+	}
+}
+
+func TestVectors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := write(&buf, defaultSeed); err != nil {
+		t.Fatal(err)
+	}
+
+	var v vectors
+	if err := json.Unmarshal(buf.Bytes(), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(v.CMAC) != 3*len(messageLengths) || len(v.AesSIV) != 3*len(aadLengths)*len(messageLengths) {
+		t.Fatal("unexpected number of vectors")
+	}
+
+	for i, cv := range v.CMAC {
+		tag := cmac.Sum(decodeHex(t, cv.Key), decodeHex(t, cv.Message))
+		if !bytes.Equal(tag, decodeHex(t, cv.Tag)) {
+			t.Errorf("cmac vector %d mismatch", i)
+		}
+	}
+
+	for i, sv := range v.AesSIV {
+		aead, err := siv.NewAesSIV(decodeHex(t, sv.Key))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		aad := make([][]byte, len(sv.AAD))
+		for j := range sv.AAD {
+			aad[j] = decodeHex(t, sv.AAD[j])
+		}
+
+		ct := aead.SealWithMultipleAAD(nil, decodeHex(t, sv.Plaintext), aad)
+		if !bytes.Equal(ct, decodeHex(t, sv.Ciphertext)) {
+			t.Errorf("aes-siv vector %d mismatch", i)
+		}
+	}
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/luc-lynx/siv/ct"
+	"github.com/luc-lynx/siv/keyset"
+	"github.com/luc-lynx/siv/siv"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+var (
+	errNoKeyset        = errors.New("-keyset is required")
+	errKeysetEncrypted = errors.New("keyset is encrypted, -kek is required")
+	errNoFiles         = errors.New("no files to re-encrypt")
+)
+
+type keysetFlags struct {
+	keyset string
+	kek    string
+}
+
+func (f *keysetFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.keyset, "keyset", "", "keyset file")
+	fs.StringVar(&f.kek, "kek", "", "file with hex encoded key encrypting the keyset")
+}
+
+func keysetCommand(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("usage: siv keyset create|rotate|enable|disable|list|wrap|unwrap|import-tink [flags]")
+	}
+
+	switch args[0] {
+	case "create":
+		return keysetCreate(args[1:])
+	case "rotate":
+		return keysetRotate(args[1:])
+	case "enable":
+		return keysetSetStatus(args[1:], keyset.StatusEnabled)
+	case "disable":
+		return keysetSetStatus(args[1:], keyset.StatusDisabled)
+	case "list":
+		return keysetList(args[1:], stdout)
+	case "wrap":
+		return keysetWrap(args[1:], stdout, true)
+	case "unwrap":
+		return keysetWrap(args[1:], stdout, false)
+	case "import-tink":
+		return keysetImportTink(args[1:])
+	}
+	return fmt.Errorf("unknown keyset command %q", args[0])
+}
+
+func keysetCreate(args []string) error {
+	fs := flag.NewFlagSet("keyset create", flag.ContinueOnError)
+	var f keysetFlags
+	fs.StringVar(&f.keyset, "out", "", "keyset file to create")
+	fs.StringVar(&f.kek, "kek", "", "file with hex encoded key encrypting the keyset")
+	bits := fs.Int("bits", 512, "key size in bits: 256, 384 or 512")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if f.keyset == "" {
+		return errors.New("-out is required")
+	}
+
+	ks, err := keyset.New(*bits)
+	if err != nil {
+		return err
+	}
+	return saveKeyset(&f, ks)
+}
+
+func keysetRotate(args []string) error {
+	fs := flag.NewFlagSet("keyset rotate", flag.ContinueOnError)
+	var f keysetFlags
+	f.register(fs)
+	bits := fs.Int("bits", 512, "key size in bits: 256, 384 or 512")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ks, err := loadKeyset(&f)
+	if err != nil {
+		return err
+	}
+
+	if _, err := ks.Rotate(*bits); err != nil {
+		return err
+	}
+	return saveKeyset(&f, ks)
+}
+
+func keysetSetStatus(args []string, status string) error {
+	fs := flag.NewFlagSet("keyset "+status, flag.ContinueOnError)
+	var f keysetFlags
+	f.register(fs)
+	id := fs.Uint("id", 0, "key id")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ks, err := loadKeyset(&f)
+	if err != nil {
+		return err
+	}
+
+	if err := ks.SetStatus(uint32(*id), status); err != nil {
+		return err
+	}
+	return saveKeyset(&f, ks)
+}
+
+func keysetList(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("keyset list", flag.ContinueOnError)
+	var f keysetFlags
+	f.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ks, err := loadKeyset(&f)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range ks.Keys {
+		primary := ""
+		if k.ID == ks.Primary {
+			primary = "primary"
+		}
+		fmt.Fprintf(stdout, "%d\t%s\t%d bits\t%s\t%s\n", k.ID, k.Status, len(k.Material)*8,
+			k.Created.Format("2006-01-02T15:04:05Z"), primary)
+	}
+	return nil
+}
+
+/*
+keysetImportTink converts a cleartext Tink keyset with AES-SIV keys,
+the new keyset is encrypted if -kek is given.
+*/
+func keysetImportTink(args []string) error {
+	fs := flag.NewFlagSet("keyset import-tink", flag.ContinueOnError)
+	var f keysetFlags
+	fs.StringVar(&f.keyset, "out", "", "keyset file to create")
+	fs.StringVar(&f.kek, "kek", "", "file with hex encoded key encrypting the keyset")
+	in := fs.String("in", "", "Tink keyset file, JSON or binary")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if f.keyset == "" || *in == "" {
+		return errors.New("-in and -out are required")
+	}
+
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		return err
+	}
+	defer clear(data)
+
+	ks, err := keyset.ImportTink(data, nil)
+	if err != nil {
+		return err
+	}
+	return saveKeyset(&f, ks)
+}
+
+/*
+keysetWrap encrypts a cleartext keyset under the KEK or decrypts it back.
+*/
+func keysetWrap(args []string, stdout io.Writer, wrap bool) error {
+	fs := flag.NewFlagSet("keyset wrap/unwrap", flag.ContinueOnError)
+	var f keysetFlags
+	f.register(fs)
+	out := fs.String("out", "", "output file (default stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if f.kek == "" {
+		return errors.New("-kek is required")
+	}
+
+	kek, err := loadKEK(f.kek)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if wrap {
+		ks, err := loadKeyset(&keysetFlags{keyset: f.keyset})
+		if err != nil {
+			return err
+		}
+		data, err = ks.Encrypt(kek)
+		if err != nil {
+			return err
+		}
+	} else {
+		ks, err := loadKeyset(&f)
+		if err != nil {
+			return err
+		}
+		data, err = ks.Marshal()
+		if err != nil {
+			return err
+		}
+	}
+
+	if *out == "" {
+		_, err := stdout.Write(data)
+		return err
+	}
+	return writeFileAtomic(*out, data)
+}
+
+/*
+reencrypt opens every file with any enabled key of the keyset (or with a legacy raw key)
+and seals it again with the primary key, replacing the file atomically.
+*/
+func reencrypt(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("reencrypt", flag.ContinueOnError)
+	var f keysetFlags
+	f.register(fs)
+	var aad aadFlag
+	fs.Var(&aad, "aad", "associated data component, can be repeated")
+	fromKey := fs.String("from-key", "", "file with hex encoded key the files have been sealed with instead of the keyset")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return errNoFiles
+	}
+
+	ks, err := loadKeyset(&f)
+	if err != nil {
+		return err
+	}
+
+	open := ks.Open
+	if *fromKey != "" {
+		key, err := readHexKey(*fromKey)
+		if err != nil {
+			return err
+		}
+		legacy, err := siv.NewAesSIV(key)
+		if err != nil {
+			return err
+		}
+		open = func(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error) {
+			return legacy.OpenWithMultipleAAD(dst, ciphertext, additionalData)
+		}
+	}
+
+	for _, name := range fs.Args() {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		if id, err := keyset.KeyID(data); *fromKey == "" && err == nil && id == ks.Primary {
+			fmt.Fprintln(stdout, name, "already sealed with the primary key")
+			continue
+		}
+
+		plaintext, err := open(nil, data, aad)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		sealed, err := ks.Seal(nil, plaintext, aad)
+		if err != nil {
+			return err
+		}
+
+		if err := writeFileAtomic(name, sealed); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, name, "re-encrypted")
+	}
+	return nil
+}
+
+/*
+scan reports the keys the files under a directory are sealed with and optionally
+re-encrypts them with the primary key. With -state the last processed file is
+saved after every file and an interrupted scan continues after it.
+*/
+func scan(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	var f keysetFlags
+	f.register(fs)
+	var aad aadFlag
+	fs.Var(&aad, "aad", "associated data component, can be repeated")
+	reencrypt := fs.Bool("reencrypt", false, "re-encrypt files that aren't sealed with the primary key")
+	rate := fs.Float64("rate", 0, "maximum re-encryptions per second, 0 means no limit")
+	state := fs.String("state", "", "file keeping the last processed file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("scan needs exactly one directory")
+	}
+
+	ks, err := loadKeyset(&f)
+	if err != nil {
+		return err
+	}
+
+	s := &keyset.Scanner{
+		Keyset:    ks,
+		AAD:       func(string) [][]byte { return aad },
+		Reencrypt: *reencrypt,
+		Rate:      *rate,
+	}
+
+	var after string
+	if *state != "" {
+		data, err := os.ReadFile(*state)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		after = string(bytes.TrimSpace(data))
+		s.Checkpoint = func(name string) error {
+			return writeFileAtomic(*state, []byte(name+"\n"))
+		}
+	}
+
+	r, err := s.Scan(context.Background(), keyset.DirCorpus(fs.Arg(0)), after)
+	if r != nil {
+		for id, n := range r.Keys {
+			primary := ""
+			if id == ks.Primary {
+				primary = "primary"
+			}
+			fmt.Fprintf(stdout, "key %d\t%d files\t%s\n", id, n, primary)
+		}
+		for alg, n := range r.Algorithms {
+			fmt.Fprintf(stdout, "%s\t%d files\n", alg, n)
+		}
+		fmt.Fprintf(stdout, "%d files, %d unknown, %d re-encrypted, %d failed\n", r.Items, r.Unknown, r.Reencrypted, len(r.Failed))
+		for name, err := range r.Failed {
+			fmt.Fprintf(stdout, "%s: %v\n", name, err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(r.Failed) > 0 {
+		return fmt.Errorf("%d files failed", len(r.Failed))
+	}
+	return nil
+}
+
+func loadKeyset(f *keysetFlags) (*keyset.Keyset, error) {
+	if f.keyset == "" {
+		return nil, errNoKeyset
+	}
+
+	data, err := os.ReadFile(f.keyset)
+	if err != nil {
+		return nil, err
+	}
+
+	if !keyset.IsEncrypted(data) {
+		return keyset.Parse(data)
+	}
+
+	if f.kek == "" {
+		return nil, errKeysetEncrypted
+	}
+
+	kek, err := loadKEK(f.kek)
+	if err != nil {
+		return nil, err
+	}
+	return keyset.Decrypt(data, kek)
+}
+
+func saveKeyset(f *keysetFlags, ks *keyset.Keyset) error {
+	var data []byte
+	var err error
+
+	if f.kek == "" {
+		data, err = ks.Marshal()
+	} else {
+		var kek keyset.KEK
+		kek, err = loadKEK(f.kek)
+		if err != nil {
+			return err
+		}
+		data, err = ks.Encrypt(kek)
+	}
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(f.keyset, data)
+}
+
+func loadKEK(name string) (keyset.KEK, error) {
+	key, err := readHexKey(name)
+	if err != nil {
+		return nil, err
+	}
+	return keyset.NewSIVKEK(key)
+}
+
+func readHexKey(name string) ([]byte, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(data)
+	return ct.DecodeHex(bytes.TrimSpace(data))
+}
+
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp"+strconv.Itoa(os.Getpid()))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
@@ -0,0 +1,336 @@
+/*
+Command siv seals and opens data with AES-SIV.
+
+	siv keygen [-bits 256|384|512] [-out file]
+	siv seal   KEY [-aad data]... [-armor] [-in file] [-out file]
+	siv open   KEY [-aad data]... [-armor] [-in file] [-out file]
+	siv stream seal|open KEY [-aad data]... [-in file] [-out file]
+	siv keyset create|rotate|enable|disable|list|wrap|unwrap|import-tink [flags]
+	siv reencrypt -keyset file [-kek file] [-from-key file] [-aad data]... files...
+	siv scan -keyset file [-kek file] [-aad data]... [-reencrypt] [-rate n] [-state file] dir
+	siv verify-vectors [-format name] [-v] files...
+
+Input is read from stdin and output is written to stdout unless -in/-out are given.
+Every -aad flag adds a separate associated data component, the same components
+in the same order must be passed to open. stream seals and opens input of any size
+in chunks without holding it in memory, with keys from -key or a password.
+
+KEY is one of -key file, -keyset file [-kek file], -password-file file or -password-env name.
+
+Keys are stored hex encoded. A keyset is a JSON file with several keys identified by random ids,
+optionally encrypted with a key encryption key (-kek). Data sealed with a keyset is prefixed with
+the id of the primary key, so it can be opened after rotation and re-encrypted with the new
+primary key in bulk. scan reports which keys the files under a directory are sealed with
+and can re-encrypt them at a limited rate, resuming from -state after an interruption.
+
+verify-vectors checks the module against vector files published by other implementations
+(Wycheproof, miscreant, OpenSSL evp tests, RFC 5297 appendix text).
+
+With a password the key is derived using PBKDF2-HMAC-SHA256
+and a random salt which is prepended to the sealed data, so such output isn't deterministic.
+*/
+package main
+
+import (
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/luc-lynx/siv/siv"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	armorType        = "SIV MESSAGE"
+	saltSize         = 16
+	passwordKeySize  = 64
+	pbkdf2Iterations = 600000
+)
+
+var (
+	errNoKey          = errors.New("one of -key, -keyset, -password-file or -password-env is required")
+	errManyKeys       = errors.New("only one of -key, -keyset, -password-file or -password-env can be used")
+	errArmor          = errors.New("input is not an armored siv message")
+	errShortInput     = errors.New("input is too short")
+	errEmptyPassword  = errors.New("password is empty")
+	errUnknownKeySize = errors.New("key size must be 256, 384 or 512 bits")
+
+	// random is the source of keys and salts, tests replace it
+	random io.Reader = rand.Reader
+)
+
+type aadFlag [][]byte
+
+func (a *aadFlag) String() string {
+	return fmt.Sprint(len(*a), " components")
+}
+
+func (a *aadFlag) Set(value string) error {
+	*a = append(*a, []byte(value))
+	return nil
+}
+
+type sealOpenFlags struct {
+	keysetFlags
+	keyFile      string
+	passwordFile string
+	passwordEnv  string
+	aad          aadFlag
+	armor        bool
+	in           string
+	out          string
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "keygen":
+		err = keygen(args[1:], stdout)
+	case "seal":
+		err = sealOpen(args[1:], stdin, stdout, true)
+	case "open":
+		err = sealOpen(args[1:], stdin, stdout, false)
+	case "stream":
+		err = stream(args[1:], stdin, stdout)
+	case "keyset":
+		err = keysetCommand(args[1:], stdout)
+	case "reencrypt":
+		err = reencrypt(args[1:], stdout)
+	case "scan":
+		err = scan(args[1:], stdout)
+	case "verify-vectors":
+		err = verifyVectors(args[1:], stdout)
+	default:
+		usage(stderr)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(stderr, "siv:", err)
+		return 1
+	}
+	return 0
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: siv keygen|seal|open|stream|keyset|reencrypt|scan|verify-vectors [flags]")
+	fmt.Fprintln(w, "run 'siv <command> -h' for the list of flags")
+}
+
+func keygen(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	bits := fs.Int("bits", 512, "key size in bits: 256, 384 or 512")
+	out := fs.String("out", "", "output file (default stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch *bits {
+	case 256, 384, 512:
+	default:
+		return errUnknownKeySize
+	}
+
+	key, err := siv.GenerateKey(random, *bits)
+	if err != nil {
+		return err
+	}
+
+	encoded := []byte(hex.EncodeToString(key) + "\n")
+	if *out == "" {
+		_, err := stdout.Write(encoded)
+		return err
+	}
+	return os.WriteFile(*out, encoded, 0600)
+}
+
+func sealOpen(args []string, stdin io.Reader, stdout io.Writer, seal bool) error {
+	var f sealOpenFlags
+	fs := flag.NewFlagSet("seal/open", flag.ContinueOnError)
+	fs.StringVar(&f.keyFile, "key", "", "file with hex encoded key")
+	f.keysetFlags.register(fs)
+	fs.StringVar(&f.passwordFile, "password-file", "", "file with the password")
+	fs.StringVar(&f.passwordEnv, "password-env", "", "environment variable with the password")
+	fs.Var(&f.aad, "aad", "associated data component, can be repeated")
+	fs.BoolVar(&f.armor, "armor", false, "use PEM armor for sealed data")
+	fs.StringVar(&f.in, "in", "", "input file (default stdin)")
+	fs.StringVar(&f.out, "out", "", "output file (default stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	input, err := readInput(f.in, stdin)
+	if err != nil {
+		return err
+	}
+
+	var output []byte
+	if seal {
+		output, err = sealData(&f, input)
+	} else {
+		output, err = openData(&f, input)
+	}
+	if err != nil {
+		return err
+	}
+
+	if f.out == "" {
+		_, err := stdout.Write(output)
+		return err
+	}
+	return os.WriteFile(f.out, output, 0600)
+}
+
+func sealData(f *sealOpenFlags, plaintext []byte) ([]byte, error) {
+	if err := checkKeySource(f); err != nil {
+		return nil, err
+	}
+
+	if f.keyset != "" {
+		ks, err := loadKeyset(&f.keysetFlags)
+		if err != nil {
+			return nil, err
+		}
+
+		sealed, err := ks.Seal(nil, plaintext, f.aad)
+		if err != nil {
+			return nil, err
+		}
+		return armor(f, sealed), nil
+	}
+
+	var salt []byte
+	if f.keyFile == "" {
+		salt = make([]byte, saltSize)
+		if _, err := io.ReadFull(random, salt); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := loadKey(f, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := siv.NewAesSIV(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := aead.SealContext(context.Background(), plaintext, f.aad)
+	if err != nil {
+		return nil, err
+	}
+	return armor(f, append(salt, sealed...)), nil
+}
+
+func armor(f *sealOpenFlags, sealed []byte) []byte {
+	if f.armor {
+		return pem.EncodeToMemory(&pem.Block{Type: armorType, Bytes: sealed})
+	}
+	return sealed
+}
+
+func openData(f *sealOpenFlags, sealed []byte) ([]byte, error) {
+	if err := checkKeySource(f); err != nil {
+		return nil, err
+	}
+
+	if f.armor {
+		block, _ := pem.Decode(sealed)
+		if block == nil || block.Type != armorType {
+			return nil, errArmor
+		}
+		sealed = block.Bytes
+	}
+
+	if f.keyset != "" {
+		ks, err := loadKeyset(&f.keysetFlags)
+		if err != nil {
+			return nil, err
+		}
+		return ks.Open(nil, sealed, f.aad)
+	}
+
+	var salt []byte
+	if f.keyFile == "" {
+		if len(sealed) < saltSize {
+			return nil, errShortInput
+		}
+		salt, sealed = sealed[:saltSize], sealed[saltSize:]
+	}
+
+	key, err := loadKey(f, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := siv.NewAesSIV(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.OpenWithMultipleAAD(nil, sealed, f.aad)
+}
+
+func checkKeySource(f *sealOpenFlags) error {
+	n := 0
+	for _, s := range []string{f.keyFile, f.keyset, f.passwordFile, f.passwordEnv} {
+		if s != "" {
+			n++
+		}
+	}
+
+	switch {
+	case n == 0:
+		return errNoKey
+	case n > 1:
+		return errManyKeys
+	}
+	return nil
+}
+
+func loadKey(f *sealOpenFlags, salt []byte) ([]byte, error) {
+	if f.keyFile != "" {
+		return readHexKey(f.keyFile)
+	}
+
+	var password string
+	if f.passwordFile != "" {
+		data, err := os.ReadFile(f.passwordFile)
+		if err != nil {
+			return nil, err
+		}
+		password = strings.TrimRight(string(data), "\r\n")
+	} else {
+		password = os.Getenv(f.passwordEnv)
+	}
+
+	if password == "" {
+		return nil, errEmptyPassword
+	}
+	return pbkdf2.Key(sha256.New, password, salt, pbkdf2Iterations, passwordKeySize)
+}
+
+func readInput(name string, stdin io.Reader) ([]byte, error) {
+	if name == "" {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(name)
+}
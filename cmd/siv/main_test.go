@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"github.com/luc-lynx/siv/siv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runCommand(t *testing.T, stdin []byte, args ...string) ([]byte, int) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, bytes.NewReader(stdin), &stdout, &stderr)
+	if code != 0 {
+		t.Log(stderr.String())
+	}
+	return stdout.Bytes(), code
+}
+
+func TestKeySealOpen(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+
+	if _, code := runCommand(t, nil, "keygen", "-bits", "256", "-out", keyFile); code != 0 {
+		t.Fatal("keygen failed")
+	}
+
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(strings.TrimSpace(string(key))) != 64 {
+		t.Fatalf("unexpected key %q", key)
+	}
+
+	plaintext := []byte("attack at dawn")
+	sealed, code := runCommand(t, plaintext, "seal", "-key", keyFile, "-aad", "one", "--aad", "two", "-armor")
+	if code != 0 {
+		t.Fatal("seal failed")
+	}
+	if !bytes.HasPrefix(sealed, []byte("-----BEGIN SIV MESSAGE-----")) {
+		t.Fatalf("output isn't armored: %s", sealed)
+	}
+
+	opened, code := runCommand(t, sealed, "open", "-key", keyFile, "-aad", "one", "-aad", "two", "-armor")
+	if code != 0 || !bytes.Equal(opened, plaintext) {
+		t.Fatal("open failed")
+	}
+
+	if _, code := runCommand(t, sealed, "open", "-key", keyFile, "-aad", "two", "-aad", "one", "-armor"); code == 0 {
+		t.Error("open with reordered aad succeeded")
+	}
+}
+
+func TestPassword(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in")
+	sealed := filepath.Join(dir, "sealed")
+	out := filepath.Join(dir, "out")
+	plaintext := []byte("file contents")
+
+	if err := os.WriteFile(in, plaintext, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SIV_TEST_PASSWORD", "correct horse battery staple")
+
+	if _, code := runCommand(t, nil, "seal", "-password-env", "SIV_TEST_PASSWORD", "-in", in, "-out", sealed); code != 0 {
+		t.Fatal("seal failed")
+	}
+	if _, code := runCommand(t, nil, "open", "-password-env", "SIV_TEST_PASSWORD", "-in", sealed, "-out", out); code != 0 {
+		t.Fatal("open failed")
+	}
+
+	result, err := os.ReadFile(out)
+	if err != nil || !bytes.Equal(result, plaintext) {
+		t.Fatal("plaintext mismatch", err)
+	}
+
+	t.Setenv("SIV_TEST_PASSWORD", "wrong password")
+	if _, code := runCommand(t, nil, "open", "-password-env", "SIV_TEST_PASSWORD", "-in", sealed); code == 0 {
+		t.Error("open with wrong password succeeded")
+	}
+}
+
+func TestStream(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	if _, code := runCommand(t, nil, "keygen", "-out", keyFile); code != 0 {
+		t.Fatal("keygen failed")
+	}
+
+	plaintext := bytes.Repeat([]byte("streamed "), 2*siv.StreamChunkSize/9+10)
+	sealed, code := runCommand(t, plaintext, "stream", "seal", "-key", keyFile, "-aad", "one")
+	if code != 0 {
+		t.Fatal("seal failed")
+	}
+	opened, code := runCommand(t, sealed, "stream", "open", "-key", keyFile, "-aad", "one")
+	if code != 0 || !bytes.Equal(opened, plaintext) {
+		t.Fatal("open failed")
+	}
+	if _, code := runCommand(t, sealed, "stream", "open", "-key", keyFile, "-aad", "two"); code == 0 {
+		t.Error("open with other aad succeeded")
+	}
+
+	// a truncated stream fails and leaves no output file behind
+	truncated := filepath.Join(dir, "truncated")
+	out := filepath.Join(dir, "out")
+	if err := os.WriteFile(truncated, sealed[:len(sealed)-100], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, code := runCommand(t, nil, "stream", "open", "-key", keyFile, "-aad", "one", "-in", truncated, "-out", out); code == 0 {
+		t.Error("open of a truncated stream succeeded")
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Error("output of a failed open wasn't removed", err)
+	}
+
+	t.Setenv("SIV_TEST_PASSWORD", "correct horse battery staple")
+	sealed, code = runCommand(t, plaintext, "stream", "seal", "-password-env", "SIV_TEST_PASSWORD")
+	if code != 0 {
+		t.Fatal("password seal failed")
+	}
+	opened, code = runCommand(t, sealed, "stream", "open", "-password-env", "SIV_TEST_PASSWORD")
+	if code != 0 || !bytes.Equal(opened, plaintext) {
+		t.Fatal("password open failed")
+	}
+}
+
+func TestBadUsage(t *testing.T) {
+	testCases := [][]string{
+		{},
+		{"unknown"},
+		{"seal"},
+		{"stream"},
+		{"stream", "seal"},
+		{"stream", "seal", "-keyset", "keyset.json"},
+		{"keygen", "-bits", "128"},
+	}
+
+	for i := range testCases {
+		if _, code := runCommand(t, nil, testCases[i]...); code == 0 {
+			t.Errorf("%v succeeded", testCases[i])
+		}
+	}
+}
+
+func TestKeysetRotateReencrypt(t *testing.T) {
+	dir := t.TempDir()
+	ks := filepath.Join(dir, "keyset.json")
+	kek := filepath.Join(dir, "kek")
+	data := filepath.Join(dir, "data")
+	plaintext := []byte("rotate me")
+
+	if _, code := runCommand(t, nil, "keygen", "-bits", "256", "-out", kek); code != 0 {
+		t.Fatal("keygen failed")
+	}
+	if _, code := runCommand(t, nil, "keyset", "create", "-out", ks, "-kek", kek); code != 0 {
+		t.Fatal("keyset create failed")
+	}
+	if _, code := runCommand(t, nil, "keyset", "list", "-keyset", ks); code == 0 {
+		t.Fatal("encrypted keyset was read without kek")
+	}
+
+	sealed, code := runCommand(t, plaintext, "seal", "-keyset", ks, "-kek", kek, "-aad", "ctx")
+	if code != 0 {
+		t.Fatal("seal failed")
+	}
+	if err := os.WriteFile(data, sealed, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	list, code := runCommand(t, nil, "keyset", "list", "-keyset", ks, "-kek", kek)
+	if code != 0 {
+		t.Fatal("keyset list failed")
+	}
+	oldID := strings.Fields(string(list))[0]
+
+	if _, code := runCommand(t, nil, "keyset", "rotate", "-keyset", ks, "-kek", kek); code != 0 {
+		t.Fatal("keyset rotate failed")
+	}
+	if _, code := runCommand(t, nil, "reencrypt", "-keyset", ks, "-kek", kek, "-aad", "ctx", data); code != 0 {
+		t.Fatal("reencrypt failed")
+	}
+	if _, code := runCommand(t, nil, "keyset", "disable", "-keyset", ks, "-kek", kek, "-id", oldID); code != 0 {
+		t.Fatal("keyset disable failed")
+	}
+
+	opened, code := runCommand(t, nil, "open", "-keyset", ks, "-kek", kek, "-aad", "ctx", "-in", data)
+	if code != 0 || !bytes.Equal(opened, plaintext) {
+		t.Fatal("open after re-encryption failed")
+	}
+
+	if _, code := runCommand(t, sealed, "open", "-keyset", ks, "-kek", kek, "-aad", "ctx"); code == 0 {
+		t.Error("data sealed with disabled key was opened")
+	}
+}
+
+func TestKeysetWrapUnwrap(t *testing.T) {
+	dir := t.TempDir()
+	ks := filepath.Join(dir, "keyset.json")
+	wrapped := filepath.Join(dir, "wrapped.json")
+	kek := filepath.Join(dir, "kek")
+
+	if _, code := runCommand(t, nil, "keygen", "-out", kek); code != 0 {
+		t.Fatal("keygen failed")
+	}
+	if _, code := runCommand(t, nil, "keyset", "create", "-out", ks, "-bits", "384"); code != 0 {
+		t.Fatal("keyset create failed")
+	}
+	if _, code := runCommand(t, nil, "keyset", "wrap", "-keyset", ks, "-kek", kek, "-out", wrapped); code != 0 {
+		t.Fatal("keyset wrap failed")
+	}
+
+	unwrapped, code := runCommand(t, nil, "keyset", "unwrap", "-keyset", wrapped, "-kek", kek)
+	if code != 0 {
+		t.Fatal("keyset unwrap failed")
+	}
+
+	original, err := os.ReadFile(ks)
+	if err != nil || !bytes.Equal(original, unwrapped) {
+		t.Error("unwrapped keyset differs", err)
+	}
+}
+
+func TestVerifyVectors(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.txt")
+	bad := filepath.Join(dir, "bad.txt")
+
+	stanza := "Cipher = aes-128-siv\n" +
+		"Key = fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff\n" +
+		"AAD = 101112131415161718191a1b1c1d1e1f2021222324252627\n" +
+		"Plaintext = 112233445566778899aabbccddee\n" +
+		"Ciphertext = 40c02b9690c4dc04daef7f6afe5c\n"
+
+	if err := os.WriteFile(good, []byte(stanza+"Tag = 85632d07c6e8f37f950acd320a2ecc93\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bad, []byte(stanza+"Tag = 85632d07c6e8f37f950acd320a2ecc94\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, code := runCommand(t, nil, "verify-vectors", good)
+	if code != 0 || !strings.Contains(string(out), "1 passed, 0 failed") {
+		t.Errorf("unexpected result %d: %s", code, out)
+	}
+
+	out, code = runCommand(t, nil, "verify-vectors", "-format", "openssl", bad)
+	if code == 0 || !strings.Contains(string(out), "FAILED") {
+		t.Errorf("unexpected result %d: %s", code, out)
+	}
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	ks := filepath.Join(dir, "keyset.json")
+	state := filepath.Join(dir, "state")
+	data := filepath.Join(dir, "data")
+	if err := os.Mkdir(data, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, code := runCommand(t, nil, "keyset", "create", "-out", ks, "-bits", "256"); code != 0 {
+		t.Fatal("keyset create failed")
+	}
+	for _, name := range []string{"a", "b"} {
+		sealed, code := runCommand(t, []byte(name), "seal", "-keyset", ks, "-aad", "ctx")
+		if code != 0 {
+			t.Fatal("seal failed")
+		}
+		if err := os.WriteFile(filepath.Join(data, name), sealed, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, code := runCommand(t, nil, "keyset", "rotate", "-keyset", ks); code != 0 {
+		t.Fatal("keyset rotate failed")
+	}
+
+	out, code := runCommand(t, nil, "scan", "-keyset", ks, "-aad", "ctx", "-reencrypt", "-state", state, data)
+	if code != 0 || !strings.Contains(string(out), "2 files, 0 unknown, 2 re-encrypted, 0 failed") {
+		t.Fatalf("scan failed: %s", out)
+	}
+	if last, err := os.ReadFile(state); err != nil || string(last) != "b\n" {
+		t.Errorf("state %q, %v", last, err)
+	}
+
+	// resumed after the last file, nothing left to do
+	out, code = runCommand(t, nil, "scan", "-keyset", ks, "-state", state, data)
+	if code != 0 || !strings.Contains(string(out), "0 files") {
+		t.Errorf("resumed scan: %s", out)
+	}
+
+	out, code = runCommand(t, nil, "scan", "-keyset", ks, data)
+	if code != 0 || !strings.Contains(string(out), "primary") || !strings.Contains(string(out), "AES-SIV-CMAC-512\t2 files") {
+		t.Errorf("scan after re-encryption: %s", out)
+	}
+}
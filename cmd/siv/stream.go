@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"github.com/luc-lynx/siv/siv"
+	"io"
+	"os"
+)
+
+var errStreamUsage = errors.New("usage: siv stream seal|open KEY [-aad data]... [-in file] [-out file]")
+
+/*
+stream seals and opens input of any size in chunks with the streaming format of
+siv.NewEncryptingWriter, so it is never held in memory. KEY is -key, -password-file
+or -password-env; with a password the salt is written before the stream. Keysets and
+-armor aren't supported, the keyset prefix and PEM are made for whole messages.
+
+A failed open stops at the chunk that failed, the output written before it is
+authenticated but only a prefix of the stream, so an -out file is removed.
+*/
+func stream(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 || (args[0] != "seal" && args[0] != "open") {
+		return errStreamUsage
+	}
+	seal := args[0] == "seal"
+
+	var f sealOpenFlags
+	fs := flag.NewFlagSet("stream", flag.ContinueOnError)
+	fs.StringVar(&f.keyFile, "key", "", "file with hex encoded key")
+	fs.StringVar(&f.passwordFile, "password-file", "", "file with the password")
+	fs.StringVar(&f.passwordEnv, "password-env", "", "environment variable with the password")
+	fs.Var(&f.aad, "aad", "associated data component, can be repeated")
+	fs.StringVar(&f.in, "in", "", "input file (default stdin)")
+	fs.StringVar(&f.out, "out", "", "output file (default stdout)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if err := checkKeySource(&f); err != nil {
+		return err
+	}
+
+	in := stdin
+	if f.in != "" {
+		file, err := os.Open(f.in)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	if f.out == "" {
+		return streamData(&f, in, stdout, seal)
+	}
+
+	out, err := os.OpenFile(f.out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	err = streamData(&f, in, out, seal)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.out)
+	}
+	return err
+}
+
+func streamData(f *sealOpenFlags, in io.Reader, out io.Writer, seal bool) error {
+	var salt []byte
+	if f.keyFile == "" {
+		salt = make([]byte, saltSize)
+		if seal {
+			if _, err := io.ReadFull(random, salt); err != nil {
+				return err
+			}
+			if _, err := out.Write(salt); err != nil {
+				return err
+			}
+		} else if _, err := io.ReadFull(in, salt); err != nil {
+			return errShortInput
+		}
+	}
+
+	key, err := loadKey(f, salt)
+	if err != nil {
+		return err
+	}
+
+	if !seal {
+		r, err := siv.NewDecryptingReader(key, in, f.aad)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, r)
+		return err
+	}
+
+	w, err := siv.NewEncryptingWriter(key, out, f.aad)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, in); err != nil {
+		return err
+	}
+	return w.Close()
+}
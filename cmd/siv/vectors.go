@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/luc-lynx/siv/interop"
+	"io"
+	"os"
+)
+
+var (
+	errVectorsFailed = errors.New("some vectors failed verification")
+)
+
+/*
+verifyVectors checks the module against vector files of other implementations,
+see package interop for the supported formats.
+*/
+func verifyVectors(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("verify-vectors", flag.ContinueOnError)
+	format := fs.String("format", "", "wycheproof, miscreant, openssl or rfc5297 (detected if empty)")
+	verbose := fs.Bool("v", false, "print passed and skipped vectors too")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return errors.New("no vector files")
+	}
+
+	failed := false
+	for _, name := range fs.Args() {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		results, err := interop.Verify(*format, data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		passed, skipped := 0, 0
+		for i := range results {
+			switch {
+			case results[i].Skipped:
+				skipped++
+			case results[i].Passed:
+				passed++
+			default:
+				failed = true
+			}
+
+			if *verbose || !results[i].Passed && !results[i].Skipped {
+				fmt.Fprintf(stdout, "%s %s\n", name, results[i].String())
+			}
+		}
+		fmt.Fprintf(stdout, "%s: %d passed, %d failed, %d skipped\n", name, passed, len(results)-passed-skipped, skipped)
+	}
+
+	if failed {
+		return errVectorsFailed
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+/*
+Command sivcheck reports misuse of the siv and cmac packages, see package sivcheck.
+
+	sivcheck ./...
+	go vet -vettool=$(which sivcheck) ./...
+*/
+package main
+
+import (
+	"github.com/luc-lynx/siv/sivcheck"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(sivcheck.Analyzer)
+}
@@ -0,0 +1,188 @@
+/*
+Command sivd serves seal, open and CMAC operations of a keyset over HTTPS,
+so services written in other languages can use one sidecar instead of holding keys.
+
+	sivd -keyset file [-kek file] [-mac-key file] -cert file -cert-key file -client-ca file [-listen addr]
+	sivd -keyset file [-kek file] [-mac-key file] -insecure-plaintext [-listen addr]
+
+Clients must present a certificate signed by -client-ca (mutual TLS).
+-insecure-plaintext serves plain HTTP for a listener that is reachable only locally,
+for example a unix socket proxy or a loopback address inside a pod.
+
+Requests and responses are JSON, byte strings are base64 encoded:
+
+	POST /v1/seal    {"plaintext": "...", "aad": ["...", ...]}  -> {"ciphertext": "..."}
+	POST /v1/open    {"ciphertext": "...", "aad": ["...", ...]} -> {"plaintext": "..."}
+	POST /v1/mac     {"data": "..."}                           -> {"tag": "..."}
+	POST /v1/verify  {"data": "...", "tag": "..."}             -> {"valid": true}
+	GET  /v1/keyset                                            -> [{"id": 1, "status": "enabled", ...}]
+
+Key material is never returned. Failed opens answer 400 without details.
+*/
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/luc-lynx/siv/ct"
+	"github.com/luc-lynx/siv/keyset"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+var (
+	errNoKeyset   = errors.New("-keyset is required")
+	errNoTLS      = errors.New("-cert, -cert-key and -client-ca are required unless -insecure-plaintext is set")
+	errNoClientCA = errors.New("-client-ca doesn't contain any certificate")
+)
+
+type flags struct {
+	listen    string
+	keyset    string
+	kek       string
+	macKey    string
+	cert      string
+	certKey   string
+	clientCA  string
+	plaintext bool
+	maxBody   int64
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+func run(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("sivd", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var f flags
+	fs.StringVar(&f.listen, "listen", "localhost:8443", "address to listen on")
+	fs.StringVar(&f.keyset, "keyset", "", "keyset file")
+	fs.StringVar(&f.kek, "kek", "", "file with hex encoded key encrypting the keyset")
+	fs.StringVar(&f.macKey, "mac-key", "", "file with hex encoded AES-CMAC key, enables /v1/mac and /v1/verify")
+	fs.StringVar(&f.cert, "cert", "", "server certificate (PEM)")
+	fs.StringVar(&f.certKey, "cert-key", "", "server certificate key (PEM)")
+	fs.StringVar(&f.clientCA, "client-ca", "", "CA certificates clients must be signed by (PEM)")
+	fs.BoolVar(&f.plaintext, "insecure-plaintext", false, "serve plain HTTP without client authentication")
+	fs.Int64Var(&f.maxBody, "max-body", 1<<20, "maximum request body size in bytes")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	srv, err := newServerFromFlags(&f)
+	if err != nil {
+		fmt.Fprintln(stderr, "sivd:", err)
+		return 2
+	}
+
+	if err := serve(&f, srv); err != nil {
+		fmt.Fprintln(stderr, "sivd:", err)
+		return 1
+	}
+	return 0
+}
+
+func newServerFromFlags(f *flags) (*server, error) {
+	if f.keyset == "" {
+		return nil, errNoKeyset
+	}
+	if !f.plaintext && (f.cert == "" || f.certKey == "" || f.clientCA == "") {
+		return nil, errNoTLS
+	}
+
+	ks, err := loadKeyset(f.keyset, f.kek)
+	if err != nil {
+		return nil, err
+	}
+
+	var macKey []byte
+	if f.macKey != "" {
+		if macKey, err = readHexKey(f.macKey); err != nil {
+			return nil, err
+		}
+	}
+
+	return newServer(ks, macKey, f.maxBody)
+}
+
+func serve(f *flags, srv *server) error {
+	hs := &http.Server{
+		Addr:              f.listen,
+		Handler:           srv.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Minute,
+		WriteTimeout:      time.Minute,
+	}
+
+	if f.plaintext {
+		return hs.ListenAndServe()
+	}
+
+	config, err := tlsConfig(f.clientCA)
+	if err != nil {
+		return err
+	}
+	hs.TLSConfig = config
+	return hs.ListenAndServeTLS(f.cert, f.certKey)
+}
+
+/*
+tlsConfig requires clients to present a certificate signed by one of the CAs in the file
+*/
+func tlsConfig(clientCA string) (*tls.Config, error) {
+	data, err := os.ReadFile(clientCA)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errNoClientCA
+	}
+
+	return &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+		MinVersion: tls.VersionTLS13,
+	}, nil
+}
+
+func loadKeyset(name, kekName string) (*keyset.Keyset, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !keyset.IsEncrypted(data) {
+		return keyset.Parse(data)
+	}
+
+	if kekName == "" {
+		return nil, errors.New("keyset is encrypted, -kek is required")
+	}
+
+	key, err := readHexKey(kekName)
+	if err != nil {
+		return nil, err
+	}
+	kek, err := keyset.NewSIVKEK(key)
+	if err != nil {
+		return nil, err
+	}
+	return keyset.Decrypt(data, kek)
+}
+
+func readHexKey(name string) ([]byte, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(data)
+	return ct.DecodeHex(bytes.TrimSpace(data))
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/luc-lynx/siv/cmac"
+	"github.com/luc-lynx/siv/keyset"
+	"github.com/luc-lynx/siv/siv"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var macKey = bytes.Repeat([]byte{0x2b}, 16)
+
+func newTestServer(t *testing.T, macKey []byte) (*httptest.Server, *keyset.Keyset) {
+	ks, err := keyset.New(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := newServer(ks, macKey, 1<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(srv.handler())
+	t.Cleanup(ts.Close)
+	return ts, ks
+}
+
+func post(t *testing.T, ts *httptest.Server, path string, req, resp interface{}) int {
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := http.Post(ts.URL+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode == http.StatusOK && resp != nil {
+		if err := json.NewDecoder(r.Body).Decode(resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r.StatusCode
+}
+
+func TestSealOpen(t *testing.T) {
+	ts, ks := newTestServer(t, nil)
+	aad := [][]byte{[]byte("header")}
+
+	var sealed sealResponse
+	if code := post(t, ts, "/v1/seal", sealRequest{Plaintext: []byte("secret"), AAD: aad}, &sealed); code != http.StatusOK {
+		t.Fatal("seal failed with", code)
+	}
+
+	if plaintext, err := ks.Open(nil, sealed.Ciphertext, aad); err != nil || string(plaintext) != "secret" {
+		t.Fatal("the keyset can't open the sealed data", err)
+	}
+
+	var opened openResponse
+	if code := post(t, ts, "/v1/open", openRequest{Ciphertext: sealed.Ciphertext, AAD: aad}, &opened); code != http.StatusOK {
+		t.Fatal("open failed with", code)
+	}
+	if string(opened.Plaintext) != "secret" {
+		t.Errorf("opened %q", opened.Plaintext)
+	}
+
+	sealed.Ciphertext[len(sealed.Ciphertext)-1] ^= 1
+	if code := post(t, ts, "/v1/open", openRequest{Ciphertext: sealed.Ciphertext, AAD: aad}, nil); code != http.StatusBadRequest {
+		t.Error("modified ciphertext: expected 400, got", code)
+	}
+
+	if code := post(t, ts, "/v1/seal", map[string]string{"key": "x"}, nil); code != http.StatusBadRequest {
+		t.Error("unknown field: expected 400, got", code)
+	}
+
+	if code := post(t, ts, "/v1/seal", sealRequest{Plaintext: make([]byte, 2<<10)}, nil); code != http.StatusBadRequest {
+		t.Error("body over the limit: expected 400, got", code)
+	}
+
+	if code := post(t, ts, "/v1/seal", sealRequest{AAD: make([][]byte, siv.MaxAssociatedData+1)}, nil); code != http.StatusBadRequest {
+		t.Error("too many associated data strings: expected 400, got", code)
+	}
+}
+
+func TestMAC(t *testing.T) {
+	ts, _ := newTestServer(t, macKey)
+	data := []byte("manifest")
+
+	var tag macResponse
+	if code := post(t, ts, "/v1/mac", macRequest{Data: data}, &tag); code != http.StatusOK {
+		t.Fatal("mac failed with", code)
+	}
+	if !bytes.Equal(tag.Tag, cmac.Sum(macKey, data)) {
+		t.Fatalf("wrong tag %x", tag.Tag)
+	}
+
+	var verified verifyResponse
+	if code := post(t, ts, "/v1/verify", macRequest{Data: data, Tag: tag.Tag}, &verified); code != http.StatusOK || !verified.Valid {
+		t.Error("valid tag rejected", code)
+	}
+
+	tag.Tag[0] ^= 1
+	if code := post(t, ts, "/v1/verify", macRequest{Data: data, Tag: tag.Tag}, &verified); code != http.StatusOK || verified.Valid {
+		t.Error("modified tag accepted", code)
+	}
+
+	noMAC, _ := newTestServer(t, nil)
+	if code := post(t, noMAC, "/v1/mac", macRequest{Data: data}, nil); code != http.StatusNotFound {
+		t.Error("without a mac key: expected 404, got", code)
+	}
+
+	if _, err := newServer(nil, macKey[:5], 1); err == nil {
+		t.Error("invalid mac key accepted")
+	}
+}
+
+func TestKeysetListing(t *testing.T) {
+	ts, ks := newTestServer(t, nil)
+
+	r, err := http.Get(ts.URL + "/v1/keyset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+
+	var keys []keyInfo
+	if err := json.NewDecoder(r.Body).Decode(&keys); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 1 || keys[0].ID != ks.Primary || !keys[0].Primary || keys[0].Bits != 256 {
+		t.Errorf("unexpected listing %+v", keys)
+	}
+}
+
+func TestFlags(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := keyset.New(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ks.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ksFile := filepath.Join(dir, "keyset")
+	if err := os.WriteFile(ksFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	macFile := filepath.Join(dir, "mac")
+	if err := os.WriteFile(macFile, []byte(hex.EncodeToString(macKey)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newServerFromFlags(&flags{}); err != errNoKeyset {
+		t.Errorf("expected %v, got %v", errNoKeyset, err)
+	}
+	if _, err := newServerFromFlags(&flags{keyset: ksFile}); err != errNoTLS {
+		t.Errorf("expected %v, got %v", errNoTLS, err)
+	}
+
+	srv, err := newServerFromFlags(&flags{keyset: ksFile, macKey: macFile, plaintext: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srv.ks.Primary != ks.Primary || !bytes.Equal(srv.macKey, macKey) {
+		t.Error("keys weren't loaded")
+	}
+
+	if _, err := tlsConfig(macFile); err != errNoClientCA {
+		t.Errorf("expected %v, got %v", errNoClientCA, err)
+	}
+
+	var stderr strings.Builder
+	if code := run([]string{"-listen", "localhost:0"}, &stderr); code != 2 {
+		t.Error("missing keyset: expected exit code 2, got", code)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/luc-lynx/siv/cmac"
+	"github.com/luc-lynx/siv/keyset"
+	"github.com/luc-lynx/siv/siv"
+	"net/http"
+	"time"
+)
+
+var (
+	errOpenFailed = errors.New("open failed")
+	errNoMACKey   = errors.New("no mac key configured")
+)
+
+type server struct {
+	ks      *keyset.Keyset
+	macKey  []byte
+	maxBody int64
+}
+
+type sealRequest struct {
+	Plaintext []byte   `json:"plaintext"`
+	AAD       [][]byte `json:"aad"`
+}
+
+type sealResponse struct {
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type openRequest struct {
+	Ciphertext []byte   `json:"ciphertext"`
+	AAD        [][]byte `json:"aad"`
+}
+
+type openResponse struct {
+	Plaintext []byte `json:"plaintext"`
+}
+
+type macRequest struct {
+	Data []byte `json:"data"`
+	Tag  []byte `json:"tag,omitempty"`
+}
+
+type macResponse struct {
+	Tag []byte `json:"tag"`
+}
+
+type verifyResponse struct {
+	Valid bool `json:"valid"`
+}
+
+type keyInfo struct {
+	ID      uint32    `json:"id"`
+	Status  string    `json:"status"`
+	Created time.Time `json:"created"`
+	Bits    int       `json:"bits"`
+	Primary bool      `json:"primary"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+/*
+newServer checks the MAC key up front, so requests never fail on it
+*/
+func newServer(ks *keyset.Keyset, macKey []byte, maxBody int64) (*server, error) {
+	if macKey != nil {
+		if _, err := cmac.NewCmac(macKey); err != nil {
+			return nil, err
+		}
+	}
+	return &server{ks: ks, macKey: macKey, maxBody: maxBody}, nil
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/seal", s.seal)
+	mux.HandleFunc("POST /v1/open", s.open)
+	mux.HandleFunc("POST /v1/mac", s.mac)
+	mux.HandleFunc("POST /v1/verify", s.verify)
+	mux.HandleFunc("GET /v1/keyset", s.keyset)
+	return mux
+}
+
+func (s *server) seal(w http.ResponseWriter, r *http.Request) {
+	var req sealRequest
+	if !s.decode(w, r, &req) {
+		return
+	}
+
+	ciphertext, err := s.ks.Seal(nil, req.Plaintext, req.AAD)
+	if errors.Is(err, siv.ErrMalformed) {
+		// e.g. more associated data strings than S2V takes
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, sealResponse{Ciphertext: ciphertext})
+}
+
+func (s *server) open(w http.ResponseWriter, r *http.Request) {
+	var req openRequest
+	if !s.decode(w, r, &req) {
+		return
+	}
+
+	plaintext, err := s.ks.Open(nil, req.Ciphertext, req.AAD)
+	if err != nil {
+		// the reason (unknown key, disabled key, bad tag) is only in the keyset log and audit
+		writeError(w, http.StatusBadRequest, errOpenFailed)
+		return
+	}
+	writeJSON(w, openResponse{Plaintext: plaintext})
+}
+
+func (s *server) mac(w http.ResponseWriter, r *http.Request) {
+	var req macRequest
+	if !s.decodeMAC(w, r, &req) {
+		return
+	}
+	writeJSON(w, macResponse{Tag: cmac.Sum(s.macKey, req.Data)})
+}
+
+func (s *server) verify(w http.ResponseWriter, r *http.Request) {
+	var req macRequest
+	if !s.decodeMAC(w, r, &req) {
+		return
+	}
+
+	valid, err := cmac.VerifyReader(s.macKey, bytes.NewReader(req.Data), req.Tag)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, verifyResponse{Valid: valid})
+}
+
+func (s *server) keyset(w http.ResponseWriter, r *http.Request) {
+	keys := make([]keyInfo, 0, len(s.ks.Keys))
+	for _, k := range s.ks.Keys {
+		keys = append(keys, keyInfo{
+			ID:      k.ID,
+			Status:  k.Status,
+			Created: k.Created,
+			Bits:    len(k.Material) * 8,
+			Primary: k.ID == s.ks.Primary,
+		})
+	}
+	writeJSON(w, keys)
+}
+
+func (s *server) decodeMAC(w http.ResponseWriter, r *http.Request, req *macRequest) bool {
+	if s.macKey == nil {
+		writeError(w, http.StatusNotFound, errNoMACKey)
+		return false
+	}
+	return s.decode(w, r, req)
+}
+
+func (s *server) decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.maxBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,151 @@
+//go:build js && wasm
+
+/*
+Command sivwasm exposes the module to JavaScript when built for WebAssembly,
+so web frontends produce and read the same formats as Go backends.
+
+	GOOS=js GOARCH=wasm go build -o siv.wasm ./cmd/sivwasm
+
+After the module has been started with wasm_exec.js it defines globalThis.siv,
+every function takes and returns Uint8Arrays and returns a Promise:
+
+	siv.seal(key, plaintext, [aad, ...])         deterministic AES-SIV
+	siv.open(key, ciphertext, [aad, ...])
+	siv.sealRandom(key, plaintext, [aad, ...])   random nonce, see siv.SealRandom
+	siv.openRandom(key, ciphertext, [aad, ...])
+	siv.cmac(key, data)                          AES-CMAC tag
+
+Failed opens, invalid keys and too many associated data strings reject the Promise with an Error.
+Chunked operation over ReadableStream/WritableStream needs the streaming format,
+which the module doesn't have yet.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/luc-lynx/siv/cmac"
+	"github.com/luc-lynx/siv/siv"
+	"syscall/js"
+)
+
+var errArguments = errors.New("siv: expected (key, data, [aad...]) Uint8Arrays")
+
+type aead interface {
+	SealContext(ctx context.Context, plaintext []byte, additionalData [][]byte) ([]byte, error)
+	OpenWithMultipleAAD(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error)
+	SealRandom(dst, plaintext []byte, additionalData [][]byte) ([]byte, error)
+	OpenRandom(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error)
+}
+
+func main() {
+	api := js.Global().Get("Object").New()
+	api.Set("seal", sivFunc(func(a aead, data []byte, aad [][]byte) ([]byte, error) {
+		return a.SealContext(context.Background(), data, aad)
+	}))
+	api.Set("open", sivFunc(func(a aead, data []byte, aad [][]byte) ([]byte, error) {
+		return a.OpenWithMultipleAAD(nil, data, aad)
+	}))
+	api.Set("sealRandom", sivFunc(func(a aead, data []byte, aad [][]byte) ([]byte, error) {
+		return a.SealRandom(nil, data, aad)
+	}))
+	api.Set("openRandom", sivFunc(func(a aead, data []byte, aad [][]byte) ([]byte, error) {
+		return a.OpenRandom(nil, data, aad)
+	}))
+	api.Set("cmac", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return promise(func() ([]byte, error) {
+			key, data, _, err := arguments(args)
+			if err != nil {
+				return nil, err
+			}
+
+			h, err := cmac.NewCmac(key)
+			if err != nil {
+				return nil, err
+			}
+			h.Write(data)
+			return h.Sum(nil), nil
+		})
+	}))
+	js.Global().Set("siv", api)
+
+	// keep the functions alive
+	select {}
+}
+
+/*
+sivFunc wraps an AES-SIV operation taking (key, data, [aad...])
+*/
+func sivFunc(op func(a aead, data []byte, aad [][]byte) ([]byte, error)) js.Func {
+	return js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return promise(func() ([]byte, error) {
+			key, data, aad, err := arguments(args)
+			if err != nil {
+				return nil, err
+			}
+
+			a, err := siv.NewAesSIV(key)
+			if err != nil {
+				return nil, err
+			}
+			return op(a, data, aad)
+		})
+	})
+}
+
+func arguments(args []js.Value) (key, data []byte, aad [][]byte, err error) {
+	if len(args) < 2 {
+		return nil, nil, nil, errArguments
+	}
+
+	if key, err = bytesOf(args[0]); err != nil {
+		return nil, nil, nil, err
+	}
+	if data, err = bytesOf(args[1]); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if len(args) > 2 && !args[2].IsUndefined() {
+		if !args[2].InstanceOf(js.Global().Get("Array")) {
+			return nil, nil, nil, errArguments
+		}
+		for i := 0; i < args[2].Length(); i++ {
+			component, err := bytesOf(args[2].Index(i))
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			aad = append(aad, component)
+		}
+	}
+	return key, data, aad, nil
+}
+
+func bytesOf(v js.Value) ([]byte, error) {
+	if !v.InstanceOf(js.Global().Get("Uint8Array")) {
+		return nil, errArguments
+	}
+	b := make([]byte, v.Length())
+	js.CopyBytesToGo(b, v)
+	return b, nil
+}
+
+/*
+promise runs f and returns a Promise resolved with its result as a Uint8Array
+or rejected with an Error
+*/
+func promise(f func() ([]byte, error)) js.Value {
+	result, err := f()
+	executor := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if err != nil {
+			args[1].Invoke(js.Global().Get("Error").New(err.Error()))
+			return nil
+		}
+
+		out := js.Global().Get("Uint8Array").New(len(result))
+		js.CopyBytesToJS(out, result)
+		args[0].Invoke(out)
+		return nil
+	})
+	defer executor.Release()
+	return js.Global().Get("Promise").New(executor)
+}
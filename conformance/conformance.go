@@ -0,0 +1,226 @@
+/*
+Package conformance checks other implementations of AES-SIV (RFC 5297) and AES-CMAC
+(RFC 4493) against the known answers and the behaviour this module relies on, so code
+written elsewhere can prove in its own CI that it interoperates:
+
+	func TestConformance(t *testing.T) {
+		conformance.TestAEAD(t, func(key []byte) (conformance.AEAD, error) {
+			return mysiv.New(key)
+		})
+	}
+
+The checks are split in subtests named after the vector or the property, failures
+are reported with t.Errorf and the suites continue with the next subtest.
+*/
+package conformance
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+/*
+AEAD is deterministic AES-SIV with a vector of associated data strings, the first
+string of the vector is the first S2V input. Open must return an error for every
+ciphertext that doesn't authenticate and must not modify its arguments.
+*/
+type AEAD interface {
+	SealWithMultipleAAD(dst, plaintext []byte, additionalData [][]byte) []byte
+	OpenWithMultipleAAD(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error)
+}
+
+/*
+RandomAEAD adds the probabilistic format of siv SealRandom:
+
+	random (16 bytes) || V || C
+
+where the random value is the last associated data string
+*/
+type RandomAEAD interface {
+	AEAD
+	SealRandom(dst, plaintext []byte, additionalData [][]byte) ([]byte, error)
+	OpenRandom(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error)
+}
+
+const (
+	tagSize    = 16
+	randomSize = 16
+)
+
+/*
+TestAEAD runs the known answers for all key sizes and checks that every change of
+the ciphertext or of the associated data vector is rejected
+*/
+func TestAEAD(t *testing.T, newAEAD func(key []byte) (AEAD, error)) {
+	for _, v := range sivVectors {
+		t.Run(v.name, func(t *testing.T) {
+			key, aad, plaintext, ciphertext := decodeVector(v.key, v.aad, v.plaintext, v.ciphertext)
+			a, err := newAEAD(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := a.SealWithMultipleAAD(nil, plaintext, aad); !bytes.Equal(got, ciphertext) {
+				t.Errorf("seal: got %x, want %x", got, ciphertext)
+			}
+			if got, err := a.OpenWithMultipleAAD(nil, ciphertext, aad); err != nil || !bytes.Equal(got, plaintext) {
+				t.Errorf("open: got %x, %v", got, err)
+			}
+
+			for i := range ciphertext {
+				modified := bytes.Clone(ciphertext)
+				modified[i] ^= 0x80
+				if _, err := a.OpenWithMultipleAAD(nil, modified, aad); err == nil {
+					t.Errorf("ciphertext modified at byte %d accepted", i)
+				}
+			}
+			for n := 0; n < len(ciphertext); n++ {
+				if _, err := a.OpenWithMultipleAAD(nil, ciphertext[:n], aad); err == nil {
+					t.Errorf("ciphertext truncated to %d bytes accepted", n)
+				}
+			}
+		})
+	}
+
+	t.Run("associated data vector", func(t *testing.T) {
+		v := sivVectors[1]
+		key, aad, plaintext, ciphertext := decodeVector(v.key, v.aad, v.plaintext, v.ciphertext)
+		a, err := newAEAD(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		changed := map[string][][]byte{
+			"swapped strings":          {aad[1], aad[0], aad[2]},
+			"missing string":           aad[:2],
+			"extra empty string":       append(cloneVector(aad), []byte{}),
+			"strings joined":           {append(bytes.Clone(aad[0]), aad[1]...), aad[2]},
+			"boundary moved":           {aad[0][:len(aad[0])-1], append(bytes.Clone(aad[0][len(aad[0])-1:]), aad[1]...), aad[2]},
+			"plaintext as last string": append(cloneVector(aad), plaintext),
+		}
+		for name, other := range changed {
+			if _, err := a.OpenWithMultipleAAD(nil, ciphertext, other); err == nil {
+				t.Errorf("%s: accepted", name)
+			}
+		}
+
+		before := cloneVector(aad)
+		a.SealWithMultipleAAD(nil, plaintext, aad)
+		a.OpenWithMultipleAAD(nil, ciphertext, aad)
+		for i := range aad {
+			if !bytes.Equal(aad[i], before[i]) {
+				t.Errorf("associated data string %d modified", i)
+			}
+		}
+	})
+
+	t.Run("dst prefix", func(t *testing.T) {
+		v := sivVectors[0]
+		key, aad, plaintext, ciphertext := decodeVector(v.key, v.aad, v.plaintext, v.ciphertext)
+		a, err := newAEAD(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		prefix := []byte("prefix")
+		if got := a.SealWithMultipleAAD(bytes.Clone(prefix), plaintext, aad); !bytes.Equal(got, append(bytes.Clone(prefix), ciphertext...)) {
+			t.Errorf("seal didn't append to dst: %x", got)
+		}
+		if got, err := a.OpenWithMultipleAAD(bytes.Clone(prefix), ciphertext, aad); err != nil || !bytes.Equal(got, append(bytes.Clone(prefix), plaintext...)) {
+			t.Errorf("open didn't append to dst: %x, %v", got, err)
+		}
+	})
+}
+
+/*
+TestRandomAEAD checks the probabilistic format: the output is randomized and is
+deterministic AES-SIV with the random value as the last associated data string
+*/
+func TestRandomAEAD(t *testing.T, newAEAD func(key []byte) (RandomAEAD, error)) {
+	v := sivVectors[1]
+	key, aad, plaintext, _ := decodeVector(v.key, v.aad, v.plaintext, v.ciphertext)
+	a, err := newAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct1, err := a.SealRandom(nil, plaintext, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct2, err := a.SealRandom(nil, plaintext, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("randomized", func(t *testing.T) {
+		if bytes.Equal(ct1, ct2) {
+			t.Error("equal plaintexts produced equal ciphertexts")
+		}
+		if len(ct1) != randomSize+tagSize+len(plaintext) {
+			t.Errorf("ciphertext is %d bytes, want %d", len(ct1), randomSize+tagSize+len(plaintext))
+		}
+	})
+
+	t.Run("format", func(t *testing.T) {
+		withRandom := append(cloneVector(aad), ct1[:randomSize])
+		if got := a.SealWithMultipleAAD(nil, plaintext, withRandom); !bytes.Equal(got, ct1[randomSize:]) {
+			t.Error("random value isn't the last associated data string")
+		}
+		if got, err := a.OpenRandom(nil, ct1, aad); err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("open: got %x, %v", got, err)
+		}
+	})
+
+	t.Run("modified random value", func(t *testing.T) {
+		modified := bytes.Clone(ct1)
+		modified[0] ^= 1
+		if _, err := a.OpenRandom(nil, modified, aad); err == nil {
+			t.Error("accepted")
+		}
+		if _, err := a.OpenRandom(nil, ct1[:randomSize], aad); err == nil {
+			t.Error("random value alone accepted")
+		}
+	})
+}
+
+/*
+TestCMAC runs the RFC 4493 examples
+*/
+func TestCMAC(t *testing.T, sum func(key, message []byte) ([]byte, error)) {
+	key, _ := hex.DecodeString(cmacKey)
+	for _, v := range cmacVectors {
+		t.Run(v.name, func(t *testing.T) {
+			message, _ := hex.DecodeString(v.message)
+			tag, _ := hex.DecodeString(v.tag)
+			if got, err := sum(key, message); err != nil || !bytes.Equal(got, tag) {
+				t.Errorf("got %x, %v, want %x", got, err, tag)
+			}
+		})
+	}
+}
+
+func decodeVector(key string, aad []string, plaintext, ciphertext string) ([]byte, [][]byte, []byte, []byte) {
+	k, _ := hex.DecodeString(key)
+	p, _ := hex.DecodeString(plaintext)
+	c, _ := hex.DecodeString(ciphertext)
+
+	var a [][]byte
+	for _, s := range aad {
+		d, _ := hex.DecodeString(s)
+		a = append(a, d)
+	}
+	return k, a, p, c
+}
+
+/*
+cloneVector copies the vector and its strings
+*/
+func cloneVector(v [][]byte) [][]byte {
+	c := make([][]byte, len(v))
+	for i := range v {
+		c[i] = bytes.Clone(v[i])
+	}
+	return c
+}
@@ -0,0 +1,25 @@
+package conformance
+
+import (
+	"github.com/luc-lynx/siv/cmac"
+	"github.com/luc-lynx/siv/siv"
+	"testing"
+)
+
+func TestSIV(t *testing.T) {
+	TestAEAD(t, func(key []byte) (AEAD, error) {
+		return siv.NewAesSIV(key)
+	})
+}
+
+func TestSIVRandom(t *testing.T) {
+	TestRandomAEAD(t, func(key []byte) (RandomAEAD, error) {
+		return siv.NewAesSIV(key)
+	})
+}
+
+func TestAESCMAC(t *testing.T) {
+	TestCMAC(t, func(key, message []byte) ([]byte, error) {
+		return cmac.Sum(key, message), nil
+	})
+}
@@ -0,0 +1,153 @@
+package conformance
+
+/*
+Known answers of AES-SIV. The first two are RFC 5297 appendix A, the nonce of A.2
+is the last associated data string. The others were produced by this module and
+cover what the RFC examples don't: no associated data, empty strings, more strings,
+all key sizes, an empty plaintext and plaintexts around the block size.
+*/
+var sivVectors = []struct {
+	name       string
+	key        string
+	aad        []string
+	plaintext  string
+	ciphertext string
+}{
+	{
+		name:       "RFC 5297 A.1",
+		key:        "fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff",
+		aad:        []string{"101112131415161718191a1b1c1d1e1f2021222324252627"},
+		plaintext:  "112233445566778899aabbccddee",
+		ciphertext: "85632d07c6e8f37f950acd320a2ecc9340c02b9690c4dc04daef7f6afe5c",
+	},
+	{
+		name: "RFC 5297 A.2",
+		key:  "7f7e7d7c7b7a79787776757473727170404142434445464748494a4b4c4d4e4f",
+		aad: []string{
+			"00112233445566778899aabbccddeeffdeaddadadeaddadaffeeddccbbaa99887766554433221100",
+			"102030405060708090a0",
+			"09f911029d74e35bd84156c5635688c0",
+		},
+		plaintext: "7468697320697320736f6d6520706c61696e7465787420746f20656e6372797074207573696e67205349562d414553",
+		ciphertext: "7bdb6e3b432667eb06f4d14bff2fbd0fcb900f2fddbe404326601965c889bf17" +
+			"dba77ceb094fa663b7a3f748ba8af829ea64ad544a272e9c485b62a3fd5c0d",
+	},
+	{
+		name: "no associated data",
+		key:  "a7c7d60589fe2fd7cfe848caad435ac5efe7893cd4d088fdd2395065f63a2a97",
+		aad:  nil,
+		plaintext: "706c61696e7465787420776974686f7574206173736f63696174656420646174" +
+			"61",
+		ciphertext: "6aa9f3de00f4290369b7ff128b430881b905c341dd6f1dfff40effd4df1ca832" +
+			"a7feb99ede0ca3e07d49d21ffb706e8239",
+	},
+	{
+		name: "empty associated data strings",
+		key:  "bdac1ecff737d04aa9eb8e5d1cf655b4667609649a4d4520a41020eeb0188b74",
+		aad: []string{
+			"",
+			"",
+			"78",
+		},
+		plaintext: "746872656520737472696e67732c2074776f206f66207468656d20656d707479",
+		ciphertext: "b4d52415fefd05591f40c87d78a29c0248596a30924b455ec54ff91bc408b574" +
+			"7ada12a2794b4cb89a8bb0fcd21a306c",
+	},
+	{
+		name: "many associated data strings",
+		key: "9fe2617083032b389a8288c650bff3fee30385d0d19384bb2c69c5158ef24454" +
+			"70144ec4fcb278c8243f9dae3ba4d5ae",
+		aad: []string{
+			"61",
+			"6262",
+			"63636363636363636363636363636363",
+			"6464646464646464646464646464646464",
+			"6565656565656565656565656565656565656565656565656565656565656565" +
+				"6565656565656565656565656565656565656565656565656565656565656565",
+		},
+		plaintext:  "6669766520737472696e6773",
+		ciphertext: "676b4cb8f2c9b67b54dcb2ecc3f346950559ca1786b3af7df8e97383",
+	},
+	{
+		name:       "empty plaintext",
+		key:        "0dba4541f76e54476179f33ed2dea17242bb7b187fbe0d89b85b655602c16eae",
+		aad:        []string{"686561646572"},
+		plaintext:  "",
+		ciphertext: "0a6a7c0e5e315e5c778a55d4156ec9a0",
+	},
+	{
+		name: "one byte plaintext",
+		key:  "af0d7bb533e8a798357da7e22b5ef5d857f619c10c5e2cf6e22e16860d8fc365",
+		aad: []string{
+			"686561646572",
+		},
+		plaintext:  "70",
+		ciphertext: "8d73824cd45d4189518d470b92fe6c14a0",
+	},
+	{
+		name: "block sized plaintext",
+		key: "27c823851ffb115065070e40650a384663a50c2aa10d7da1bc9b19d8095be540" +
+			"8d9b35b2dac983a6f1a57c3681b3d36a01cc1333eeff0bd079dd2e2dbd70b5f9",
+		aad: []string{
+			"686561646572",
+		},
+		plaintext:  "62626262626262626262626262626262",
+		ciphertext: "ad776c5ab06bed66039e205ba1fd07b0a09cedfa017726da4d679d43ac16c1b1",
+	},
+	{
+		name: "block and a byte plaintext",
+		key: "15f7155033a4281f9f56c061a12cf5e5e9654bedf38f4acb6f002136820bc72c" +
+			"2edbf3243bdd52ec67d58685772f7e4d921610fcd3bdb9198ef22c857532b1ff",
+		aad: []string{
+			"686561646572",
+		},
+		plaintext: "6262626262626262626262626262626262",
+		ciphertext: "90332c9505494a3240b13e29156cc26e555bdb101fa9b2a21b35fd2963528b8a" +
+			"69",
+	},
+	{
+		name: "long plaintext",
+		key: "1a82f8723bb9c67633d243861a5e967ea8496e1a4497722c9b9a416471aed33f" +
+			"6c8e67c4df030053b6d2e417d054cea8",
+		aad: []string{
+			"686561646572",
+			"6e6f6e6365",
+		},
+		plaintext: "3031323334353637383961626364656630313233343536373839616263646566" +
+			"3031323334353637383961626364656630313233343536373839616263646566" +
+			"3031323334353637383961626364656630313233343536373839616263646566" +
+			"3031323334353637383961626364656630313233343536373839616263646566" +
+			"303132333435363738396162636465667461696c",
+		ciphertext: "c77af47b5c7d781a9901c326957c8b9712a49491592f05433ddb40ec8cdab97a" +
+			"9715cf7da60878d08717da535e49316ebc77a6e9f495ab5c871ffe9771bd87ca" +
+			"7d1747f1111a63adf04cd805a03fdece676da5d08e8e1c05f6becbda8f8bcbbe" +
+			"c15945d654c0872f6f33e99287939bc3a0cbd8dd6a0ff022c5f50c84a5abdcc2" +
+			"de2ea2fabac03bbaef4f7816b64400e252d0d9302446b98cd66810194940de02" +
+			"fd9711d5",
+	},
+}
+
+/*
+Known answers of AES-CMAC from RFC 4493 section 4, all with the same key
+*/
+const cmacKey = "2b7e151628aed2a6abf7158809cf4f3c"
+
+var cmacVectors = []struct {
+	name    string
+	message string
+	tag     string
+}{
+	{"RFC 4493 example 1", "", "bb1d6929e95937287fa37d129b756746"},
+	{"RFC 4493 example 2", "6bc1bee22e409f96e93d7e117393172a", "070a16b46b4d4144f79bdd9dd04a287c"},
+	{
+		"RFC 4493 example 3",
+		"6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411",
+		"dfa66747de9ae63030ca32611497c827",
+	},
+	{
+		"RFC 4493 example 4",
+		"6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51" +
+			"30c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710",
+		"51f0bebf7e3b9d92fc49741779363cfe",
+	},
+}
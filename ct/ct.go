@@ -0,0 +1,68 @@
+/*
+Package ct contains constant-time helpers for building protocols on top of
+siv and cmac. None of the functions branches on or indexes memory by the
+contents of its arguments, only lengths may leak.
+*/
+package ct
+
+import "crypto/subtle"
+
+const BlockSize = 16
+
+const (
+	doubleInvalidParameters = "ct: Double needs 16 byte blocks"
+	copyInvalidParameters   = "ct: Copy needs slices of equal length"
+	rb                      = 0x87
+)
+
+/*
+XOR sets dst[i] = x[i] ^ y[i] for i < n = min(len(x), len(y)) and returns n.
+dst must be at least n bytes long and may alias x or y exactly.
+*/
+func XOR(dst, x, y []byte) int {
+	return subtle.XORBytes(dst, x, y)
+}
+
+/*
+Equal reports whether x and y have the same contents. The time depends on the
+lengths only, the lengths themselves aren't secret.
+*/
+func Equal(x, y []byte) bool {
+	return subtle.ConstantTimeCompare(x, y) == 1
+}
+
+/*
+Copy copies src into dst if v is 1 and leaves dst unchanged if v is 0,
+any other v is a programming error. dst and src must have the same length.
+*/
+func Copy(v int, dst, src []byte) {
+	if len(dst) != len(src) {
+		panic(copyInvalidParameters)
+	}
+	subtle.ConstantTimeCopy(v, dst, src)
+}
+
+/*
+Select returns 1 if x is non-zero and 0 otherwise, to be used as v of Copy
+*/
+func Select(x byte) int {
+	return 1 ^ subtle.ConstantTimeByteEq(x, 0)
+}
+
+/*
+Double multiplies a block by x in GF(2^128) with the polynomial
+x^128 + x^7 + x^2 + x + 1, the dbl operation of CMAC subkeys and S2V
+(https://tools.ietf.org/html/rfc5297#section-2.3). dst may alias src.
+*/
+func Double(dst, src []byte) {
+	if len(dst) != BlockSize || len(src) != BlockSize {
+		panic(doubleInvalidParameters)
+	}
+
+	// 0xff if the most significant bit is set, 0x00 otherwise
+	carry := -(src[0] >> 7)
+	for i := 0; i < BlockSize-1; i++ {
+		dst[i] = src[i]<<1 | src[i+1]>>7
+	}
+	dst[BlockSize-1] = src[BlockSize-1]<<1 ^ rb&carry
+}
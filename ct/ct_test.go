@@ -0,0 +1,119 @@
+package ct
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestCT(t *testing.T) {
+	t.Run("xor", testXOR)
+	t.Run("equal", testEqual)
+	t.Run("conditional copy", testCopy)
+	t.Run("double", testDouble)
+}
+
+func testXOR(t *testing.T) {
+	dst := make([]byte, 4)
+	n := XOR(dst, []byte{0xff, 0x0f, 0x01}, []byte{0x0f, 0x0f, 0x01, 0x77})
+	if n != 3 || !bytes.Equal(dst, []byte{0xf0, 0x00, 0x00, 0x00}) {
+		t.Errorf("got %d, %x", n, dst)
+	}
+}
+
+func testEqual(t *testing.T) {
+	if !Equal([]byte("tag"), []byte("tag")) || Equal([]byte("tag"), []byte("taG")) || Equal([]byte("tag"), []byte("ta")) {
+		t.Error("wrong comparison result")
+	}
+}
+
+func testCopy(t *testing.T) {
+	dst := []byte{1, 2, 3}
+	Copy(Select(0), dst, []byte{7, 8, 9})
+	if !bytes.Equal(dst, []byte{1, 2, 3}) {
+		t.Errorf("copied with v = 0: %v", dst)
+	}
+
+	Copy(Select(0x80), dst, []byte{7, 8, 9})
+	if !bytes.Equal(dst, []byte{7, 8, 9}) {
+		t.Errorf("didn't copy with v = 1: %v", dst)
+	}
+}
+
+/*
+Values from https://tools.ietf.org/html/rfc5297#appendix-A.1
+*/
+func testDouble(t *testing.T) {
+	cases := []struct{ in, out string }{
+		{"0e04dfafc1efbf040140582859bf073a", "1c09bf5f83df7e080280b050b37e0e74"},
+		{"edf09de876c642ee4d78bce4ceedfc4f", "dbe13bd0ed8c85dc9af179c99ddbf819"},
+	}
+
+	for _, c := range cases {
+		in, _ := hex.DecodeString(c.in)
+		out, _ := hex.DecodeString(c.out)
+
+		dst := make([]byte, BlockSize)
+		Double(dst, in)
+		if !bytes.Equal(dst, out) {
+			t.Errorf("dbl(%s) = %x", c.in, dst)
+		}
+
+		// in place
+		Double(in, in)
+		if !bytes.Equal(in, out) {
+			t.Errorf("in place dbl(%s) = %x", c.in, in)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	t.Run("hex", testDecodeHex)
+	t.Run("base64", testDecodeBase64)
+}
+
+func testDecodeHex(t *testing.T) {
+	for n := 0; n < 70; n++ {
+		key := make([]byte, n)
+		rand.Read(key)
+
+		for _, encoded := range []string{hex.EncodeToString(key), strings.ToUpper(hex.EncodeToString(key))} {
+			decoded, err := DecodeHex([]byte(encoded))
+			if err != nil || !bytes.Equal(decoded, key) {
+				t.Fatalf("%s: got %x, %v", encoded, decoded, err)
+			}
+		}
+	}
+
+	for _, invalid := range []string{"0", "0g", "zz", "0x00", "00 0", "@0", "`0", "G0", "/0", ":0"} {
+		if _, err := DecodeHex([]byte(invalid)); err != errInvalidHex {
+			t.Errorf("%q accepted", invalid)
+		}
+	}
+}
+
+func testDecodeBase64(t *testing.T) {
+	for n := 0; n < 70; n++ {
+		key := make([]byte, n)
+		rand.Read(key)
+
+		encoded := base64.StdEncoding.EncodeToString(key)
+		decoded, err := DecodeBase64([]byte(encoded))
+		if err != nil || !bytes.Equal(decoded, key) {
+			t.Fatalf("%s: got %x, %v", encoded, decoded, err)
+		}
+	}
+
+	for _, invalid := range []string{"A", "AAA", "AA=A", "AB==", "AAB=", "AA-_", "AA\nA", "===="} {
+		_, err := DecodeBase64([]byte(invalid))
+		if _, stdErr := base64.StdEncoding.Strict().DecodeString(invalid); stdErr == nil {
+			t.Fatalf("%q is valid base64", invalid)
+		}
+		if err != errInvalidBase64 {
+			t.Errorf("%q accepted", invalid)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package ct
+
+import "errors"
+
+/*
+Key decoding. encoding/hex and encoding/base64 use lookup tables indexed by
+the input and return at the first invalid character, so the timing depends
+on the key. DecodeHex and DecodeBase64 compute every value arithmetically,
+look at every character and report errors only at the end. The output is
+wiped on error.
+*/
+
+var (
+	errInvalidHex    = errors.New("ct: invalid hex key")
+	errInvalidBase64 = errors.New("ct: invalid base64 key")
+)
+
+/*
+inRange returns 0xff if lo <= c <= hi and 0x00 otherwise
+*/
+func inRange(c byte, lo, hi int32) byte {
+	x := int32(c)
+	return ^byte(((x - lo) | (hi - x)) >> 31)
+}
+
+func hexValue(c byte) (value, valid byte) {
+	digit := inRange(c, '0', '9')
+	lower := inRange(c, 'a', 'f')
+	upper := inRange(c, 'A', 'F')
+
+	value = (c-'0')&digit | (c-'a'+10)&lower | (c-'A'+10)&upper
+	return value, digit | lower | upper
+}
+
+/*
+DecodeHex decodes hex with lower or upper case digits
+*/
+func DecodeHex(src []byte) ([]byte, error) {
+	if len(src)%2 != 0 {
+		return nil, errInvalidHex
+	}
+
+	dst := make([]byte, len(src)/2)
+	valid := byte(0xff)
+	for i := range dst {
+		hi, hiValid := hexValue(src[2*i])
+		lo, loValid := hexValue(src[2*i+1])
+		dst[i] = hi<<4 | lo
+		valid &= hiValid & loValid
+	}
+
+	if valid != 0xff {
+		clear(dst)
+		return nil, errInvalidHex
+	}
+	return dst, nil
+}
+
+func base64Value(c byte) (value, valid byte) {
+	upper := inRange(c, 'A', 'Z')
+	lower := inRange(c, 'a', 'z')
+	digit := inRange(c, '0', '9')
+	plus := inRange(c, '+', '+')
+	slash := inRange(c, '/', '/')
+
+	value = (c-'A')&upper | (c-'a'+26)&lower | (c-'0'+52)&digit | 62&plus | 63&slash
+	return value, upper | lower | digit | plus | slash
+}
+
+/*
+DecodeBase64 decodes the padded standard encoding of RFC 4648, the one used
+for []byte by encoding/json. Only the padding, which depends on the public
+length, is handled with branches.
+*/
+func DecodeBase64(src []byte) ([]byte, error) {
+	if len(src)%4 != 0 {
+		return nil, errInvalidBase64
+	}
+
+	padding := 0
+	if len(src) > 0 && src[len(src)-1] == '=' {
+		padding++
+		if src[len(src)-2] == '=' {
+			padding++
+		}
+	}
+
+	data := src[:len(src)-padding]
+	dst := make([]byte, len(data)*6/8)
+	valid := byte(0xff)
+
+	var acc uint32
+	bits := 0
+	n := 0
+	for _, c := range data {
+		v, ok := base64Value(c)
+		valid &= ok
+		acc = acc<<6 | uint32(v)
+		bits += 6
+		if bits >= 8 {
+			bits -= 8
+			dst[n] = byte(acc >> bits)
+			n++
+		}
+	}
+
+	// the bits left over by the padding must be zero, as in base64.StdEncoding.Strict()
+	valid &= inRange(byte(acc&(1<<bits-1)), 0, 0)
+	acc = 0
+
+	if valid != 0xff {
+		clear(dst)
+		return nil, errInvalidBase64
+	}
+	return dst, nil
+}
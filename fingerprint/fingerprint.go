@@ -0,0 +1,98 @@
+/*
+Package fingerprint computes keyed content digests for deduplication and change
+detection. Unlike a plain hash, a fingerprint can't be recomputed without the key,
+so whoever sees the fingerprints can't confirm a guess of the content (a
+confirmation attack on a known document or a low-entropy file).
+
+	fingerprint = AES-CMAC(K, "siv fingerprint" || 0x00 || content)
+	chunk i     = AES-CMAC(K, "siv fingerprint chunk" || 0x00 || chunk i)
+
+Chunk fingerprints don't depend on the position, equal chunks of different
+objects deduplicate. The output is 128 bits; CMAC is a PRF, not a collision
+resistant hash, so holders of the key can make two contents collide on purpose.
+Use a key dedicated to fingerprinting.
+*/
+package fingerprint
+
+import (
+	"errors"
+	"github.com/luc-lynx/siv/cmac"
+	"hash"
+	"io"
+)
+
+const Size = 16
+
+var (
+	labelObject = []byte("siv fingerprint\x00")
+	labelChunk  = []byte("siv fingerprint chunk\x00")
+
+	errChunkSize = errors.New("fingerprint: chunk size must be positive")
+)
+
+type Fingerprinter struct {
+	key []byte
+}
+
+/*
+New takes an AES-CMAC key of 16, 24 or 32 bytes
+*/
+func New(key []byte) (*Fingerprinter, error) {
+	if _, err := cmac.NewCmac(key); err != nil {
+		return nil, err
+	}
+	return &Fingerprinter{key: append([]byte{}, key...)}, nil
+}
+
+func (f *Fingerprinter) Sum(data []byte) []byte {
+	mac := f.newMAC(labelObject)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+/*
+Reader fingerprints everything r returns, Reader and Sum of the same content agree
+*/
+func (f *Fingerprinter) Reader(r io.Reader) ([]byte, error) {
+	mac := f.newMAC(labelObject)
+	if _, err := io.Copy(mac, r); err != nil {
+		return nil, err
+	}
+	return mac.Sum(nil), nil
+}
+
+/*
+Chunks splits the content read from r into chunks of chunkSize bytes, the last one
+can be shorter, and returns the fingerprint of every chunk. Empty content has no chunks.
+*/
+func (f *Fingerprinter) Chunks(r io.Reader, chunkSize int) ([][]byte, error) {
+	if chunkSize <= 0 {
+		return nil, errChunkSize
+	}
+
+	var result [][]byte
+	chunk := make([]byte, chunkSize)
+	mac := f.newMAC(nil)
+	for {
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 {
+			mac.Reset()
+			mac.Write(labelChunk)
+			mac.Write(chunk[:n])
+			result = append(result, mac.Sum(nil))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (f *Fingerprinter) newMAC(label []byte) hash.Hash {
+	// the key has been checked by New
+	mac, _ := cmac.NewCmac(f.key)
+	mac.Write(label)
+	return mac
+}
@@ -0,0 +1,73 @@
+package fingerprint
+
+import (
+	"bytes"
+	"github.com/luc-lynx/siv/cmac"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+var key = bytes.Repeat([]byte{0x2b}, 16)
+
+func TestFingerprint(t *testing.T) {
+	f, err := New(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte(strings.Repeat("content ", 100))
+	sum := f.Sum(data)
+	if len(sum) != Size || bytes.Equal(sum, cmac.Sum(key, data)) {
+		t.Error("fingerprint isn't domain separated from a plain CMAC")
+	}
+
+	fromReader, err := f.Reader(iotest.OneByteReader(bytes.NewReader(data)))
+	if err != nil || !bytes.Equal(sum, fromReader) {
+		t.Error("Reader and Sum disagree", err)
+	}
+
+	other, _ := New(bytes.Repeat([]byte{0x2c}, 16))
+	if bytes.Equal(sum, other.Sum(data)) {
+		t.Error("fingerprint doesn't depend on the key")
+	}
+
+	if _, err := f.Reader(iotest.ErrReader(iotest.ErrTimeout)); err != iotest.ErrTimeout {
+		t.Errorf("expected %v, got %v", iotest.ErrTimeout, err)
+	}
+	if _, err := New(key[:3]); err == nil {
+		t.Error("invalid key accepted")
+	}
+}
+
+func TestChunks(t *testing.T) {
+	f, err := New(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := f.Chunks(strings.NewReader("aaaabbbbaaaacc"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 4 || !bytes.Equal(a[0], a[2]) || bytes.Equal(a[0], a[1]) {
+		t.Fatal("equal chunks must have equal fingerprints and only those")
+	}
+
+	// position independent, so a shifted object shares its aligned chunks
+	b, _ := f.Chunks(strings.NewReader("bbbbaaaa"), 4)
+	if !bytes.Equal(a[1], b[0]) || !bytes.Equal(a[2], b[1]) {
+		t.Error("chunk fingerprints depend on the position")
+	}
+
+	if bytes.Equal(f.Sum([]byte("aaaa")), a[0]) {
+		t.Error("chunk and object fingerprints aren't separated")
+	}
+
+	if empty, err := f.Chunks(strings.NewReader(""), 4); err != nil || len(empty) != 0 {
+		t.Error("empty content has chunks", err)
+	}
+	if _, err := f.Chunks(strings.NewReader("x"), 0); err != errChunkSize {
+		t.Errorf("expected %v, got %v", errChunkSize, err)
+	}
+}
@@ -0,0 +1,53 @@
+package gcmsiv
+
+import "github.com/luc-lynx/siv/siv"
+
+/*
+Deterministic AES-GCM-SIV for siv.DAEAD: every message is sealed with the all-zero
+nonce, which is the nonce misuse RFC 8452 is designed to survive. Equal messages
+give equal ciphertexts and nothing else leaks, as for AES-SIV. GCM-SIV takes one
+associated data string, SealDeterministic panics with more and OpenDeterministic
+fails with siv.ErrMalformed.
+*/
+
+const tooManyAAD = "gcmsiv: AES-GCM-SIV takes at most one associated data string"
+
+var errTooManyAAD = siv.NewError(siv.ErrMalformed, tooManyAAD)
+
+type deterministic struct {
+	aead  *gcmsiv
+	nonce [NonceSize]byte
+}
+
+/*
+NewDeterministic returns AES-GCM-SIV with a fixed nonce as a deterministic AEAD,
+the key is the same as for New
+*/
+func NewDeterministic(key []byte) (siv.DAEAD, error) {
+	aead, err := New(key)
+	if err != nil {
+		return nil, err
+	}
+	return &deterministic{aead: aead.(*gcmsiv)}, nil
+}
+
+func (d *deterministic) SealDeterministic(dst, plaintext []byte, additionalData ...[]byte) []byte {
+	if len(additionalData) > 1 {
+		panic(tooManyAAD)
+	}
+	return d.aead.Seal(dst, d.nonce[:], plaintext, single(additionalData))
+}
+
+func (d *deterministic) OpenDeterministic(dst, ciphertext []byte, additionalData ...[]byte) ([]byte, error) {
+	if len(additionalData) > 1 {
+		return nil, errTooManyAAD
+	}
+	return d.aead.Open(dst, d.nonce[:], ciphertext, single(additionalData))
+}
+
+func single(additionalData [][]byte) []byte {
+	if len(additionalData) == 0 {
+		return nil
+	}
+	return additionalData[0]
+}
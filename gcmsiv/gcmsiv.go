@@ -0,0 +1,236 @@
+/*
+Package gcmsiv implements AES-GCM-SIV from RFC 8452, a nonce misuse-resistant AEAD
+with 96-bit nonces. Like AES-SIV the tag is a PRF of the whole message and is the
+IV of CTR, so repeating a nonce only reveals whether two messages are equal. The
+PRF is POLYVAL, a polynomial hash that is much faster than CMAC where carry-less
+multiplication is done in hardware. POLYVAL of the polyval package is portable Go
+and constant time, which makes it slower than AES-SIV on AES-NI machines for now:
+CMAC and CTR of AES-SIV run on the assembly AES of the standard library.
+
+For every nonce the key-generating key derives a fresh authentication key and
+encryption key:
+
+	block i        = AES(K, i (4 bytes, little endian) || nonce)
+	auth key       = first 8 bytes of blocks 0, 1
+	encryption key = first 8 bytes of blocks 2, 3 (and 4, 5 for AES-256)
+	S              = POLYVAL(auth key, AAD padded || P padded || bitlen(AAD) || bitlen(P))
+	tag            = AES(encryption key, (S xor nonce) with the top bit cleared)
+	C              = AES-CTR(encryption key, tag with the top bit set, P) || tag
+
+The counter is the first 32 bits of the block, little endian, and wraps around.
+*/
+package gcmsiv
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"github.com/luc-lynx/siv/internal/common"
+	"github.com/luc-lynx/siv/polyval"
+	"github.com/luc-lynx/siv/siv"
+)
+
+const (
+	// KeySize128 and KeySize256 are the key sizes of AEAD_AES_128_GCM_SIV and AEAD_AES_256_GCM_SIV
+	KeySize128 = 16
+	KeySize256 = 32
+
+	NonceSize = 12
+	TagSize   = 16
+
+	blockSize = 16
+
+	// RFC 8452 section 6: both the plaintext and the associated data are at most 2^36 bytes
+	maxInput = 1 << 36
+)
+
+var (
+	errKeySize          = siv.NewError(siv.ErrKeySize, "gcmsiv: key must be 16 or 32 bytes")
+	errFIPS             = errors.New("gcmsiv: AES-GCM-SIV isn't available in FIPS mode, POLYVAL isn't an approved MAC")
+	errCiphertextLength = siv.NewError(siv.ErrCiphertextTooShort, "gcmsiv: ciphertext is too short")
+	errCiphertextLarge  = siv.NewError(siv.ErrMalformed, "gcmsiv: ciphertext or associated data is too large")
+	errOpen             = siv.NewError(siv.ErrAuthentication, "gcmsiv: message authentication failed")
+)
+
+const (
+	invalidNonceSize     = "gcmsiv: incorrect nonce length given to AES-GCM-SIV"
+	inputTooLarge        = "gcmsiv: plaintext or associated data longer than 2^36 bytes"
+	invalidBufferOverlap = "gcmsiv: invalid buffer overlap"
+)
+
+type gcmsiv struct {
+	block   cipher.Block
+	keySize int
+}
+
+/*
+New returns AES-GCM-SIV keyed with the key-generating key, 16 bytes select
+AEAD_AES_128_GCM_SIV and 32 bytes AEAD_AES_256_GCM_SIV. It fails in the FIPS mode
+of siv, see siv.FIPSMode
+*/
+func New(key []byte) (cipher.AEAD, error) {
+	if siv.FIPSMode() {
+		return nil, errFIPS
+	}
+	if len(key) != KeySize128 && len(key) != KeySize256 {
+		return nil, errKeySize
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &gcmsiv{block: block, keySize: len(key)}, nil
+}
+
+func (g *gcmsiv) NonceSize() int {
+	return NonceSize
+}
+
+func (g *gcmsiv) Overhead() int {
+	return TagSize
+}
+
+/*
+deriveKeys returns the authentication key and the encryption cipher for nonce,
+RFC 8452 section 4
+*/
+func (g *gcmsiv) deriveKeys(nonce []byte) ([blockSize]byte, cipher.Block) {
+	var in, out [blockSize]byte
+	copy(in[4:], nonce)
+
+	material := make([]byte, 0, blockSize+g.keySize)
+	for i := uint32(0); len(material) < cap(material); i++ {
+		binary.LittleEndian.PutUint32(in[:4], i)
+		g.block.Encrypt(out[:], in[:])
+		material = append(material, out[:8]...)
+	}
+
+	var authKey [blockSize]byte
+	copy(authKey[:], material)
+	enc, err := aes.NewCipher(material[blockSize:])
+	if err != nil {
+		// the size of the material is fixed by the key size, a valid AES key size
+		panic(err)
+	}
+	clear(material)
+	return authKey, enc
+}
+
+/*
+tag computes the tag of plaintext, RFC 8452 section 4
+*/
+func tag(authKey []byte, enc cipher.Block, nonce, plaintext, additionalData []byte) [blockSize]byte {
+	p, err := polyval.New(authKey)
+	if err != nil {
+		// the authentication key is always a block
+		panic(err)
+	}
+	p.Write(additionalData)
+	p.Pad()
+	p.Write(plaintext)
+	p.Pad()
+
+	var lengths [blockSize]byte
+	binary.LittleEndian.PutUint64(lengths[:8], uint64(len(additionalData))*8)
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(plaintext))*8)
+	p.Write(lengths[:])
+
+	var s [blockSize]byte
+	p.Sum(s[:0])
+	subtle.XORBytes(s[:NonceSize], s[:NonceSize], nonce)
+	s[blockSize-1] &= 0x7f
+	enc.Encrypt(s[:], s[:])
+	return s
+}
+
+/*
+xorKeyStream encrypts or decrypts in into out with AES-CTR starting at the tag,
+the counter is the first 32 bits, little endian
+*/
+func xorKeyStream(enc cipher.Block, t [blockSize]byte, out, in []byte) {
+	counter := t
+	counter[blockSize-1] |= 0x80
+
+	var ks [blockSize]byte
+	for len(in) > 0 {
+		enc.Encrypt(ks[:], counter[:])
+		n := subtle.XORBytes(out, in, ks[:])
+		out, in = out[n:], in[n:]
+		binary.LittleEndian.PutUint32(counter[:4], binary.LittleEndian.Uint32(counter[:4])+1)
+	}
+}
+
+func (g *gcmsiv) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != NonceSize {
+		panic(invalidNonceSize)
+	}
+	if uint64(len(plaintext)) > maxInput || uint64(len(additionalData)) > maxInput {
+		panic(inputTooLarge)
+	}
+
+	ret, out := sliceForAppend(dst, len(plaintext)+TagSize)
+	if common.InexactOverlap(out, plaintext) {
+		panic(invalidBufferOverlap)
+	}
+
+	authKey, enc := g.deriveKeys(nonce)
+	t := tag(authKey[:], enc, nonce, plaintext, additionalData)
+	clear(authKey[:])
+
+	xorKeyStream(enc, t, out[:len(plaintext)], plaintext)
+	copy(out[len(plaintext):], t[:])
+	return ret
+}
+
+/*
+Open authenticates after decrypting, on failure the plaintext written to dst is
+wiped
+*/
+func (g *gcmsiv) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != NonceSize {
+		panic(invalidNonceSize)
+	}
+	if len(ciphertext) < TagSize {
+		return nil, errCiphertextLength
+	}
+	if uint64(len(ciphertext)-TagSize) > maxInput || uint64(len(additionalData)) > maxInput {
+		return nil, errCiphertextLarge
+	}
+
+	var received [blockSize]byte
+	copy(received[:], ciphertext[len(ciphertext)-TagSize:])
+	ciphertext = ciphertext[:len(ciphertext)-TagSize]
+
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	if common.InexactOverlap(out, ciphertext) {
+		panic(invalidBufferOverlap)
+	}
+
+	authKey, enc := g.deriveKeys(nonce)
+	xorKeyStream(enc, received, out, ciphertext)
+	expected := tag(authKey[:], enc, nonce, out, additionalData)
+	clear(authKey[:])
+
+	if subtle.ConstantTimeCompare(expected[:], received[:]) != 1 {
+		clear(out)
+		return nil, errOpen
+	}
+	return ret, nil
+}
+
+/*
+sliceForAppend is the helper of crypto/cipher, it extends in by n bytes reusing
+its capacity and returns the whole slice and the extension
+*/
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
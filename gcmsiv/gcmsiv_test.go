@@ -0,0 +1,244 @@
+package gcmsiv
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"errors"
+	"github.com/luc-lynx/siv/siv"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+/*
+skipFIPS skips tests of the AEAD itself in the FIPS mode of siv, which rejects it
+*/
+func skipFIPS(tb testing.TB) {
+	if siv.FIPSMode() {
+		tb.Skip("AES-GCM-SIV isn't available in FIPS mode")
+	}
+}
+
+/*
+RFC 8452 Appendix C.1 (AEAD_AES_128_GCM_SIV) and C.2 (AEAD_AES_256_GCM_SIV)
+*/
+var vectors = []struct {
+	key, nonce, aad, plaintext, result string
+}{
+	{
+		"01000000000000000000000000000000", "030000000000000000000000", "", "",
+		"dc20e2d83f25705bb49e439eca56de25",
+	},
+	{
+		"01000000000000000000000000000000", "030000000000000000000000", "", "0100000000000000",
+		"b5d839330ac7b786578782fff6013b815b287c22493a364c",
+	},
+	{
+		"01000000000000000000000000000000", "030000000000000000000000", "", "010000000000000000000000",
+		"7323ea61d05932260047d942a4978db357391a0bc4fdec8b0d106639",
+	},
+	{
+		"01000000000000000000000000000000", "030000000000000000000000", "", "01000000000000000000000000000000",
+		"743f7c8077ab25f8624e2e948579cf77303aaf90f6fe21199c6068577437a0c4",
+	},
+	{
+		"01000000000000000000000000000000", "030000000000000000000000", "",
+		"0100000000000000000000000000000002000000000000000000000000000000",
+		"84e07e62ba83a6585417245d7ec413a9fe427d6315c09b57ce45f2e3936a94451a8e45dcd4578c667cd86847bf6155ff",
+	},
+	{
+		"01000000000000000000000000000000", "030000000000000000000000", "01", "0200000000000000",
+		"1e6daba35669f4273b0a1a2560969cdf790d99759abd1508",
+	},
+	{
+		"0100000000000000000000000000000000000000000000000000000000000000", "030000000000000000000000", "", "",
+		"07f5f4169bbf55a8400cd47ea6fd400f",
+	},
+	{
+		"0100000000000000000000000000000000000000000000000000000000000000", "030000000000000000000000", "", "0100000000000000",
+		"c2ef328e5c71c83b843122130f7364b761e0b97427e3df28",
+	},
+}
+
+func TestVectors(t *testing.T) {
+	skipFIPS(t)
+	for i, v := range vectors {
+		a, err := New(unhex(t, v.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonce, aad, plaintext, result := unhex(t, v.nonce), unhex(t, v.aad), unhex(t, v.plaintext), unhex(t, v.result)
+
+		if sealed := a.Seal(nil, nonce, plaintext, aad); !bytes.Equal(sealed, result) {
+			t.Errorf("vector %d: got %x, expected %x", i, sealed, result)
+		}
+		if opened, err := a.Open(nil, nonce, result, aad); err != nil || !bytes.Equal(opened, plaintext) {
+			t.Errorf("vector %d: open: %v", i, err)
+		}
+	}
+}
+
+/*
+The 32-bit counter wraps around without carrying into the rest of the block
+*/
+func TestCounterWrap(t *testing.T) {
+	skipFIPS(t)
+	enc, _ := aes.NewCipher(make([]byte, KeySize128))
+	var tg [blockSize]byte
+	copy(tg[:], []byte{0xff, 0xff, 0xff, 0xff, 1, 2, 3})
+
+	out := make([]byte, 2*blockSize)
+	xorKeyStream(enc, tg, out, out)
+
+	counter := tg
+	counter[blockSize-1] |= 0x80
+	clear(counter[:4])
+	expected := make([]byte, blockSize)
+	enc.Encrypt(expected, counter[:])
+	if !bytes.Equal(out[blockSize:], expected) {
+		t.Errorf("got %x, expected %x", out[blockSize:], expected)
+	}
+}
+
+func TestOpenFailures(t *testing.T) {
+	skipFIPS(t)
+	a, _ := New(bytes.Repeat([]byte{0x42}, KeySize256))
+	nonce := make([]byte, NonceSize)
+	sealed := a.Seal(nil, nonce, []byte("plaintext"), []byte("aad"))
+
+	if _, err := a.Open(nil, nonce, sealed[:TagSize-1], nil); !errors.Is(err, siv.ErrCiphertextTooShort) {
+		t.Errorf("short ciphertext: %v", err)
+	}
+	if _, err := a.Open(nil, nonce, sealed, []byte("other aad")); !errors.Is(err, siv.ErrAuthentication) {
+		t.Errorf("wrong aad: %v", err)
+	}
+
+	// the plaintext of a failed open doesn't stay in dst
+	dst := make([]byte, 0, len(sealed))
+	sealed[0] ^= 1
+	if _, err := a.Open(dst, nonce, sealed, []byte("aad")); !errors.Is(err, siv.ErrAuthentication) {
+		t.Errorf("modified ciphertext: %v", err)
+	}
+	if !bytes.Equal(dst[:len(sealed)-TagSize], make([]byte, len(sealed)-TagSize)) {
+		t.Error("dst isn't wiped")
+	}
+
+	if _, err := New(make([]byte, 24)); !errors.Is(err, siv.ErrKeySize) {
+		t.Errorf("expected %v, got %v", errKeySize, err)
+	}
+}
+
+func TestInPlace(t *testing.T) {
+	skipFIPS(t)
+	a, _ := New(bytes.Repeat([]byte{0x42}, KeySize128))
+	nonce := make([]byte, NonceSize)
+	plaintext := bytes.Repeat([]byte("in place "), 10)
+
+	buf := append(make([]byte, 0, len(plaintext)+TagSize), plaintext...)
+	sealed := a.Seal(buf[:0], nonce, buf, nil)
+	if !bytes.Equal(sealed, a.Seal(nil, nonce, plaintext, nil)) {
+		t.Fatal("in-place seal differs")
+	}
+	opened, err := a.Open(sealed[:0], nonce, sealed, nil)
+	if err != nil || !bytes.Equal(opened, plaintext) {
+		t.Fatalf("in-place open: %v", err)
+	}
+}
+
+func BenchmarkSeal(b *testing.B) {
+	skipFIPS(b)
+	a, _ := New(make([]byte, KeySize128))
+	nonce := make([]byte, NonceSize)
+	plaintext := make([]byte, 4096)
+	dst := make([]byte, 0, len(plaintext)+TagSize)
+
+	b.SetBytes(int64(len(plaintext)))
+	for b.Loop() {
+		a.Seal(dst, nonce, plaintext, nil)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	skipFIPS(t)
+	key := bytes.Repeat([]byte{0x42}, KeySize128)
+	d, err := NewDeterministic(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the all-zero nonce of New
+	a, _ := New(key)
+	sealed := d.SealDeterministic(nil, []byte("plaintext"), []byte("aad"))
+	if expected := a.Seal(nil, make([]byte, NonceSize), []byte("plaintext"), []byte("aad")); !bytes.Equal(sealed, expected) {
+		t.Errorf("got %x, expected %x", sealed, expected)
+	}
+	if pt, err := d.OpenDeterministic(nil, sealed, []byte("aad")); err != nil || string(pt) != "plaintext" {
+		t.Errorf("open: %v", err)
+	}
+	if _, err := d.OpenDeterministic(nil, sealed, []byte("aad"), []byte("more")); !errors.Is(err, siv.ErrMalformed) {
+		t.Errorf("two associated data strings: %v", err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	skipFIPS(t)
+	nonce := make([]byte, NonceSize)
+	for _, c := range []struct {
+		name    string
+		id      uint16
+		keySize int
+	}{
+		{AlgAES128GCMSIV, IDAES128GCMSIV, KeySize128},
+		{AlgAES256GCMSIV, IDAES256GCMSIV, KeySize256},
+	} {
+		key := bytes.Repeat([]byte{0x42}, c.keySize)
+		direct, _ := New(key)
+		expected := direct.Seal(nil, nonce, []byte("plaintext"), nil)
+
+		byName, err := siv.New(c.name, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		byID, err := siv.NewByID(c.id, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, a := range []cipher.AEAD{byName, byID} {
+			if sealed := a.Seal(nil, nonce, []byte("plaintext"), nil); !bytes.Equal(sealed, expected) {
+				t.Errorf("%s: got %x, expected %x", c.name, sealed, expected)
+			}
+		}
+
+		if _, err := siv.NewByID(c.id, make([]byte, KeySize128+KeySize256-c.keySize)); !errors.Is(err, siv.ErrKeySize) {
+			t.Errorf("%s: expected %v, got %v", c.name, siv.ErrKeySize, err)
+		}
+	}
+}
+
+func TestFIPS(t *testing.T) {
+	if !siv.FIPSMode() {
+		t.Skip("not in FIPS mode")
+	}
+
+	key := make([]byte, KeySize256)
+	if _, err := New(key); err != errFIPS {
+		t.Errorf("New: expected %v, got %v", errFIPS, err)
+	}
+	if _, err := NewDeterministic(key); err != errFIPS {
+		t.Errorf("NewDeterministic: expected %v, got %v", errFIPS, err)
+	}
+	if _, err := siv.New(AlgAES256GCMSIV, key); err != errFIPS {
+		t.Errorf("registry name: expected %v, got %v", errFIPS, err)
+	}
+	if _, err := siv.NewByID(IDAES256GCMSIV, key); err != errFIPS {
+		t.Errorf("registry id: expected %v, got %v", errFIPS, err)
+	}
+}
@@ -0,0 +1,50 @@
+package gcmsiv
+
+import (
+	"crypto/cipher"
+	"github.com/luc-lynx/siv/siv"
+)
+
+/*
+Importing the package registers AES-GCM-SIV in the siv registry, by name and by
+its IANA identifiers (RFC 8452 section 8):
+
+	import _ "github.com/luc-lynx/siv/gcmsiv"
+
+	a, err := siv.New(gcmsiv.AlgAES256GCMSIV, key)
+	a, err := siv.NewByID(gcmsiv.IDAES256GCMSIV, key)
+
+Unlike the AES-SIV-CMAC names of siv, both forms are the same nonce-based AEAD.
+*/
+
+const (
+	AlgAES128GCMSIV = "AES-GCM-SIV-128"
+	AlgAES256GCMSIV = "AES-GCM-SIV-256"
+
+	AlgAEADAES128GCMSIV = "AEAD_AES_128_GCM_SIV"
+	AlgAEADAES256GCMSIV = "AEAD_AES_256_GCM_SIV"
+
+	IDAES128GCMSIV uint16 = 30
+	IDAES256GCMSIV uint16 = 31
+)
+
+var errKeySizeMismatch = siv.NewError(siv.ErrKeySize, "gcmsiv: key size doesn't match the algorithm")
+
+func init() {
+	siv.Register(AlgAES128GCMSIV, exactKeySize(KeySize128))
+	siv.Register(AlgAES256GCMSIV, exactKeySize(KeySize256))
+
+	siv.Register(AlgAEADAES128GCMSIV, exactKeySize(KeySize128))
+	siv.Register(AlgAEADAES256GCMSIV, exactKeySize(KeySize256))
+	siv.RegisterID(IDAES128GCMSIV, AlgAEADAES128GCMSIV)
+	siv.RegisterID(IDAES256GCMSIV, AlgAEADAES256GCMSIV)
+}
+
+func exactKeySize(size int) siv.Constructor {
+	return func(key []byte) (cipher.AEAD, error) {
+		if len(key) != size {
+			return nil, errKeySizeMismatch
+		}
+		return New(key)
+	}
+}
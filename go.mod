@@ -1,3 +1,13 @@
 module github.com/luc-lynx/siv
 
-go 1.14
+go 1.24.0
+
+require (
+	golang.org/x/text v0.22.0
+	golang.org/x/tools v0.42.0
+)
+
+require (
+	golang.org/x/mod v0.33.0 // indirect
+	golang.org/x/sync v0.19.0 // indirect
+)
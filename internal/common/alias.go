@@ -0,0 +1,24 @@
+package common
+
+import "unsafe"
+
+/*
+AnyOverlap and InexactOverlap follow crypto/internal/alias from the standard
+library. AnyOverlap reports whether x and y share memory at any index.
+*/
+func AnyOverlap(x, y []byte) bool {
+	return len(x) > 0 && len(y) > 0 &&
+		uintptr(unsafe.Pointer(&x[0])) <= uintptr(unsafe.Pointer(&y[len(y)-1])) &&
+		uintptr(unsafe.Pointer(&y[0])) <= uintptr(unsafe.Pointer(&x[len(x)-1]))
+}
+
+/*
+InexactOverlap reports whether x and y share memory at any non-corresponding
+index. x and y aliasing each other exactly is allowed, it's in-place operation.
+*/
+func InexactOverlap(x, y []byte) bool {
+	if len(x) == 0 || len(y) == 0 || &x[0] == &y[0] {
+		return false
+	}
+	return AnyOverlap(x, y)
+}
@@ -0,0 +1,71 @@
+package common
+
+import (
+	"crypto/subtle"
+	"github.com/luc-lynx/siv/ct"
+)
+
+var (
+	invalidXorParamsMessage   = "invalid input for xor function - the both arguments must have the same length"
+	invalidPaddingDataMessage = "invalid input for padding function - data must be shorter than a block"
+	invalidPaddingDstMessage  = "invalid input for padding function - destination must be a block"
+)
+
+const (
+	blockSize         = 16
+	firstPaddingOctet = 0b10000000
+)
+
+func Xor(a, b []byte) []byte {
+	if len(a) != len(b) {
+		panic(invalidXorParamsMessage)
+	}
+	result := make([]byte, len(a))
+
+	for i := range a {
+		result[i] = a[i] ^ b[i]
+	}
+
+	return result
+}
+
+/*
+Dbl and Padding are used on secret values (CMAC subkeys, S2V state),
+so they don't branch on or index by the data they process
+*/
+
+/*
+Dbl is ct.Double returning a new block
+*/
+func Dbl(data []byte) []byte {
+	result := make([]byte, len(data))
+	ct.Double(result, data)
+	return result
+}
+
+/*
+Padding writes data followed by the 10* padding into dst and returns it.
+dst must be a block or nil, in which case a fresh block is allocated,
+data must be shorter than a block. data is never modified.
+*/
+func Padding(dst, data []byte) []byte {
+	if len(data) >= blockSize {
+		panic(invalidPaddingDataMessage)
+	}
+	if dst == nil {
+		dst = make([]byte, blockSize)
+	}
+	if len(dst) != blockSize {
+		panic(invalidPaddingDstMessage)
+	}
+
+	n := copy(dst, data)
+	for i := range dst {
+		// 0xff for the octets of data, 0x00 for the padding
+		keep := byte(-subtle.ConstantTimeLessOrEq(i+1, n))
+		pad := firstPaddingOctet & byte(-subtle.ConstantTimeEq(int32(i), int32(n)))
+		dst[i] = dst[i]&keep | pad
+	}
+
+	return dst
+}
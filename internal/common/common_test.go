@@ -0,0 +1,69 @@
+package common
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPadding(t *testing.T) {
+	t.Run("padding values", testPaddingValues)
+	t.Run("padding doesn't touch the caller's slice", testPaddingAliasing)
+}
+
+func testPaddingValues(t *testing.T) {
+	for n := 0; n < blockSize; n++ {
+		data := bytes.Repeat([]byte{0xaa}, n)
+		expected := make([]byte, blockSize)
+		copy(expected, data)
+		expected[n] = firstPaddingOctet
+
+		if !bytes.Equal(Padding(nil, data), expected) {
+			t.Errorf("wrong padding for %d bytes", n)
+			t.Fail()
+		}
+
+		dst := bytes.Repeat([]byte{0x55}, blockSize)
+		if !bytes.Equal(Padding(dst, data), expected) {
+			t.Errorf("wrong padding into a dirty block for %d bytes", n)
+			t.Fail()
+		}
+	}
+}
+
+func testPaddingAliasing(t *testing.T) {
+	backing := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+	data := backing[:3]
+
+	Padding(nil, data)
+	if !bytes.Equal(backing, []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}) {
+		t.Error("padding modified the spare capacity of the input")
+		t.Fail()
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	buf := make([]byte, 32)
+
+	cases := []struct {
+		name    string
+		x, y    []byte
+		any     bool
+		inexact bool
+	}{
+		{"disjoint", buf[:16], buf[16:], false, false},
+		{"exact", buf[:16], buf[:16], true, false},
+		{"shifted", buf[:16], buf[8:24], true, true},
+		{"empty", buf[:0], buf, false, false},
+	}
+
+	for _, c := range cases {
+		if AnyOverlap(c.x, c.y) != c.any {
+			t.Errorf("%s: AnyOverlap = %v", c.name, !c.any)
+			t.Fail()
+		}
+		if InexactOverlap(c.x, c.y) != c.inexact {
+			t.Errorf("%s: InexactOverlap = %v", c.name, !c.inexact)
+			t.Fail()
+		}
+	}
+}
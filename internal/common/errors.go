@@ -0,0 +1,26 @@
+package common
+
+import "errors"
+
+/*
+ErrKeySize is exported by siv as siv.ErrKeySize. It is defined here so cmac and
+polyval, which can't import siv, wrap the same sentinel in their key size errors.
+*/
+var ErrKeySize = errors.New("siv: key size not supported")
+
+type keySizeError string
+
+func (e keySizeError) Error() string {
+	return string(e)
+}
+
+func (e keySizeError) Unwrap() error {
+	return ErrKeySize
+}
+
+/*
+KeySizeError returns an error with the message msg wrapping ErrKeySize
+*/
+func KeySizeError(msg string) error {
+	return keySizeError(msg)
+}
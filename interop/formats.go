@@ -0,0 +1,335 @@
+package interop
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type wycheproofFile struct {
+	Algorithm  string `json:"algorithm"`
+	TestGroups []struct {
+		Tests []struct {
+			TcID    int    `json:"tcId"`
+			Comment string `json:"comment"`
+			Key     string `json:"key"`
+			AAD     string `json:"aad"`
+			Msg     string `json:"msg"`
+			CT      string `json:"ct"`
+			Tag     string `json:"tag"`
+			Result  string `json:"result"`
+		} `json:"tests"`
+	} `json:"testGroups"`
+}
+
+func parseWycheproof(data []byte) ([]vector, error) {
+	var f wycheproofFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+
+	var kind string
+	switch f.Algorithm {
+	case "AES-SIV-CMAC":
+		kind = kindSIV
+	case "AES-CMAC":
+		kind = kindCMAC
+	default:
+		kind = f.Algorithm
+	}
+
+	var vectors []vector
+	for _, group := range f.TestGroups {
+		for _, test := range group.Tests {
+			v := vector{
+				kind:      kind,
+				name:      fmt.Sprintf("tcId %d %s", test.TcID, test.Comment),
+				valid:     test.Result != "invalid",
+				supported: kind == kindSIV || kind == kindCMAC,
+			}
+
+			output := test.CT
+			if kind == kindCMAC {
+				output = test.Tag
+			}
+
+			var err error
+			if v.key, err = decodeHex(test.Key); err != nil {
+				return nil, err
+			}
+			if v.input, err = decodeHex(test.Msg); err != nil {
+				return nil, err
+			}
+			if v.output, err = decodeHex(output); err != nil {
+				return nil, err
+			}
+
+			if kind == kindSIV {
+				aad, err := decodeHex(test.AAD)
+				if err != nil {
+					return nil, err
+				}
+				v.aad = [][]byte{aad}
+			}
+
+			vectors = append(vectors, v)
+		}
+	}
+	return vectors, nil
+}
+
+/*
+Miscreant uses TJSON where member names carry type tags ("key:d16", "ad:A<d16>"),
+the tags are stripped so plain JSON files with the same layout work too.
+*/
+func parseMiscreant(data []byte) ([]vector, error) {
+	var f map[string][]map[string]interface{}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+
+	var vectors []vector
+	for name, examples := range f {
+		kind := kindSIV
+		if !strings.HasPrefix(name, "examples") {
+			continue
+		}
+
+		for _, example := range examples {
+			fields := make(map[string]interface{})
+			for k, v := range example {
+				fields[strings.SplitN(k, ":", 2)[0]] = v
+			}
+
+			if _, ok := fields["tag"]; ok {
+				kind = kindCMAC
+			}
+
+			v := vector{kind: kind, valid: true, supported: true}
+			if s, ok := fields["name"].(string); ok {
+				v.name = s
+			}
+
+			var err error
+			if v.key, err = decodeHex(stringField(fields, "key")); err != nil {
+				return nil, err
+			}
+
+			if kind == kindCMAC {
+				if v.input, err = decodeHex(stringField(fields, "message")); err != nil {
+					return nil, err
+				}
+				if v.output, err = decodeHex(stringField(fields, "tag")); err != nil {
+					return nil, err
+				}
+			} else {
+				if v.input, err = decodeHex(stringField(fields, "plaintext")); err != nil {
+					return nil, err
+				}
+				if v.output, err = decodeHex(stringField(fields, "ciphertext")); err != nil {
+					return nil, err
+				}
+
+				ad, _ := fields["ad"].([]interface{})
+				for _, a := range ad {
+					s, _ := a.(string)
+					b, err := decodeHex(s)
+					if err != nil {
+						return nil, err
+					}
+					v.aad = append(v.aad, b)
+				}
+			}
+
+			vectors = append(vectors, v)
+		}
+	}
+	return vectors, nil
+}
+
+func stringField(fields map[string]interface{}, name string) string {
+	s, _ := fields[name].(string)
+	return s
+}
+
+/*
+OpenSSL evp test files are stanzas of "Name = value" lines separated by empty lines.
+SIV ciphertexts are split into Tag and Ciphertext, several AAD lines form the AD vector.
+*/
+func parseOpenSSL(data []byte) ([]vector, error) {
+	var vectors []vector
+	stanza := make(map[string][]string)
+	line := 0
+	start := 0
+
+	flush := func() error {
+		defer func() {
+			stanza = make(map[string][]string)
+		}()
+
+		v := vector{valid: true, name: fmt.Sprintf("line %d", start)}
+		switch {
+		case len(stanza["Cipher"]) > 0:
+			cipher := strings.ToLower(stanza["Cipher"][0])
+			v.kind = kindSIV
+			v.supported = strings.HasSuffix(cipher, "-siv") && strings.HasPrefix(cipher, "aes-")
+			if !v.supported {
+				v.kind = cipher
+			}
+		case len(stanza["MAC"]) > 0:
+			v.kind = kindCMAC
+			v.supported = stanza["MAC"][0] == "CMAC" && len(stanza["Algorithm"]) > 0 &&
+				strings.HasPrefix(strings.ToUpper(stanza["Algorithm"][0]), "AES-")
+			if !v.supported {
+				v.kind = strings.Join(append(stanza["MAC"], stanza["Algorithm"]...), " ")
+			}
+		default:
+			// title or other kind of stanza
+			return nil
+		}
+
+		v.valid = len(stanza["Result"]) == 0
+
+		fields := []struct {
+			name string
+			dst  *[]byte
+		}{
+			{"Key", &v.key},
+			{"Plaintext", &v.input},
+			{"Input", &v.input},
+			{"Output", &v.output},
+		}
+		for _, f := range fields {
+			if len(stanza[f.name]) == 0 {
+				continue
+			}
+			b, err := decodeHex(stanza[f.name][0])
+			if err != nil {
+				return err
+			}
+			*f.dst = b
+		}
+
+		if v.kind == kindSIV {
+			tag, err := decodeHex(first(stanza["Tag"]))
+			if err != nil {
+				return err
+			}
+			ct, err := decodeHex(first(stanza["Ciphertext"]))
+			if err != nil {
+				return err
+			}
+			v.output = append(tag, ct...)
+
+			for _, a := range stanza["AAD"] {
+				b, err := decodeHex(a)
+				if err != nil {
+					return err
+				}
+				v.aad = append(v.aad, b)
+			}
+		}
+
+		vectors = append(vectors, v)
+		return nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if text == "" {
+			if err := flush(); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			continue
+		}
+
+		parts := strings.SplitN(text, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: invalid line", line)
+		}
+		if len(stanza) == 0 {
+			start = line
+		}
+		name := strings.TrimSpace(parts[0])
+		stanza[name] = append(stanza[name], strings.TrimSpace(parts[1]))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+/*
+The RFC text has labels ending with a colon followed by indented hex groups. Key, AD*, Nonce,
+Plaintext and output are used (the nonce is the last AD string), intermediate values are ignored.
+*/
+func parseRFC5297(data []byte) ([]vector, error) {
+	var vectors []vector
+	var current *vector
+	var label string
+
+	values := make(map[string]*[]byte)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.Trim(text, "-") == "" {
+			continue
+		}
+
+		if strings.HasSuffix(text, ":") {
+			label = strings.TrimSpace(strings.TrimSuffix(text, ":"))
+			switch {
+			case label == "Key":
+				vectors = append(vectors, vector{kind: kindSIV, valid: true, supported: true})
+				current = &vectors[len(vectors)-1]
+				current.name = fmt.Sprintf("example %d", len(vectors))
+				values = map[string]*[]byte{
+					"Key":       &current.key,
+					"Plaintext": &current.input,
+					"output":    &current.output,
+				}
+			case current != nil && (strings.HasPrefix(label, "AD") || label == "Nonce"):
+				current.aad = append(current.aad, []byte{})
+				values[label] = &current.aad[len(current.aad)-1]
+			}
+			continue
+		}
+
+		dst, ok := values[label]
+		if current == nil || !ok {
+			continue
+		}
+
+		b, err := decodeHex(text)
+		if err != nil {
+			// prose between the examples
+			label = ""
+			continue
+		}
+		*dst = append(*dst, b...)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
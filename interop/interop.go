@@ -0,0 +1,201 @@
+package interop
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/luc-lynx/siv/cmac"
+	"github.com/luc-lynx/siv/siv"
+)
+
+/*
+Verification of this module against vector files published by other implementations,
+in their native formats:
+
+	wycheproof - Wycheproof JSON files (aes_siv_cmac_test.json, aes_cmac_test.json) used by Tink
+	miscreant  - miscreant vectors (aes_siv.tjson, aes_cmac.tjson), plain JSON is accepted too
+	openssl    - OpenSSL evp test files (evpciph_aes_siv.txt, evpmac_common.txt)
+	rfc5297    - text of the RFC 5297 appendix A examples
+*/
+
+const (
+	FormatWycheproof = "wycheproof"
+	FormatMiscreant  = "miscreant"
+	FormatOpenSSL    = "openssl"
+	FormatRFC5297    = "rfc5297"
+
+	kindSIV  = "AES-SIV"
+	kindCMAC = "AES-CMAC"
+)
+
+var (
+	errUnknownFormat = errors.New("unknown vector file format")
+)
+
+/*
+Result of a single vector. Expected and Got are set when the output differs.
+*/
+type Result struct {
+	Index    int
+	Name     string
+	Passed   bool
+	Skipped  bool
+	Expected []byte
+	Got      []byte
+	Err      error
+}
+
+func (r *Result) String() string {
+	switch {
+	case r.Skipped:
+		return fmt.Sprintf("#%d %s: SKIPPED (%v)", r.Index, r.Name, r.Err)
+	case r.Passed:
+		return fmt.Sprintf("#%d %s: OK", r.Index, r.Name)
+	case r.Expected != nil || r.Got != nil:
+		return fmt.Sprintf("#%d %s: FAILED\n\texpected %x\n\tgot      %x", r.Index, r.Name, r.Expected, r.Got)
+	}
+	return fmt.Sprintf("#%d %s: FAILED (%v)", r.Index, r.Name, r.Err)
+}
+
+type vector struct {
+	kind      string
+	name      string
+	key       []byte
+	aad       [][]byte
+	input     []byte
+	output    []byte
+	valid     bool
+	supported bool
+}
+
+/*
+Verify parses the vector file in the given format (or detects it for an empty format)
+and checks every vector against this implementation.
+*/
+func Verify(format string, data []byte) ([]Result, error) {
+	if format == "" {
+		format = DetectFormat(data)
+	}
+
+	var vectors []vector
+	var err error
+	switch format {
+	case FormatWycheproof:
+		vectors, err = parseWycheproof(data)
+	case FormatMiscreant:
+		vectors, err = parseMiscreant(data)
+	case FormatOpenSSL:
+		vectors, err = parseOpenSSL(data)
+	case FormatRFC5297:
+		vectors, err = parseRFC5297(data)
+	default:
+		return nil, errUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, len(vectors))
+	for i := range vectors {
+		results[i] = check(&vectors[i])
+		results[i].Index = i + 1
+	}
+	return results, nil
+}
+
+/*
+DetectFormat guesses the format of the vector file, an empty string is returned if it fails.
+*/
+func DetectFormat(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")) && bytes.Contains(data, []byte(`"testGroups"`)):
+		return FormatWycheproof
+	case bytes.HasPrefix(trimmed, []byte("{")) && bytes.Contains(data, []byte(`"examples`)):
+		return FormatMiscreant
+	case bytes.Contains(data, []byte("Cipher = ")) || bytes.Contains(data, []byte("MAC = ")):
+		return FormatOpenSSL
+	case bytes.Contains(data, []byte("S2V-CMAC-AES")) || bytes.Contains(data, []byte("output")):
+		return FormatRFC5297
+	}
+	return ""
+}
+
+func check(v *vector) Result {
+	r := Result{Name: v.name}
+	if !v.supported {
+		r.Skipped = true
+		r.Err = fmt.Errorf("unsupported algorithm %s", v.kind)
+		return r
+	}
+
+	switch v.kind {
+	case kindSIV:
+		return checkSIV(v, r)
+	case kindCMAC:
+		return checkCMAC(v, r)
+	}
+
+	r.Skipped = true
+	r.Err = fmt.Errorf("unsupported algorithm %s", v.kind)
+	return r
+}
+
+func checkSIV(v *vector, r Result) Result {
+	aead, err := siv.NewAesSIV(v.key)
+	if err != nil {
+		r.Passed = !v.valid
+		r.Err = err
+		return r
+	}
+
+	if !v.valid {
+		// invalid vectors carry a forged or malformed ciphertext which must be rejected
+		_, err := aead.OpenWithMultipleAAD(nil, v.output, v.aad)
+		r.Passed = err != nil
+		if !r.Passed {
+			r.Err = errors.New("invalid ciphertext has been accepted")
+		}
+		return r
+	}
+
+	got := aead.SealWithMultipleAAD(nil, v.input, v.aad)
+	if !bytes.Equal(got, v.output) {
+		r.Expected = v.output
+		r.Got = got
+		return r
+	}
+
+	r.Passed = true
+	return r
+}
+
+func checkCMAC(v *vector, r Result) Result {
+	c, err := cmac.NewCmac(v.key)
+	if err != nil {
+		r.Passed = !v.valid
+		r.Err = err
+		return r
+	}
+
+	c.Write(v.input)
+	got := c.Sum(nil)
+	if len(v.output) < len(got) {
+		// truncated tags
+		got = got[:len(v.output)]
+	}
+
+	if bytes.Equal(got, v.output) != v.valid {
+		r.Expected = v.output
+		r.Got = got
+		return r
+	}
+
+	r.Passed = true
+	return r
+}
+
+func decodeHex(s string) ([]byte, error) {
+	return hex.DecodeString(string(bytes.Join(bytes.Fields([]byte(s)), nil)))
+}
@@ -0,0 +1,213 @@
+package interop
+
+import (
+	"testing"
+)
+
+const rfc5297Text = `
+A.1.  Deterministic Authenticated Encryption Example
+
+   Input:
+   -----
+   Key:
+           fffefdfc fbfaf9f8 f7f6f5f4 f3f2f1f0
+           f0f1f2f3 f4f5f6f7 f8f9fafb fcfdfeff
+
+   AD:
+           10111213 14151617 18191a1b 1c1d1e1f
+           20212223 24252627
+
+   Plaintext:
+           11223344 55667788 99aabbcc ddee
+
+   S2V-CMAC-AES
+   ------------
+   CMAC(zero):
+           0e04dfaf c1efbf04 01405828 59bf073a
+
+   result
+   ------
+   output    :
+           85632d07 c6e8f37f 950acd32 0a2ecc93
+           40c02b96 90c4dc04 daef7f6a fe5c
+
+A.2.  Nonce-Based Authenticated Encryption Example
+
+   Input:
+   -----
+   Key:
+           7f7e7d7c 7b7a7978 77767574 73727170
+           40414243 44454647 48494a4b 4c4d4e4f
+
+   AD1:
+           00112233 44556677 8899aabb ccddeeff
+           deaddada deaddada ffeeddcc bbaa9988
+           77665544 33221100
+
+   AD2:
+           10203040 50607080 90a0
+
+   Nonce:
+           09f91102 9d74e35b d84156c5 635688c0
+
+   Plaintext:
+           74686973 20697320 736f6d65 20706c61
+           696e7465 78742074 6f20656e 63727970
+           74207573 696e6720 5349562d 414553
+
+   result
+   ------
+   output    :
+           7bdb6e3b 432667eb 06f4d14b ff2fbd0f
+           cb900f2f ddbe4043 26601965 c889bf17
+           dba77ceb 094fa663 b7a3f748 ba8af829
+           ea64ad54 4a272e9c 485b62a3 fd5c0d
+`
+
+const openSSLText = `
+Title = AES SIV test vectors from RFC5297
+
+Cipher = aes-128-siv
+Key = fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff
+AAD = 101112131415161718191a1b1c1d1e1f2021222324252627
+Tag = 85632d07c6e8f37f950acd320a2ecc93
+Plaintext = 112233445566778899aabbccddee
+Ciphertext = 40c02b9690c4dc04daef7f6afe5c
+
+Cipher = aes-128-siv
+Key = fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff
+AAD = 101112131415161718191a1b1c1d1e1f2021222324252627
+Tag = 85632d07c6e8f37f950acd320a2ecc94
+Plaintext = 112233445566778899aabbccddee
+Ciphertext = 40c02b9690c4dc04daef7f6afe5c
+Operation = DECRYPT
+Result = CIPHERFINAL_ERROR
+
+# RFC 4493 example 2
+MAC = CMAC
+Algorithm = AES-128-CBC
+Key = 2B7E151628AED2A6ABF7158809CF4F3C
+Input = 6BC1BEE22E409F96E93D7E117393172A
+Output = 070A16B46B4D4144F79BDD9DD04A287C
+
+MAC = CMAC
+Algorithm = DES-EDE3-CBC
+Key = 89BCD952A8C8AB371AF48AC7D07085D5EFF702E6D62CDC23
+Input = FA620C1BBE97319E9A0CF0492121F7A20EB08A6A709DCBD00AAF38E4F99E754E
+Output = 8F49A1B7D6AA2258
+`
+
+const wycheproofText = `{
+  "algorithm": "AES-SIV-CMAC",
+  "testGroups": [
+    {
+      "keySize": 256,
+      "type": "DaeadTest",
+      "tests": [
+        {
+          "tcId": 1, "comment": "RFC 5297", "flags": [],
+          "key": "fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff",
+          "aad": "101112131415161718191a1b1c1d1e1f2021222324252627",
+          "msg": "112233445566778899aabbccddee",
+          "ct": "85632d07c6e8f37f950acd320a2ecc9340c02b9690c4dc04daef7f6afe5c",
+          "result": "valid"
+        },
+        {
+          "tcId": 2, "comment": "modified tag", "flags": [],
+          "key": "fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff",
+          "aad": "101112131415161718191a1b1c1d1e1f2021222324252627",
+          "msg": "112233445566778899aabbccddee",
+          "ct": "85632d07c6e8f37f950acd320a2ecc9240c02b9690c4dc04daef7f6afe5c",
+          "result": "invalid"
+        }
+      ]
+    }
+  ]
+}`
+
+const miscreantText = `{
+  "examples:A<O>": [
+    {
+      "name:s": "Deterministic AES-SIV example",
+      "key:d16": "fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff",
+      "ad:A<d16>": ["101112131415161718191a1b1c1d1e1f2021222324252627"],
+      "plaintext:d16": "112233445566778899aabbccddee",
+      "ciphertext:d16": "85632d07c6e8f37f950acd320a2ecc9340c02b9690c4dc04daef7f6afe5c"
+    },
+    {
+      "name:s": "Nonce-based AES-SIV example",
+      "key:d16": "7f7e7d7c7b7a797877767574737271704041424344454647done",
+      "ad:A<d16>": [],
+      "plaintext:d16": "",
+      "ciphertext:d16": ""
+    }
+  ]
+}`
+
+func checkResults(t *testing.T, format, data string, expected []bool) {
+	if detected := DetectFormat([]byte(data)); detected != format {
+		t.Errorf("detected format %q instead of %q", detected, format)
+	}
+
+	results, err := Verify("", []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != len(expected) {
+		t.Fatalf("%d results instead of %d", len(results), len(expected))
+	}
+
+	for i := range results {
+		if results[i].Passed != expected[i] {
+			t.Errorf("unexpected result %s", results[i].String())
+		}
+	}
+}
+
+func TestRFC5297(t *testing.T) {
+	checkResults(t, FormatRFC5297, rfc5297Text, []bool{true, true})
+}
+
+func TestOpenSSL(t *testing.T) {
+	checkResults(t, FormatOpenSSL, openSSLText, []bool{true, true, true, false})
+
+	results, err := Verify(FormatOpenSSL, []byte(openSSLText))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[3].Skipped {
+		t.Error("3DES CMAC vector isn't skipped")
+	}
+}
+
+func TestWycheproof(t *testing.T) {
+	checkResults(t, FormatWycheproof, wycheproofText, []bool{true, true})
+}
+
+func TestMiscreant(t *testing.T) {
+	if _, err := Verify(FormatMiscreant, []byte(miscreantText)); err == nil {
+		t.Error("invalid hex has been accepted")
+	}
+
+	valid := `{"examples:A<O>": [{
+		"name:s": "Deterministic AES-SIV example",
+		"key:d16": "fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff",
+		"ad:A<d16>": ["101112131415161718191a1b1c1d1e1f2021222324252627"],
+		"plaintext:d16": "112233445566778899aabbccddee",
+		"ciphertext:d16": "85632d07c6e8f37f950acd320a2ecc9340c02b9690c4dc04daef7f6afe5c"
+	}, {
+		"name:s": "Swapped ciphertext",
+		"key:d16": "fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff",
+		"ad:A<d16>": [],
+		"plaintext:d16": "112233445566778899aabbccddee",
+		"ciphertext:d16": "85632d07c6e8f37f950acd320a2ecc9340c02b9690c4dc04daef7f6afe5c"
+	}]}`
+	checkResults(t, FormatMiscreant, valid, []bool{true, false})
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := Verify("", []byte("nothing to see here")); err == nil {
+		t.Fail()
+	}
+}
@@ -0,0 +1,138 @@
+package keyset
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+/*
+CachingKEK is a KEK remembering the results of Decrypt, so data keys unwrapped
+by a KMS aren't sent to it again on every open. Entries are keyed by the SHA-256
+digest of the ciphertext and the associated data, expire after the TTL and the
+least recently used one is evicted when the cache is full. Evicted plaintexts are
+wiped. Encrypt always goes to the wrapped KEK.
+*/
+type CachingKEK struct {
+	kek        KEK
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	lru     *list.List
+	now     func() time.Time
+}
+
+type cacheEntry struct {
+	digest    [sha256.Size]byte
+	plaintext []byte
+	expires   time.Time
+}
+
+/*
+NewCachingKEK caches up to maxEntries plaintexts for ttl each
+*/
+func NewCachingKEK(kek KEK, ttl time.Duration, maxEntries int) *CachingKEK {
+	return &CachingKEK{
+		kek:        kek,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[[sha256.Size]byte]*list.Element),
+		lru:        list.New(),
+		now:        time.Now,
+	}
+}
+
+func (c *CachingKEK) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	return c.kek.Encrypt(plaintext, associatedData)
+}
+
+/*
+Decrypt returns a copy of the cached plaintext, callers may wipe it
+*/
+func (c *CachingKEK) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	digest := cacheDigest(ciphertext, associatedData)
+
+	c.mu.Lock()
+	if e, ok := c.entries[digest]; ok {
+		entry := e.Value.(*cacheEntry)
+		if c.now().Before(entry.expires) {
+			c.lru.MoveToFront(e)
+			plaintext := append([]byte{}, entry.plaintext...)
+			c.mu.Unlock()
+			return plaintext, nil
+		}
+		c.remove(e)
+	}
+	c.mu.Unlock()
+
+	// concurrent misses for the same digest may both call the KEK, the last one is kept
+	plaintext, err := c.kek.Decrypt(ciphertext, associatedData)
+	if err != nil || c.maxEntries <= 0 || c.ttl <= 0 {
+		return plaintext, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[digest]; ok {
+		c.remove(e)
+	}
+	for c.lru.Len() >= c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+
+	c.entries[digest] = c.lru.PushFront(&cacheEntry{
+		digest:    digest,
+		plaintext: append([]byte{}, plaintext...),
+		expires:   c.now().Add(c.ttl),
+	})
+	return plaintext, nil
+}
+
+/*
+Len returns the number of cached entries, including expired ones not yet evicted
+*/
+func (c *CachingKEK) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+/*
+Wipe removes and wipes all the cached plaintexts
+*/
+func (c *CachingKEK) Wipe() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *CachingKEK) remove(e *list.Element) {
+	entry := c.lru.Remove(e).(*cacheEntry)
+	delete(c.entries, entry.digest)
+	clear(entry.plaintext)
+}
+
+/*
+cacheDigest hashes the length of the ciphertext with both inputs, so moving bytes
+between them changes the digest
+*/
+func cacheDigest(ciphertext, associatedData []byte) [sha256.Size]byte {
+	h := sha256.New()
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(len(ciphertext)))
+	h.Write(n[:])
+	h.Write(ciphertext)
+	h.Write(associatedData)
+
+	var digest [sha256.Size]byte
+	h.Sum(digest[:0])
+	return digest
+}
@@ -0,0 +1,141 @@
+package keyset
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/luc-lynx/siv/siv"
+)
+
+var (
+	keysetAAD = []byte("siv encrypted keyset")
+
+	errNotEncrypted = errors.New("data is not an encrypted keyset")
+)
+
+/*
+KEK is a key encryption key protecting keysets at rest. It's implemented by
+NewSIVKEK for local keys, KMS clients can be plugged in by implementing it too.
+*/
+type KEK interface {
+	Encrypt(plaintext, associatedData []byte) ([]byte, error)
+	Decrypt(ciphertext, associatedData []byte) ([]byte, error)
+}
+
+type encryptedKeyset struct {
+	EncryptedKeyset []byte `json:"encryptedKeyset"`
+}
+
+/*
+multipleAAD seals with SealTo, SealWithMultipleAAD panics on too many associated data strings
+*/
+type multipleAAD interface {
+	SealTo(dst, plaintext []byte, additionalData [][]byte) (int, error)
+	OpenWithMultipleAAD(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error)
+	Overhead() int
+}
+
+type sivKEK struct {
+	aead multipleAAD
+}
+
+/*
+NewSIVKEK returns a KEK wrapping data with AES-SIV, which is the deterministic
+key wrap construction RFC 5297 has been designed for.
+*/
+func NewSIVKEK(key []byte) (KEK, error) {
+	aead, err := siv.NewAesSIV(key)
+	if err != nil {
+		return nil, err
+	}
+	return &sivKEK{aead: aead}, nil
+}
+
+func (k *sivKEK) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	out := make([]byte, len(plaintext)+k.aead.Overhead())
+	n, err := k.aead.SealTo(out, plaintext, [][]byte{associatedData})
+	if err != nil {
+		return nil, err
+	}
+	return out[:n], nil
+}
+
+func (k *sivKEK) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	return k.aead.OpenWithMultipleAAD(nil, ciphertext, [][]byte{associatedData})
+}
+
+/*
+Encrypt returns the keyset encrypted with the KEK.
+*/
+func (ks *Keyset) Encrypt(kek KEK) ([]byte, error) {
+	cleartext, err := json.Marshal(ks)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := kek.Encrypt(cleartext, keysetAAD)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(&encryptedKeyset{EncryptedKeyset: ciphertext}, "", "  ")
+}
+
+/*
+Decrypt decrypts a keyset produced by Keyset.Encrypt.
+*/
+func Decrypt(data []byte, kek KEK) (*Keyset, error) {
+	var e encryptedKeyset
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+
+	if e.EncryptedKeyset == nil {
+		return nil, errNotEncrypted
+	}
+
+	cleartext, err := kek.Decrypt(e.EncryptedKeyset, keysetAAD)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(cleartext)
+}
+
+/*
+IsEncrypted reports whether the data looks like an encrypted keyset.
+*/
+func IsEncrypted(data []byte) bool {
+	var e encryptedKeyset
+	return json.Unmarshal(data, &e) == nil && e.EncryptedKeyset != nil
+}
+
+/*
+KEKSealer adapts a KEK, typically a KMS client, to siv.SealOpener. KMS APIs take a
+single associated data string, so every component is prefixed with its length
+(8 bytes, big endian) and they are concatenated. The context isn't passed to the KEK.
+*/
+func KEKSealer(kek KEK) siv.SealOpener {
+	return kekSealer{kek}
+}
+
+type kekSealer struct {
+	kek KEK
+}
+
+func (k kekSealer) SealContext(_ context.Context, plaintext []byte, additionalData [][]byte) ([]byte, error) {
+	return k.kek.Encrypt(plaintext, joinAAD(additionalData))
+}
+
+func (k kekSealer) OpenContext(_ context.Context, ciphertext []byte, additionalData [][]byte) ([]byte, error) {
+	return k.kek.Decrypt(ciphertext, joinAAD(additionalData))
+}
+
+func joinAAD(additionalData [][]byte) []byte {
+	var joined []byte
+	for _, c := range additionalData {
+		joined = binary.BigEndian.AppendUint64(joined, uint64(len(c)))
+		joined = append(joined, c...)
+	}
+	return joined
+}
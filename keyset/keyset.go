@@ -0,0 +1,425 @@
+package keyset
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/luc-lynx/siv/siv"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+)
+
+/*
+Keyset is a set of AES-SIV keys identified by random 32-bit IDs, one of them is primary.
+Data is sealed with the primary key and prefixed with
+
+	version (1 byte) || key id (4 bytes, big endian)
+
+so it can be opened by any enabled key of the keyset after the primary key has been rotated.
+*/
+
+const (
+	StatusEnabled  = "enabled"
+	StatusDisabled = "disabled"
+
+	prefixVersion = 0x01
+	prefixSize    = 5
+)
+
+var (
+	errUnknownKey     = errors.New("key is not in the keyset")
+	errKeyDisabled    = errors.New("key is disabled")
+	errDisablePrimary = errors.New("primary key can't be disabled")
+	errUnknownStatus  = errors.New("unknown key status")
+	errInvalidPrefix  = siv.NewError(siv.ErrCiphertextTooShort, "ciphertext is too short for a key prefix")
+	errPrefixVersion  = siv.NewError(siv.ErrUnsupportedVersion, "ciphertext has an unknown key prefix version")
+	errNoPrimary      = errors.New("keyset doesn't have an enabled primary key")
+	errDuplicateKeyID = errors.New("keyset has duplicate key ids")
+	errKeySize        = siv.NewError(siv.ErrKeySize, "key size must be 256, 384 or 512 bits")
+)
+
+type Key struct {
+	ID       uint32    `json:"id"`
+	Status   string    `json:"status"`
+	Created  time.Time `json:"created"`
+	Material Material  `json:"material"`
+}
+
+type Keyset struct {
+	Primary uint32 `json:"primary"`
+
+	// Keys may be changed after loading, a key added or whose Material was
+	// replaced is used right away and cached by the next Rotate, which also
+	// destroys the cached AEADs of removed keys
+	Keys []*Key `json:"keys"`
+
+	// Audit, if set, is called after every Seal and Open with the id of the key
+	// used and AuditContext, see siv.AuditHook
+	Audit        siv.AuditHook     `json:"-"`
+	AuditContext map[string]string `json:"-"`
+
+	// Rand, if set, replaces crypto/rand for key material and key ids,
+	// e.g. with a DRBG or a hardware TRNG
+	Rand io.Reader `json:"-"`
+
+	// aeads holds the AEAD of every key by id with a copy of its material, built
+	// when the key is parsed or generated and synced with Keys by Rotate. Seal and
+	// Open only read it, so they can run concurrently but not with Rotate
+	aeads map[uint32]*cachedAEAD
+	log   *slog.Logger
+}
+
+/*
+New creates a keyset with a single primary key of the given size in bits.
+To draw the key from another source, set Rand on an empty Keyset and call Rotate.
+*/
+func New(bits int) (*Keyset, error) {
+	ks := &Keyset{}
+	if _, err := ks.Rotate(bits); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+/*
+Parse decodes a cleartext keyset and validates it.
+*/
+func Parse(data []byte) (*Keyset, error) {
+	ks := &Keyset{}
+	if err := json.Unmarshal(data, ks); err != nil {
+		return nil, err
+	}
+
+	if err := ks.validate(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+func (ks *Keyset) Marshal() ([]byte, error) {
+	return json.MarshalIndent(ks, "", "  ")
+}
+
+/*
+Rotate generates a new key and makes it primary. The previous keys stay enabled,
+so data sealed with them can still be opened.
+*/
+func (ks *Keyset) Rotate(bits int) (*Key, error) {
+	switch bits {
+	case 256, 384, 512:
+	default:
+		return nil, errKeySize
+	}
+
+	material, err := siv.GenerateKey(ks.Rand, bits)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := ks.newID()
+	if err != nil {
+		return nil, err
+	}
+
+	k := &Key{
+		ID:       id,
+		Status:   StatusEnabled,
+		Created:  time.Now().UTC().Truncate(time.Second),
+		Material: Material(material),
+	}
+	if err := ks.cacheAEAD(k); err != nil {
+		return nil, err
+	}
+
+	ks.Keys = append(ks.Keys, k)
+	ks.Primary = id
+	ks.syncAEADs()
+	ks.logger().Info("key rotated", "key_id", id, "bits", bits, "version", prefixVersion)
+	return k, nil
+}
+
+func (ks *Keyset) Key(id uint32) (*Key, error) {
+	for _, k := range ks.Keys {
+		if k.ID == id {
+			return k, nil
+		}
+	}
+	return nil, errUnknownKey
+}
+
+func (ks *Keyset) SetStatus(id uint32, status string) error {
+	switch status {
+	case StatusEnabled, StatusDisabled:
+	default:
+		return errUnknownStatus
+	}
+
+	k, err := ks.Key(id)
+	if err != nil {
+		return err
+	}
+
+	if id == ks.Primary && status == StatusDisabled {
+		return errDisablePrimary
+	}
+
+	k.Status = status
+	ks.logger().Info("key status changed", "key_id", id, "status", status)
+	return nil
+}
+
+/*
+Seal seals the plaintext with the primary key and prepends the key prefix.
+*/
+func (ks *Keyset) Seal(dst, plaintext []byte, additionalData [][]byte) ([]byte, error) {
+	k, err := ks.Key(ks.Primary)
+	if err != nil || k.Status != StatusEnabled {
+		return nil, ks.auditFailure(siv.OpSeal, formatID(ks.Primary), 0, len(additionalData), errNoPrimary)
+	}
+
+	aead, cached, err := ks.aead(k)
+	if err != nil {
+		return nil, ks.auditFailure(siv.OpSeal, formatID(k.ID), 0, len(additionalData), err)
+	}
+	if !cached {
+		defer aead.Destroy()
+	}
+
+	dst = slices.Grow(dst, prefixSize+len(plaintext)+aead.Overhead())
+	dst = append(dst, prefixVersion, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(dst[len(dst)-4:], k.ID)
+	n, err := aead.SealTo(dst[len(dst):cap(dst)], plaintext, additionalData)
+	if err != nil {
+		ks.logger().Warn("seal failed", "key_id", k.ID, "error", err)
+		return nil, err
+	}
+
+	ks.logger().Debug("sealed", "key_id", k.ID, "version", prefixVersion)
+	return dst[:len(dst)+n], nil
+}
+
+/*
+Open opens the ciphertext with the enabled key referenced by its prefix.
+*/
+func (ks *Keyset) Open(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error) {
+	id, err := KeyID(ciphertext)
+	if err != nil {
+		return nil, ks.auditFailure(siv.OpOpen, "", len(ciphertext), len(additionalData), err)
+	}
+
+	k, err := ks.Key(id)
+	if err != nil {
+		return nil, ks.auditFailure(siv.OpOpen, formatID(id), len(ciphertext), len(additionalData), err)
+	}
+
+	if k.Status != StatusEnabled {
+		return nil, ks.auditFailure(siv.OpOpen, formatID(id), len(ciphertext), len(additionalData), errKeyDisabled)
+	}
+
+	aead, cached, err := ks.aead(k)
+	if err != nil {
+		return nil, ks.auditFailure(siv.OpOpen, formatID(id), len(ciphertext), len(additionalData), err)
+	}
+	if !cached {
+		defer aead.Destroy()
+	}
+
+	plaintext, err := aead.OpenWithMultipleAAD(dst, ciphertext[prefixSize:], additionalData)
+	if err != nil {
+		ks.logger().Warn("open failed", "key_id", id, "version", prefixVersion, "error", err)
+		return nil, err
+	}
+
+	ks.logger().Debug("opened", "key_id", id, "version", prefixVersion)
+	return plaintext, nil
+}
+
+/*
+keyAEAD is the AEAD of a key, destroyed once it's evicted from the cache
+*/
+type keyAEAD interface {
+	multipleAAD
+	Destroy()
+}
+
+type cachedAEAD struct {
+	material Material
+	aead     keyAEAD
+}
+
+/*
+aead returns the cached AEAD of k if it was built from the current material of k.
+Keys added to Keys by hand or whose Material was replaced aren't cached until the
+next Rotate, their AEAD is built for every call and must be destroyed by the caller.
+*/
+func (ks *Keyset) aead(k *Key) (keyAEAD, bool, error) {
+	if c, ok := ks.aeads[k.ID]; ok && subtle.ConstantTimeCompare(c.material, k.Material) == 1 {
+		return c.aead, true, nil
+	}
+	aead, err := ks.newAEAD(k)
+	if err != nil {
+		return nil, false, err
+	}
+	return aead, false, nil
+}
+
+/*
+newAEAD reports to ks.audit rather than to Audit, so Audit and AuditContext
+can be set after the keyset has been loaded
+*/
+func (ks *Keyset) newAEAD(k *Key) (keyAEAD, error) {
+	return siv.NewAesSIV(k.Material, siv.WithAudit(ks.audit, formatID(k.ID), nil))
+}
+
+func (ks *Keyset) cacheAEAD(k *Key) error {
+	aead, err := ks.newAEAD(k)
+	if err != nil {
+		return err
+	}
+	if ks.aeads == nil {
+		ks.aeads = make(map[uint32]*cachedAEAD)
+	}
+	ks.evictAEAD(k.ID)
+	ks.aeads[k.ID] = &cachedAEAD{material: slices.Clone(k.Material), aead: aead}
+	return nil
+}
+
+func (ks *Keyset) evictAEAD(id uint32) {
+	if c, ok := ks.aeads[id]; ok {
+		c.aead.Destroy()
+		clear(c.material)
+		delete(ks.aeads, id)
+	}
+}
+
+/*
+syncAEADs destroys the AEADs of keys removed from Keys or whose Material was
+replaced, and caches the keys added by hand. Invalid keys stay uncached, Seal
+and Open report their error.
+*/
+func (ks *Keyset) syncAEADs() {
+	current := make(map[uint32]*Key, len(ks.Keys))
+	for _, k := range ks.Keys {
+		current[k.ID] = k
+	}
+
+	for id, c := range ks.aeads {
+		if k, ok := current[id]; !ok || subtle.ConstantTimeCompare(c.material, k.Material) != 1 {
+			ks.evictAEAD(id)
+		}
+	}
+	for id, k := range current {
+		if _, ok := ks.aeads[id]; !ok {
+			_ = ks.cacheAEAD(k)
+		}
+	}
+}
+
+func (ks *Keyset) audit(e siv.AuditEvent) {
+	if ks.Audit != nil {
+		e.Context = ks.AuditContext
+		ks.Audit(e)
+	}
+}
+
+/*
+auditFailure logs and reports calls failing before the key is used, e.g. with an unknown key id
+*/
+func (ks *Keyset) auditFailure(op, keyID string, ciphertextLen, aadCount int, err error) error {
+	ks.logger().Warn(op+" failed", "key_id", keyID, "error", err)
+	if ks.Audit != nil {
+		ks.Audit(siv.AuditEvent{
+			Operation:     op,
+			KeyID:         keyID,
+			CiphertextLen: ciphertextLen,
+			AADCount:      aadCount,
+			Err:           err,
+			Context:       ks.AuditContext,
+		})
+	}
+	return err
+}
+
+func formatID(id uint32) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+/*
+KeyID returns the id of the key the ciphertext has been sealed with.
+*/
+func KeyID(ciphertext []byte) (uint32, error) {
+	if len(ciphertext) < prefixSize {
+		return 0, errInvalidPrefix
+	}
+	if ciphertext[0] != prefixVersion {
+		return 0, errPrefixVersion
+	}
+	return binary.BigEndian.Uint32(ciphertext[1:prefixSize]), nil
+}
+
+func (ks *Keyset) newID() (uint32, error) {
+	var b [4]byte
+	for {
+		if err := ks.readRandom(b[:]); err != nil {
+			return 0, err
+		}
+
+		id := binary.BigEndian.Uint32(b[:])
+		if _, err := ks.Key(id); err != nil {
+			return id, nil
+		}
+	}
+}
+
+func (ks *Keyset) readRandom(b []byte) error {
+	r := ks.Rand
+	if r == nil {
+		r = rand.Reader
+	}
+	_, err := io.ReadFull(r, b)
+	return err
+}
+
+func (ks *Keyset) validate() error {
+	ids := make(map[uint32]bool)
+	for _, k := range ks.Keys {
+		if ids[k.ID] {
+			return errDuplicateKeyID
+		}
+		ids[k.ID] = true
+
+		if k.Status != StatusEnabled && k.Status != StatusDisabled {
+			return errUnknownStatus
+		}
+
+		if err := ks.cacheAEAD(k); err != nil {
+			return err
+		}
+	}
+
+	k, err := ks.Key(ks.Primary)
+	if err != nil || k.Status != StatusEnabled {
+		return errNoPrimary
+	}
+	return nil
+}
+
+/*
+SealContext implements siv.Sealer with the primary key
+*/
+func (ks *Keyset) SealContext(_ context.Context, plaintext []byte, additionalData [][]byte) ([]byte, error) {
+	return ks.Seal(nil, plaintext, additionalData)
+}
+
+/*
+OpenContext implements siv.Opener with any enabled key
+*/
+func (ks *Keyset) OpenContext(_ context.Context, ciphertext []byte, additionalData [][]byte) ([]byte, error) {
+	return ks.Open(nil, ciphertext, additionalData)
+}
@@ -0,0 +1,758 @@
+package keyset
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/luc-lynx/siv/siv"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var aad = [][]byte{[]byte("header")}
+
+func TestKeyset(t *testing.T) {
+	t.Run("rotate", testRotate)
+	t.Run("disable", testDisable)
+	t.Run("marshal/parse", testMarshalParse)
+	t.Run("encrypt/decrypt", testEncryptDecrypt)
+	t.Run("invalid keysets", testInvalidKeysets)
+	t.Run("audit", testAudit)
+	t.Run("logging redacts key material", testLogRedaction)
+	t.Run("tink import", testTinkImport)
+	t.Run("tink import errors", testTinkImportErrors)
+	t.Run("scan and re-encrypt", testScan)
+	t.Run("kek sealer", testKEKSealer)
+	t.Run("caching kek", testCachingKEK)
+	t.Run("error classes", testErrorClasses)
+	t.Run("injected randomness", testRand)
+	t.Run("aead cache", testAEADCache)
+}
+
+func testRotate(t *testing.T) {
+	ks, err := New(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := []byte("secret")
+	old, err := ks.Seal(nil, plaintext, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldID := ks.Primary
+	if _, err := ks.Rotate(512); err != nil {
+		t.Fatal(err)
+	}
+	if ks.Primary == oldID || len(ks.Keys) != 2 {
+		t.Fatal("primary key wasn't rotated")
+	}
+
+	current, err := ks.Seal(nil, plaintext, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ct := range [][]byte{old, current} {
+		pt, err := ks.Open(nil, ct, aad)
+		if err != nil || !bytes.Equal(pt, plaintext) {
+			t.Fatal("failed to open", err)
+		}
+	}
+
+	if id, err := KeyID(current); err != nil || id != ks.Primary {
+		t.Error("unexpected key id", id, err)
+	}
+	if id, err := KeyID(old); err != nil || id != oldID {
+		t.Error("unexpected key id", id, err)
+	}
+}
+
+func testDisable(t *testing.T) {
+	ks, err := New(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := ks.Seal(nil, []byte("secret"), aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ks.SetStatus(ks.Primary, StatusDisabled); err == nil {
+		t.Error("primary key was disabled")
+	}
+
+	oldID := ks.Primary
+	if _, err := ks.Rotate(256); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SetStatus(oldID, StatusDisabled); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Open(nil, old, aad); err == nil {
+		t.Error("disabled key opened data")
+	}
+
+	if err := ks.SetStatus(oldID, StatusEnabled); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Open(nil, old, aad); err != nil {
+		t.Error(err)
+	}
+}
+
+func testMarshalParse(t *testing.T) {
+	ks, err := New(384)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct, err := ks.Seal(nil, []byte("secret"), aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ks.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := parsed.Open(nil, ct, aad); err != nil {
+		t.Error(err)
+	}
+}
+
+func testEncryptDecrypt(t *testing.T) {
+	ks, err := New(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kekKey := make([]byte, 32)
+	if _, err := rand.Read(kekKey); err != nil {
+		t.Fatal(err)
+	}
+
+	kek, err := NewSIVKEK(kekKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ks.Encrypt(kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsEncrypted(data) || bytes.Contains(data, []byte("material")) {
+		t.Fatal("keyset isn't encrypted")
+	}
+
+	decrypted, err := Decrypt(data, kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted.Primary != ks.Primary {
+		t.Error("primary key mismatch")
+	}
+
+	kekKey[0] ^= 1
+	otherKek, err := NewSIVKEK(kekKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt(data, otherKek); err == nil {
+		t.Error("keyset was decrypted with another kek")
+	}
+}
+
+func testInvalidKeysets(t *testing.T) {
+	invalid := []string{
+		`{"primary": 1, "keys": []}`,
+		`{"primary": 1, "keys": [{"id": 1, "status": "enabled", "material": "AAAA"}]}`,
+		`{"primary": 1, "keys": [{"id": 1, "status": "destroyed",
+			"material": "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}]}`,
+		`{"primary": 1, "keys": [{"id": 1, "status": "disabled",
+			"material": "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}]}`,
+		`{"primary": 1, "keys": [{"id": 1, "status": "enabled",
+			"material": "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA-="}]}`,
+		`{"primary": 1, "keys": [{"id": 1, "status": "enabled", "material": 42}]}`,
+	}
+
+	for i := range invalid {
+		if _, err := Parse([]byte(invalid[i])); err == nil {
+			t.Errorf("keyset %d was accepted", i)
+		}
+	}
+}
+
+func testAudit(t *testing.T) {
+	ks, err := New(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []siv.AuditEvent
+	ks.Audit = func(e siv.AuditEvent) {
+		events = append(events, e)
+	}
+	ks.AuditContext = map[string]string{"service": "billing"}
+
+	ct, err := ks.Seal(nil, []byte("secret"), aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Open(nil, ct, aad); err != nil {
+		t.Fatal(err)
+	}
+	ct[len(ct)-1] ^= 1
+	if _, err := ks.Open(nil, ct, aad); err == nil {
+		t.Fatal("tampered ciphertext opened")
+	}
+	if _, err := ks.Open(nil, []byte("garbage"), aad); err == nil {
+		t.Fatal("ciphertext without prefix opened")
+	}
+
+	id := strconv.FormatUint(uint64(ks.Primary), 10)
+	expected := []struct {
+		op        string
+		keyID     string
+		plaintext int
+		failed    bool
+	}{
+		{siv.OpSeal, id, 6, false},
+		{siv.OpOpen, id, 6, false},
+		{siv.OpOpen, id, 0, true},
+		{siv.OpOpen, "", 0, true},
+	}
+
+	if len(events) != len(expected) {
+		t.Fatalf("got %d events, expected %d", len(events), len(expected))
+	}
+	for i, e := range expected {
+		got := events[i]
+		if got.Operation != e.op || got.KeyID != e.keyID || got.PlaintextLen != e.plaintext ||
+			(got.Err != nil) != e.failed || got.Context["service"] != "billing" {
+			t.Errorf("event %d: %+v", i, got)
+		}
+	}
+}
+
+func testLogRedaction(t *testing.T) {
+	var out bytes.Buffer
+	l := slog.New(slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	ks, err := New(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.SetLogger(l)
+	if _, err := ks.Rotate(256); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Open(nil, []byte{prefixVersion, 0, 0, 0, 0, 0}, nil); err == nil {
+		t.Fatal("unknown key id accepted")
+	}
+
+	k := ks.Keys[0]
+	ks.logger().Info("misuse", "key", k, "material", k.Material, "raw", []byte(k.Material),
+		slog.Group("nested", "raw", []byte(k.Material)))
+
+	kek := NewLoggingKEK(&failingKEK{}, l)
+	if _, err := ks.Encrypt(kek); err == nil {
+		t.Fatal("kek error is lost")
+	}
+
+	printed := fmt.Sprintf("%v %x %+v %#v", k.Material, k.Material, *k, k.Material)
+	for _, material := range []string{hex.EncodeToString(k.Material), base64.StdEncoding.EncodeToString(k.Material)} {
+		if strings.Contains(out.String(), material) || strings.Contains(printed, material) {
+			t.Fatalf("key material leaked:\n%s\n%s", out.String(), printed)
+		}
+	}
+
+	for _, expected := range []string{"key rotated", strconv.FormatUint(uint64(ks.Primary), 10), "open failed", "kek encrypt failed", "kms unavailable"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("log doesn't contain %q:\n%s", expected, out.String())
+		}
+	}
+}
+
+type failingKEK struct{}
+
+func (k *failingKEK) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	return nil, errors.New("kms unavailable")
+}
+
+func (k *failingKEK) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	return nil, errors.New("kms unavailable")
+}
+
+func protoField(num int, b []byte) []byte {
+	out := binary.AppendUvarint(nil, uint64(num<<3|wireBytes))
+	out = binary.AppendUvarint(out, uint64(len(b)))
+	return append(out, b...)
+}
+
+func protoVarint(num int, v uint64) []byte {
+	out := binary.AppendUvarint(nil, uint64(num<<3|wireVarint))
+	return binary.AppendUvarint(out, v)
+}
+
+func tinkKeyProto(id uint32, status, prefix uint64, typeURL string, material []byte) []byte {
+	keyData := append(protoField(1, []byte(typeURL)), protoField(2, protoField(2, material))...)
+	key := protoField(1, keyData)
+	key = append(key, protoVarint(2, status)...)
+	key = append(key, protoVarint(3, uint64(id))...)
+	return append(key, protoVarint(4, prefix)...)
+}
+
+func tinkKeysetJSON(primary uint32, keys ...string) []byte {
+	return []byte(fmt.Sprintf(`{"primaryKeyId": %d, "key": [%s]}`, primary, strings.Join(keys, ",")))
+}
+
+func tinkKeyJSON(id uint32, status, prefix, typeURL string, material []byte) string {
+	value := base64.StdEncoding.EncodeToString(protoField(2, material))
+	return fmt.Sprintf(`{"keyData": {"typeUrl": %q, "value": %q, "keyMaterialType": "SYMMETRIC"},
+		"status": %q, "keyId": %d, "outputPrefixType": %q}`, typeURL, value, status, id, prefix)
+}
+
+func testTinkImport(t *testing.T) {
+	primary := make([]byte, 64)
+	old := make([]byte, 64)
+	for i := range primary {
+		primary[i] = byte(i)
+		old[i] = byte(255 - i)
+	}
+
+	// a Tink ciphertext is the TINK prefix followed by AES-SIV with the associated data as the only component
+	a, err := siv.NewAesSIV(primary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tinkCiphertext := append([]byte{0x01, 0x12, 0x34, 0x56, 0x78}, a.SealWithMultipleAAD(nil, []byte("secret"), aad)...)
+
+	binaryKeyset := append(protoVarint(1, 0x12345678),
+		protoField(2, tinkKeyProto(0x12345678, 1, 1, tinkAesSivTypeURL, primary))...)
+	binaryKeyset = append(binaryKeyset, protoField(2, tinkKeyProto(7, 2, 1, tinkAesSivTypeURL, old))...)
+	binaryKeyset = append(binaryKeyset, protoField(2, tinkKeyProto(8, 3, 1, tinkAesSivTypeURL, nil))...)
+
+	kek, err := NewSIVKEK(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := kek.Encrypt(binaryKeyset, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedBinary := protoField(2, encrypted)
+	encryptedJSON := []byte(fmt.Sprintf(`{"encryptedKeyset": %q, "keysetInfo": {"primaryKeyId": 305419896}}`,
+		base64.StdEncoding.EncodeToString(encrypted)))
+
+	inputs := map[string][]byte{
+		"json": tinkKeysetJSON(0x12345678,
+			tinkKeyJSON(0x12345678, "ENABLED", "TINK", tinkAesSivTypeURL, primary),
+			tinkKeyJSON(7, "DISABLED", "TINK", tinkAesSivTypeURL, old),
+			`{"status": "DESTROYED", "keyId": 8, "outputPrefixType": "TINK"}`),
+		"binary":           binaryKeyset,
+		"encrypted binary": encryptedBinary,
+		"encrypted json":   encryptedJSON,
+	}
+
+	for name, data := range inputs {
+		ks, err := ImportTink(data, kek)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		if ks.Primary != 0x12345678 || len(ks.Keys) != 2 || ks.Keys[1].Status != StatusDisabled {
+			t.Errorf("%s: wrong keyset %v", name, ks)
+			continue
+		}
+
+		plaintext, err := ks.Open(nil, tinkCiphertext, aad)
+		if err != nil || string(plaintext) != "secret" {
+			t.Errorf("%s: can't open the Tink ciphertext: %v", name, err)
+		}
+	}
+}
+
+func testTinkImportErrors(t *testing.T) {
+	material := make([]byte, 64)
+	for i := range material {
+		material[i] = byte(i)
+	}
+
+	kek, err := NewSIVKEK(material)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := kek.Encrypt(tinkKeyProto(1, 1, 1, tinkAesSivTypeURL, material), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		data []byte
+		kek  KEK
+		err  error
+	}{
+		{"raw prefix", tinkKeysetJSON(1, tinkKeyJSON(1, "ENABLED", "RAW", tinkAesSivTypeURL, material)), nil, errTinkPrefix},
+		{"other key type", tinkKeysetJSON(1, tinkKeyJSON(1, "ENABLED", "TINK", "type.googleapis.com/google.crypto.tink.AesGcmKey", material[:16])), nil, errTinkKeyType},
+		{"unknown status", tinkKeysetJSON(1, tinkKeyJSON(1, "UNKNOWN_STATUS", "TINK", tinkAesSivTypeURL, material)), nil, errTinkStatus},
+		{"no keys", tinkKeysetJSON(1), nil, errTinkEmpty},
+		{"primary disabled", tinkKeysetJSON(1, tinkKeyJSON(1, "DISABLED", "TINK", tinkAesSivTypeURL, material)), nil, errNoPrimary},
+		{"encrypted without kek", protoField(2, encrypted), nil, errTinkEncrypted},
+		{"truncated protobuf", protoField(2, encrypted)[:10], nil, errProtobufTruncated},
+	}
+
+	for _, c := range cases {
+		if _, err := ImportTink(c.data, c.kek); !errors.Is(err, c.err) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.err, err)
+		}
+	}
+}
+
+func testScan(t *testing.T) {
+	ks, err := New(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldID := ks.Primary
+
+	dir := t.TempDir()
+	names := []string{"a", "b/c", "b-d", "e"}
+	for i, name := range names {
+		data, err := ks.Seal(nil, []byte(name), aad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == len(names)-1 {
+			data = []byte("not sealed")
+		}
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := ks.Rotate(512); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first run stops after two items, the second one resumes from the checkpoint
+	var checkpoints []string
+	errStop := errors.New("stop")
+	s := &Scanner{
+		Keyset:    ks,
+		AAD:       func(string) [][]byte { return aad },
+		Reencrypt: true,
+		Rate:      1000,
+		Checkpoint: func(name string) error {
+			checkpoints = append(checkpoints, name)
+			if len(checkpoints) == 2 {
+				return errStop
+			}
+			return nil
+		},
+	}
+
+	r, err := s.Scan(context.Background(), DirCorpus(dir), "")
+	if err != errStop || r.Last != "b-d" || r.Reencrypted != 2 {
+		t.Fatalf("first run: %v, %+v", err, r)
+	}
+
+	r, err = s.Scan(context.Background(), DirCorpus(dir), r.Last)
+	if err != nil || r.Items != 2 || r.Reencrypted != 1 || r.Unknown != 1 || r.Keys[oldID] != 1 {
+		t.Fatalf("second run: %v, %+v", err, r)
+	}
+	if strings.Join(checkpoints, ",") != "a,b-d,b/c,e" {
+		t.Errorf("unexpected order %v", checkpoints)
+	}
+
+	r, err = (&Scanner{Keyset: ks}).Scan(context.Background(), DirCorpus(dir), "")
+	if err != nil || r.Keys[ks.Primary] != 3 || r.Keys[oldID] != 0 || r.Algorithms[siv.AlgAESSIVCMAC512] != 3 {
+		t.Fatalf("after re-encryption: %v, %+v", err, r)
+	}
+
+	for _, name := range names[:3] {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plaintext, err := ks.Open(nil, data, aad); err != nil || string(plaintext) != name {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.Scan(ctx, DirCorpus(dir), ""); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+
+	if _, err := DirCorpus(dir).Read("../x"); err != errItemName {
+		t.Errorf("expected %v, got %v", errItemName, err)
+	}
+}
+
+func testKEKSealer(t *testing.T) {
+	kek, err := NewSIVKEK(append(bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := KEKSealer(kek)
+	ctx := context.Background()
+
+	sealed, err := s.SealContext(ctx, []byte("dek"), [][]byte{[]byte("ab"), []byte("c")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plaintext, err := s.OpenContext(ctx, sealed, [][]byte{[]byte("ab"), []byte("c")}); err != nil || string(plaintext) != "dek" {
+		t.Fatal("doesn't round trip", err)
+	}
+
+	// the joined associated data keeps the component boundaries
+	if _, err := s.OpenContext(ctx, sealed, [][]byte{[]byte("a"), []byte("bc")}); err == nil {
+		t.Error("opened with differently split associated data")
+	}
+}
+
+type countingKEK struct {
+	KEK
+	decrypts int
+}
+
+func (k *countingKEK) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	k.decrypts++
+	return k.KEK.Decrypt(ciphertext, associatedData)
+}
+
+func testCachingKEK(t *testing.T) {
+	sivKEK, err := NewSIVKEK(append(bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kek := &countingKEK{KEK: sivKEK}
+
+	now := time.Unix(1700000000, 0)
+	c := NewCachingKEK(kek, time.Minute, 2)
+	c.now = func() time.Time { return now }
+
+	wrapped := make([][]byte, 3)
+	for i := range wrapped {
+		if wrapped[i], err = c.Encrypt([]byte{byte('a' + i)}, []byte("dek")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	decrypt := func(i int) {
+		t.Helper()
+		plaintext, err := c.Decrypt(wrapped[i], []byte("dek"))
+		if err != nil || string(plaintext) != string(rune('a'+i)) {
+			t.Fatalf("dek %d: %q, %v", i, plaintext, err)
+		}
+		// callers wiping their copy don't wipe the cache
+		clear(plaintext)
+	}
+
+	decrypt(0)
+	decrypt(0)
+	if kek.decrypts != 1 {
+		t.Errorf("cached dek was unwrapped again, %d decrypts", kek.decrypts)
+	}
+
+	if _, err := c.Decrypt(wrapped[0], []byte("other")); err == nil || kek.decrypts != 2 {
+		t.Error("cache hit with different associated data")
+	}
+
+	// 1 and 2 evict 0, the least recently used entry
+	decrypt(1)
+	decrypt(2)
+	decrypt(1)
+	decrypt(0)
+	if kek.decrypts != 5 || c.Len() != 2 {
+		t.Errorf("unexpected eviction: %d decrypts, %d entries", kek.decrypts, c.Len())
+	}
+
+	now = now.Add(time.Minute)
+	decrypt(0)
+	if kek.decrypts != 6 {
+		t.Error("expired entry was used")
+	}
+
+	c.Wipe()
+	if c.Len() != 0 {
+		t.Error("entries left after Wipe")
+	}
+}
+
+func testErrorClasses(t *testing.T) {
+	ks, err := New(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := ks.Seal(nil, []byte("classes"), aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	future := append([]byte{0x02}, sealed[1:]...)
+	modified := append([]byte{}, sealed...)
+	modified[len(modified)-1] ^= 1
+
+	for _, c := range []struct {
+		ciphertext []byte
+		class      error
+	}{
+		{sealed[:3], siv.ErrMalformed},
+		{future, siv.ErrUnsupportedVersion},
+		{modified, siv.ErrAuthentication},
+	} {
+		if _, err := ks.Open(nil, c.ciphertext, aad); !errors.Is(err, c.class) {
+			t.Errorf("expected %v, got %v", c.class, err)
+		}
+	}
+
+	if _, err := ks.Seal(nil, []byte("classes"), make([][]byte, siv.MaxAssociatedData+1)); !errors.Is(err, siv.ErrMalformed) {
+		t.Errorf("too many associated data strings: expected %v, got %v", siv.ErrMalformed, err)
+	}
+}
+
+func testRand(t *testing.T) {
+	seed := strings.Repeat("k", 32) + strings.Repeat("K", 32) + "\x00\x00\x00\x07"
+
+	ks := &Keyset{Rand: strings.NewReader(seed)}
+	k, err := ks.Rotate(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(k.Material) != seed[:64] || k.ID != 7 || ks.Primary != 7 {
+		t.Fatalf("key wasn't drawn from the reader: id %d", k.ID)
+	}
+
+	if _, err := ks.Rotate(256); err == nil {
+		t.Error("no error from an exhausted reader")
+	}
+}
+
+func testAEADCache(t *testing.T) {
+	ks, err := New(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Rotate(512); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ks.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ks := range []*Keyset{ks, parsed} {
+		if len(ks.aeads) != len(ks.Keys) {
+			t.Fatalf("%d AEADs cached for %d keys", len(ks.aeads), len(ks.Keys))
+		}
+		for _, k := range ks.Keys {
+			first, cached, err := ks.aead(k)
+			if err != nil || !cached {
+				t.Fatalf("key %d: not cached: %v", k.ID, err)
+			}
+			second, _, err := ks.aead(k)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first != second {
+				t.Errorf("key %d: AEAD is built on every call", k.ID)
+			}
+		}
+	}
+
+	// a key appended by hand still works, without being cached
+	material, err := siv.GenerateKey(nil, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &Key{ID: 1, Status: StatusEnabled, Material: Material(material)}
+	ks.Keys = append(ks.Keys, k)
+	ks.Primary = k.ID
+	ct, err := ks.Seal(nil, []byte("secret"), aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Open(nil, ct, aad); err != nil {
+		t.Fatal(err)
+	}
+
+	// replaced material is used right away, not the cached AEAD of the old one
+	if material, err = siv.GenerateKey(nil, 256); err != nil {
+		t.Fatal(err)
+	}
+	replaced := ks.Keys[0]
+	old, _, _ := ks.aead(replaced)
+	replaced.Material = Material(material)
+	ks.Primary = replaced.ID
+	ct, err = ks.Seal(nil, []byte("secret"), aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := siv.NewAesSIV(material)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pt, err := fresh.OpenWithMultipleAAD(nil, ct[prefixSize:], aad); err != nil || string(pt) != "secret" {
+		t.Fatalf("sealed with the old material: %v", err)
+	}
+
+	// Rotate caches the new material and the hand-added key, and destroys the
+	// AEADs of replaced and removed keys
+	removed := ks.Keys[1]
+	removedAEAD, _, _ := ks.aead(removed)
+	ks.Keys = slices.Delete(ks.Keys, 1, 2)
+	if _, err := ks.Rotate(256); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ks.aeads[removed.ID]; ok {
+		t.Error("removed key is still cached")
+	}
+	if len(ks.aeads) != len(ks.Keys) {
+		t.Errorf("%d AEADs cached for %d keys", len(ks.aeads), len(ks.Keys))
+	}
+	for _, k := range ks.Keys {
+		if _, cached, _ := ks.aead(k); !cached {
+			t.Errorf("key %d isn't cached after Rotate", k.ID)
+		}
+	}
+	for name, aead := range map[string]keyAEAD{"replaced": old, "removed": removedAEAD} {
+		if _, err := aead.SealTo(make([]byte, 64), []byte("secret"), aad); err == nil {
+			t.Errorf("%s key: evicted AEAD isn't destroyed", name)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package keyset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/luc-lynx/siv/ct"
+	"io"
+	"log/slog"
+	"reflect"
+)
+
+const redacted = "[redacted]"
+
+var errMaterialFormat = errors.New("key material must be a base64 string")
+
+/*
+Material is raw key material. It's encoded to JSON as base64 like any []byte,
+but it's printed and logged as [redacted], so keys can be logged as is.
+*/
+type Material []byte
+
+func (m Material) String() string {
+	return redacted
+}
+
+func (m Material) GoString() string {
+	return redacted
+}
+
+func (m Material) Format(f fmt.State, verb rune) {
+	io.WriteString(f, redacted)
+}
+
+func (m Material) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+/*
+UnmarshalJSON decodes the base64 string with ct.DecodeBase64
+*/
+func (m *Material) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*m = nil
+		return nil
+	}
+
+	if len(data) < 2 || data[0] != '"' || data[len(data)-1] != '"' {
+		return errMaterialFormat
+	}
+
+	material, err := ct.DecodeBase64(data[1 : len(data)-1])
+	if err != nil {
+		return err
+	}
+	*m = material
+	return nil
+}
+
+func (k *Key) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Any("id", k.ID),
+		slog.String("status", k.Status),
+		slog.Time("created", k.Created),
+		slog.Int("bits", len(k.Material)*8),
+	)
+}
+
+func (ks *Keyset) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Any("primary", ks.Primary),
+		slog.Int("keys", len(ks.Keys)),
+	)
+}
+
+/*
+NewLogHandler wraps h so that attributes holding byte slices or arrays are
+replaced with [redacted] before they reach h. Key ids, versions and errors
+pass through. Keysets and KEKs log through this handler only, see SetLogger
+and NewLoggingKEK.
+*/
+func NewLogHandler(h slog.Handler) slog.Handler {
+	if r, ok := h.(*redactingHandler); ok {
+		return r
+	}
+	return &redactingHandler{h}
+}
+
+type redactingHandler struct {
+	slog.Handler
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	clean := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		clean.AddAttrs(redact(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, clean)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clean := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		clean[i] = redact(a)
+	}
+	return &redactingHandler{h.Handler.WithAttrs(clean)}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{h.Handler.WithGroup(name)}
+}
+
+func redact(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindGroup:
+		group := v.Group()
+		clean := make([]slog.Attr, len(group))
+		for i, g := range group {
+			clean[i] = redact(g)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(clean...)}
+	case slog.KindAny:
+		if isBytes(v.Any()) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+func isBytes(v interface{}) bool {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return false
+	}
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() == reflect.Uint8
+}
+
+/*
+SetLogger makes the keyset log rotations, status changes and failed opens to l
+through NewLogHandler, successful seals and opens are logged at debug level.
+*/
+func (ks *Keyset) SetLogger(l *slog.Logger) {
+	ks.log = slog.New(NewLogHandler(l.Handler()))
+}
+
+func (ks *Keyset) logger() *slog.Logger {
+	if ks.log == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return ks.log
+}
+
+type loggingKEK struct {
+	kek KEK
+	log *slog.Logger
+}
+
+/*
+NewLoggingKEK returns a KEK logging the errors of kek, e.g. KMS failures, to l
+through NewLogHandler.
+*/
+func NewLoggingKEK(kek KEK, l *slog.Logger) KEK {
+	return &loggingKEK{kek: kek, log: slog.New(NewLogHandler(l.Handler()))}
+}
+
+func (k *loggingKEK) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	ciphertext, err := k.kek.Encrypt(plaintext, associatedData)
+	if err != nil {
+		k.log.Error("kek encrypt failed", "error", err)
+	}
+	return ciphertext, err
+}
+
+func (k *loggingKEK) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	plaintext, err := k.kek.Decrypt(ciphertext, associatedData)
+	if err != nil {
+		k.log.Error("kek decrypt failed", "error", err)
+	}
+	return plaintext, err
+}
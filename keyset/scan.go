@@ -0,0 +1,247 @@
+package keyset
+
+import (
+	"context"
+	"errors"
+	"github.com/luc-lynx/siv/siv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var errItemName = errors.New("item name is outside of the corpus")
+
+/*
+Scanner walks a corpus of data sealed with a keyset, counts which keys and
+algorithms are in use and optionally re-encrypts items under the primary key.
+
+Items are visited in the order of Corpus.Walk and Checkpoint is called after
+every item, so a scan interrupted by an error or a cancelled context can be
+resumed from the last checkpoint.
+*/
+type Scanner struct {
+	Keyset *Keyset
+
+	// AAD returns the associated data an item has been sealed with, nil means none
+	AAD func(name string) [][]byte
+
+	// Reencrypt seals items that aren't sealed with the primary key again
+	Reencrypt bool
+
+	// Rate limits re-encryptions per second, 0 means no limit
+	Rate float64
+
+	// Checkpoint, if set, is called with the name of every processed item
+	Checkpoint func(name string) error
+}
+
+/*
+Corpus is a collection of sealed items, for example files or objects in a bucket
+*/
+type Corpus interface {
+	// Walk calls fn for the names of all items after the given one in a stable order,
+	// after is empty for a full walk
+	Walk(ctx context.Context, after string, fn func(name string) error) error
+	Read(name string) ([]byte, error)
+	// Write replaces the item, atomically if the storage allows it
+	Write(name string, data []byte) error
+}
+
+/*
+Report summarizes a scan. Items that don't have a keyset prefix or are sealed with
+a key that isn't in the keyset are counted as Unknown.
+*/
+type Report struct {
+	Items       int
+	Keys        map[uint32]int
+	Algorithms  map[string]int
+	Unknown     int
+	Reencrypted int
+	Failed      map[string]error
+	Last        string
+}
+
+/*
+Scan processes the items of the corpus after the given name, pass the last checkpoint
+to resume. Failures to open or re-encrypt an item are recorded in the report,
+errors of the corpus, the checkpoint or the context stop the scan.
+*/
+func (s *Scanner) Scan(ctx context.Context, c Corpus, after string) (*Report, error) {
+	r := &Report{
+		Keys:       make(map[uint32]int),
+		Algorithms: make(map[string]int),
+		Failed:     make(map[string]error),
+		Last:       after,
+	}
+
+	var interval time.Duration
+	if s.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / s.Rate)
+	}
+	var next time.Time
+
+	err := c.Walk(ctx, after, func(name string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		data, err := c.Read(name)
+		if err != nil {
+			return err
+		}
+		r.Items++
+
+		if reencrypt := s.count(r, data); reencrypt && s.Reencrypt {
+			if wait := time.Until(next); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+			next = time.Now().Add(interval)
+
+			if err := s.reencrypt(c, name, data); err != nil {
+				r.Failed[name] = err
+			} else {
+				r.Reencrypted++
+			}
+		}
+
+		r.Last = name
+		if s.Checkpoint != nil {
+			return s.Checkpoint(name)
+		}
+		return nil
+	})
+	return r, err
+}
+
+/*
+count records the key of the item and reports whether it should be re-encrypted
+*/
+func (s *Scanner) count(r *Report, data []byte) bool {
+	id, err := KeyID(data)
+	if err != nil {
+		r.Unknown++
+		return false
+	}
+
+	k, err := s.Keyset.Key(id)
+	if err != nil {
+		r.Unknown++
+		return false
+	}
+
+	r.Keys[id]++
+	if a, err := siv.NewAesSIV(k.Material); err == nil {
+		r.Algorithms[a.Algorithm()]++
+	}
+	return id != s.Keyset.Primary
+}
+
+func (s *Scanner) reencrypt(c Corpus, name string, data []byte) error {
+	var aad [][]byte
+	if s.AAD != nil {
+		aad = s.AAD(name)
+	}
+
+	plaintext, err := s.Keyset.Open(nil, data, aad)
+	if err != nil {
+		return err
+	}
+	defer clear(plaintext)
+
+	sealed, err := s.Keyset.Seal(nil, plaintext, aad)
+	if err != nil {
+		return err
+	}
+	return c.Write(name, sealed)
+}
+
+/*
+DirCorpus is a Corpus of the regular files under a directory, names are slash separated
+paths relative to it. Files are replaced atomically by renaming a temporary file.
+*/
+type DirCorpus string
+
+func (d DirCorpus) Walk(ctx context.Context, after string, fn func(name string) error) error {
+	// names are sorted as strings, WalkDir's order differs once names contain separators
+	var names []string
+	err := filepath.WalkDir(string(d), func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !e.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(string(d), path)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); name > after {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		if err := fn(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d DirCorpus) Read(name string) ([]byte, error) {
+	path, err := d.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func (d DirCorpus) Write(name string, data []byte) error {
+	path, err := d.path(name)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp"+strconv.Itoa(os.Getpid()))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+/*
+path rejects names escaping the directory
+*/
+func (d DirCorpus) path(name string) (string, error) {
+	local := filepath.FromSlash(name)
+	if !filepath.IsLocal(local) {
+		return "", errItemName
+	}
+	return filepath.Join(string(d), local), nil
+}
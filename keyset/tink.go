@@ -0,0 +1,322 @@
+package keyset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/luc-lynx/siv/ct"
+	"time"
+)
+
+/*
+Import of Tink keyset files.
+
+Tink's AES-SIV keys are RFC 5297 AES-SIV keys with a single associated data
+component, so a Tink ciphertext produced with associated data ad is opened by
+Keyset.Open with [][]byte{ad}. Tink's TINK output prefix is
+
+	0x01 || key id (4 bytes, big endian)
+
+which is exactly the prefix of this package, key ids are kept as they are.
+Keys with the RAW, LEGACY or CRUNCHY prefixes can't be represented and are
+rejected, destroyed keys are skipped.
+
+Both the JSON and the binary (protobuf) encodings are read. Encrypted keysets
+are decrypted with a KEK, a Tink KMS AEAD has the same method set and can be
+passed as it is; like Tink's keyset.Read no associated data is used.
+*/
+
+const (
+	tinkAesSivTypeURL = "type.googleapis.com/google.crypto.tink.AesSivKey"
+
+	// protobuf wire types
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var (
+	errTinkKeyType       = errors.New("tink keyset contains a key that is not AES-SIV")
+	errTinkPrefix        = errors.New("tink keyset contains a key without the TINK output prefix")
+	errTinkStatus        = errors.New("tink keyset contains a key with an unknown status")
+	errTinkKeyVersion    = errors.New("tink keyset contains an AES-SIV key of an unsupported version")
+	errTinkEncrypted     = errors.New("tink keyset is encrypted, a KEK is required")
+	errTinkEmpty         = errors.New("tink keyset doesn't contain keys")
+	errProtobufTruncated = errors.New("tink keyset: truncated protobuf")
+	errProtobufWireType  = errors.New("tink keyset: unsupported protobuf wire type")
+)
+
+// Tink enum values, the JSON encoding uses the names
+var (
+	tinkStatuses = map[uint64]string{1: "ENABLED", 2: "DISABLED", 3: "DESTROYED"}
+	tinkPrefixes = map[uint64]string{1: "TINK", 2: "LEGACY", 3: "RAW", 4: "CRUNCHY"}
+)
+
+type tinkKey struct {
+	KeyData struct {
+		TypeURL string `json:"typeUrl"`
+		Value   string `json:"value"`
+		value   []byte
+	} `json:"keyData"`
+	Status           string `json:"status"`
+	KeyID            uint32 `json:"keyId"`
+	OutputPrefixType string `json:"outputPrefixType"`
+}
+
+type tinkKeyset struct {
+	PrimaryKeyID    uint32     `json:"primaryKeyId"`
+	Key             []*tinkKey `json:"key"`
+	EncryptedKeyset string     `json:"encryptedKeyset"`
+}
+
+/*
+ImportTink reads a cleartext or encrypted Tink keyset in the JSON or binary encoding.
+kek is only used for encrypted keysets and may be nil otherwise.
+*/
+func ImportTink(data []byte, kek KEK) (*Keyset, error) {
+	tks, encrypted, err := parseTink(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if encrypted != nil {
+		if kek == nil {
+			return nil, errTinkEncrypted
+		}
+
+		cleartext, err := kek.Decrypt(encrypted, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer clear(cleartext)
+
+		// the encrypted keyset is always binary
+		tks = &tinkKeyset{}
+		if err := tks.unmarshalProto(cleartext); err != nil {
+			return nil, err
+		}
+	}
+
+	return tks.keyset()
+}
+
+/*
+parseTink decodes a Tink keyset, the ciphertext of an encrypted keyset is returned separately
+*/
+func parseTink(data []byte) (*tinkKeyset, []byte, error) {
+	tks := &tinkKeyset{}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, tks); err != nil {
+			return nil, nil, err
+		}
+
+		if tks.EncryptedKeyset != "" {
+			encrypted, err := ct.DecodeBase64([]byte(tks.EncryptedKeyset))
+			return nil, encrypted, err
+		}
+
+		for _, k := range tks.Key {
+			value, err := ct.DecodeBase64([]byte(k.KeyData.Value))
+			if err != nil {
+				return nil, nil, err
+			}
+			k.KeyData.value = value
+		}
+		return tks, nil, nil
+	}
+
+	// binary EncryptedKeyset has the ciphertext in field 2, Keyset has the keys there
+	var encrypted []byte
+	err := protoFields(data, func(num int, _ uint64, b []byte) error {
+		if num == 2 && b != nil && encrypted == nil && !looksLikeTinkKey(b) {
+			encrypted = b
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if encrypted != nil {
+		return nil, encrypted, nil
+	}
+
+	if err := tks.unmarshalProto(data); err != nil {
+		return nil, nil, err
+	}
+	return tks, nil, nil
+}
+
+/*
+looksLikeTinkKey reports whether b parses as a Keyset.Key message with key data
+*/
+func looksLikeTinkKey(b []byte) bool {
+	k := &tinkKey{}
+	return k.unmarshalProto(b) == nil && k.KeyData.TypeURL != ""
+}
+
+func (tks *tinkKeyset) unmarshalProto(data []byte) error {
+	return protoFields(data, func(num int, v uint64, b []byte) error {
+		switch num {
+		case 1:
+			tks.PrimaryKeyID = uint32(v)
+		case 2:
+			k := &tinkKey{}
+			if err := k.unmarshalProto(b); err != nil {
+				return err
+			}
+			tks.Key = append(tks.Key, k)
+		}
+		return nil
+	})
+}
+
+func (k *tinkKey) unmarshalProto(data []byte) error {
+	return protoFields(data, func(num int, v uint64, b []byte) error {
+		switch num {
+		case 1:
+			return protoFields(b, func(num int, _ uint64, b []byte) error {
+				switch num {
+				case 1:
+					k.KeyData.TypeURL = string(b)
+				case 2:
+					k.KeyData.value = b
+				}
+				return nil
+			})
+		case 2:
+			k.Status = tinkStatuses[v]
+		case 3:
+			k.KeyID = uint32(v)
+		case 4:
+			k.OutputPrefixType = tinkPrefixes[v]
+		}
+		return nil
+	})
+}
+
+/*
+keyset converts the Tink keys and validates the result
+*/
+func (tks *tinkKeyset) keyset() (*Keyset, error) {
+	ks := &Keyset{Primary: tks.PrimaryKeyID}
+	created := time.Now().UTC().Truncate(time.Second)
+
+	for _, tk := range tks.Key {
+		var status string
+		switch tk.Status {
+		case "ENABLED":
+			status = StatusEnabled
+		case "DISABLED":
+			status = StatusDisabled
+		case "DESTROYED":
+			continue
+		default:
+			return nil, errTinkStatus
+		}
+
+		if tk.KeyData.TypeURL != tinkAesSivTypeURL {
+			return nil, fmt.Errorf("%w: key %d has type %q", errTinkKeyType, tk.KeyID, tk.KeyData.TypeURL)
+		}
+		if tk.OutputPrefixType != "TINK" {
+			return nil, fmt.Errorf("%w: key %d has prefix %q", errTinkPrefix, tk.KeyID, tk.OutputPrefixType)
+		}
+
+		material, err := aesSivKeyValue(tk.KeyData.value)
+		if err != nil {
+			return nil, err
+		}
+
+		ks.Keys = append(ks.Keys, &Key{
+			ID:       tk.KeyID,
+			Status:   status,
+			Created:  created,
+			Material: material,
+		})
+	}
+
+	if len(ks.Keys) == 0 {
+		return nil, errTinkEmpty
+	}
+
+	if err := ks.validate(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+/*
+aesSivKeyValue extracts the key from a serialized AesSivKey message:
+version (field 1, must be 0) and key_value (field 2)
+*/
+func aesSivKeyValue(data []byte) ([]byte, error) {
+	var material []byte
+	err := protoFields(data, func(num int, v uint64, b []byte) error {
+		switch num {
+		case 1:
+			if v != 0 {
+				return errTinkKeyVersion
+			}
+		case 2:
+			material = append([]byte{}, b...)
+		}
+		return nil
+	})
+	return material, err
+}
+
+/*
+protoFields calls f for every varint and length-delimited field of a protobuf message,
+with the value of varints or the bytes of length-delimited fields. Fixed size fields are skipped.
+*/
+func protoFields(data []byte, f func(num int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errProtobufTruncated
+		}
+		data = data[n:]
+
+		num := int(tag >> 3)
+		var v uint64
+		var b []byte
+
+		switch tag & 7 {
+		case wireVarint:
+			v, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errProtobufTruncated
+			}
+			data = data[n:]
+		case wireBytes:
+			l, n := binary.Uvarint(data)
+			if n <= 0 || l > uint64(len(data)-n) {
+				return errProtobufTruncated
+			}
+			b = data[n : n+int(l)]
+			data = data[n+int(l):]
+		case wireFixed64:
+			if len(data) < 8 {
+				return errProtobufTruncated
+			}
+			data = data[8:]
+			continue
+		case wireFixed32:
+			if len(data) < 4 {
+				return errProtobufTruncated
+			}
+			data = data[4:]
+			continue
+		default:
+			return errProtobufWireType
+		}
+
+		if err := f(num, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
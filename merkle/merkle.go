@@ -0,0 +1,220 @@
+/*
+Package merkle authenticates an object chunk by chunk under one small root, so a
+reader holding the key and the root can verify any chunk it fetched, for example a
+range of a CDN-served file, without reading the rest of the object.
+
+All tags are AES-CMAC under one key with a domain byte in front:
+
+	leaf = CMAC(K, 0x00 || index (8 bytes) || chunk)
+	node = CMAC(K, 0x01 || left || right)
+	root = CMAC(K, 0x02 || chunk size (8 bytes) || chunks (8 bytes) || top node)
+
+Indices are big endian. A node without a sibling at the end of a level moves up
+unchanged. The proof of a chunk is the list of its siblings from the leaf level up,
+it grows with the logarithm of the number of chunks. The chunk size and count are
+bound by the root, so a reader can't be made to accept a shorter object or other
+chunk boundaries. Use a key dedicated to the index, CMAC is a MAC, not a hash:
+everybody who can verify can also forge.
+*/
+package merkle
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"github.com/luc-lynx/siv/cmac"
+	"hash"
+	"io"
+)
+
+const (
+	domainLeaf = 0x00
+	domainNode = 0x01
+	domainRoot = 0x02
+)
+
+var (
+	errChunkSize  = errors.New("merkle: chunk size must be positive")
+	errChunkIndex = errors.New("merkle: chunk index out of range")
+)
+
+type Tree struct {
+	chunkSize int
+	// levels[0] are the leaves, the last level is the top node
+	levels [][][]byte
+	root   []byte
+}
+
+/*
+Build reads the object and computes the tree, an empty object is one empty chunk
+*/
+func Build(key []byte, r io.Reader, chunkSize int) (*Tree, error) {
+	if chunkSize <= 0 {
+		return nil, errChunkSize
+	}
+	mac, err := cmac.NewCmac(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var leaves [][]byte
+	chunk := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 || len(leaves) == 0 && err == io.EOF {
+			leaves = append(leaves, leaf(mac, uint64(len(leaves)), chunk[:n]))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t := &Tree{chunkSize: chunkSize, levels: [][][]byte{leaves}}
+	for level := leaves; len(level) > 1; {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+			} else {
+				next = append(next, node(mac, level[i], level[i+1]))
+			}
+		}
+		t.levels = append(t.levels, next)
+		level = next
+	}
+
+	t.root = root(mac, chunkSize, len(leaves), t.levels[len(t.levels)-1][0])
+	return t, nil
+}
+
+func (t *Tree) Root() []byte {
+	return append([]byte{}, t.root...)
+}
+
+func (t *Tree) Chunks() int {
+	return len(t.levels[0])
+}
+
+func (t *Tree) ChunkSize() int {
+	return t.chunkSize
+}
+
+/*
+Proof returns the siblings needed to verify chunk i
+*/
+func (t *Tree) Proof(i int) ([][]byte, error) {
+	if i < 0 || i >= t.Chunks() {
+		return nil, errChunkIndex
+	}
+
+	var proof [][]byte
+	for _, level := range t.levels[:len(t.levels)-1] {
+		if sibling := i ^ 1; sibling < len(level) {
+			proof = append(proof, append([]byte{}, level[sibling]...))
+		}
+		i /= 2
+	}
+	return proof, nil
+}
+
+/*
+Verifier checks chunks against a trusted root
+*/
+type Verifier struct {
+	mac       hash.Hash
+	root      []byte
+	chunkSize int
+	chunks    int
+}
+
+/*
+NewVerifier takes the key, the trusted root and the shape of the object, the shape
+doesn't have to be trusted, a wrong one fails every verification
+*/
+func NewVerifier(key, root []byte, chunkSize, chunks int) (*Verifier, error) {
+	if chunkSize <= 0 {
+		return nil, errChunkSize
+	}
+	mac, err := cmac.NewCmac(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Verifier{mac: mac, root: append([]byte{}, root...), chunkSize: chunkSize, chunks: chunks}, nil
+}
+
+/*
+Verify reports whether chunk is the i-th chunk of the object. A Verifier isn't
+safe for concurrent use.
+*/
+func (v *Verifier) Verify(i int, chunk []byte, proof [][]byte) bool {
+	if i < 0 || i >= v.chunks || !v.validLength(i, len(chunk)) {
+		return false
+	}
+
+	tag := leaf(v.mac, uint64(i), chunk)
+	for width := v.chunks; width > 1; width = (width + 1) / 2 {
+		if sibling := i ^ 1; sibling < width {
+			if len(proof) == 0 {
+				return false
+			}
+			if i%2 == 0 {
+				tag = node(v.mac, tag, proof[0])
+			} else {
+				tag = node(v.mac, proof[0], tag)
+			}
+			proof = proof[1:]
+		}
+		i /= 2
+	}
+	if len(proof) != 0 {
+		return false
+	}
+
+	computed := root(v.mac, v.chunkSize, v.chunks, tag)
+	return subtle.ConstantTimeCompare(computed, v.root) == 1
+}
+
+/*
+validLength accepts full chunks and a last chunk of up to chunkSize bytes,
+which is only empty for an empty object
+*/
+func (v *Verifier) validLength(i, n int) bool {
+	if i < v.chunks-1 {
+		return n == v.chunkSize
+	}
+	return n <= v.chunkSize && (n > 0 || v.chunks == 1)
+}
+
+func leaf(mac hash.Hash, index uint64, chunk []byte) []byte {
+	var header [9]byte
+	header[0] = domainLeaf
+	binary.BigEndian.PutUint64(header[1:], index)
+
+	mac.Reset()
+	mac.Write(header[:])
+	mac.Write(chunk)
+	return mac.Sum(nil)
+}
+
+func node(mac hash.Hash, left, right []byte) []byte {
+	mac.Reset()
+	mac.Write([]byte{domainNode})
+	mac.Write(left)
+	mac.Write(right)
+	return mac.Sum(nil)
+}
+
+func root(mac hash.Hash, chunkSize, chunks int, top []byte) []byte {
+	var header [17]byte
+	header[0] = domainRoot
+	binary.BigEndian.PutUint64(header[1:9], uint64(chunkSize))
+	binary.BigEndian.PutUint64(header[9:], uint64(chunks))
+
+	mac.Reset()
+	mac.Write(header[:])
+	mac.Write(top)
+	return mac.Sum(nil)
+}
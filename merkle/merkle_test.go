@@ -0,0 +1,114 @@
+package merkle
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+var key = bytes.Repeat([]byte{0x2b}, 16)
+
+func chunks(data []byte, size int) [][]byte {
+	var result [][]byte
+	for len(data) > size {
+		result = append(result, data[:size])
+		data = data[size:]
+	}
+	return append(result, data)
+}
+
+func TestVerifyEveryChunk(t *testing.T) {
+	for _, size := range []int{0, 1, 10, 16, 17, 70, 160} {
+		data := []byte(strings.Repeat("0123456789abcdef", 10)[:size])
+		tree, err := Build(key, bytes.NewReader(data), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parts := chunks(data, 10)
+		if tree.Chunks() != len(parts) {
+			t.Fatalf("%d bytes: %d chunks, want %d", size, tree.Chunks(), len(parts))
+		}
+
+		v, err := NewVerifier(key, tree.Root(), tree.ChunkSize(), tree.Chunks())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, chunk := range parts {
+			proof, err := tree.Proof(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !v.Verify(i, chunk, proof) {
+				t.Errorf("%d bytes: chunk %d rejected", size, i)
+			}
+		}
+	}
+}
+
+func TestRejects(t *testing.T) {
+	data := []byte(strings.Repeat("x", 45))
+	tree, err := Build(key, bytes.NewReader(data), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := NewVerifier(key, tree.Root(), 10, tree.Chunks())
+	proof, _ := tree.Proof(2)
+	chunk := data[20:30]
+
+	if !v.Verify(2, chunk, proof) {
+		t.Fatal("valid chunk rejected")
+	}
+	if v.Verify(3, chunk, proof) {
+		t.Error("chunk accepted at another index")
+	}
+	if v.Verify(2, []byte(strings.Repeat("y", 10)), proof) {
+		t.Error("modified chunk accepted")
+	}
+	if v.Verify(2, chunk, proof[:len(proof)-1]) {
+		t.Error("short proof accepted")
+	}
+	if v.Verify(2, chunk, append(proof, proof[0])) {
+		t.Error("long proof accepted")
+	}
+	if v.Verify(4, data[40:42], mustProof(t, tree, 4)) {
+		t.Error("truncated last chunk accepted")
+	}
+
+	// a shorter object with the same leading chunks
+	shorter, _ := NewVerifier(key, tree.Root(), 10, 4)
+	if shorter.Verify(2, chunk, proof) {
+		t.Error("chunk count isn't bound by the root")
+	}
+
+	otherKey, _ := NewVerifier(bytes.Repeat([]byte{1}, 16), tree.Root(), 10, tree.Chunks())
+	if otherKey.Verify(2, chunk, proof) {
+		t.Error("chunk accepted under another key")
+	}
+}
+
+func mustProof(t *testing.T, tree *Tree, i int) [][]byte {
+	proof, err := tree.Proof(i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+func TestErrors(t *testing.T) {
+	if _, err := Build(key, strings.NewReader("x"), 0); err != errChunkSize {
+		t.Errorf("expected %v, got %v", errChunkSize, err)
+	}
+	if _, err := Build(key[:3], strings.NewReader("x"), 1); err == nil {
+		t.Error("invalid key accepted")
+	}
+	if _, err := Build(key, iotest.ErrReader(iotest.ErrTimeout), 1); err != iotest.ErrTimeout {
+		t.Errorf("expected %v, got %v", iotest.ErrTimeout, err)
+	}
+
+	tree, _ := Build(key, strings.NewReader("abc"), 1)
+	if _, err := tree.Proof(3); err != errChunkIndex {
+		t.Errorf("expected %v, got %v", errChunkIndex, err)
+	}
+}
@@ -0,0 +1,57 @@
+/*
+Package metrics turns Seal and Open calls into counters and histograms.
+
+Hook builds a siv.AuditHook (it can be set on a single key with siv.WithAudit or on
+a keyset) feeding the following metrics to a Sink:
+
+	siv_operations_total{op, key}   calls
+	siv_failures_total{op, key, reason}
+	                                calls that returned an error, reason is siv.FailureClass
+	siv_bytes_total{op}             plaintext bytes sealed and opened
+	siv_duration_seconds{op}        histogram of call durations
+
+Registry is an in-memory Sink that can be published with expvar and scraped
+by Prometheus.
+*/
+package metrics
+
+import (
+	"github.com/luc-lynx/siv/siv"
+	"strconv"
+)
+
+const (
+	Operations = "siv_operations_total"
+	Failures   = "siv_failures_total"
+	Bytes      = "siv_bytes_total"
+	Duration   = "siv_duration_seconds"
+)
+
+/*
+Sink is the small interface Hook reports to, it can be implemented on top of
+any metrics library
+*/
+type Sink interface {
+	// Add increments the counter name{labels} by delta
+	Add(name string, labels map[string]string, delta float64)
+	// Observe records value in the histogram name{labels}
+	Observe(name string, labels map[string]string, value float64)
+}
+
+func Hook(sink Sink) siv.AuditHook {
+	return func(e siv.AuditEvent) {
+		byKey := map[string]string{"op": e.Operation, "key": e.KeyID}
+		byOp := map[string]string{"op": e.Operation}
+
+		sink.Add(Operations, byKey, 1)
+		if e.Err != nil {
+			sink.Add(Failures, map[string]string{"op": e.Operation, "key": e.KeyID, "reason": siv.FailureClass(e.Err)}, 1)
+		}
+		sink.Add(Bytes, byOp, float64(e.PlaintextLen))
+		sink.Observe(Duration, byOp, e.Duration.Seconds())
+	}
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
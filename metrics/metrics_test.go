@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"github.com/luc-lynx/siv/siv"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("hook counts operations", testHook)
+	t.Run("prometheus format", testPrometheus)
+	t.Run("expvar", testExpvar)
+}
+
+func sealOpen(t *testing.T, r *Registry) {
+	s, err := siv.NewAesSIV([]byte("0123456789abcdef0123456789ABCDEF"), siv.WithAudit(Hook(r), "1", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct := s.SealWithMultipleAAD(nil, []byte("0123456789"), [][]byte{[]byte("ad")})
+	if _, err := s.OpenWithMultipleAAD(nil, ct, [][]byte{[]byte("ad")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.OpenWithMultipleAAD(nil, ct, nil); err == nil {
+		t.Fatal("wrong associated data accepted")
+	}
+}
+
+func testHook(t *testing.T) {
+	r := NewRegistry(nil)
+	sealOpen(t, r)
+
+	checks := []struct {
+		name     string
+		labels   map[string]string
+		expected float64
+	}{
+		{Operations, map[string]string{"op": siv.OpSeal, "key": "1"}, 1},
+		{Operations, map[string]string{"op": siv.OpOpen, "key": "1"}, 2},
+		{Failures, map[string]string{"op": siv.OpOpen, "key": "1", "reason": "authentication"}, 1},
+		{Failures, map[string]string{"op": siv.OpSeal, "key": "1", "reason": "other"}, 0},
+		{Bytes, map[string]string{"op": siv.OpSeal}, 10},
+		{Bytes, map[string]string{"op": siv.OpOpen}, 10},
+	}
+
+	for _, c := range checks {
+		if v := r.Counter(c.name, c.labels); v != c.expected {
+			t.Errorf("%s%s = %v, expected %v", c.name, formatLabels(c.labels), v, c.expected)
+		}
+	}
+}
+
+func testPrometheus(t *testing.T) {
+	r := NewRegistry([]float64{1})
+	r.Add(Operations, map[string]string{"op": "seal", "key": "7"}, 2)
+	r.Observe(Duration, map[string]string{"op": "seal"}, 0.5)
+	r.Observe(Duration, map[string]string{"op": "seal"}, 2)
+
+	var b strings.Builder
+	if err := r.WritePrometheus(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# TYPE siv_operations_total counter
+siv_operations_total{key="7",op="seal"} 2
+# TYPE siv_duration_seconds histogram
+siv_duration_seconds_bucket{op="seal",le="1"} 1
+siv_duration_seconds_bucket{op="seal",le="+Inf"} 2
+siv_duration_seconds_sum{op="seal"} 2.5
+siv_duration_seconds_count{op="seal"} 2
+`
+	if b.String() != expected {
+		t.Errorf("unexpected output:\n%s", b.String())
+	}
+}
+
+func testExpvar(t *testing.T) {
+	r := NewRegistry(nil)
+	sealOpen(t, r)
+	expvar.Publish("siv_test", r)
+
+	var vars map[string]interface{}
+	if err := json.Unmarshal([]byte(expvar.Get("siv_test").String()), &vars); err != nil {
+		t.Fatal(err)
+	}
+	if vars[`siv_operations_total{key="1",op="open"}`] != 2.0 {
+		t.Errorf("unexpected expvar output %v", vars)
+	}
+}
@@ -0,0 +1,200 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+DefaultBuckets are the upper bounds of the duration histogram buckets in seconds
+*/
+var DefaultBuckets = []float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 1}
+
+type series struct {
+	name   string
+	labels string
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+/*
+Registry keeps the metrics in memory. It implements expvar.Var, so it can be
+published with expvar.Publish, and http.Handler serving the Prometheus text
+exposition format.
+*/
+type Registry struct {
+	buckets []float64
+
+	mu         sync.Mutex
+	counters   map[series]float64
+	histograms map[series]*histogram
+}
+
+/*
+NewRegistry creates a registry with the given histogram buckets, DefaultBuckets if nil
+*/
+func NewRegistry(buckets []float64) *Registry {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return &Registry{
+		buckets:    buckets,
+		counters:   make(map[series]float64),
+		histograms: make(map[series]*histogram),
+	}
+}
+
+func (r *Registry) Add(name string, labels map[string]string, delta float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counters[series{name, formatLabels(labels)}] += delta
+}
+
+func (r *Registry) Observe(name string, labels map[string]string, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := series{name, formatLabels(labels)}
+	h := r.histograms[s]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(r.buckets))}
+		r.histograms[s] = h
+	}
+
+	for i, le := range r.buckets {
+		if value <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+/*
+Counter returns the current value of the counter name{labels}
+*/
+func (r *Registry) Counter(name string, labels map[string]string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counters[series{name, formatLabels(labels)}]
+}
+
+/*
+String returns the metrics as a JSON object for expvar
+*/
+func (r *Registry) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	vars := make(map[string]interface{})
+	for s, v := range r.counters {
+		vars[s.name+s.labels] = v
+	}
+	for s, h := range r.histograms {
+		vars[s.name+s.labels] = map[string]interface{}{"count": h.count, "sum": h.sum}
+	}
+
+	data, err := json.Marshal(vars)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.WritePrometheus(w)
+}
+
+/*
+WritePrometheus writes the metrics in the Prometheus text exposition format
+*/
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b strings.Builder
+	counters := make([]series, 0, len(r.counters))
+	for s := range r.counters {
+		counters = append(counters, s)
+	}
+	sortSeries(counters)
+
+	for i, s := range counters {
+		if i == 0 || counters[i-1].name != s.name {
+			fmt.Fprintf(&b, "# TYPE %s counter\n", s.name)
+		}
+		fmt.Fprintf(&b, "%s%s %s\n", s.name, s.labels, formatFloat(r.counters[s]))
+	}
+
+	histograms := make([]series, 0, len(r.histograms))
+	for s := range r.histograms {
+		histograms = append(histograms, s)
+	}
+	sortSeries(histograms)
+
+	for i, s := range histograms {
+		if i == 0 || histograms[i-1].name != s.name {
+			fmt.Fprintf(&b, "# TYPE %s histogram\n", s.name)
+		}
+
+		h := r.histograms[s]
+		for j, le := range r.buckets {
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", s.name, withLabel(s.labels, "le", formatFloat(le)), h.counts[j])
+		}
+		fmt.Fprintf(&b, "%s_bucket%s %d\n", s.name, withLabel(s.labels, "le", formatFloat(math.Inf(1))), h.count)
+		fmt.Fprintf(&b, "%s_sum%s %s\n", s.name, s.labels, formatFloat(h.sum))
+		fmt.Fprintf(&b, "%s_count%s %d\n", s.name, s.labels, h.count)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func sortSeries(s []series) {
+	sort.Slice(s, func(i, j int) bool {
+		if s[i].name != s[j].name {
+			return s[i].name < s[j].name
+		}
+		return s[i].labels < s[j].labels
+	})
+}
+
+/*
+formatLabels renders labels sorted by name as {a="1",b="2"}
+*/
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%q", name, labels[name])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func withLabel(labels, name, value string) string {
+	pair := fmt.Sprintf("%s=%q", name, value)
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
@@ -0,0 +1,162 @@
+/*
+Package nonce issues strictly increasing counter nonces that are never reused,
+even across restarts and crashes.
+
+The Manager reserves windows of counters: before handing out the first counter
+of a window it persists the end of the window to the Store. After a restart
+counting continues from the persisted value, so at most one window of counters
+is skipped and none is issued twice. Larger windows mean fewer writes to the
+store and more counters lost on crash.
+
+A Manager must be the only user of its store, two processes sharing a store
+will issue the same counters.
+*/
+package nonce
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	errExhausted   = errors.New("nonce: counter space exhausted")
+	errWindowSize  = errors.New("nonce: window must be positive")
+	errNonceSize   = errors.New("nonce: size must be at least 8 bytes")
+	errStoreFormat = errors.New("nonce: store doesn't contain a counter")
+)
+
+/*
+Store persists the high-water mark of a Manager, Save must be durable before it returns
+*/
+type Store interface {
+	// Load returns the saved value, 0 if nothing has been saved yet
+	Load() (uint64, error)
+	Save(uint64) error
+}
+
+type Manager struct {
+	store  Store
+	window uint64
+
+	mu    sync.Mutex
+	next  uint64
+	limit uint64
+}
+
+func NewManager(store Store, window uint64) (*Manager, error) {
+	if window == 0 {
+		return nil, errWindowSize
+	}
+
+	start, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Manager{store: store, window: window, next: start, limit: start}, nil
+}
+
+/*
+Next returns the next counter
+*/
+func (m *Manager) Next() (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.next == m.limit {
+		limit := m.limit + m.window
+		if limit < m.limit {
+			return 0, errExhausted
+		}
+		if err := m.store.Save(limit); err != nil {
+			return 0, err
+		}
+		m.limit = limit
+	}
+
+	n := m.next
+	m.next++
+	return n, nil
+}
+
+/*
+NextNonce returns the next counter as a big endian nonce of size bytes,
+e.g. to be passed as the last associated data string of AES-SIV
+*/
+func (m *Manager) NextNonce(size int) ([]byte, error) {
+	if size < 8 {
+		return nil, errNonceSize
+	}
+
+	n, err := m.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, size)
+	binary.BigEndian.PutUint64(nonce[size-8:], n)
+	return nonce, nil
+}
+
+type fileStore struct {
+	path string
+}
+
+/*
+NewFileStore keeps the counter as decimal text in a file, replaced atomically on save
+*/
+func NewFileStore(path string) Store {
+	return &fileStore{path: path}
+}
+
+func (s *fileStore) Load() (uint64, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, errStoreFormat
+	}
+	return n, nil
+}
+
+func (s *fileStore) Save(n uint64) error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(strconv.FormatUint(n, 10) + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+
+	// make the rename itself durable
+	dir, err := os.Open(filepath.Dir(s.path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
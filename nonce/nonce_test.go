@@ -0,0 +1,125 @@
+package nonce
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+type memStore struct {
+	value uint64
+	saves int
+	err   error
+}
+
+func (s *memStore) Load() (uint64, error) {
+	return s.value, nil
+}
+
+func (s *memStore) Save(n uint64) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.value = n
+	s.saves++
+	return nil
+}
+
+func TestManager(t *testing.T) {
+	t.Run("counters increase across restarts", testRestart)
+	t.Run("store failure", testStoreFailure)
+	t.Run("exhaustion", testExhaustion)
+	t.Run("file store", testFileStore)
+	t.Run("nonce encoding", testNonceEncoding)
+}
+
+func testRestart(t *testing.T) {
+	store := &memStore{}
+	m, err := NewManager(store, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := uint64(0); i < 15; i++ {
+		n, err := m.Next()
+		if err != nil || n != i {
+			t.Fatalf("got %d, %v, expected %d", n, err, i)
+		}
+	}
+	if store.saves != 2 || store.value != 20 {
+		t.Fatalf("unexpected store state %+v", store)
+	}
+
+	// a crash loses the rest of the window but never repeats a counter
+	m, err = NewManager(store, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := m.Next(); n != 20 {
+		t.Errorf("got %d after restart, expected 20", n)
+	}
+}
+
+func testStoreFailure(t *testing.T) {
+	store := &memStore{err: errors.New("disk full")}
+	m, err := NewManager(store, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Next(); err != store.err {
+		t.Errorf("expected store error, got %v", err)
+	}
+
+	store.err = nil
+	if n, err := m.Next(); err != nil || n != 0 {
+		t.Errorf("got %d, %v after the store recovered", n, err)
+	}
+}
+
+func testExhaustion(t *testing.T) {
+	store := &memStore{value: math.MaxUint64 - 1}
+	m, err := NewManager(store, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Next(); err != errExhausted {
+		t.Errorf("expected %v, got %v", errExhausted, err)
+	}
+}
+
+func testFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counter")
+	for restart := uint64(0); restart < 3; restart++ {
+		m, err := NewManager(NewFileStore(path), 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n, err := m.Next()
+		if err != nil || n != restart*100 {
+			t.Fatalf("got %d, %v, expected %d", n, err, restart*100)
+		}
+	}
+}
+
+func testNonceEncoding(t *testing.T) {
+	m, err := NewManager(&memStore{value: 0x0102}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.NextNonce(4); err != errNonceSize {
+		t.Errorf("expected %v, got %v", errNonceSize, err)
+	}
+
+	nonce, err := m.NextNonce(12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(nonce) != "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x02" {
+		t.Errorf("unexpected nonce %x", nonce)
+	}
+}
@@ -0,0 +1,209 @@
+/*
+Package polyval implements POLYVAL from RFC 8452 section 3, the universal hash of
+AES-GCM-SIV and the little-endian sibling of GHASH. Field elements are GF(2^128)
+modulo x^128 + x^127 + x^126 + x^121 + 1, a block is read as a little endian
+128-bit number and dot(a, b) = a * b * x^-128, the Montgomery form of the product:
+
+	S_0 = 0
+	S_j = dot(S_{j-1} xor X_j, H)
+	POLYVAL(H, X_1, ..., X_n) = S_n
+
+The multiplication follows the constant-time GHASH of BearSSL: carry-less 64-bit
+products are built from integer multiplications of masked operands, so there are no
+tables indexed by the key or the data. The bit reversal BearSSL needs for GHASH
+falls away.
+
+POLYVAL is a universal hash, not a MAC: H must be secret and the output must be
+encrypted, as AES-GCM-SIV does.
+*/
+package polyval
+
+import (
+	"encoding/binary"
+	"github.com/luc-lynx/siv/internal/common"
+	"math/bits"
+)
+
+// Size is the size of the key, of the blocks and of the output
+const Size = 16
+
+var errKeySize = common.KeySizeError("polyval: key must be 16 bytes")
+
+type fieldElement struct {
+	lo, hi uint64
+}
+
+func loadElement(b []byte) fieldElement {
+	return fieldElement{binary.LittleEndian.Uint64(b), binary.LittleEndian.Uint64(b[8:])}
+}
+
+func (x fieldElement) store(b []byte) {
+	binary.LittleEndian.PutUint64(b, x.lo)
+	binary.LittleEndian.PutUint64(b[8:], x.hi)
+}
+
+func (x fieldElement) xor(y fieldElement) fieldElement {
+	return fieldElement{x.lo ^ y.lo, x.hi ^ y.hi}
+}
+
+/*
+bmul64 returns the low 64 bits of the carry-less product of x and y. Spacing the
+bits 4 apart leaves room for the carries of the integer multiplications, which the
+masks drop.
+*/
+func bmul64(x, y uint64) uint64 {
+	const m0, m1, m2, m3 = 0x1111111111111111, 0x2222222222222222, 0x4444444444444444, 0x8888888888888888
+
+	x0, x1, x2, x3 := x&m0, x&m1, x&m2, x&m3
+	y0, y1, y2, y3 := y&m0, y&m1, y&m2, y&m3
+
+	z0 := x0*y0 ^ x1*y3 ^ x2*y2 ^ x3*y1
+	z1 := x0*y1 ^ x1*y0 ^ x2*y3 ^ x3*y2
+	z2 := x0*y2 ^ x1*y1 ^ x2*y0 ^ x3*y3
+	z3 := x0*y3 ^ x1*y2 ^ x2*y1 ^ x3*y0
+	return z0&m0 | z1&m1 | z2&m2 | z3&m3
+}
+
+/*
+mulKey holds the halves of a fixed operand of dot and their bit reversals, which
+only depend on the key
+*/
+type mulKey struct {
+	h0, h1, h2    uint64
+	h0r, h1r, h2r uint64
+}
+
+func newMulKey(h fieldElement) mulKey {
+	k := mulKey{h0: h.lo, h1: h.hi, h0r: bits.Reverse64(h.lo), h1r: bits.Reverse64(h.hi)}
+	k.h2, k.h2r = k.h0^k.h1, k.h0r^k.h1r
+	return k
+}
+
+/*
+dot returns y * h * x^-128. The 256-bit product is computed with Karatsuba, the
+high halves of the partial products come from the products of the bit-reversed
+operands, then two folding steps reduce it.
+*/
+func (k *mulKey) dot(y fieldElement) fieldElement {
+	y0, y1 := y.lo, y.hi
+	y0r, y1r := bits.Reverse64(y0), bits.Reverse64(y1)
+	y2, y2r := y0^y1, y0r^y1r
+
+	z0 := bmul64(y0, k.h0)
+	z1 := bmul64(y1, k.h1)
+	z2 := bmul64(y2, k.h2)
+	z0h := bmul64(y0r, k.h0r)
+	z1h := bmul64(y1r, k.h1r)
+	z2h := bmul64(y2r, k.h2r)
+
+	z2 ^= z0 ^ z1
+	z2h ^= z0h ^ z1h
+	z0h = bits.Reverse64(z0h) >> 1
+	z1h = bits.Reverse64(z1h) >> 1
+	z2h = bits.Reverse64(z2h) >> 1
+
+	v0 := z0
+	v1 := z0h ^ z2
+	v2 := z1 ^ z2h
+	v3 := z1h
+
+	v2 ^= v0 ^ v0>>1 ^ v0>>2 ^ v0>>7
+	v1 ^= v0<<63 ^ v0<<62 ^ v0<<57
+	v3 ^= v1 ^ v1>>1 ^ v1>>2 ^ v1>>7
+	v2 ^= v1<<63 ^ v1<<62 ^ v1<<57
+	return fieldElement{v2, v3}
+}
+
+/*
+Polyval computes POLYVAL incrementally. Data written to it is split into blocks,
+Pad and Sum absorb a trailing partial block padded with zeros, as RFC 8452 pads
+the associated data and the plaintext. It implements hash.Hash.
+*/
+type Polyval struct {
+	h   mulKey
+	s   fieldElement
+	buf [Size]byte
+	n   int
+}
+
+/*
+New returns POLYVAL keyed with the 16-byte H
+*/
+func New(key []byte) (*Polyval, error) {
+	if len(key) != Size {
+		return nil, errKeySize
+	}
+	return &Polyval{h: newMulKey(loadElement(key))}, nil
+}
+
+func (p *Polyval) Size() int {
+	return Size
+}
+
+func (p *Polyval) BlockSize() int {
+	return Size
+}
+
+/*
+Reset starts over with the same key
+*/
+func (p *Polyval) Reset() {
+	p.s = fieldElement{}
+	clear(p.buf[:])
+	p.n = 0
+}
+
+func (p *Polyval) Write(data []byte) (int, error) {
+	written := len(data)
+	if p.n > 0 {
+		c := copy(p.buf[p.n:], data)
+		p.n += c
+		data = data[c:]
+		if p.n < Size {
+			return written, nil
+		}
+		p.block(p.buf[:])
+		p.n = 0
+	}
+
+	for len(data) >= Size {
+		p.block(data)
+		data = data[Size:]
+	}
+	p.n = copy(p.buf[:], data)
+	return written, nil
+}
+
+/*
+Pad absorbs the pending partial block padded with zeros, so the next Write starts
+a new block. It does nothing at a block boundary.
+*/
+func (p *Polyval) Pad() {
+	if p.n == 0 {
+		return
+	}
+	clear(p.buf[p.n:])
+	p.block(p.buf[:])
+	p.n = 0
+}
+
+/*
+Sum appends POLYVAL of the data written so far, zero-padded to a whole number of
+blocks, to b. It doesn't change the state.
+*/
+func (p *Polyval) Sum(b []byte) []byte {
+	s := p.s
+	if p.n > 0 {
+		var last [Size]byte
+		copy(last[:], p.buf[:p.n])
+		s = p.h.dot(s.xor(loadElement(last[:])))
+	}
+
+	var out [Size]byte
+	s.store(out[:])
+	return append(b, out[:]...)
+}
+
+func (p *Polyval) block(b []byte) {
+	p.s = p.h.dot(p.s.xor(loadElement(b)))
+}
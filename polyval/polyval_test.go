@@ -0,0 +1,103 @@
+package polyval
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"github.com/luc-lynx/siv/siv"
+	"hash"
+	"testing"
+)
+
+var _ hash.Hash = (*Polyval)(nil)
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+/*
+RFC 8452 Appendix A
+*/
+func TestVector(t *testing.T) {
+	p, err := New(unhex(t, "25629347589242761d31f826ba4b757b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Write(unhex(t, "4f4f95668c83dfb6401762bb2d01a262d1a24ddd2721d006bbe45f20d3c9f362"))
+
+	expected := unhex(t, "f7a3b47b846119fae5b7866cf5e5b77e")
+	if sum := p.Sum(nil); !bytes.Equal(sum, expected) {
+		t.Errorf("got %x, expected %x", sum, expected)
+	}
+
+	// Sum doesn't change the state, Reset clears it
+	if sum := p.Sum(nil); !bytes.Equal(sum, expected) {
+		t.Errorf("second Sum: got %x", sum)
+	}
+	p.Reset()
+	if sum := p.Sum(nil); !bytes.Equal(sum, make([]byte, Size)) {
+		t.Errorf("after Reset: got %x", sum)
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	key := bytes.Repeat([]byte{0x5a}, Size)
+	data := make([]byte, 100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	whole, _ := New(key)
+	whole.Write(data)
+	expected := whole.Sum(nil)
+
+	for _, chunk := range []int{1, 3, 15, 16, 17, 33} {
+		p, _ := New(key)
+		for rest := data; len(rest) > 0; {
+			n := min(chunk, len(rest))
+			p.Write(rest[:n])
+			rest = rest[n:]
+		}
+		if sum := p.Sum(nil); !bytes.Equal(sum, expected) {
+			t.Errorf("chunks of %d: got %x, expected %x", chunk, sum, expected)
+		}
+	}
+
+	// Pad is the same as writing the zeros
+	padded, _ := New(key)
+	padded.Write(data)
+	padded.Pad()
+	padded.Pad()
+	padded.Write(data[:1])
+
+	zeros, _ := New(key)
+	zeros.Write(data)
+	zeros.Write(make([]byte, 112-len(data)))
+	zeros.Write(data[:1])
+	if !bytes.Equal(padded.Sum(nil), zeros.Sum(nil)) {
+		t.Error("Pad differs from zero padding")
+	}
+}
+
+func TestKeySize(t *testing.T) {
+	if _, err := New(make([]byte, 32)); err != errKeySize {
+		t.Errorf("expected %v, got %v", errKeySize, err)
+	}
+	if !errors.Is(errKeySize, siv.ErrKeySize) {
+		t.Errorf("%v doesn't wrap %v", errKeySize, siv.ErrKeySize)
+	}
+}
+
+func BenchmarkWrite(b *testing.B) {
+	p, _ := New(make([]byte, Size))
+	data := make([]byte, 4096)
+
+	b.SetBytes(int64(len(data)))
+	for b.Loop() {
+		p.Write(data)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Package prf describes the keyed pseudorandom functions S2V and the key derivation
+code are built on, so they don't depend on AES-CMAC directly.
+
+A PRF is a keyed hash.Hash: BlockSize and Size describe its input and output
+blocks, Write feeds the message and SumInto writes the output without allocating.
+Reset starts a new message under the same key.
+*/
+package prf
+
+import (
+	"crypto/hmac"
+	"errors"
+	"github.com/luc-lynx/siv/cmac"
+	"hash"
+)
+
+var (
+	errNilHash       = errors.New("prf: hash constructor is nil")
+	errTruncatedSize = errors.New("prf: truncated size must be between 1 and the output size")
+)
+
+const sumIntoShortBuffer = "prf: destination is shorter than the output"
+
+/*
+PRF is a keyed pseudorandom function
+*/
+type PRF interface {
+	hash.Hash
+	// SumInto writes the output into dst[:Size()] without changing the state
+	SumInto(dst []byte)
+}
+
+/*
+Func keys a PRF
+*/
+type Func func(key []byte) (PRF, error)
+
+/*
+CMAC keys AES-CMAC (RFC 4493), key must be 16, 24 or 32 bytes long
+*/
+func CMAC(key []byte) (PRF, error) {
+	h, err := cmac.NewCmac(key)
+	if err != nil {
+		return nil, err
+	}
+	return h.(PRF), nil
+}
+
+/*
+HMAC returns a Func keying HMAC (RFC 2104) with the hash h
+*/
+func HMAC(h func() hash.Hash) Func {
+	return func(key []byte) (PRF, error) {
+		if h == nil {
+			return nil, errNilHash
+		}
+		return hmacPRF{hmac.New(h, key)}, nil
+	}
+}
+
+type hmacPRF struct {
+	hash.Hash
+}
+
+func (h hmacPRF) SumInto(dst []byte) {
+	if len(dst) < h.Size() {
+		panic(sumIntoShortBuffer)
+	}
+	h.Sum(dst[:0])
+}
+
+/*
+Truncated returns a Func keying f and keeping the first size bytes of its output,
+e.g. HMAC-SHA-256 cut to the 128 bits S2V needs
+*/
+func Truncated(f Func, size int) Func {
+	return func(key []byte) (PRF, error) {
+		p, err := f(key)
+		if err != nil {
+			return nil, err
+		}
+		if size < 1 || size > p.Size() {
+			return nil, errTruncatedSize
+		}
+		return &truncated{PRF: p, size: size, full: make([]byte, p.Size())}, nil
+	}
+}
+
+type truncated struct {
+	PRF
+	size int
+	full []byte
+}
+
+func (t *truncated) Size() int {
+	return t.size
+}
+
+func (t *truncated) Sum(b []byte) []byte {
+	return append(b, t.PRF.Sum(nil)[:t.size]...)
+}
+
+func (t *truncated) SumInto(dst []byte) {
+	if len(dst) < t.size {
+		panic(sumIntoShortBuffer)
+	}
+	t.PRF.SumInto(t.full)
+	copy(dst, t.full[:t.size])
+}
@@ -0,0 +1,104 @@
+package prf
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"github.com/luc-lynx/siv/cmac"
+	"testing"
+)
+
+var (
+	key     = []byte("0123456789abcdef")
+	message = []byte("the quick brown fox jumps over the lazy dog")
+)
+
+func TestPRF(t *testing.T) {
+	t.Run("cmac", testCMAC)
+	t.Run("hmac", testHMAC)
+	t.Run("truncated", testTruncated)
+}
+
+func testCMAC(t *testing.T) {
+	p, err := CMAC(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	checkPRF(t, p, cmac.Sum(key, message))
+
+	if _, err := CMAC(key[:5]); err == nil {
+		t.Error("CMAC accepted a 5 byte key")
+		t.Fail()
+	}
+}
+
+func testHMAC(t *testing.T) {
+	p, err := HMAC(sha256.New)(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	h := hmac.New(sha256.New, key)
+	h.Write(message)
+	checkPRF(t, p, h.Sum(nil))
+
+	if _, err := HMAC(nil)(key); err != errNilHash {
+		t.Errorf("expected %v, got %v", errNilHash, err)
+		t.Fail()
+	}
+}
+
+func checkPRF(t *testing.T, p PRF, expected []byte) {
+	if p.Size() != len(expected) {
+		t.Errorf("size %d, expected %d", p.Size(), len(expected))
+		t.Fail()
+		return
+	}
+
+	for i := 0; i < 2; i++ {
+		p.Reset()
+		p.Write(message)
+		out := make([]byte, p.Size())
+		p.SumInto(out)
+		if !bytes.Equal(out, expected) {
+			t.Errorf("run %d: wrong output %x", i, out)
+			t.Fail()
+		}
+	}
+
+	if n := testing.AllocsPerRun(10, func() {
+		p.Reset()
+		p.Write(message)
+		p.SumInto(make([]byte, 64)[:p.Size()])
+	}); n > 1 {
+		t.Errorf("SumInto allocates, %v allocs", n)
+		t.Fail()
+	}
+}
+
+func testTruncated(t *testing.T) {
+	p, err := Truncated(HMAC(sha256.New), 16)(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	h := hmac.New(sha256.New, key)
+	h.Write(message)
+	checkPRF(t, p, h.Sum(nil)[:16])
+
+	if _, err := Truncated(HMAC(sha256.New), 33)(key); err != errTruncatedSize {
+		t.Errorf("expected %v, got %v", errTruncatedSize, err)
+		t.Fail()
+	}
+	if _, err := Truncated(CMAC, 16)(key[:5]); err == nil {
+		t.Error("invalid key accepted")
+		t.Fail()
+	}
+}
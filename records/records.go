@@ -0,0 +1,108 @@
+/*
+Package records encrypts key/value records of log based event streams such as Kafka.
+
+Record keys are sealed deterministically, so equal keys still land on the same
+partition and log compaction still keeps the latest value of a key. Values are
+sealed with a random nonce (siv SealRandom), so equal values don't show.
+
+The value is bound to its encrypted key and both to the topic through the
+associated data
+
+	key:   topic, "key"
+	value: topic, "value", encrypted key
+
+so a value can't be moved under another key or into another topic. Nil values
+(compaction tombstones) stay nil, records without a key get a nil key.
+Keys and values are sealed with separate subkeys derived with HKDF-SHA256.
+*/
+package records
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"github.com/luc-lynx/siv/siv"
+)
+
+var (
+	labelKey   = []byte("key")
+	labelValue = []byte("value")
+)
+
+type randomAEAD interface {
+	SealWithMultipleAAD(dst, plaintext []byte, additionalData [][]byte) []byte
+	OpenWithMultipleAAD(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error)
+	SealRandom(dst, plaintext []byte, additionalData [][]byte) ([]byte, error)
+	OpenRandom(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error)
+}
+
+type Codec struct {
+	topic  []byte
+	keys   randomAEAD
+	values randomAEAD
+}
+
+/*
+NewCodec returns a codec for one topic, key must be 32, 48 or 64 bytes long
+*/
+func NewCodec(key []byte, topic string) (*Codec, error) {
+	if _, err := siv.NewAesSIV(key); err != nil {
+		return nil, err
+	}
+
+	keys, err := derive(key, "siv records key")
+	if err != nil {
+		return nil, err
+	}
+	values, err := derive(key, "siv records value")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Codec{topic: []byte(topic), keys: keys, values: values}, nil
+}
+
+func derive(key []byte, info string) (randomAEAD, error) {
+	subkey, err := hkdf.Key(sha256.New, key, nil, info, len(key))
+	if err != nil {
+		return nil, err
+	}
+	defer clear(subkey)
+	return siv.NewAesSIV(subkey)
+}
+
+/*
+Encrypt seals a record, equal keys give equal encrypted keys
+*/
+func (c *Codec) Encrypt(key, value []byte) (encryptedKey, encryptedValue []byte, err error) {
+	if key != nil {
+		encryptedKey = c.keys.SealWithMultipleAAD(nil, key, [][]byte{c.topic, labelKey})
+	}
+
+	if value != nil {
+		encryptedValue, err = c.values.SealRandom(nil, value, [][]byte{c.topic, labelValue, encryptedKey})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return encryptedKey, encryptedValue, nil
+}
+
+/*
+Decrypt opens a record sealed by Encrypt with the same key and topic
+*/
+func (c *Codec) Decrypt(encryptedKey, encryptedValue []byte) (key, value []byte, err error) {
+	if encryptedKey != nil {
+		key, err = c.keys.OpenWithMultipleAAD(nil, encryptedKey, [][]byte{c.topic, labelKey})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if encryptedValue != nil {
+		value, err = c.values.OpenRandom(nil, encryptedValue, [][]byte{c.topic, labelValue, encryptedKey})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return key, value, nil
+}
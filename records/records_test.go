@@ -0,0 +1,90 @@
+package records
+
+import (
+	"bytes"
+	"testing"
+)
+
+var key = append(bytes.Repeat([]byte{0x11}, 32), bytes.Repeat([]byte{0x22}, 32)...)
+
+func TestCodec(t *testing.T) {
+	t.Run("round trip", testRoundTrip)
+	t.Run("keys are deterministic, values aren't", testDeterminism)
+	t.Run("values are bound to keys and topic", testBinding)
+}
+
+func newCodec(t *testing.T, topic string) *Codec {
+	c, err := NewCodec(key, topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func testRoundTrip(t *testing.T) {
+	c := newCodec(t, "orders")
+
+	for _, r := range []struct{ key, value []byte }{
+		{[]byte("customer-1"), []byte(`{"total": 10}`)},
+		{[]byte("customer-1"), nil},
+		{nil, []byte("keyless")},
+	} {
+		ek, ev, err := c.Encrypt(r.key, r.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (ek == nil) != (r.key == nil) || (ev == nil) != (r.value == nil) {
+			t.Errorf("nil key or value changed: %q %q", ek, ev)
+		}
+
+		k, v, err := c.Decrypt(ek, ev)
+		if err != nil || !bytes.Equal(k, r.key) || !bytes.Equal(v, r.value) {
+			t.Errorf("got %q %q, %v", k, v, err)
+		}
+	}
+
+	if _, err := NewCodec(key[:20], "orders"); err == nil {
+		t.Error("short key accepted")
+	}
+}
+
+func testDeterminism(t *testing.T) {
+	c := newCodec(t, "orders")
+
+	k1, v1, _ := c.Encrypt([]byte("customer-1"), []byte("value"))
+	k2, v2, _ := c.Encrypt([]byte("customer-1"), []byte("value"))
+	if !bytes.Equal(k1, k2) {
+		t.Error("equal keys were encrypted differently")
+	}
+	if bytes.Equal(v1, v2) {
+		t.Error("equal values were encrypted equally")
+	}
+
+	// the topic is part of the associated data of keys
+	k3, _, _ := newCodec(t, "payments").Encrypt([]byte("customer-1"), nil)
+	if bytes.Equal(k1, k3) {
+		t.Error("keys of different topics are equal")
+	}
+}
+
+func testBinding(t *testing.T) {
+	c := newCodec(t, "orders")
+
+	k1, v1, _ := c.Encrypt([]byte("customer-1"), []byte("value 1"))
+	k2, _, _ := c.Encrypt([]byte("customer-2"), []byte("value 2"))
+
+	if _, _, err := c.Decrypt(k2, v1); err == nil {
+		t.Error("value was accepted under another key")
+	}
+	if _, _, err := c.Decrypt(nil, v1); err == nil {
+		t.Error("value was accepted without its key")
+	}
+	if _, _, err := newCodec(t, "payments").Decrypt(k1, v1); err == nil {
+		t.Error("record was accepted in another topic")
+	}
+
+	k1[len(k1)-1] ^= 1
+	if _, _, err := c.Decrypt(k1, nil); err == nil {
+		t.Error("modified key was accepted")
+	}
+}
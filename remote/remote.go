@@ -0,0 +1,121 @@
+/*
+Package remote is a client of the sivd daemon (cmd/sivd). Client implements
+siv.SealOpener, so code written against that interface can move its keys into
+the daemon without other changes.
+
+For mutual TLS pass an http.Client whose transport has the client certificate.
+*/
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const maxResponseSize = 64 << 20
+
+var errOpenFailed = errors.New("remote: open failed")
+
+type Client struct {
+	url  string
+	http *http.Client
+}
+
+/*
+NewClient returns a client of the daemon at baseURL, http.DefaultClient is used if hc is nil
+*/
+func NewClient(baseURL string, hc *http.Client) *Client {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return &Client{url: strings.TrimSuffix(baseURL, "/"), http: hc}
+}
+
+type sealRequest struct {
+	Plaintext []byte   `json:"plaintext"`
+	AAD       [][]byte `json:"aad"`
+}
+
+type sealResponse struct {
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type openRequest struct {
+	Ciphertext []byte   `json:"ciphertext"`
+	AAD        [][]byte `json:"aad"`
+}
+
+type openResponse struct {
+	Plaintext []byte `json:"plaintext"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (c *Client) SealContext(ctx context.Context, plaintext []byte, additionalData [][]byte) ([]byte, error) {
+	var resp sealResponse
+	if err := c.call(ctx, "/v1/seal", sealRequest{Plaintext: plaintext, AAD: additionalData}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Ciphertext, nil
+}
+
+/*
+OpenContext returns a generic error if the daemon rejects the ciphertext,
+the daemon doesn't tell why
+*/
+func (c *Client) OpenContext(ctx context.Context, ciphertext []byte, additionalData [][]byte) ([]byte, error) {
+	var resp openResponse
+	err := c.call(ctx, "/v1/open", openRequest{Ciphertext: ciphertext, AAD: additionalData}, &resp)
+	var status statusError
+	if errors.As(err, &status) && status.code == http.StatusBadRequest {
+		return nil, errOpenFailed
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.Plaintext, nil
+}
+
+type statusError struct {
+	code    int
+	message string
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("remote: %d %s", e.code, e.message)
+}
+
+func (c *Client) call(ctx context.Context, path string, req, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+
+	res, err := c.http.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	dec := json.NewDecoder(io.LimitReader(res.Body, maxResponseSize))
+	if res.StatusCode != http.StatusOK {
+		var e errorResponse
+		dec.Decode(&e)
+		return statusError{code: res.StatusCode, message: e.Error}
+	}
+	return dec.Decode(resp)
+}
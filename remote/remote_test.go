@@ -0,0 +1,80 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/luc-lynx/siv/keyset"
+	"github.com/luc-lynx/siv/siv"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// same shape as the sivd handlers
+func newDaemon(t *testing.T, ks *keyset.Keyset) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/seal", func(w http.ResponseWriter, r *http.Request) {
+		var req sealRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		ciphertext, _ := ks.Seal(nil, req.Plaintext, req.AAD)
+		json.NewEncoder(w).Encode(sealResponse{Ciphertext: ciphertext})
+	})
+	mux.HandleFunc("POST /v1/open", func(w http.ResponseWriter, r *http.Request) {
+		var req openRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		plaintext, err := ks.Open(nil, req.Ciphertext, req.AAD)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(errorResponse{Error: "open failed"})
+			return
+		}
+		json.NewEncoder(w).Encode(openResponse{Plaintext: plaintext})
+	})
+
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestClient(t *testing.T) {
+	ks, err := keyset.New(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newDaemon(t, ks)
+	ctx := context.Background()
+	aad := [][]byte{[]byte("header")}
+
+	// the keyset and the client are interchangeable
+	var local, remote siv.SealOpener = ks, NewClient(ts.URL+"/", ts.Client())
+
+	sealed, err := remote.SealContext(ctx, []byte("secret"), aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := local.OpenContext(ctx, sealed, aad); err != nil || string(plaintext) != "secret" {
+		t.Fatal("sealed remotely, can't open locally", err)
+	}
+
+	sealed, err = local.SealContext(ctx, []byte("secret"), aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := remote.OpenContext(ctx, sealed, aad); err != nil || string(plaintext) != "secret" {
+		t.Fatal("sealed locally, can't open remotely", err)
+	}
+
+	if _, err := remote.OpenContext(ctx, sealed, nil); err != errOpenFailed {
+		t.Errorf("expected %v, got %v", errOpenFailed, err)
+	}
+
+	if _, err := NewClient(ts.URL+"/missing", ts.Client()).SealContext(ctx, nil, nil); err == nil {
+		t.Error("unknown endpoint didn't fail")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := remote.SealContext(cancelled, []byte("secret"), nil); err == nil {
+		t.Error("cancelled context didn't fail")
+	}
+}
@@ -0,0 +1,77 @@
+package siv
+
+import "time"
+
+const (
+	OpSeal = "seal"
+	OpOpen = "open"
+)
+
+/*
+AuditEvent describes a single Seal or Open call. It never contains key material,
+plaintext, ciphertext or associated data, only their sizes.
+*/
+type AuditEvent struct {
+	Operation string
+	// KeyID is set by the owner of the key, e.g. a keyset, it's empty for bare keys
+	KeyID string
+	// PlaintextLen is 0 for a failed Open
+	PlaintextLen  int
+	CiphertextLen int
+	AADCount      int
+	Duration      time.Duration
+	// Err is nil on success
+	Err error
+	// Context is supplied by the caller along with the hook and passed as is
+	Context map[string]string
+}
+
+/*
+AuditHook is called synchronously after every Seal and Open, it should hand the
+event over to the audit pipeline and return quickly
+*/
+type AuditHook func(AuditEvent)
+
+type audit struct {
+	hook    AuditHook
+	keyID   string
+	context map[string]string
+}
+
+/*
+WithAudit makes every Seal and Open report an event to hook, keyID and context are
+passed in every event. A nil hook turns auditing off.
+*/
+func WithAudit(hook AuditHook, keyID string, context map[string]string) Option {
+	return func(a *aessiv) error {
+		a.audit = nil
+		if hook != nil {
+			a.audit = &audit{hook: hook, keyID: keyID, context: context}
+		}
+		return nil
+	}
+}
+
+/*
+SetAudit makes every following Seal and Open report an event to hook.
+A nil hook turns auditing off.
+
+Deprecated: use WithAudit. The hook is replaced without synchronization, so
+SetAudit must not be called while Seal or Open may run on another goroutine.
+*/
+func (a *aessiv) SetAudit(hook AuditHook, keyID string, context map[string]string) {
+	WithAudit(hook, keyID, context)(a)
+}
+
+func (a *audit) record(op string, plaintextLen, ciphertextLen, aadCount int, start time.Time, err error) {
+	a.hook(AuditEvent{
+		Operation:     op,
+		KeyID:         a.keyID,
+		PlaintextLen:  plaintextLen,
+		CiphertextLen: ciphertextLen,
+		AADCount:      aadCount,
+		Duration:      time.Since(start),
+		Err:           err,
+		Context:       a.context,
+	})
+}
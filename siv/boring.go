@@ -0,0 +1,9 @@
+//go:build boringcrypto
+
+package siv
+
+import "crypto/boring"
+
+func boringEnabled() bool {
+	return boring.Enabled()
+}
@@ -0,0 +1,189 @@
+package siv
+
+import (
+	"bufio"
+	"compress/flate"
+	"errors"
+	"io"
+	"slices"
+)
+
+/*
+Compression of streams, compress-then-encrypt inside the streaming format so backups
+don't wrap the encryptor in compressors of their own. The algorithm is stored in the
+high 4 bits of the version byte of the header, which is authenticated with every
+chunk:
+
+	version byte = compression (4 bits) || version (4 bits)
+
+Only flate from compress/flate is supported, zstd would need a third-party module.
+
+Compressed length leaks the content: when data an attacker controls is compressed
+together with a secret, the size of the chunks and flushes tells how much of the
+attacker's data matched the secret, and repeated guesses recover the secret (the
+CRIME and BREACH attacks). Only compress streams whose content the attacker can't
+influence or whose sizes can't be observed, e.g. backups of files at rest, never
+interactive streams mixing user input with secrets. The reader also inflates data
+of any size, which a sender can abuse as a decompression bomb.
+
+So compression is opt-in on both ends, the writer compresses with WithCompression
+and the reader accepts a compressed stream only if WithAllowedCompression lists its
+algorithm. Other readers fail with ErrUnsupportedVersion.
+*/
+
+const CompressionFlate = "flate"
+
+var (
+	compressionCodes = map[string]byte{CompressionFlate: 1}
+
+	errUnknownCompression    = errors.New("siv: unknown stream compression")
+	errCompressionNotAllowed = NewError(ErrUnsupportedVersion, "stream compression isn't allowed")
+	errCompressedTrailing    = NewError(ErrMalformed, "stream has data after the compressed data")
+)
+
+type StreamOption func(*streamOptions) error
+
+type streamOptions struct {
+	compression byte
+	allowed     []byte
+	tracer      StreamTracer
+	keyID       string
+}
+
+/*
+WithCompression makes the writer compress the plaintext with algorithm, see the
+risks above. Readers ignore it.
+*/
+func WithCompression(algorithm string) StreamOption {
+	return func(o *streamOptions) error {
+		code, ok := compressionCodes[algorithm]
+		if !ok {
+			return errUnknownCompression
+		}
+		o.compression = code
+		return nil
+	}
+}
+
+/*
+WithAllowedCompression makes the reader accept streams compressed with any of the
+algorithms, it rejects all compressed streams by default. Writers ignore it.
+*/
+func WithAllowedCompression(algorithms ...string) StreamOption {
+	return func(o *streamOptions) error {
+		for _, algorithm := range algorithms {
+			code, ok := compressionCodes[algorithm]
+			if !ok {
+				return errUnknownCompression
+			}
+			o.allowed = append(o.allowed, code)
+		}
+		return nil
+	}
+}
+
+func newStreamOptions(opts []StreamOption) (*streamOptions, error) {
+	o := &streamOptions{}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+/*
+checkCompression accepts no compression and the allowed algorithms
+*/
+func (o *streamOptions) checkCompression(code byte) error {
+	if code == 0 || slices.Contains(o.allowed, code) {
+		return nil
+	}
+	for _, known := range compressionCodes {
+		if code == known {
+			return errCompressionNotAllowed
+		}
+	}
+	return errStreamVersion
+}
+
+type compressingWriter struct {
+	fw *flate.Writer
+	e  *encryptingWriter
+}
+
+func newCompressingWriter(e *encryptingWriter) *compressingWriter {
+	// DefaultCompression is a valid level, NewWriter can't fail
+	fw, _ := flate.NewWriter(e, flate.DefaultCompression)
+	return &compressingWriter{fw: fw, e: e}
+}
+
+func (c *compressingWriter) Write(p []byte) (int, error) {
+	return c.fw.Write(p)
+}
+
+/*
+Flush emits the compressed data buffered by flate before sealing the chunk, so the
+reader can inflate everything written so far
+*/
+func (c *compressingWriter) Flush() error {
+	if !c.e.framed {
+		return errStreamNoFlush
+	}
+	if err := c.fw.Flush(); err != nil {
+		return err
+	}
+	return c.e.Flush()
+}
+
+func (c *compressingWriter) Close() error {
+	if err := c.fw.Close(); err != nil {
+		return err
+	}
+	return c.e.Close()
+}
+
+type decompressingReader struct {
+	d   *bufio.Reader
+	fr  io.ReadCloser
+	err error
+}
+
+/*
+newDecompressingReader buffers d itself, flate reads through the buffer without
+wrapping it in another one, so finish sees whatever flate left unread
+*/
+func newDecompressingReader(d *decryptingReader) *decompressingReader {
+	buffered := bufio.NewReader(d)
+	return &decompressingReader{d: buffered, fr: flate.NewReader(buffered)}
+}
+
+/*
+Read returns io.EOF once the end of the flate data and the last chunk were both
+authenticated, flate stops reading at its final block which may come before
+*/
+func (r *decompressingReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err := r.fr.Read(p)
+	if err == io.EOF {
+		err = r.finish()
+	}
+	r.err = err
+	return n, err
+}
+
+func (r *decompressingReader) finish() error {
+	var b [1]byte
+	for {
+		n, err := r.d.Read(b[:])
+		if n != 0 {
+			return errCompressedTrailing
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
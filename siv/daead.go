@@ -0,0 +1,44 @@
+package siv
+
+/*
+DAEAD is a deterministic AEAD: equal plaintexts under equal associated data give
+equal ciphertexts, and nothing else about the plaintexts leaks. Every SIV variant
+implements it, so code can switch between them:
+
+	AES-SIV         NewAesSIV, NewSIVCMAC256/384/512, NewSIV, WithHMAC
+	truncated tags  NewTruncatedAesSIV
+	AES-GCM-SIV     gcmsiv.NewDeterministic
+
+SealDeterministic panics where SealWithMultipleAAD does, e.g. with more associated
+data strings than the variant accepts. The associated data strings are bound
+separately and in order, like the vector of S2V.
+*/
+type DAEAD interface {
+	SealDeterministic(dst, plaintext []byte, additionalData ...[]byte) []byte
+	OpenDeterministic(dst, ciphertext []byte, additionalData ...[]byte) ([]byte, error)
+}
+
+var (
+	_ DAEAD = aessiv{}
+	_ DAEAD = truncatedSIV{}
+)
+
+/*
+SealDeterministic is SealWithMultipleAAD with the strings as arguments, it ignores
+WithNonceSize
+*/
+func (a aessiv) SealDeterministic(dst, plaintext []byte, additionalData ...[]byte) []byte {
+	return a.SealWithMultipleAAD(dst, plaintext, additionalData)
+}
+
+func (a aessiv) OpenDeterministic(dst, ciphertext []byte, additionalData ...[]byte) ([]byte, error) {
+	return a.OpenWithMultipleAAD(dst, ciphertext, additionalData)
+}
+
+func (a truncatedSIV) SealDeterministic(dst, plaintext []byte, additionalData ...[]byte) []byte {
+	return a.SealWithMultipleAAD(dst, plaintext, additionalData)
+}
+
+func (a truncatedSIV) OpenDeterministic(dst, ciphertext []byte, additionalData ...[]byte) ([]byte, error) {
+	return a.OpenWithMultipleAAD(dst, ciphertext, additionalData)
+}
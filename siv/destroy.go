@@ -0,0 +1,34 @@
+package siv
+
+import "errors"
+
+var errKeyDestroyed = errors.New("siv: key destroyed")
+
+/*
+Destroy wipes the key and the CMAC subkeys and drops the cached cipher state, every
+later operation fails with a "key destroyed" error (SealWithMultipleAAD, Seal and
+Open of cipher.AEAD panic like for an invalid key). The AES key schedules are kept
+inside crypto/aes, which has no way to wipe them, they are released to the garbage
+collector like the PRF state of WithPRF and WithHMAC. Destroy must not be called
+concurrently with other calls on the AEAD.
+*/
+func (a *aessiv) Destroy() {
+	clear(a.key)
+	if a.mac != nil {
+		a.mac.Destroy()
+	}
+	a.ctr, a.mac, a.scratch = nil, nil, nil
+	a.destroyed = true
+}
+
+/*
+Destroy wipes the key of truncated AES-SIV like aessiv's Destroy
+*/
+func (a *truncatedSIV) Destroy() {
+	clear(a.key)
+	if a.mac != nil {
+		a.mac.Destroy()
+	}
+	a.ctr, a.mac, a.scratch = nil, nil, nil
+	a.destroyed = true
+}
@@ -0,0 +1,58 @@
+package siv
+
+import "time"
+
+/*
+SealDetached and OpenDetached keep the synthetic IV apart from the encrypted
+plaintext, for wire formats that store the 16 byte tag in a header or another
+column. The ciphertext is the same as the output of Seal without its first 16 bytes.
+*/
+
+var errInvalidTagLength = NewError(ErrMalformed, "invalid tag length")
+
+/*
+SealDetached appends the encrypted plaintext to dst and returns the synthetic IV
+separately. The plaintext may be encrypted in place with dst = plaintext[:0].
+*/
+func (a aessiv) SealDetached(dst, plaintext []byte, additionalData [][]byte) (ciphertext, tag []byte, err error) {
+	var start time.Time
+	instrumented := a.audit != nil || a.duplicates != nil || a.quantum != 0
+	if instrumented {
+		start = time.Now()
+	}
+
+	checkOverlap(dst, len(plaintext), plaintext)
+	tag = make([]byte, blockSize)
+	ret, c := sliceForAppend(dst, len(plaintext))
+	err = a.sealDetached(tag, c, plaintext, additionalData)
+	if instrumented {
+		a.sealDone(start, tag, len(plaintext), len(additionalData), err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return ret, tag, nil
+}
+
+/*
+OpenDetached appends the plaintext of ciphertext authenticated by tag to dst, on
+failure nothing is left in the output
+*/
+func (a aessiv) OpenDetached(dst, ciphertext, tag []byte, additionalData [][]byte) ([]byte, error) {
+	var start time.Time
+	instrumented := a.audit != nil || a.quantum != 0
+	if instrumented {
+		start = time.Now()
+	}
+
+	checkOverlap(dst, len(ciphertext), ciphertext)
+	var ret []byte
+	err := errInvalidTagLength
+	if len(tag) == blockSize {
+		ret, err = a.openDetached(dst, ciphertext, tag, additionalData)
+	}
+	if instrumented {
+		a.openDone(start, len(ret)-len(dst), len(ciphertext)+len(tag), len(additionalData), err)
+	}
+	return ret, err
+}
@@ -0,0 +1,130 @@
+package siv
+
+import "sync"
+
+/*
+DuplicateMonitor watches for repeated (plaintext, associated data) pairs.
+
+SIV is deterministic, so sealing the same pair twice gives the same ciphertext
+and observers can tell the messages are equal. The monitor keeps the synthetic
+IVs of the last window seals, the IV is a PRF of the inputs, so no plaintext is
+kept in memory, and calls alert when the share of duplicates in the window
+reaches threshold. alert isn't called again until the rate has dropped below
+threshold. A high rate usually means a nonce or other varying associated data
+should be added.
+*/
+type DuplicateMonitor struct {
+	threshold float64
+	alert     func(rate float64)
+
+	mu      sync.Mutex
+	window  []duplicateEntry
+	next    int
+	full    bool
+	counts  map[[blockSize]byte]int
+	dups    int
+	alerted bool
+}
+
+type duplicateEntry struct {
+	iv  [blockSize]byte
+	dup bool
+}
+
+/*
+NewDuplicateMonitor creates a monitor over the last window seals, window must be positive
+*/
+func NewDuplicateMonitor(window int, threshold float64, alert func(rate float64)) *DuplicateMonitor {
+	return &DuplicateMonitor{
+		threshold: threshold,
+		alert:     alert,
+		window:    make([]duplicateEntry, window),
+		counts:    make(map[[blockSize]byte]int, window),
+	}
+}
+
+/*
+WithDuplicateMonitor makes every Seal report its synthetic IV to m, a nil m turns
+monitoring off. A monitor can be shared by several keys, it has its own lock.
+*/
+func WithDuplicateMonitor(m *DuplicateMonitor) Option {
+	return func(a *aessiv) error {
+		a.duplicates = m
+		return nil
+	}
+}
+
+/*
+SetDuplicateMonitor makes every following Seal report its synthetic IV to m,
+a nil m turns monitoring off. A monitor can be shared by several keys.
+
+Deprecated: use WithDuplicateMonitor. Only the monitor is synchronized, setting it
+on an AEAD that is already in use is a data race.
+*/
+func (a *aessiv) SetDuplicateMonitor(m *DuplicateMonitor) {
+	WithDuplicateMonitor(m)(a)
+}
+
+/*
+Observe records a synthetic IV, the first block of a ciphertext
+*/
+func (m *DuplicateMonitor) Observe(iv []byte) {
+	var e duplicateEntry
+	copy(e.iv[:], iv)
+
+	m.mu.Lock()
+	if m.full {
+		old := m.window[m.next]
+		if m.counts[old.iv]--; m.counts[old.iv] == 0 {
+			delete(m.counts, old.iv)
+		}
+		if old.dup {
+			m.dups--
+		}
+	}
+
+	e.dup = m.counts[e.iv] > 0
+	if e.dup {
+		m.dups++
+	}
+	m.counts[e.iv]++
+	m.window[m.next] = e
+	m.next = (m.next + 1) % len(m.window)
+	if m.next == 0 {
+		m.full = true
+	}
+
+	rate := m.rate()
+	fire := false
+	if rate >= m.threshold && m.full {
+		fire = !m.alerted
+		m.alerted = true
+	} else if rate < m.threshold {
+		m.alerted = false
+	}
+	m.mu.Unlock()
+
+	if fire && m.alert != nil {
+		m.alert(rate)
+	}
+}
+
+/*
+Rate returns the share of seals in the window that repeated an earlier one
+*/
+func (m *DuplicateMonitor) Rate() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rate()
+}
+
+func (m *DuplicateMonitor) rate() float64 {
+	n := m.next
+	if m.full {
+		n = len(m.window)
+	}
+	if n == 0 {
+		return 0
+	}
+	return float64(m.dups) / float64(n)
+}
@@ -0,0 +1,74 @@
+package siv
+
+import (
+	"errors"
+	"github.com/luc-lynx/siv/internal/common"
+)
+
+/*
+Failure classes. Errors returned by Open and by the packages built on it wrap one
+of them, use errors.Is to branch on the cause:
+
+	ErrMalformed           the input can't be a ciphertext, e.g. it is too short
+	ErrAuthentication      the tag doesn't match: wrong key, associated data or a modified ciphertext
+	ErrUnsupportedVersion  the input has a format version this build doesn't know
+*/
+var (
+	ErrMalformed          = errors.New("siv: malformed input")
+	ErrAuthentication     = errors.New("siv: message authentication failed")
+	ErrUnsupportedVersion = errors.New("siv: unsupported format version")
+)
+
+/*
+Sentinels for failures callers commonly branch on. The packages of this module
+wrap them in their own errors, so errors.Is works across them, cmac and polyval
+included:
+
+	ErrKeySize             a key of the wrong size for the algorithm, a configuration error
+	ErrCiphertextTooShort  shorter than the tag or the framing, it is ErrMalformed too
+*/
+var (
+	ErrKeySize            = common.ErrKeySize
+	ErrCiphertextTooShort = NewError(ErrMalformed, "siv: ciphertext is too short")
+)
+
+/*
+classified is an error with its own message belonging to one of the failure classes
+*/
+type classified struct {
+	msg   string
+	class error
+}
+
+func (e *classified) Error() string {
+	return e.msg
+}
+
+func (e *classified) Unwrap() error {
+	return e.class
+}
+
+/*
+NewError returns an error with the message msg wrapping class, for packages
+built on siv that want their errors classified the same way
+*/
+func NewError(class error, msg string) error {
+	return &classified{msg: msg, class: class}
+}
+
+/*
+FailureClass names the class of err for metrics and logs: "malformed",
+"authentication", "version" or "other"
+*/
+func FailureClass(err error) string {
+	switch {
+	case errors.Is(err, ErrMalformed):
+		return "malformed"
+	case errors.Is(err, ErrAuthentication):
+		return "authentication"
+	case errors.Is(err, ErrUnsupportedVersion):
+		return "version"
+	default:
+		return "other"
+	}
+}
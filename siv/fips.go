@@ -0,0 +1,80 @@
+package siv
+
+import (
+	"crypto/fips140"
+	"crypto/subtle"
+	"errors"
+	"sync"
+)
+
+/*
+FIPS-leaning mode.
+
+AES-SIV itself isn't a NIST approved mode, but it is built only from approved
+primitives: AES-CMAC (SP 800-38B) and AES-CTR (SP 800-38A). The package never
+ships its own AES, every block cipher comes from crypto/aes, so the Go FIPS 140-3
+module (GODEBUG=fips140=on) or BoringCrypto (GOEXPERIMENT=boringcrypto) is used
+whenever the binary is built or run with one of them.
+
+The mode is enabled by building with the sivfips tag or by running with the Go
+FIPS 140-3 module enabled. In this mode NewAesSIV
+  - runs the known answer tests once before the first key is accepted
+  - rejects keys whose CMAC and CTR halves are equal, SP 800-57 requires
+    a key to be used for a single purpose
+  - rejects block ciphers other than crypto/aes and PRFs other than AES-CMAC
+
+and the constructions that aren't RFC 5297 are rejected: WithIVMask with a mask
+of its own, NewTruncatedAesSIV with tags shorter than 128 bits, and AES-GCM-SIV
+of the gcmsiv package, whose POLYVAL isn't an approved MAC.
+*/
+
+var (
+	errFIPSKeyReuse = errors.New("fips mode: CMAC and CTR keys must be different")
+
+	selfTestOnce   sync.Once
+	selfTestResult error
+)
+
+/*
+FIPSMode reports whether the restrictions of the FIPS-leaning mode are enforced
+*/
+func FIPSMode() bool {
+	return fipsBuild || fips140.Enabled()
+}
+
+/*
+ValidatedBackend reports whether AES is provided by a FIPS 140 validated module,
+either the Go Cryptographic Module or BoringCrypto
+*/
+func ValidatedBackend() bool {
+	return fips140.Enabled() || boringEnabled()
+}
+
+/*
+Backend names the implementation behind crypto/aes: "boringcrypto",
+"go-fips140" or "go"
+*/
+func Backend() string {
+	switch {
+	case boringEnabled():
+		return "boringcrypto"
+	case fips140.Enabled():
+		return "go-fips140"
+	default:
+		return "go"
+	}
+}
+
+func checkFIPS(key []byte) error {
+	selfTestOnce.Do(func() {
+		selfTestResult = SelfTest()
+	})
+	if selfTestResult != nil {
+		return selfTestResult
+	}
+
+	if subtle.ConstantTimeCompare(key[:len(key)/2], key[len(key)/2:]) == 1 {
+		return errFIPSKeyReuse
+	}
+	return nil
+}
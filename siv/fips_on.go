@@ -0,0 +1,5 @@
+//go:build sivfips
+
+package siv
+
+const fipsBuild = true
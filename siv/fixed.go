@@ -0,0 +1,41 @@
+package siv
+
+import "errors"
+
+/*
+SealTo and OpenTo write into the caller's buffer instead of appending, for
+pooled and ring buffer I/O. They never allocate the output and return the number
+of bytes written to the start of dst.
+*/
+
+var errShortBuffer = errors.New("siv: destination buffer is too small")
+
+/*
+SealTo seals into dst, which must hold at least len(plaintext)+Overhead() bytes
+*/
+func (a aessiv) SealTo(dst, plaintext []byte, additionalData [][]byte) (int, error) {
+	if len(dst) < len(plaintext)+blockSize {
+		return 0, errShortBuffer
+	}
+	ret, err := a.sealWithMultipleAAD(dst[:0], plaintext, additionalData)
+	if err != nil {
+		return 0, err
+	}
+	return len(ret), nil
+}
+
+/*
+OpenTo opens into dst, which must hold at least len(ciphertext)-Overhead() bytes.
+On failure nothing is left in dst.
+*/
+func (a aessiv) OpenTo(dst, ciphertext []byte, additionalData [][]byte) (int, error) {
+	if len(ciphertext) >= blockSize && len(dst) < len(ciphertext)-blockSize {
+		return 0, errShortBuffer
+	}
+
+	plaintext, err := a.OpenWithMultipleAAD(dst[:0], ciphertext, additionalData)
+	if err != nil {
+		return 0, err
+	}
+	return len(plaintext), nil
+}
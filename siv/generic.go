@@ -0,0 +1,17 @@
+package siv
+
+import "crypto/cipher"
+
+/*
+NewSIV is SIV (RFC 5297) over another block cipher with 128-bit blocks, e.g. SM4,
+Camellia, ARIA, Twofish or Serpent from third party packages. S2V uses CMAC over
+the same cipher, the doubling in GF(2^128) and the CTR counter are the same as for
+AES. key is two keys of the cipher, the first for S2V and the second for CTR, 32,
+48 or 64 bytes in total. The result interoperates with other implementations of
+the same cipher's SIV only; the FIPS mode rejects it, even with crypto/aes.
+
+NewSIV(newCipher, key, opts...) is NewAesSIV(key, WithBlockCipher(newCipher), opts...).
+*/
+func NewSIV(newCipher func(key []byte) (cipher.Block, error), key []byte, opts ...Option) (*aessiv, error) {
+	return NewAesSIV(key, append([]Option{WithBlockCipher(newCipher)}, opts...)...)
+}
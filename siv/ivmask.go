@@ -0,0 +1,57 @@
+package siv
+
+import "errors"
+
+var (
+	errIVMaskSize = errors.New("siv: IV mask must be 16 bytes")
+	errFIPSIVMask = errors.New("siv: FIPS mode requires the RFC 5297 IV mask")
+)
+
+/*
+WithIVMask replaces the mask applied to the synthetic IV before it is used as the
+CTR counter. RFC 5297 clears the top bits of the last two 32-bit words, which is
+the default and what nil keeps. Other masks are only meant for reading data
+produced by non-conformant implementations during a migration, the output isn't
+AES-SIV and doesn't interoperate with anything else. An all-ones mask clears no bits.
+The FIPS mode rejects any mask but nil.
+*/
+func WithIVMask(ivMask []byte) Option {
+	return func(a *aessiv) error {
+		if ivMask == nil {
+			a.ivMask = nil
+			return nil
+		}
+		if FIPSMode() {
+			return errFIPSIVMask
+		}
+		if len(ivMask) != blockSize {
+			return errIVMaskSize
+		}
+		a.ivMask = append([]byte{}, ivMask...)
+		return nil
+	}
+}
+
+/*
+SetIVMask replaces the mask applied to the synthetic IV like WithIVMask, nil
+restores the RFC 5297 mask.
+
+Deprecated: use WithIVMask. Calling it during a concurrent Seal or Open is a data race.
+*/
+func (a *aessiv) SetIVMask(ivMask []byte) error {
+	return WithIVMask(ivMask)(a)
+}
+
+func (a aessiv) counterInto(iv, v []byte) {
+	if a.ivMask != nil {
+		maskInto(iv, v, a.ivMask)
+		return
+	}
+	maskInto(iv, v, mask)
+}
+
+func maskInto(iv, v, m []byte) {
+	for i := range iv {
+		iv[i] = v[i] & m[i]
+	}
+}
@@ -0,0 +1,80 @@
+package siv
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+/*
+Key is AES-SIV key material, both halves included. It never prints: String, Format
+and LogValue return a placeholder, so a Key logged or wrapped into an error by
+mistake doesn't leak.
+*/
+type Key []byte
+
+const redactedKey = "[siv key redacted]"
+
+var (
+	errKeyBits       = NewError(ErrKeySize, "siv: key size must be 256, 384 or 512 bits")
+	errDegenerateKey = errors.New("siv: random source returned a degenerate key")
+)
+
+/*
+GenerateKey reads a key of 256, 384 or 512 bits from random, nil means crypto/rand.
+A failing or short read is returned as an error, and so is output whose halves
+are equal, which a stuck source produces and which the FIPS mode rejects anyway.
+*/
+func GenerateKey(random io.Reader, bits int) (Key, error) {
+	switch bits {
+	case 256, 384, 512:
+	default:
+		return nil, errKeyBits
+	}
+	if random == nil {
+		random = rand.Reader
+	}
+
+	key := make(Key, bits/8)
+	if _, err := io.ReadFull(random, key); err != nil {
+		return nil, fmt.Errorf("siv: reading key material: %w", err)
+	}
+	if subtle.ConstantTimeCompare(key[:len(key)/2], key[len(key)/2:]) == 1 {
+		clear(key)
+		return nil, errDegenerateKey
+	}
+	return key, nil
+}
+
+/*
+AEAD returns deterministic AES-SIV with the key, see NewAesSIV
+*/
+func (k Key) AEAD() (*aessiv, error) {
+	return NewAesSIV(k)
+}
+
+/*
+Bits returns the key size in bits, both halves included
+*/
+func (k Key) Bits() int {
+	return len(k) * 8
+}
+
+func (k Key) String() string {
+	return redactedKey
+}
+
+func (k Key) GoString() string {
+	return redactedKey
+}
+
+func (k Key) Format(f fmt.State, verb rune) {
+	io.WriteString(f, redactedKey)
+}
+
+func (k Key) LogValue() slog.Value {
+	return slog.StringValue(redactedKey)
+}
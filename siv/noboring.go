@@ -0,0 +1,7 @@
+//go:build !boringcrypto
+
+package siv
+
+func boringEnabled() bool {
+	return false
+}
@@ -0,0 +1,54 @@
+package siv
+
+/*
+Nonce-based AES-SIV from https://tools.ietf.org/html/rfc5297#section-3.
+The nonce is the last S2V string, after the associated data:
+
+	V = S2V(K1, AD, N, P)
+
+so the output is probabilistic as long as nonces don't repeat, and a repeated nonce
+only reveals that the same message was sealed twice. The type is a cipher.AEAD
+with a 16 byte nonce for code that does its own nonce handling; data sealed with
+it can be opened by NewAesSIV with the nonce passed as the last associated data string.
+*/
+
+const NonceSize = 16
+
+const invalidNonceSize = "siv: incorrect nonce length given to nonce-based AES-SIV"
+
+var errNonceSize = NewError(ErrMalformed, "invalid nonce length")
+
+type nonceSIV struct {
+	*aessiv
+}
+
+/*
+NewNonceAesSIV creates nonce-based AES-SIV, keys are the same as for NewAesSIV.
+Seal panics on nonces that aren't NonceSize bytes long like the AEADs of
+crypto/cipher, Open returns an error.
+*/
+func NewNonceAesSIV(key []byte) (*nonceSIV, error) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		return nil, err
+	}
+	return &nonceSIV{s}, nil
+}
+
+func (a nonceSIV) NonceSize() int {
+	return NonceSize
+}
+
+func (a nonceSIV) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != NonceSize {
+		panic(invalidNonceSize)
+	}
+	return a.SealWithMultipleAAD(dst, plaintext, [][]byte{additionalData, nonce})
+}
+
+func (a nonceSIV) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != NonceSize {
+		return nil, errNonceSize
+	}
+	return a.OpenWithMultipleAAD(dst, ciphertext, [][]byte{additionalData, nonce})
+}
@@ -0,0 +1,155 @@
+package siv
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"github.com/luc-lynx/siv/prf"
+	"hash"
+)
+
+/*
+Options of NewAesSIV for the variants that used to need their own constructor or
+setter. They are applied once by the constructor:
+
+	a, err := siv.NewAesSIV(key, siv.WithNonceSize(12), siv.WithMaxAAD(4))
+
+Options next to the features they configure: WithAudit (audit.go), WithDuplicateMonitor
+(duplicates.go), WithIVMask (ivmask.go), WithRandom (random.go), WithUniformFailureTiming
+and WithTimeQuantum (timing.go). The deprecated Set methods of the same features still
+mutate the AEAD without synchronization; an AEAD configured only with options doesn't
+change after the constructor returns and is safe for concurrent use.
+*/
+
+var (
+	errNilBlockCipher = errors.New("siv: block cipher constructor is nil")
+	errBlockSize      = errors.New("siv: block cipher must have 128-bit blocks")
+	errOptionNonce    = errors.New("siv: nonce size must not be negative")
+	errOptionMaxAAD   = errors.New("siv: associated data limit must be between 1 and 126")
+	errFIPSCipher     = errors.New("siv: FIPS mode requires AES from crypto/aes")
+	errNilPRF         = errors.New("siv: PRF constructor is nil")
+	errPRFSize        = errors.New("siv: S2V PRF must have 128-bit output")
+	errFIPSPRF        = errors.New("siv: FIPS mode requires AES-CMAC for S2V")
+)
+
+type Option func(*aessiv) error
+
+/*
+WithBlockCipher replaces crypto/aes for both halves of the key, newCipher gets
+each half and must return a cipher with 128-bit blocks. The FIPS mode rejects it.
+*/
+func WithBlockCipher(newCipher func(key []byte) (cipher.Block, error)) Option {
+	return func(a *aessiv) error {
+		if newCipher == nil {
+			return errNilBlockCipher
+		}
+		a.newCipher = newCipher
+		return nil
+	}
+}
+
+/*
+WithPRF builds S2V on f instead of AES-CMAC, f gets the first half of the key and
+must return a PRF with 128-bit output, CTR still uses the second half. The result
+doesn't interoperate with RFC 5297 and the FIPS mode rejects it.
+*/
+func WithPRF(f prf.Func) Option {
+	return func(a *aessiv) error {
+		if f == nil {
+			return errNilPRF
+		}
+		a.newPRF, a.prfName = f, "PRF"
+		return nil
+	}
+}
+
+/*
+WithHMAC builds S2V on HMAC with the hash h truncated to 128 bits, SIV-HMAC as
+deployed where CMAC is avoided. With sha256.New and a 64-byte key S2V is keyed
+with 32 bytes of HMAC-SHA-256 and CTR is AES-256:
+
+	a, err := siv.NewAesSIV(key, siv.WithHMAC(sha256.New))
+*/
+func WithHMAC(h func() hash.Hash) Option {
+	return func(a *aessiv) error {
+		if h == nil {
+			return errNilPRF
+		}
+		a.newPRF, a.prfName = prf.Truncated(prf.HMAC(h), blockSize), "HMAC"
+		return nil
+	}
+}
+
+/*
+WithNonceSize makes Seal and Open of cipher.AEAD nonce-based like NewNonceAesSIV
+but with n byte nonces, the nonce is the last associated data string. 0 keeps the
+deterministic AEAD, which ignores the nonce argument.
+*/
+func WithNonceSize(n int) Option {
+	return func(a *aessiv) error {
+		if n < 0 {
+			return errOptionNonce
+		}
+		a.nonceSize = n
+		return nil
+	}
+}
+
+/*
+WithMaxAAD lowers the number of associated data strings accepted per call from
+MaxAssociatedData to n, the nonce of WithNonceSize and of SealRandom counts as one
+*/
+func WithMaxAAD(n int) Option {
+	return func(a *aessiv) error {
+		if n < 1 || n > MaxAssociatedData {
+			return errOptionMaxAAD
+		}
+		a.maxAAD = n
+		return nil
+	}
+}
+
+func (a aessiv) aadLimit() int {
+	if a.maxAAD == 0 {
+		return MaxAssociatedData
+	}
+	return a.maxAAD
+}
+
+/*
+newBlock keys the configured block cipher, crypto/aes by default
+*/
+func (a aessiv) newBlock(key []byte) (cipher.Block, error) {
+	if a.newCipher == nil {
+		return aes.NewCipher(key)
+	}
+
+	b, err := a.newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if b.BlockSize() != blockSize {
+		return nil, errBlockSize
+	}
+	return b, nil
+}
+
+/*
+newPRFScratch is newScratch for S2V keyed with the PRF of WithPRF or WithHMAC
+*/
+func newPRFScratch(key []byte, ctr cipher.Block, newPRF prf.Func) (*scratch, error) {
+	mac, err := newPRF(key[:len(key)/2])
+	if err != nil {
+		return nil, fmt.Errorf("siv: %w", err)
+	}
+	if mac.Size() != blockSize {
+		return nil, errPRFSize
+	}
+	if ctr == nil {
+		if ctr, err = newCTRCipher(key); err != nil {
+			return nil, err
+		}
+	}
+	return &scratch{mac: mac, ctr: ctr}, nil
+}
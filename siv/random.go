@@ -0,0 +1,156 @@
+package siv
+
+import (
+	"crypto/rand"
+	"github.com/luc-lynx/siv/internal/common"
+	"io"
+)
+
+/*
+SealRandom and OpenRandom give probabilistic encryption: a random 16 byte value
+is used as the last associated data string (the nonce position of RFC 5297
+section 3) and is prepended to the output
+
+	random (16 bytes) || V (16 bytes) || C
+
+Equal messages produce different ciphertexts. If the random source ever
+repeats, the result degrades to deterministic AES-SIV: only the equality of
+messages sealed with the same value leaks, nothing else.
+
+Like Seal they work in place, with dst = plaintext[:0] and dst = ciphertext[:0],
+and with room left for the nonce, dst = buf[:0] and plaintext = buf[16:].
+*/
+
+const RandomNonceSize = 16
+
+var hedgeLabel = []byte("siv hedged nonce")
+
+/*
+WithRandom replaces crypto/rand as the source of the random values of SealRandom and
+SealHedged, nil keeps it. Meant for a DRBG or hardware TRNG, and for deterministic
+tests; a predictable reader turns SealRandom into deterministic encryption. Reads
+aren't serialized, r must be safe for concurrent use if the AEAD is.
+*/
+func WithRandom(r io.Reader) Option {
+	return func(a *aessiv) error {
+		a.random = r
+		return nil
+	}
+}
+
+/*
+SetRandom replaces crypto/rand as the source of the random values of SealRandom and
+SealHedged like WithRandom, nil restores it.
+
+Deprecated: use WithRandom. Replacing the reader while SealRandom runs on another
+goroutine is a data race.
+*/
+func (a *aessiv) SetRandom(r io.Reader) {
+	WithRandom(r)(a)
+}
+
+func (a aessiv) readRandom(b []byte) error {
+	r := a.random
+	if r == nil {
+		r = rand.Reader
+	}
+	_, err := io.ReadFull(r, b)
+	return err
+}
+
+func (a aessiv) SealRandom(dst, plaintext []byte, additionalData [][]byte) ([]byte, error) {
+	var nonce [RandomNonceSize]byte
+	if err := a.readRandom(nonce[:]); err != nil {
+		return nil, err
+	}
+
+	return a.sealPrefixed(dst, nonce[:], plaintext, withNonce(additionalData, nonce[:]))
+}
+
+/*
+SealHedged is SealRandom with a nonce derived from both the random value and the
+input, the random value itself is never sent:
+
+	nonce = S2V(K1, AD1, ..., ADn, "siv hedged nonce", random, P)
+
+While the random source is healthy the output is randomized like with SealRandom.
+If it fails or repeats, the nonce is still a PRF of the message and the result is
+exactly as secure as deterministic AES-SIV. The output is opened with OpenRandom,
+dst and plaintext may overlap like for SealRandom.
+*/
+func (a aessiv) SealHedged(dst, plaintext []byte, additionalData [][]byte) ([]byte, error) {
+	var random [RandomNonceSize]byte
+	if err := a.readRandom(random[:]); err != nil {
+		return nil, err
+	}
+
+	hedge := append(withNonce(additionalData, hedgeLabel), random[:])
+	if len(hedge) > MaxAssociatedData {
+		return nil, errTooManyAAD
+	}
+
+	s, err := a.getScratch()
+	if err != nil {
+		return nil, err
+	}
+	var nonce [RandomNonceSize]byte
+	s2vInto(s.mac, s.d[:], s.block[:], hedge, plaintext)
+	copy(nonce[:], s.d[:])
+	a.putScratch(s)
+
+	return a.sealPrefixed(dst, nonce[:], plaintext, withNonce(additionalData, nonce[:]))
+}
+
+func (a aessiv) OpenRandom(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error) {
+	if len(ciphertext) < RandomNonceSize {
+		return nil, ErrCiphertextTooShort
+	}
+
+	var nonce [RandomNonceSize]byte
+	copy(nonce[:], ciphertext)
+	additionalData = withNonce(additionalData, nonce[:])
+	sealed := ciphertext[RandomNonceSize:]
+
+	ret, out := sliceForAppend(dst, max(len(sealed)-blockSize, 0))
+	if common.InexactOverlap(out, sealed) && !common.InexactOverlap(out, ciphertext) {
+		// dst = ciphertext[:0]: open in place behind the nonce, then move the plaintext
+		plaintext, err := a.OpenWithMultipleAAD(sealed[:0], sealed, additionalData)
+		if err != nil {
+			return nil, err
+		}
+		copy(out, plaintext)
+		return ret, nil
+	}
+	return a.OpenWithMultipleAAD(dst, sealed, additionalData)
+}
+
+/*
+sealPrefixed appends prefix || SIV(K, additionalData, plaintext) to dst. The output
+may start where the plaintext does or RandomNonceSize bytes before it, the first
+case is sealed in place and moved up to make room for the prefix.
+*/
+func (a aessiv) sealPrefixed(dst, prefix, plaintext []byte, additionalData [][]byte) ([]byte, error) {
+	ret, out := sliceForAppend(dst, len(prefix)+len(plaintext)+blockSize)
+	sealed := out[len(prefix):]
+
+	if common.InexactOverlap(sealed, plaintext) && !common.InexactOverlap(out, plaintext) {
+		if _, err := a.sealWithMultipleAAD(out[:0], plaintext, additionalData); err != nil {
+			return nil, err
+		}
+		copy(sealed, out)
+	} else if _, err := a.sealWithMultipleAAD(sealed[:0], plaintext, additionalData); err != nil {
+		return nil, err
+	}
+
+	copy(out, prefix)
+	return ret, nil
+}
+
+/*
+withNonce appends the nonce without touching the caller's slice
+*/
+func withNonce(additionalData [][]byte, nonce []byte) [][]byte {
+	aad := make([][]byte, len(additionalData), len(additionalData)+1)
+	copy(aad, additionalData)
+	return append(aad, nonce)
+}
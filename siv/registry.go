@@ -0,0 +1,165 @@
+package siv
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+/*
+Algorithm registry. Modes register a constructor under a stable name so they can
+be selected by configuration strings. Packages with other modes register
+themselves in init, like database/sql drivers, and have to be imported for
+their side effects: gcmsiv registers AES-GCM-SIV-128 and AES-GCM-SIV-256 and the
+IANA identifiers 30 and 31.
+*/
+
+const (
+	AlgAESSIVCMAC256 = "AES-SIV-CMAC-256"
+	AlgAESSIVCMAC384 = "AES-SIV-CMAC-384"
+	AlgAESSIVCMAC512 = "AES-SIV-CMAC-512"
+)
+
+/*
+Names and numeric identifiers of the IANA "AEAD Algorithms" registry (RFC 5116),
+the values protocols such as NTS (RFC 8915) negotiate. They denote nonce-based
+AES-SIV of RFC 5297 section 6, the AEAD takes a NonceSize byte nonce as the last
+S2V string. The AES-SIV-CMAC names above are deterministic AES-SIV.
+*/
+const (
+	AlgAEADAESSIVCMAC256 = "AEAD_AES_SIV_CMAC_256"
+	AlgAEADAESSIVCMAC384 = "AEAD_AES_SIV_CMAC_384"
+	AlgAEADAESSIVCMAC512 = "AEAD_AES_SIV_CMAC_512"
+
+	IDAESSIVCMAC256 uint16 = 15
+	IDAESSIVCMAC384 uint16 = 16
+	IDAESSIVCMAC512 uint16 = 17
+)
+
+var (
+	errUnknownAlgorithm = errors.New("unknown algorithm")
+	errKeySizeMismatch  = NewError(ErrKeySize, "key size doesn't match the algorithm")
+
+	registryMu sync.RWMutex
+	registry   = make(map[string]Constructor)
+	ids        = make(map[uint16]string)
+)
+
+type Constructor func(key []byte) (cipher.AEAD, error)
+
+func init() {
+	Register(AlgAESSIVCMAC256, constructor(NewSIVCMAC256))
+	Register(AlgAESSIVCMAC384, constructor(NewSIVCMAC384))
+	Register(AlgAESSIVCMAC512, constructor(NewSIVCMAC512))
+
+	Register(AlgAEADAESSIVCMAC256, nonceConstructor(32))
+	Register(AlgAEADAESSIVCMAC384, nonceConstructor(48))
+	Register(AlgAEADAESSIVCMAC512, nonceConstructor(64))
+	RegisterID(IDAESSIVCMAC256, AlgAEADAESSIVCMAC256)
+	RegisterID(IDAESSIVCMAC384, AlgAEADAESSIVCMAC384)
+	RegisterID(IDAESSIVCMAC512, AlgAEADAESSIVCMAC512)
+}
+
+/*
+Register makes a constructor available by name. It panics if the name is
+already taken or the constructor is nil.
+*/
+func Register(name string, c Constructor) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if c == nil {
+		panic("siv: Register constructor is nil")
+	}
+	if _, dup := registry[name]; dup {
+		panic("siv: Register called twice for " + name)
+	}
+	registry[name] = c
+}
+
+/*
+RegisterID makes the algorithm registered under name available by its IANA
+identifier. It panics if the identifier is already taken.
+*/
+func RegisterID(id uint16, name string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, dup := ids[id]; dup {
+		panic(fmt.Sprintf("siv: RegisterID called twice for %d", id))
+	}
+	ids[id] = name
+}
+
+/*
+New creates the AEAD registered under name
+*/
+func New(name string, key []byte) (cipher.AEAD, error) {
+	registryMu.RLock()
+	c, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", errUnknownAlgorithm, name)
+	}
+	return c(key)
+}
+
+/*
+NewByID creates the AEAD with the IANA identifier id, 15, 16 and 17 are nonce-based
+AEAD_AES_SIV_CMAC_256, 384 and 512, 30 and 31 are AES-GCM-SIV once gcmsiv is
+imported. The key size must match the identifier.
+*/
+func NewByID(id uint16, key []byte) (cipher.AEAD, error) {
+	registryMu.RLock()
+	name, ok := ids[id]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: AEAD identifier %d", errUnknownAlgorithm, id)
+	}
+	return New(name, key)
+}
+
+/*
+Algorithms returns the sorted names of the registered algorithms
+*/
+func Algorithms() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+nonceConstructor returns nonce-based AES-SIV for keys of exactly size bytes
+*/
+func nonceConstructor(size int) Constructor {
+	return func(key []byte) (cipher.AEAD, error) {
+		aead, err := newExactKeySize(key, size)
+		if err != nil {
+			return nil, err
+		}
+		return &nonceSIV{aead}, nil
+	}
+}
+
+/*
+constructor adapts the siv constructors, a nil *aessiv must become a nil cipher.AEAD
+*/
+func constructor(newAEAD func(key []byte) (*aessiv, error)) Constructor {
+	return func(key []byte) (cipher.AEAD, error) {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		return aead, nil
+	}
+}
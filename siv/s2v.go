@@ -0,0 +1,155 @@
+package siv
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/luc-lynx/siv/ct"
+	"github.com/luc-lynx/siv/internal/common"
+	"github.com/luc-lynx/siv/prf"
+)
+
+var (
+	errTooManyStrings = NewError(ErrMalformed, "S2V is defined for at most 127 strings")
+	errS2VFinished    = errors.New("siv: S2V writer is already finished")
+	one               = []byte{
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+	}
+)
+
+/*
+S2V is the vector PRF of RFC 5297 section 2.4 over AES-CMAC, the synthetic IV of
+AES-SIV is S2V(K1, AD1, ..., ADn, P). It takes a vector of strings rather than a
+concatenation, so ("ab", "c") and ("a", "bc") give unrelated outputs without any
+encoding, which makes it a deterministic MAC for tuples and a key derivation function
+with separate context strings.
+
+key is a CMAC key of 16, 24 or 32 bytes and must not be the first half of an
+AES-SIV key: S2V over the strings of a message is the synthetic IV of that message under
+the AES-SIV key. There are at most 127 strings; with none the output is
+AES-CMAC(K, <one>) as in the RFC.
+*/
+func S2V(key []byte, strings [][]byte) ([16]byte, error) {
+	var v [blockSize]byte
+	if len(strings) > MaxAssociatedData+1 {
+		return v, errTooManyStrings
+	}
+
+	mac, err := prf.CMAC(key)
+	if err != nil {
+		return v, err
+	}
+
+	if len(strings) == 0 {
+		mac.Write(one)
+		mac.SumInto(v[:])
+		return v, nil
+	}
+
+	var block [blockSize]byte
+	s2vInto(mac, v[:], block[:], strings[:len(strings)-1], strings[len(strings)-1])
+	return v, nil
+}
+
+/*
+S2VWriter computes S2V of a vector whose last string is too large to hold in memory.
+The other strings are passed to NewS2VWriter, the last one is written in any number
+of pieces. Only the last 16 bytes written are buffered, they are combined with the
+value of the other strings (xorend, or doubling and padding for short strings) when
+Sum is called.
+*/
+type S2VWriter struct {
+	mac  prf.PRF
+	d    [blockSize]byte
+	tail [blockSize]byte
+	n    int
+
+	done bool
+	v    [blockSize]byte
+}
+
+/*
+NewS2VWriter starts S2V(key, additionalData..., last), key is a CMAC key of 16,
+24 or 32 bytes and there are at most MaxAssociatedData strings
+*/
+func NewS2VWriter(key []byte, additionalData [][]byte) (*S2VWriter, error) {
+	if len(additionalData) > MaxAssociatedData {
+		return nil, errTooManyAAD
+	}
+
+	mac, err := prf.CMAC(key)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &S2VWriter{mac: mac}
+	mac.Write(zero)
+	mac.SumInto(w.d[:])
+
+	var block [blockSize]byte
+	for _, s := range additionalData {
+		mac.Reset()
+		mac.Write(s)
+		mac.SumInto(block[:])
+		ct.Double(w.d[:], w.d[:])
+		subtle.XORBytes(w.d[:], w.d[:], block[:])
+	}
+	mac.Reset()
+	return w, nil
+}
+
+/*
+Write appends p to the last string, everything but the last 16 bytes seen so far
+goes to the MAC right away
+*/
+func (w *S2VWriter) Write(p []byte) (int, error) {
+	if w.done {
+		return 0, errS2VFinished
+	}
+
+	n := len(p)
+	if w.n+len(p) <= blockSize {
+		w.n += copy(w.tail[w.n:], p)
+		return n, nil
+	}
+
+	flush := w.n + len(p) - blockSize
+	if flush <= w.n {
+		w.mac.Write(w.tail[:flush])
+		copy(w.tail[:], w.tail[flush:w.n])
+		copy(w.tail[w.n-flush:], p)
+	} else {
+		w.mac.Write(w.tail[:w.n])
+		w.mac.Write(p[:flush-w.n])
+		copy(w.tail[:], p[flush-w.n:])
+	}
+	w.n = blockSize
+	return n, nil
+}
+
+/*
+Sum finishes the last string and returns S2V. Later calls return the same value,
+Write fails after Sum.
+*/
+func (w *S2VWriter) Sum() [16]byte {
+	if w.done {
+		return w.v
+	}
+
+	var block [blockSize]byte
+	if w.n == blockSize {
+		subtle.XORBytes(block[:], w.tail[:], w.d[:])
+	} else {
+		ct.Double(w.d[:], w.d[:])
+		common.Padding(block[:], w.tail[:w.n])
+		subtle.XORBytes(block[:], block[:], w.d[:])
+	}
+	w.mac.Write(block[:])
+	w.mac.SumInto(w.v[:])
+
+	// the buffered plaintext and the masked block
+	clear(block[:])
+	clear(w.tail[:])
+	w.done = true
+	return w.v
+}
@@ -0,0 +1,109 @@
+package siv
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"github.com/luc-lynx/siv/cmac"
+	"github.com/luc-lynx/siv/prf"
+)
+
+/*
+Allocation-free Seal and Open. The AES block of CTR and the keyed CMAC of S2V, with
+its subkeys, are computed once by the constructor and shared, they are safe for
+concurrent use. The CMAC state and the working blocks are per call, they live in a
+scratch value that is pooled per key. With a dst that has room for the output the
+fast path doesn't allocate.
+
+cipher.NewCTR allocates its buffer on every call, so CTR is done here with the block
+cipher for messages up to inlineCTRSize bytes. Above that the single allocation of
+the standard library CTR costs less than the slower block by block keystream.
+*/
+
+const inlineCTRSize = 256
+
+type scratch struct {
+	mac   prf.PRF
+	ctr   cipher.Block
+	d     [blockSize]byte
+	block [blockSize]byte
+	v     [blockSize]byte
+	iv    [blockSize]byte
+	ks    [blockSize]byte
+}
+
+func newCTRCipher(key []byte) (cipher.Block, error) {
+	block, err := aes.NewCipher(key[len(key)/2:])
+	if err != nil {
+		return nil, fmt.Errorf("siv: %w", err)
+	}
+	return block, nil
+}
+
+func newScratch(key []byte, ctr cipher.Block, mac *cmac.Keyed) (*scratch, error) {
+	var err error
+	if mac == nil {
+		if mac, err = cmac.NewKeyed(key[:len(key)/2]); err != nil {
+			return nil, fmt.Errorf("siv: %w", err)
+		}
+	}
+	if ctr == nil {
+		if ctr, err = newCTRCipher(key); err != nil {
+			return nil, err
+		}
+	}
+	return &scratch{mac: mac.New().(prf.PRF), ctr: ctr}, nil
+}
+
+/*
+getScratch falls back to a fresh state for values not built by a constructor, it
+is where every operation fails after Destroy
+*/
+func (a aessiv) getScratch() (*scratch, error) {
+	if a.destroyed {
+		return nil, errKeyDestroyed
+	}
+	if a.scratch != nil {
+		if s, ok := a.scratch.Get().(*scratch); ok {
+			return s, nil
+		}
+	}
+	if a.newPRF != nil {
+		return newPRFScratch(a.key, a.ctr, a.newPRF)
+	}
+	return newScratch(a.key, a.ctr, a.mac)
+}
+
+func (a aessiv) putScratch(s *scratch) {
+	s.mac.Reset()
+	clear(s.block[:])
+	clear(s.ks[:])
+	if a.scratch != nil {
+		a.scratch.Put(s)
+	}
+}
+
+/*
+xorKeyStream encrypts or decrypts buf in place in CTR mode starting at s.iv
+*/
+func (s *scratch) xorKeyStream(buf []byte) {
+	if len(buf) > inlineCTRSize {
+		cipher.NewCTR(s.ctr, s.iv[:]).XORKeyStream(buf, buf)
+		return
+	}
+
+	// the counter is the whole 128-bit block, big endian
+	for len(buf) > 0 {
+		s.ctr.Encrypt(s.ks[:], s.iv[:])
+		n := subtle.XORBytes(buf, buf, s.ks[:])
+		buf = buf[n:]
+
+		lo := binary.BigEndian.Uint64(s.iv[8:]) + 1
+		binary.BigEndian.PutUint64(s.iv[8:], lo)
+		if lo == 0 {
+			binary.BigEndian.PutUint64(s.iv[:8], binary.BigEndian.Uint64(s.iv[:8])+1)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package siv
+
+import "context"
+
+/*
+Sealer and Opener hide where the key lives, like crypto.Signer does for signing keys.
+Code written against them works the same with a local key, a keyset or a remote
+service such as a KMS or the sivd daemon. The context carries deadlines and
+cancellation of remote calls, local implementations ignore it.
+*/
+
+type Sealer interface {
+	SealContext(ctx context.Context, plaintext []byte, additionalData [][]byte) ([]byte, error)
+}
+
+type Opener interface {
+	OpenContext(ctx context.Context, ciphertext []byte, additionalData [][]byte) ([]byte, error)
+}
+
+type SealOpener interface {
+	Sealer
+	Opener
+}
+
+/*
+SealerFunc adapts a function to Sealer
+*/
+type SealerFunc func(ctx context.Context, plaintext []byte, additionalData [][]byte) ([]byte, error)
+
+func (f SealerFunc) SealContext(ctx context.Context, plaintext []byte, additionalData [][]byte) ([]byte, error) {
+	return f(ctx, plaintext, additionalData)
+}
+
+/*
+OpenerFunc adapts a function to Opener
+*/
+type OpenerFunc func(ctx context.Context, ciphertext []byte, additionalData [][]byte) ([]byte, error)
+
+func (f OpenerFunc) OpenContext(ctx context.Context, ciphertext []byte, additionalData [][]byte) ([]byte, error) {
+	return f(ctx, ciphertext, additionalData)
+}
+
+func (a aessiv) SealContext(_ context.Context, plaintext []byte, additionalData [][]byte) ([]byte, error) {
+	return a.sealWithMultipleAAD(nil, plaintext, additionalData)
+}
+
+func (a aessiv) OpenContext(_ context.Context, ciphertext []byte, additionalData [][]byte) ([]byte, error) {
+	return a.OpenWithMultipleAAD(nil, ciphertext, additionalData)
+}
+
+func (a truncatedSIV) SealContext(_ context.Context, plaintext []byte, additionalData [][]byte) ([]byte, error) {
+	return a.seal(nil, plaintext, additionalData)
+}
+
+func (a truncatedSIV) OpenContext(_ context.Context, ciphertext []byte, additionalData [][]byte) ([]byte, error) {
+	return a.OpenWithMultipleAAD(nil, ciphertext, additionalData)
+}
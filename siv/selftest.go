@@ -0,0 +1,79 @@
+package siv
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"github.com/luc-lynx/siv/cmac"
+)
+
+/*
+Known answer tests from https://tools.ietf.org/html/rfc5297#appendix-A
+The nonce of the A.2 example is the last associated data string.
+*/
+var knownAnswers = []struct {
+	name       string
+	key        string
+	aad        []string
+	plaintext  string
+	ciphertext string
+}{
+	{
+		name:       "RFC 5297 A.1",
+		key:        "fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff",
+		aad:        []string{"101112131415161718191a1b1c1d1e1f2021222324252627"},
+		plaintext:  "112233445566778899aabbccddee",
+		ciphertext: "85632d07c6e8f37f950acd320a2ecc9340c02b9690c4dc04daef7f6afe5c",
+	},
+	{
+		name: "RFC 5297 A.2",
+		key:  "7f7e7d7c7b7a79787776757473727170404142434445464748494a4b4c4d4e4f",
+		aad: []string{
+			"00112233445566778899aabbccddeeffdeaddadadeaddadaffeeddccbbaa99887766554433221100",
+			"102030405060708090a0",
+			"09f911029d74e35bd84156c5635688c0",
+		},
+		plaintext: "7468697320697320736f6d6520706c61696e7465787420746f20656e6372797074207573696e67205349562d414553",
+		ciphertext: "7bdb6e3b432667eb06f4d14bff2fbd0fcb900f2fddbe404326601965c889bf17" +
+			"dba77ceb094fa663b7a3f748ba8af829ea64ad544a272e9c485b62a3fd5c0d",
+	},
+}
+
+/*
+SelfTest runs the CMAC and AES-SIV known answer tests, sealing and opening every vector.
+It returns an error naming the first failed test, call it at startup if power-on self-tests
+are required or to detect a miscompiled or broken AES implementation.
+*/
+func SelfTest() error {
+	if err := cmac.SelfTest(); err != nil {
+		return err
+	}
+
+	for _, ka := range knownAnswers {
+		key, _ := hex.DecodeString(ka.key)
+		plaintext, _ := hex.DecodeString(ka.plaintext)
+		ciphertext, _ := hex.DecodeString(ka.ciphertext)
+		aad := make([][]byte, len(ka.aad))
+		for i := range ka.aad {
+			aad[i], _ = hex.DecodeString(ka.aad[i])
+		}
+
+		// NewAesSIV runs the self-test itself in FIPS mode
+		s := &aessiv{key: key}
+
+		if subtle.ConstantTimeCompare(s.SealWithMultipleAAD(nil, plaintext, aad), ciphertext) != 1 {
+			return fmt.Errorf("siv: self-test %s failed on seal", ka.name)
+		}
+
+		opened, err := s.OpenWithMultipleAAD(nil, ciphertext, aad)
+		if err != nil || subtle.ConstantTimeCompare(opened, plaintext) != 1 {
+			return fmt.Errorf("siv: self-test %s failed on open", ka.name)
+		}
+
+		ciphertext[0] ^= 1
+		if _, err := s.OpenWithMultipleAAD(nil, ciphertext, aad); err == nil {
+			return fmt.Errorf("siv: self-test %s failed, modified ciphertext has been accepted", ka.name)
+		}
+	}
+	return nil
+}
@@ -1,12 +1,16 @@
 package siv
 
 import (
-	"crypto/aes"
 	"crypto/cipher"
 	"crypto/subtle"
-	"errors"
+	"fmt"
 	"github.com/luc-lynx/siv/cmac"
-	"github.com/luc-lynx/siv/common"
+	"github.com/luc-lynx/siv/ct"
+	"github.com/luc-lynx/siv/internal/common"
+	"github.com/luc-lynx/siv/prf"
+	"io"
+	"sync"
+	"time"
 )
 
 /*
@@ -21,43 +25,63 @@ https://crypto.stackexchange.com/questions/59076/aes-pmac-siv-ae-algorithm
 */
 
 var (
-	errKeySizeNotSupported     = errors.New("key size not supported")
-	errInvalidCiphertextLength = errors.New("invalid ciphertext length")
-	errIntegrityError          = errors.New("integrity error")
-	mask                       = []byte{
+	errIntegrityError = NewError(ErrAuthentication, "integrity error")
+	errTooManyAAD     = NewError(ErrMalformed, "too many associated data strings")
+	mask              = []byte{
 		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
 		0x7f, 0xff, 0xff, 0xff, 0x7f, 0xff, 0xff, 0xff,
 	}
-	one = []byte{
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
-	}
 	zero = []byte{
 		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
 		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
 	}
-	rb = []byte{
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x87,
-	}
 )
 
+/*
+MaxAssociatedData is the number of associated data strings S2V is defined for
+(RFC 5297 section 2.4), the plaintext is the last of its 127 inputs. The modes that
+pass a nonce or a label as an extra string leave one less for the caller.
+*/
+const MaxAssociatedData = 126
+
 const (
-	xorEndInvalidParameters = "invalid parameters for xorEnd function, len(a) must be greater or equal than len(b)"
 	bitAndInvalidParameters = "invalid parameters for bitEnd function, len(a) must be equal to len(b)"
+	prfInvalidSize          = "siv: S2V needs a PRF with 128-bit output"
+	invalidBufferOverlap    = "siv: invalid buffer overlap"
 	blockSize               = 16
 )
 
 type aessiv struct {
 	cipher.AEAD
-	key []byte
+	key        []byte
+	audit      *audit
+	duplicates *DuplicateMonitor
+
+	uniformTiming bool
+	quantum       time.Duration
+	ivMask        []byte
+	random        io.Reader
+
+	// built by the constructors, see scratch.go
+	ctr       cipher.Block
+	mac       *cmac.Keyed
+	scratch   *sync.Pool
+	destroyed bool
+
+	// set by options, see options.go
+	newCipher func(key []byte) (cipher.Block, error)
+	nonceSize int
+	maxAAD    int
+	newPRF    prf.Func
+	prfName   string
 }
 
 func (a aessiv) NonceSize() int {
 	/*
-		We don't need any external nonce for SIV as SIV generates nonce itself
+		We don't need any external nonce for SIV as SIV generates nonce itself,
+		unless WithNonceSize asks for one
 	*/
-	return 0
+	return a.nonceSize
 }
 
 func (a aessiv) Overhead() int {
@@ -67,108 +91,386 @@ func (a aessiv) Overhead() int {
 	return blockSize
 }
 
-func (a aessiv) SealWithMultipleAAD(dst, plaintext []byte, additionalData [][]byte) []byte {
-	sivKey := a.key[0 : len(a.key)/2]
-	encKey := a.key[len(a.key)/2:]
+/*
+Algorithm returns the registry name of the mode, e.g. AES-SIV-CMAC-256
+*/
+func (a aessiv) Algorithm() string {
+	if a.newCipher != nil || a.newPRF != nil {
+		name, mac := "SIV", "CMAC"
+		if a.newCipher == nil {
+			name = "AES-SIV"
+		}
+		if a.newPRF != nil {
+			mac = a.prfName
+		}
+		return fmt.Sprintf("%s-%s-%d", name, mac, len(a.key)*8)
+	}
+	switch len(a.key) {
+	case 32:
+		return AlgAESSIVCMAC256
+	case 48:
+		return AlgAESSIVCMAC384
+	default:
+		return AlgAESSIVCMAC512
+	}
+}
 
-	v := s2v(sivKey, additionalData, plaintext)
-	iv := bitAnd(v, mask)
-	dst = append(dst, v...)
+/*
+KeySize returns the key size in bytes, both halves included
+*/
+func (a aessiv) KeySize() int {
+	return len(a.key)
+}
+
+func (a aessiv) TagSize() int {
+	return blockSize
+}
+
+/*
+String identifies the algorithm and never includes the key, so it's safe for logs
+*/
+func (a aessiv) String() string {
+	return fmt.Sprintf("%s (key %d bits, tag %d bits)", a.Algorithm(), a.KeySize()*8, a.TagSize()*8)
+}
 
-	aesEcb, err := aes.NewCipher(encKey)
+/*
+SealWithMultipleAAD can't return an error, it panics if the key is invalid, which only
+happens for an AEAD that wasn't created by a constructor, or with more associated
+data strings than the limit (MaxAssociatedData or WithMaxAAD). The methods returning an error (SealContext, SealTo,
+SealRandom) report it instead.
+*/
+func (a aessiv) SealWithMultipleAAD(dst, plaintext []byte, additionalData [][]byte) []byte {
+	ret, err := a.sealWithMultipleAAD(dst, plaintext, additionalData)
 	if err != nil {
 		panic(err.Error())
 	}
+	return ret
+}
 
-	enc := cipher.NewCTR(aesEcb, iv)
-	ciphertext := make([]byte, len(plaintext))
-	enc.XORKeyStream(ciphertext, plaintext)
+func (a aessiv) sealWithMultipleAAD(dst, plaintext []byte, additionalData [][]byte) ([]byte, error) {
+	if a.audit == nil && a.duplicates == nil && a.quantum == 0 {
+		return a.seal(dst, plaintext, additionalData)
+	}
 
-	return append(dst, ciphertext...)
+	start := time.Now()
+	ret, err := a.seal(dst, plaintext, additionalData)
+	var v []byte
+	if err == nil {
+		v = ret[len(dst) : len(dst)+blockSize]
+	}
+	a.sealDone(start, v, len(plaintext), len(additionalData), err)
+	return ret, err
+}
+
+/*
+sealDone and openDone feed the duplicate monitor and the audit hook and pad the time
+*/
+func (a aessiv) sealDone(start time.Time, v []byte, plaintextLen, aadCount int, err error) {
+	ciphertextLen := 0
+	if err == nil {
+		ciphertextLen = blockSize + plaintextLen
+		if a.duplicates != nil {
+			a.duplicates.Observe(v)
+		}
+	}
+	if a.audit != nil {
+		a.audit.record(OpSeal, plaintextLen, ciphertextLen, aadCount, start, err)
+	}
+	a.padTime(start)
+}
+
+func (a aessiv) openDone(start time.Time, plaintextLen, ciphertextLen, aadCount int, err error) {
+	if a.audit != nil {
+		if err != nil {
+			plaintextLen = 0
+		}
+		a.audit.record(OpOpen, plaintextLen, ciphertextLen, aadCount, start, err)
+	}
+	a.padTime(start)
 }
 
 func (a aessiv) OpenWithMultipleAAD(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error) {
-	if len(ciphertext) < blockSize+1 {
-		return nil, errInvalidCiphertextLength
+	if a.audit == nil && a.quantum == 0 {
+		return a.open(dst, ciphertext, additionalData)
+	}
+
+	start := time.Now()
+	ret, err := a.open(dst, ciphertext, additionalData)
+	a.openDone(start, len(ret)-len(dst), len(ciphertext), len(additionalData), err)
+	return ret, err
+}
+
+/*
+seal and open write into the capacity of dst like the AEADs of crypto/cipher, so
+Seal(plaintext[:0], nil, plaintext, ad) encrypts in place when plaintext has room
+for the synthetic IV and Open(ciphertext[:0], nil, ciphertext, ad) decrypts in
+place. The input is moved into place with copy and encrypted there; S2V reads the
+plaintext before it is moved. Any other overlap of the output with the input
+panics, see checkOverlap.
+*/
+func (a aessiv) seal(dst, plaintext []byte, additionalData [][]byte) ([]byte, error) {
+	checkOverlap(dst, blockSize+len(plaintext), plaintext)
+	ret, out := sliceForAppend(dst, blockSize+len(plaintext))
+	if err := a.sealDetached(out[:blockSize], out[blockSize:], plaintext, additionalData); err != nil {
+		return nil, err
 	}
+	return ret, nil
+}
 
-	v := ciphertext[0:blockSize]
-	c := ciphertext[blockSize:]
-	k1 := a.key[0 : len(a.key)/2]
-	k2 := a.key[len(a.key)/2:]
+/*
+sealDetached writes the synthetic IV into v and the encrypted plaintext into c, the
+IV is written last so v may overlap the plaintext
+*/
+func (a aessiv) sealDetached(v, c, plaintext []byte, additionalData [][]byte) error {
+	if len(additionalData) > a.aadLimit() {
+		return errTooManyAAD
+	}
 
-	iv := bitAnd(v, mask)
-	aesEcb, err := aes.NewCipher(k2)
+	s, err := a.getScratch()
 	if err != nil {
-		panic(err.Error())
+		return err
+	}
+	defer a.putScratch(s)
+
+	s2vInto(s.mac, s.d[:], s.block[:], additionalData, plaintext)
+
+	copy(c, plaintext)
+	a.counterInto(s.iv[:], s.d[:])
+	s.xorKeyStream(c)
+	copy(v, s.d[:])
+	return nil
+}
+
+/*
+open clears the output on failure, when it overlaps the ciphertext that is lost too
+*/
+func (a aessiv) open(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error) {
+	// an empty plaintext is sealed to the synthetic IV alone
+	if len(ciphertext) < blockSize {
+		if a.uniformTiming {
+			a.dummyOpen(ciphertext, additionalData)
+		}
+		return nil, ErrCiphertextTooShort
 	}
+	checkOverlap(dst, len(ciphertext)-blockSize, ciphertext)
+	return a.openDetached(dst, ciphertext[blockSize:], ciphertext[:blockSize], additionalData)
+}
+
+func (a aessiv) openDetached(dst, ciphertext, v []byte, additionalData [][]byte) ([]byte, error) {
+	if len(additionalData) > a.aadLimit() {
+		return nil, errTooManyAAD
+	}
+
+	s, err := a.getScratch()
+	if err != nil {
+		return nil, err
+	}
+	defer a.putScratch(s)
 
-	enc := cipher.NewCTR(aesEcb, iv)
+	// the output may overwrite the synthetic IV
+	copy(s.v[:], v)
 
-	plaintext := make([]byte, len(c))
-	enc.XORKeyStream(plaintext, c)
+	ret, plaintext := sliceForAppend(dst, len(ciphertext))
+	copy(plaintext, ciphertext)
+	a.counterInto(s.iv[:], s.v[:])
+	s.xorKeyStream(plaintext)
 
-	t := s2v(k1, additionalData, plaintext)
-	if subtle.ConstantTimeCompare(t, v) == 1 {
-		return append(dst, plaintext...), nil
+	s2vInto(s.mac, s.d[:], s.block[:], additionalData, plaintext)
+	if subtle.ConstantTimeCompare(s.d[:], s.v[:]) == 1 {
+		return ret, nil
 	}
 
+	// don't leave unauthenticated plaintext in memory
+	clear(plaintext)
 	return nil, errIntegrityError
 }
 
 func (a aessiv) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if a.nonceSize > 0 {
+		if len(nonce) != a.nonceSize {
+			panic(invalidNonceSize)
+		}
+		return a.SealWithMultipleAAD(dst, plaintext, [][]byte{additionalData, nonce})
+	}
 	return a.SealWithMultipleAAD(dst, plaintext, [][]byte{additionalData})
 }
 
 func (a aessiv) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if a.nonceSize > 0 {
+		if len(nonce) != a.nonceSize {
+			return nil, errNonceSize
+		}
+		return a.OpenWithMultipleAAD(dst, ciphertext, [][]byte{additionalData, nonce})
+	}
 	return a.OpenWithMultipleAAD(dst, ciphertext, [][]byte{additionalData})
 }
 
-func NewAesSIV(key []byte) (*aessiv, error) {
+/*
+NewAesSIV keeps a copy of the key and expands the CTR key and the CMAC subkeys once,
+the caller can clear key afterwards. The options are in options.go.
+*/
+func NewAesSIV(key []byte, opts ...Option) (*aessiv, error) {
 	switch len(key) {
 	case 32, 48, 64:
-		return &aessiv{key: key}, nil
 	default:
-		return nil, errKeySizeNotSupported
+		return nil, ErrKeySize
 	}
-}
 
-func s2v(key []byte, aad [][]byte, plaintext []byte) []byte {
-	if len(aad) == 0 {
-		return cmac.Sum(key, one)
+	a := &aessiv{scratch: &sync.Pool{}}
+	for _, opt := range opts {
+		if err := opt(a); err != nil {
+			return nil, err
+		}
 	}
 
-	d := cmac.Sum(key, zero)
-	for i := 0; i < len(aad); i++ {
-		d = common.Xor(dbl(d), cmac.Sum(key, aad[i]))
+	if FIPSMode() {
+		if a.newCipher != nil {
+			return nil, errFIPSCipher
+		}
+		if a.newPRF != nil {
+			return nil, errFIPSPRF
+		}
+		if err := checkFIPS(key); err != nil {
+			return nil, err
+		}
 	}
 
-	var t []byte
-	if len(plaintext) >= 16 {
-		t = xorEnd(plaintext, d)
-	} else {
-		t = common.Xor(dbl(d), common.Padding(plaintext))
+	a.key = append([]byte{}, key...)
+	var err error
+	if a.ctr, err = a.newBlock(a.key[len(key)/2:]); err != nil {
+		return nil, fmt.Errorf("siv: %w", err)
+	}
+
+	// a PRF of WithPRF or WithHMAC is keyed per scratch, the first one checks it
+	if a.newPRF != nil {
+		s, err := newPRFScratch(a.key, a.ctr, a.newPRF)
+		if err != nil {
+			return nil, err
+		}
+		a.scratch.Put(s)
+		return a, nil
 	}
 
-	return cmac.Sum(key, t)
+	macBlock, err := a.newBlock(a.key[:len(key)/2])
+	if err != nil {
+		return nil, fmt.Errorf("siv: %w", err)
+	}
+	if a.mac, err = cmac.NewKeyedCipher(macBlock); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+/*
+NewSIVCMAC256 creates AEAD_AES_SIV_CMAC_256 from https://tools.ietf.org/html/rfc5297#section-6.1,
+the key is 32 bytes: AES-128 for S2V and AES-128 for CTR, 128-bit security level
+*/
+func NewSIVCMAC256(key []byte) (*aessiv, error) {
+	return newExactKeySize(key, 32)
 }
 
-func xorEnd(a, b []byte) []byte {
-	if len(a) < len(b) {
-		panic(xorEndInvalidParameters)
+/*
+NewSIVCMAC384 creates AEAD_AES_SIV_CMAC_384 from https://tools.ietf.org/html/rfc5297#section-6.2,
+the key is 48 bytes: AES-192 for S2V and AES-192 for CTR, 192-bit security level
+*/
+func NewSIVCMAC384(key []byte) (*aessiv, error) {
+	return newExactKeySize(key, 48)
+}
+
+/*
+NewSIVCMAC512 creates AEAD_AES_SIV_CMAC_512 from https://tools.ietf.org/html/rfc5297#section-6.3,
+the key is 64 bytes: AES-256 for S2V and AES-256 for CTR, 256-bit security level.
+The synthetic IV is 128 bits for all the parameter sets, so resistance to forgery stays at
+128 bits.
+*/
+func NewSIVCMAC512(key []byte) (*aessiv, error) {
+	return newExactKeySize(key, 64)
+}
+
+func newExactKeySize(key []byte, size int) (*aessiv, error) {
+	if len(key) != size {
+		return nil, errKeySizeMismatch
 	}
+	return NewAesSIV(key)
+}
 
-	offset := len(a) - len(b)
-	result := make([]byte, len(a))
-	for i := 0; i < offset; i++ {
-		result[i] = a[i]
+/*
+s2vPRF is S2V over any PRF with 128-bit output, mac must be freshly keyed
+*/
+func s2vPRF(mac prf.PRF, aad [][]byte, plaintext []byte) []byte {
+	d := make([]byte, blockSize)
+	s2vInto(mac, d, make([]byte, blockSize), aad, plaintext)
+	return d
+}
+
+/*
+s2vInto writes S2V into d using block as the working block, the PRF is reset first.
+The plaintext is always the last S2V string, so there is at least one string even
+with no associated data and the special case of RFC 5297 for an empty vector,
+CMAC(<one>), never applies here: it would ignore the plaintext and give every
+message the same synthetic IV.
+*/
+func s2vInto(mac prf.PRF, d, block []byte, aad [][]byte, plaintext []byte) {
+	if mac.Size() != blockSize {
+		panic(prfInvalidSize)
 	}
 
-	for i := 0; i < len(b); i++ {
-		result[i+offset] = a[i+offset] ^ b[i]
+	mac.Reset()
+	mac.Write(zero)
+	mac.SumInto(d)
+
+	for i := 0; i < len(aad); i++ {
+		mac.Reset()
+		mac.Write(aad[i])
+		mac.SumInto(block)
+		ct.Double(d, d)
+		subtle.XORBytes(d, d, block)
 	}
 
-	return result
+	// the last block of the plaintext is xored with d, the rest is MACed in place
+	mac.Reset()
+	if len(plaintext) >= blockSize {
+		n := len(plaintext) - blockSize
+		mac.Write(plaintext[:n])
+		subtle.XORBytes(block, plaintext[n:], d)
+	} else {
+		ct.Double(d, d)
+		common.Padding(block, plaintext)
+		subtle.XORBytes(block, block, d)
+	}
+	mac.Write(block)
+	// block holds masked plaintext
+	clear(block)
+
+	mac.SumInto(d)
+}
+
+/*
+checkOverlap panics if the n bytes appended to dst share memory with in at any
+index but the corresponding one, the check of crypto/cipher: in-place operation
+with dst = in[:0] is fine, a shifted overlap is a caller bug. A dst without room
+for n bytes is reallocated and can't overlap.
+*/
+func checkOverlap(dst []byte, n int, in []byte) {
+	if cap(dst)-len(dst) >= n && common.InexactOverlap(dst[len(dst):len(dst)+n], in) {
+		panic(invalidBufferOverlap)
+	}
+}
+
+/*
+sliceForAppend takes a slice and a requested number of bytes. It returns a slice
+with the contents of the given slice followed by that many bytes and a second
+slice that aliases into it and contains only the extra bytes, as in crypto/cipher
+*/
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
 }
 
 /*
@@ -176,11 +478,7 @@ Doubling operation described at
 https://tools.ietf.org/html/rfc5297#section-2.3
 */
 func dbl(d []byte) []byte {
-	result := common.ShiftLeft(d)
-	if d[0]&common.Msb == common.Msb {
-		return common.Xor(result, rb)
-	}
-	return result
+	return common.Dbl(d)
 }
 
 func bitAnd(a, b []byte) []byte {
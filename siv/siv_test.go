@@ -1,10 +1,24 @@
 package siv
 
 import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"github.com/luc-lynx/siv/cmac"
+	"github.com/luc-lynx/siv/prf"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 /*
@@ -18,6 +32,7 @@ func TestAesSiv(t *testing.T) {
 	t.Run("seal", testSeal)
 	t.Run("open", testOpen)
 	t.Run("seal/open (256 bit each key)", testSeal256)
+	t.Run("seal/open (256 bit each key, distinct halves)", testSeal256DistinctHalves)
 	t.Run("random seal/open (256 bits)", func(t *testing.T) {
 		testRandomSealOpen(t, 32)
 	})
@@ -28,6 +43,51 @@ func TestAesSiv(t *testing.T) {
 		testRandomSealOpen(t, 64)
 	})
 	t.Run("bad key size test", testBadKeySize)
+	t.Run("empty aad vector", testEmptyAADVector)
+	t.Run("empty aad vector S2V", testEmptyAADVectorS2V)
+	t.Run("empty plaintext", testEmptyPlaintext)
+	t.Run("self-test", testSelfTest)
+	t.Run("fips mode", testFIPS)
+	t.Run("in-place seal and open", testSealOverlap)
+	t.Run("audit hook", testAuditHook)
+	t.Run("duplicate monitor", testDuplicateMonitor)
+	t.Run("registry", testRegistry)
+	t.Run("IANA identifiers", testNewByID)
+	t.Run("algorithm identifiers", testAlgorithm)
+	t.Run("named constructors", testNamedConstructors)
+	t.Run("truncated tags", testTruncated)
+	t.Run("seal/open with random nonce", testSealRandom)
+	t.Run("hedged seal", testSealHedged)
+	t.Run("injected randomness", testSetRandom)
+	t.Run("options instead of setters", testSetterOptions)
+	t.Run("sealer and opener", testSealerOpener)
+	t.Run("error classes", testErrorClasses)
+	t.Run("uniform failure timing", testUniformFailureTiming)
+	t.Run("time quantum", testTimeQuantum)
+	t.Run("fixed buffers", testSealToOpenTo)
+	t.Run("IV mask", testIVMask)
+	t.Run("nonce-based", testNonceBased)
+	t.Run("synthetic nonce", testSyntheticNonce)
+	t.Run("errors instead of panics", testInvalidKeyErrors)
+	t.Run("inline CTR", testInlineCTR)
+	t.Run("allocation-free seal and open", testSealOpenAllocs)
+	t.Run("key state built at construction", testConstructionState)
+	t.Run("associated data limit", testAADLimit)
+	t.Run("detached tag", testDetached)
+	t.Run("S2V", testS2V)
+	t.Run("streaming S2V", testS2VWriter)
+	t.Run("streaming write errors", testStreamingWriteError)
+	t.Run("streaming encryption", testStreaming)
+	t.Run("streaming io.Copy", testStreamingCopy)
+	t.Run("streaming flush", testStreamingFlush)
+	t.Run("streaming compression", testStreamingCompression)
+	t.Run("streaming tracing", testStreamingTracing)
+	t.Run("destroy", testDestroy)
+	t.Run("generated keys", testGenerateKey)
+	t.Run("constructor options", testOptions)
+	t.Run("SIV over other block ciphers", testGenericSIV)
+	t.Run("SIV-HMAC", testSIVHMAC)
+	t.Run("deterministic AEAD interface", testDAEAD)
 }
 
 func testBitAnd(t *testing.T) {
@@ -113,6 +173,17 @@ var (
 		0xf0, 0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7,
 		0xf8, 0xf9, 0xfa, 0xfb, 0xfc, 0xfd, 0xfe, 0xff,
 	}
+	// key512 with distinct halves, the FIPS mode rejects key512
+	key512Distinct = []byte{
+		0xff, 0xfe, 0xfd, 0xfc, 0xfb, 0xfa, 0xf9, 0xf8,
+		0xf7, 0xf6, 0xf5, 0xf4, 0xf3, 0xf2, 0xf1, 0xf0,
+		0xf0, 0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7,
+		0xf8, 0xf9, 0xfa, 0xfb, 0xfc, 0xfd, 0xfe, 0xff,
+		0xf0, 0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7,
+		0xf8, 0xf9, 0xfa, 0xfb, 0xfc, 0xfd, 0xfe, 0xff,
+		0xff, 0xfe, 0xfd, 0xfc, 0xfb, 0xfa, 0xf9, 0xf8,
+		0xf7, 0xf6, 0xf5, 0xf4, 0xf3, 0xf2, 0xf1, 0xf0,
+	}
 )
 
 func testSeal(t *testing.T) {
@@ -151,6 +222,13 @@ func testOpen(t *testing.T) {
 
 func testSeal256(t *testing.T) {
 	enc, err := NewAesSIV(key512)
+	if FIPSMode() {
+		if err != errFIPSKeyReuse {
+			t.Errorf("expected %v, got %v", errFIPSKeyReuse, err)
+			t.Fail()
+		}
+		return
+	}
 	if err != nil {
 		t.Error(err)
 		t.Fail()
@@ -170,6 +248,13 @@ func testSeal256(t *testing.T) {
 	}
 }
 
+func testSeal256DistinctHalves(t *testing.T) {
+	if err := runSealOpen(key512Distinct, plaintext, [][]byte{ad}); err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+}
+
 func runSealOpen(key, plaintext []byte, aad [][]byte) error {
 	s, err := NewAesSIV(key)
 	if err != nil {
@@ -236,3 +321,2384 @@ func testBadKeySize(t *testing.T) {
 		t.Fail()
 	}
 }
+
+/*
+With no associated data the plaintext is the only S2V string,
+so the synthetic IV must still depend on it
+*/
+func testEmptyAADVector(t *testing.T) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	ct1 := s.SealWithMultipleAAD(nil, []byte("first message"), nil)
+	ct2 := s.SealWithMultipleAAD(nil, []byte("other message"), nil)
+	if subtle.ConstantTimeCompare(ct1[:blockSize], ct2[:blockSize]) == 1 {
+		t.Error("synthetic IV doesn't depend on the plaintext")
+		t.Fail()
+		return
+	}
+
+	if err := runSealOpen(key, plaintext, nil); err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+}
+
+/*
+With no associated data S2V is RFC 5297 section 2.4 for the vector (P), n = 1:
+
+	V = CMAC(K, P xorend CMAC(K, <zero>))               if len(P) >= 16
+	V = CMAC(K, dbl(CMAC(K, <zero>)) xor pad(P))        otherwise
+
+and not CMAC(K, <one>), which is only defined for an empty vector
+*/
+func testEmptyAADVectorS2V(t *testing.T) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+	macKey := key[:len(key)/2]
+
+	d, _ := cmac.Tag(macKey, zero)
+	for _, p := range [][]byte{[]byte("short"), []byte("a plaintext of more than one block")} {
+		var last []byte
+		if len(p) >= blockSize {
+			last = append([]byte{}, p...)
+			subtle.XORBytes(last[len(p)-blockSize:], last[len(p)-blockSize:], d)
+		} else {
+			last = make([]byte, blockSize)
+			copy(last, p)
+			last[len(p)] = 0x80
+			subtle.XORBytes(last, last, dbl(d))
+		}
+		expected, _ := cmac.Tag(macKey, last)
+
+		if iv := s.SealWithMultipleAAD(nil, p, nil)[:blockSize]; !bytes.Equal(iv, expected) {
+			t.Errorf("%q: got %x, expected %x", p, iv, expected)
+			t.Fail()
+		}
+		if v, _ := S2V(macKey, [][]byte{p}); !bytes.Equal(v[:], expected) {
+			t.Errorf("S2V %q: got %x, expected %x", p, v, expected)
+			t.Fail()
+		}
+	}
+}
+
+func testEmptyPlaintext(t *testing.T) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	aad := [][]byte{ad}
+	ct := s.SealWithMultipleAAD(nil, nil, aad)
+	if len(ct) != blockSize {
+		t.Errorf("empty plaintext sealed to %d bytes", len(ct))
+		t.Fail()
+		return
+	}
+
+	pt, err := s.OpenWithMultipleAAD([]byte("dst"), ct, aad)
+	if err != nil || string(pt) != "dst" {
+		t.Errorf("doesn't round trip: %q, %v", pt, err)
+		t.Fail()
+	}
+	if n, err := s.OpenTo(nil, ct, aad); err != nil || n != 0 {
+		t.Errorf("OpenTo: %d, %v", n, err)
+		t.Fail()
+	}
+
+	if _, err := s.OpenWithMultipleAAD(nil, ct, [][]byte{plaintext}); err != errIntegrityError {
+		t.Error("opened with other associated data")
+		t.Fail()
+	}
+	if _, err := s.OpenWithMultipleAAD(nil, ct[:blockSize-1], aad); err != ErrCiphertextTooShort {
+		t.Errorf("expected %v, got %v", ErrCiphertextTooShort, err)
+		t.Fail()
+	}
+}
+
+func testSelfTest(t *testing.T) {
+	if err := SelfTest(); err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+}
+
+func testFIPS(t *testing.T) {
+	if Backend() == "" {
+		t.Error("empty backend name")
+		t.Fail()
+	}
+
+	if err := checkFIPS(key); err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	same := append(append([]byte{}, key[:blockSize]...), key[:blockSize]...)
+	if err := checkFIPS(same); err != errFIPSKeyReuse {
+		t.Error("equal CMAC and CTR keys accepted")
+		t.Fail()
+		return
+	}
+
+	_, err := NewAesSIV(same)
+	if FIPSMode() != (err != nil) {
+		t.Errorf("NewAesSIV in fips mode = %v: unexpected error %v", FIPSMode(), err)
+		t.Fail()
+	}
+}
+
+func testSealOverlap(t *testing.T) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	// plaintext has been overwritten by the random tests
+	ciphertext := s.Seal(nil, nil, plaintext, ad)
+
+	// in place: the ciphertext starts where the plaintext did
+	buf := make([]byte, len(plaintext), len(plaintext)+blockSize)
+	copy(buf, plaintext)
+	sealed := s.Seal(buf[:0], nil, buf, ad)
+	if &sealed[0] != &buf[0] || subtle.ConstantTimeCompare(sealed, ciphertext) != 1 {
+		t.Error("in-place seal")
+		t.Fail()
+	}
+
+	opened, err := s.Open(sealed[:0], nil, sealed, ad)
+	if err != nil || &opened[0] != &buf[0] || subtle.ConstantTimeCompare(opened, plaintext) != 1 {
+		t.Errorf("in-place open: %v", err)
+		t.Fail()
+	}
+
+	// in place with the detached tag
+	buf = append(buf[:0], plaintext...)
+	c, tag, err := s.SealDetached(buf[:0], buf, [][]byte{ad})
+	if err != nil || &c[0] != &buf[0] || subtle.ConstantTimeCompare(append(tag, c...), ciphertext) != 1 {
+		t.Errorf("in-place detached seal: %v", err)
+		t.Fail()
+	}
+	if opened, err := s.OpenDetached(c[:0], c, tag, [][]byte{ad}); err != nil || subtle.ConstantTimeCompare(opened, plaintext) != 1 {
+		t.Errorf("in-place detached open: %v", err)
+		t.Fail()
+	}
+
+	// the plaintext behind the start of the output is a shifted overlap
+	buf = make([]byte, blockSize+len(plaintext))
+	copy(buf[blockSize:], plaintext)
+	if !panics(func() { s.Seal(buf[:0], nil, buf[blockSize:], ad) }) {
+		t.Error("seal with the plaintext after dst didn't panic")
+		t.Fail()
+	}
+	copy(buf, ciphertext)
+	if !panics(func() { s.Open(buf[1:1], nil, buf, ad) }) {
+		t.Error("open with a shifted overlap didn't panic")
+		t.Fail()
+	}
+
+	// a failed in-place open leaves no plaintext
+	copy(buf, ciphertext)
+	if _, err := s.Open(buf[:0], nil, buf, nil); err != errIntegrityError {
+		t.Errorf("expected %v, got %v", errIntegrityError, err)
+		t.Fail()
+	}
+	if subtle.ConstantTimeCompare(buf[:len(plaintext)], make([]byte, len(plaintext))) != 1 {
+		t.Error("unauthenticated plaintext left in dst")
+		t.Fail()
+	}
+
+	tr, _ := NewTruncatedAesSIV(key, testTagSize(8))
+	buf = append(make([]byte, 0, len(plaintext)+tr.Overhead()), plaintext...)
+	sealed = tr.Seal(buf[:0], nil, buf, ad)
+	if opened, err := tr.Open(sealed[:0], nil, sealed, ad); err != nil || subtle.ConstantTimeCompare(opened, plaintext) != 1 {
+		t.Errorf("truncated in place: %v", err)
+		t.Fail()
+	}
+}
+
+func testAuditHook(t *testing.T) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	var events []AuditEvent
+	s.SetAudit(func(e AuditEvent) {
+		events = append(events, e)
+	}, "test key", nil)
+
+	ct := s.Seal([]byte("prefix"), nil, plaintext, ad)
+	if _, err := s.Open(nil, nil, ct[len("prefix"):], nil); err == nil {
+		t.Error("wrong associated data accepted")
+		t.Fail()
+		return
+	}
+
+	if len(events) != 2 {
+		t.Errorf("got %d events", len(events))
+		t.Fail()
+		return
+	}
+
+	seal, open := events[0], events[1]
+	if seal.Operation != OpSeal || seal.KeyID != "test key" || seal.Err != nil ||
+		seal.PlaintextLen != len(plaintext) || seal.CiphertextLen != len(ciphertext) {
+		t.Errorf("unexpected seal event %+v", seal)
+		t.Fail()
+	}
+	if open.Operation != OpOpen || open.Err != errIntegrityError || open.PlaintextLen != 0 {
+		t.Errorf("unexpected open event %+v", open)
+		t.Fail()
+	}
+}
+
+func testDuplicateMonitor(t *testing.T) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	var alerts []float64
+	m := NewDuplicateMonitor(4, 0.5, func(rate float64) {
+		alerts = append(alerts, rate)
+	})
+	s.SetDuplicateMonitor(m)
+
+	messages := []string{"a", "b", "c", "d", "a", "b", "a", "a", "e", "f", "g", "h", "a", "a", "a"}
+	for _, msg := range messages {
+		s.Seal(nil, nil, []byte(msg), ad)
+	}
+
+	// alerts once the window is "a b a a", then the rate drops with "f g h"
+	// and the second alert comes at the window "h a a a"
+	if len(alerts) != 2 || alerts[0] != 0.5 || alerts[1] != 0.5 {
+		t.Errorf("unexpected alerts %v", alerts)
+		t.Fail()
+	}
+	if m.Rate() != 0.5 {
+		t.Errorf("unexpected rate %v", m.Rate())
+		t.Fail()
+	}
+}
+
+func testRegistry(t *testing.T) {
+	aead, err := New(AlgAESSIVCMAC256, key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	s, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+	if subtle.ConstantTimeCompare(aead.Seal(nil, nil, plaintext, ad), s.Seal(nil, nil, plaintext, ad)) != 1 {
+		t.Error("registered AES-SIV-CMAC-256 differs from NewAesSIV")
+		t.Fail()
+	}
+
+	if _, err := New(AlgAESSIVCMAC512, key); err != errKeySizeMismatch {
+		t.Errorf("expected %v, got %v", errKeySizeMismatch, err)
+		t.Fail()
+	}
+
+	if _, err := New("ROT13", key); !errors.Is(err, errUnknownAlgorithm) {
+		t.Errorf("expected %v, got %v", errUnknownAlgorithm, err)
+		t.Fail()
+	}
+
+	// the IANA names of nonce-based AES-SIV sort first
+	names := Algorithms()
+	if len(names) < 6 || names[0] != AlgAEADAESSIVCMAC256 || names[3] != AlgAESSIVCMAC256 {
+		t.Errorf("unexpected algorithms %v", names)
+		t.Fail()
+	}
+}
+
+func testNewByID(t *testing.T) {
+	decode := func(s string) []byte {
+		b, _ := hex.DecodeString(s)
+		return b
+	}
+
+	tests := []struct {
+		id   uint16
+		name string
+		size int
+	}{
+		{IDAESSIVCMAC256, AlgAEADAESSIVCMAC256, 32},
+		{IDAESSIVCMAC384, AlgAEADAESSIVCMAC384, 48},
+		{IDAESSIVCMAC512, AlgAEADAESSIVCMAC512, 64},
+	}
+	for _, test := range tests {
+		k := make([]byte, test.size)
+		for i := range k {
+			k[i] = byte(i)
+		}
+
+		byID, err := NewByID(test.id, k)
+		if err != nil {
+			t.Errorf("%d: %v", test.id, err)
+			t.Fail()
+			continue
+		}
+		byName, err := New(test.name, k)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			t.Fail()
+			continue
+		}
+		if byID.NonceSize() != NonceSize || byName.NonceSize() != NonceSize {
+			t.Errorf("%d: nonce size %d, expected %d", test.id, byID.NonceSize(), NonceSize)
+			t.Fail()
+			continue
+		}
+
+		// RFC 5297 section 3: the nonce is the last S2V string, after the associated data
+		n1, n2 := bytes.Repeat([]byte{1}, NonceSize), bytes.Repeat([]byte{2}, NonceSize)
+		sealed := byID.Seal(nil, n1, []byte("plaintext"), ad)
+		if bytes.Equal(sealed, byID.Seal(nil, n2, []byte("plaintext"), ad)) {
+			t.Errorf("%d: the nonce isn't used", test.id)
+			t.Fail()
+		}
+		direct, _ := NewAesSIV(k)
+		if expected := direct.SealWithMultipleAAD(nil, []byte("plaintext"), [][]byte{ad, n1}); !bytes.Equal(sealed, expected) ||
+			!bytes.Equal(byName.Seal(nil, n1, []byte("plaintext"), ad), expected) {
+			t.Errorf("%d: differs from nonce-based AES-SIV", test.id)
+			t.Fail()
+		}
+		if pt, err := byID.Open(nil, n1, sealed, ad); err != nil || string(pt) != "plaintext" {
+			t.Errorf("%d: open: %v", test.id, err)
+			t.Fail()
+		}
+		if _, err := byID.Open(nil, n2, sealed, ad); !errors.Is(err, ErrAuthentication) {
+			t.Errorf("%d: open with another nonce: %v", test.id, err)
+			t.Fail()
+		}
+	}
+
+	// RFC 5297 A.2, the AEAD of identifier 15 with two associated data strings
+	a2, err := NewByID(IDAESSIVCMAC256, decode("7f7e7d7c7b7a79787776757473727170404142434445464748494a4b4c4d4e4f"))
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+	multiple, ok := a2.(interface {
+		SealWithMultipleAAD(dst, plaintext []byte, additionalData [][]byte) []byte
+	})
+	if !ok {
+		t.Error("the AEAD doesn't take multiple associated data strings")
+		t.Fail()
+		return
+	}
+	sealed := multiple.SealWithMultipleAAD(nil, []byte("this is some plaintext to encrypt using SIV-AES"), [][]byte{
+		decode("00112233445566778899aabbccddeeffdeaddadadeaddadaffeeddccbbaa99887766554433221100"),
+		decode("102030405060708090a0"),
+		decode("09f911029d74e35bd84156c5635688c0"),
+	})
+	expected := decode("7bdb6e3b432667eb06f4d14bff2fbd0f" +
+		"cb900f2fddbe404326601965c889bf17dba77ceb094fa663b7a3f748ba8af829ea64ad544a272e9c485b62a3fd5c0d")
+	if !bytes.Equal(sealed, expected) {
+		t.Errorf("RFC 5297 A.2: got %x, expected %x", sealed, expected)
+		t.Fail()
+	}
+
+	if _, err := NewByID(IDAESSIVCMAC384, key); err != errKeySizeMismatch {
+		t.Errorf("expected %v, got %v", errKeySizeMismatch, err)
+		t.Fail()
+	}
+	// AEAD_AES_128_GCM, registered but not provided here
+	if _, err := NewByID(1, key); !errors.Is(err, errUnknownAlgorithm) {
+		t.Errorf("expected %v, got %v", errUnknownAlgorithm, err)
+		t.Fail()
+	}
+}
+
+func testAlgorithm(t *testing.T) {
+	sizes := map[string]int{AlgAESSIVCMAC256: 32, AlgAESSIVCMAC384: 48, AlgAESSIVCMAC512: 64}
+	for name, size := range sizes {
+		k := make([]byte, size)
+		if _, err := rand.Read(k); err != nil {
+			t.Error(err)
+			t.Fail()
+			return
+		}
+
+		aead, err := New(name, k)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+			return
+		}
+
+		s := aead.(*aessiv)
+		if s.Algorithm() != name || s.KeySize() != size || s.TagSize() != 16 {
+			t.Errorf("%s: got %s", name, s)
+			t.Fail()
+		}
+
+		printed := fmt.Sprintf("%v %+v %s", s, s, s)
+		if strings.Contains(printed, fmt.Sprint(k)) || !strings.HasPrefix(s.String(), name) {
+			t.Errorf("%s: unexpected string %q", name, printed)
+			t.Fail()
+		}
+	}
+}
+
+func testNamedConstructors(t *testing.T) {
+	constructors := []struct {
+		name    string
+		newSIV  func([]byte) (*aessiv, error)
+		keySize int
+	}{
+		{AlgAESSIVCMAC256, NewSIVCMAC256, 32},
+		{AlgAESSIVCMAC384, NewSIVCMAC384, 48},
+		{AlgAESSIVCMAC512, NewSIVCMAC512, 64},
+	}
+
+	for _, c := range constructors {
+		for _, size := range []int{32, 48, 64} {
+			k := make([]byte, size)
+			k[0] = 1
+			s, err := c.newSIV(k)
+			if size != c.keySize {
+				if err != errKeySizeMismatch {
+					t.Errorf("%s accepted a %d byte key", c.name, size)
+					t.Fail()
+				}
+				continue
+			}
+
+			if err != nil || s.Algorithm() != c.name {
+				t.Errorf("%s: %v", c.name, err)
+				t.Fail()
+			}
+		}
+	}
+}
+
+/*
+testTagSize is size outside of the FIPS mode, which only accepts full tags
+*/
+func testTagSize(size int) int {
+	if FIPSMode() {
+		return MaxTruncatedTagSize
+	}
+	return size
+}
+
+func testTruncated(t *testing.T) {
+	for _, size := range []int{7, 17} {
+		if _, err := NewTruncatedAesSIV(key, size); err != errTagSizeNotSupported {
+			t.Errorf("tag size %d accepted", size)
+			t.Fail()
+		}
+	}
+	if FIPSMode() {
+		for size := MinTruncatedTagSize; size < MaxTruncatedTagSize; size++ {
+			if _, err := NewTruncatedAesSIV(key, size); err != errFIPSTagSize {
+				t.Errorf("FIPS mode, tag size %d: expected %v, got %v", size, errFIPSTagSize, err)
+				t.Fail()
+			}
+		}
+		if _, err := NewTruncatedAesSIV(key, MaxTruncatedTagSize); err != nil {
+			t.Errorf("FIPS mode, full tags: %v", err)
+			t.Fail()
+		}
+		return
+	}
+
+	full, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	for size := MinTruncatedTagSize; size <= MaxTruncatedTagSize; size++ {
+		s, err := NewTruncatedAesSIV(key, size)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+			return
+		}
+
+		for _, msg := range []string{"", "short", "a message longer than one block"} {
+			ct := s.Seal(nil, nil, []byte(msg), ad)
+			if len(ct) != len(msg)+size {
+				t.Errorf("tag size %d: ciphertext length %d", size, len(ct))
+				t.Fail()
+				return
+			}
+
+			pt, err := s.Open(nil, nil, ct, ad)
+			if err != nil || string(pt) != msg {
+				t.Errorf("tag size %d: %q doesn't round trip: %v", size, msg, err)
+				t.Fail()
+				return
+			}
+
+			ct[0] ^= 1
+			if _, err := s.Open(nil, nil, ct, ad); err != errIntegrityError {
+				t.Errorf("tag size %d: tampered tag accepted", size)
+				t.Fail()
+				return
+			}
+		}
+
+		// the tag is the prefix of the full synthetic IV
+		msg := []byte("a message longer than one block")
+		if subtle.ConstantTimeCompare(s.Seal(nil, nil, msg, ad)[:size], full.Seal(nil, nil, msg, ad)[:size]) != 1 {
+			t.Errorf("tag size %d: tag isn't a prefix of the synthetic IV", size)
+			t.Fail()
+		}
+	}
+
+	s, _ := NewTruncatedAesSIV(key, 8)
+	if s.Algorithm() != AlgAESSIVCMAC256+"-T64" {
+		t.Errorf("unexpected algorithm %s", s.Algorithm())
+		t.Fail()
+	}
+}
+
+func testSealRandom(t *testing.T) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	aad := [][]byte{ad}
+	msg := []byte("a message longer than one block")
+	ct1, err := s.SealRandom(nil, msg, aad)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+	ct2, _ := s.SealRandom(nil, msg, aad)
+
+	if len(ct1) != RandomNonceSize+blockSize+len(msg) || subtle.ConstantTimeCompare(ct1, ct2) == 1 {
+		t.Error("equal messages produced equal ciphertexts")
+		t.Fail()
+		return
+	}
+
+	// the nonce is the last associated data string
+	deterministic := s.SealWithMultipleAAD(nil, msg, [][]byte{ad, ct1[:RandomNonceSize]})
+	if subtle.ConstantTimeCompare(ct1[RandomNonceSize:], deterministic) != 1 {
+		t.Error("nonce isn't the last associated data string")
+		t.Fail()
+	}
+
+	pt, err := s.OpenRandom(nil, ct1, aad)
+	if err != nil || subtle.ConstantTimeCompare(pt, msg) != 1 {
+		t.Errorf("doesn't round trip: %v", err)
+		t.Fail()
+	}
+
+	ct1[0] ^= 1
+	if _, err := s.OpenRandom(nil, ct1, aad); err != errIntegrityError {
+		t.Error("tampered nonce accepted")
+		t.Fail()
+	}
+	if len(aad) != 1 {
+		t.Error("caller's associated data modified")
+		t.Fail()
+	}
+
+	testRandomInPlace(t, s.SealRandom, s.OpenRandom)
+}
+
+/*
+testRandomInPlace seals and opens with dst = plaintext[:0] and dst = ciphertext[:0],
+and with room left for the nonce in front of the plaintext
+*/
+func testRandomInPlace(t *testing.T, seal, open func(dst, in []byte, additionalData [][]byte) ([]byte, error)) {
+	aad := [][]byte{ad}
+	msg := []byte("a message longer than one block")
+	overhead := RandomNonceSize + blockSize
+
+	buf := make([]byte, len(msg), len(msg)+overhead)
+	copy(buf, msg)
+	ct, err := seal(buf[:0], buf, aad)
+	if err != nil || &ct[0] != &buf[0] {
+		t.Errorf("in-place seal: %v", err)
+		t.Fail()
+		return
+	}
+	if pt, err := open(nil, ct, aad); err != nil || !bytes.Equal(pt, msg) {
+		t.Errorf("in-place seal doesn't open: %v", err)
+		t.Fail()
+	}
+	pt, err := open(ct[:0], ct, aad)
+	if err != nil || !bytes.Equal(pt, msg) || &pt[0] != &buf[0] {
+		t.Errorf("in-place open: %v", err)
+		t.Fail()
+	}
+
+	buf = make([]byte, RandomNonceSize+len(msg), len(msg)+overhead)
+	copy(buf[RandomNonceSize:], msg)
+	ct, err = seal(buf[:0], buf[RandomNonceSize:], aad)
+	if err != nil || &ct[0] != &buf[0] {
+		t.Errorf("seal behind the nonce: %v", err)
+		t.Fail()
+		return
+	}
+	if pt, err := open(nil, ct, aad); err != nil || !bytes.Equal(pt, msg) {
+		t.Errorf("seal behind the nonce doesn't open: %v", err)
+		t.Fail()
+	}
+
+	buf = make([]byte, len(msg), len(msg)+overhead+1)
+	if !panics(func() { seal(buf[1:1], buf, aad) }) {
+		t.Error("shifted overlap accepted")
+		t.Fail()
+	}
+}
+
+func testSetRandom(t *testing.T) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	msg := []byte("fixed nonce")
+	nonce := strings.Repeat("n", RandomNonceSize)
+	s.SetRandom(strings.NewReader(nonce))
+	ct1, err := s.SealRandom(nil, msg, nil)
+	if err != nil || string(ct1[:RandomNonceSize]) != nonce {
+		t.Errorf("nonce wasn't read from the reader: %v", err)
+		t.Fail()
+		return
+	}
+
+	s.SetRandom(strings.NewReader(nonce))
+	if ct2, _ := s.SealRandom(nil, msg, nil); subtle.ConstantTimeCompare(ct1, ct2) != 1 {
+		t.Error("same random values produced different ciphertexts")
+		t.Fail()
+	}
+
+	// exhausted reader
+	if _, err := s.SealHedged(nil, msg, nil); err == nil {
+		t.Error("no error from an empty reader")
+		t.Fail()
+	}
+	s.SetRandom(iotest.ErrReader(errors.New("no entropy")))
+	if _, err := s.SealRandom(nil, msg, nil); err == nil || err.Error() != "no entropy" {
+		t.Errorf("reader error not returned: %v", err)
+		t.Fail()
+	}
+
+	s.SetRandom(nil)
+	if _, err := s.SealRandom(nil, msg, nil); err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+}
+
+func testSealHedged(t *testing.T) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	aad := [][]byte{ad}
+	msg := []byte("hedged")
+	ct1, err := s.SealHedged(nil, msg, aad)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+	ct2, _ := s.SealHedged(nil, msg, aad)
+
+	if subtle.ConstantTimeCompare(ct1, ct2) == 1 {
+		t.Error("equal messages produced equal ciphertexts")
+		t.Fail()
+	}
+
+	for _, ct := range [][]byte{ct1, ct2} {
+		pt, err := s.OpenRandom(nil, ct, aad)
+		if err != nil || subtle.ConstantTimeCompare(pt, msg) != 1 {
+			t.Errorf("doesn't round trip: %v", err)
+			t.Fail()
+		}
+	}
+	testRandomInPlace(t, s.SealHedged, s.OpenRandom)
+}
+
+func testSealerOpener(t *testing.T) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	// a remote service would be plugged in the same way
+	var sealer Sealer = SealerFunc(func(ctx context.Context, plaintext []byte, additionalData [][]byte) ([]byte, error) {
+		return s.SealWithMultipleAAD(nil, plaintext, additionalData), nil
+	})
+	var opener Opener = s
+
+	aad := [][]byte{ad}
+	msg := []byte("sealer")
+	ct, err := sealer.SealContext(context.Background(), msg, aad)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	pt, err := opener.OpenContext(context.Background(), ct, aad)
+	if err != nil || subtle.ConstantTimeCompare(pt, msg) != 1 {
+		t.Errorf("doesn't round trip: %v", err)
+		t.Fail()
+	}
+
+	if _, err := opener.OpenContext(context.Background(), ct, nil); err == nil {
+		t.Error("opened with different associated data")
+		t.Fail()
+	}
+}
+
+func testErrorClasses(t *testing.T) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	ct := s.SealWithMultipleAAD(nil, []byte("classes"), nil)
+	_, short := s.OpenWithMultipleAAD(nil, ct[:10], nil)
+	_, modified := s.OpenWithMultipleAAD(nil, ct, [][]byte{ad})
+
+	cases := []struct {
+		err   error
+		class error
+		name  string
+	}{
+		{short, ErrMalformed, "malformed"},
+		{modified, ErrAuthentication, "authentication"},
+		{NewError(ErrUnsupportedVersion, "v9"), ErrUnsupportedVersion, "version"},
+		{ErrKeySize, nil, "other"},
+	}
+
+	for _, c := range cases {
+		if c.class != nil && !errors.Is(c.err, c.class) {
+			t.Errorf("%v doesn't wrap %v", c.err, c.class)
+			t.Fail()
+		}
+		if FailureClass(c.err) != c.name {
+			t.Errorf("%v: class %s, expected %s", c.err, FailureClass(c.err), c.name)
+			t.Fail()
+		}
+	}
+
+	if errIntegrityError.Error() != "integrity error" {
+		t.Error("error message changed")
+		t.Fail()
+	}
+
+	// the sentinels are wrapped by the errors of every constructor and format
+	_, badKey := NewAesSIV(key[:20])
+	_, badID := NewByID(IDAESSIVCMAC512, key)
+	_, badBits := GenerateKey(nil, 128)
+	_, truncated := NewDecryptingReader(key, bytes.NewReader([]byte{streamVersion}), nil)
+	_, badS2V := S2V(key[:20], nil)
+	_, badS2VWriter := NewS2VWriter(key[:20], nil)
+	_, badSynthetic := SyntheticNonce(key[:20], 12, plaintext, nil)
+	_, badPRF := prf.CMAC(key[:20])
+	_, badTag := cmac.Tag(key[:20], plaintext)
+	sentinels := []struct {
+		err      error
+		sentinel error
+	}{
+		{badKey, ErrKeySize},
+		{badID, ErrKeySize},
+		{badBits, ErrKeySize},
+		{badS2V, ErrKeySize},
+		{badS2VWriter, ErrKeySize},
+		{badSynthetic, ErrKeySize},
+		{badPRF, ErrKeySize},
+		{badTag, ErrKeySize},
+		{short, ErrCiphertextTooShort},
+		{short, ErrMalformed},
+		{truncated, ErrCiphertextTooShort},
+		{modified, ErrAuthentication},
+	}
+	for _, c := range sentinels {
+		if !errors.Is(c.err, c.sentinel) {
+			t.Errorf("%v doesn't wrap %v", c.err, c.sentinel)
+			t.Fail()
+		}
+	}
+}
+
+/*
+The options configure the same features as the deprecated setters, at construction
+*/
+func testSetterOptions(t *testing.T) {
+	var events int
+	monitor := NewDuplicateMonitor(4, 0.5, func(float64) {})
+	nonce := strings.Repeat("n", RandomNonceSize)
+	noMask := []byte(strings.Repeat("\xff", blockSize))
+	ivMask, maskErr := noMask, errIVMaskSize
+	if FIPSMode() {
+		ivMask, maskErr = nil, errFIPSIVMask
+	}
+
+	s, err := NewAesSIV(key,
+		WithAudit(func(AuditEvent) { events++ }, "1", nil),
+		WithDuplicateMonitor(monitor),
+		WithIVMask(ivMask),
+		WithRandom(strings.NewReader(nonce)),
+		WithUniformFailureTiming(),
+		WithTimeQuantum(time.Microsecond),
+	)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	legacy, _ := NewAesSIV(key)
+	legacy.SetIVMask(ivMask)
+	legacy.SetRandom(strings.NewReader(nonce))
+
+	ct, err := s.SealRandom(nil, plaintext, nil)
+	if expected, _ := legacy.SealRandom(nil, plaintext, nil); err != nil || !bytes.Equal(ct, expected) {
+		t.Errorf("WithRandom and WithIVMask differ from the setters: %v", err)
+		t.Fail()
+	}
+	if events != 1 || monitor.next != 1 {
+		t.Errorf("WithAudit or WithDuplicateMonitor not applied: %d events, %d observed", events, monitor.next)
+		t.Fail()
+	}
+	if !s.uniformTiming || s.quantum != time.Microsecond {
+		t.Error("WithUniformFailureTiming or WithTimeQuantum not applied")
+		t.Fail()
+	}
+
+	if _, err := NewAesSIV(key, WithIVMask(noMask[:8])); err != maskErr {
+		t.Errorf("expected %v, got %v", maskErr, err)
+		t.Fail()
+	}
+	if _, err := NewAesSIV(key, WithTimeQuantum(-time.Second)); err != errOptionQuantum {
+		t.Errorf("expected %v, got %v", errOptionQuantum, err)
+		t.Fail()
+	}
+}
+
+func testUniformFailureTiming(t *testing.T) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+	s.SetUniformFailureTiming(true)
+
+	aad := [][]byte{ad}
+	short := make([]byte, 5)
+	forged := make([]byte, blockSize)
+
+	if _, err := s.OpenWithMultipleAAD(nil, short, aad); err != ErrCiphertextTooShort {
+		t.Errorf("expected %v, got %v", ErrCiphertextTooShort, err)
+		t.Fail()
+	}
+
+	// the work done is the same, so are the allocations
+	shortAllocs := testing.AllocsPerRun(10, func() { s.OpenWithMultipleAAD(nil, short, aad) })
+	forgedAllocs := testing.AllocsPerRun(10, func() { s.OpenWithMultipleAAD(nil, forged, aad) })
+	if shortAllocs < forgedAllocs {
+		t.Errorf("short input: %v allocs, forged input: %v allocs", shortAllocs, forgedAllocs)
+		t.Fail()
+	}
+
+	ct := s.SealWithMultipleAAD(nil, []byte("uniform"), aad)
+	if pt, err := s.OpenWithMultipleAAD(nil, ct, aad); err != nil || string(pt) != "uniform" {
+		t.Errorf("doesn't round trip: %v", err)
+		t.Fail()
+	}
+}
+
+func testTimeQuantum(t *testing.T) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+	const quantum = 20 * time.Millisecond
+	s.SetTimeQuantum(quantum)
+
+	aad := [][]byte{ad}
+	start := time.Now()
+	ct := s.SealWithMultipleAAD(nil, []byte("padded"), aad)
+	if elapsed := time.Since(start); elapsed < quantum {
+		t.Errorf("seal returned after %v", elapsed)
+		t.Fail()
+	}
+
+	start = time.Now()
+	if pt, err := s.OpenWithMultipleAAD(nil, ct, aad); err != nil || string(pt) != "padded" {
+		t.Errorf("doesn't round trip: %v", err)
+		t.Fail()
+	}
+	if elapsed := time.Since(start); elapsed < quantum {
+		t.Errorf("open returned after %v", elapsed)
+		t.Fail()
+	}
+
+	start = time.Now()
+	if _, err := s.OpenWithMultipleAAD(nil, make([]byte, 3), aad); err != ErrCiphertextTooShort {
+		t.Errorf("expected %v, got %v", ErrCiphertextTooShort, err)
+		t.Fail()
+	}
+	if elapsed := time.Since(start); elapsed < quantum {
+		t.Errorf("failed open returned after %v", elapsed)
+		t.Fail()
+	}
+
+	s.SetTimeQuantum(-time.Second)
+	if s.quantum != 0 {
+		t.Error("negative quantum accepted")
+		t.Fail()
+	}
+}
+
+func testSealToOpenTo(t *testing.T) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	aad := [][]byte{ad}
+	msg := []byte("fixed buffer")
+	buf := make([]byte, 64)
+
+	n, err := s.SealTo(buf, msg, aad)
+	if err != nil || n != len(msg)+blockSize {
+		t.Errorf("SealTo: %d, %v", n, err)
+		t.Fail()
+		return
+	}
+	if subtle.ConstantTimeCompare(buf[:n], s.SealWithMultipleAAD(nil, msg, aad)) != 1 {
+		t.Error("SealTo and SealWithMultipleAAD differ")
+		t.Fail()
+	}
+
+	out := make([]byte, len(msg))
+	m, err := s.OpenTo(out, buf[:n], aad)
+	if err != nil || m != len(msg) || subtle.ConstantTimeCompare(out, msg) != 1 {
+		t.Errorf("OpenTo: %d, %v", m, err)
+		t.Fail()
+	}
+
+	if _, err := s.SealTo(buf[:len(msg)+blockSize-1], msg, aad); err != errShortBuffer {
+		t.Errorf("expected %v, got %v", errShortBuffer, err)
+		t.Fail()
+	}
+	if _, err := s.OpenTo(out[:len(msg)-1], buf[:n], aad); err != errShortBuffer {
+		t.Errorf("expected %v, got %v", errShortBuffer, err)
+		t.Fail()
+	}
+	if _, err := s.OpenTo(out, buf[:n], nil); err != errIntegrityError {
+		t.Errorf("expected %v, got %v", errIntegrityError, err)
+		t.Fail()
+	}
+}
+
+func testIVMask(t *testing.T) {
+	rfc, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+	legacy, _ := NewAesSIV(key)
+
+	noMask := []byte(strings.Repeat("\xff", blockSize))
+	if FIPSMode() {
+		if _, err := NewAesSIV(key, WithIVMask(noMask)); err != errFIPSIVMask {
+			t.Errorf("FIPS mode: expected %v, got %v", errFIPSIVMask, err)
+			t.Fail()
+		}
+		if err := legacy.SetIVMask(noMask); err != errFIPSIVMask {
+			t.Errorf("FIPS mode: expected %v, got %v", errFIPSIVMask, err)
+			t.Fail()
+		}
+		if err := legacy.SetIVMask(nil); err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		return
+	}
+	if err := legacy.SetIVMask(noMask); err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	aad := [][]byte{ad}
+	msg := make([]byte, 1024)
+	ct := legacy.SealWithMultipleAAD(nil, msg, aad)
+	if ct[8]&0x80 == 0 && ct[12]&0x80 == 0 {
+		t.Error("the tag of the fixture has no bit the RFC mask clears")
+		t.Fail()
+		return
+	}
+
+	if pt, err := legacy.OpenWithMultipleAAD(nil, ct, aad); err != nil || subtle.ConstantTimeCompare(pt, msg) != 1 {
+		t.Errorf("doesn't round trip with the legacy mask: %v", err)
+		t.Fail()
+	}
+	if _, err := rfc.OpenWithMultipleAAD(nil, ct, aad); err == nil {
+		t.Error("RFC mask opened data sealed without masking")
+		t.Fail()
+	}
+
+	if err := legacy.SetIVMask(nil); err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if subtle.ConstantTimeCompare(legacy.SealWithMultipleAAD(nil, msg, aad), rfc.SealWithMultipleAAD(nil, msg, aad)) != 1 {
+		t.Error("nil mask doesn't restore RFC 5297 behavior")
+		t.Fail()
+	}
+
+	if err := legacy.SetIVMask(noMask[:8]); err != errIVMaskSize {
+		t.Errorf("expected %v, got %v", errIVMaskSize, err)
+		t.Fail()
+	}
+}
+
+func testNonceBased(t *testing.T) {
+	var a cipher.AEAD
+	a, err := NewNonceAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+	if a.NonceSize() != NonceSize || a.Overhead() != blockSize {
+		t.Errorf("nonce size %d, overhead %d", a.NonceSize(), a.Overhead())
+		t.Fail()
+	}
+
+	nonce := []byte("0123456789abcdef")
+	ct := a.Seal(nil, nonce, plaintext, ad)
+	if pt, err := a.Open(nil, nonce, ct, ad); err != nil || subtle.ConstantTimeCompare(pt, plaintext) != 1 {
+		t.Errorf("doesn't round trip: %v", err)
+		t.Fail()
+	}
+
+	// the nonce is the last S2V string
+	s, _ := NewAesSIV(key)
+	if subtle.ConstantTimeCompare(ct, s.SealWithMultipleAAD(nil, plaintext, [][]byte{ad, nonce})) != 1 {
+		t.Error("nonce isn't the last associated data string")
+		t.Fail()
+	}
+
+	other := []byte("fedcba9876543210")
+	if subtle.ConstantTimeCompare(ct, a.Seal(nil, other, plaintext, ad)) == 1 {
+		t.Error("ciphertext doesn't depend on the nonce")
+		t.Fail()
+	}
+	if _, err := a.Open(nil, other, ct, ad); err != errIntegrityError {
+		t.Error("opened with another nonce")
+		t.Fail()
+	}
+	if _, err := a.Open(nil, nonce[:8], ct, ad); err != errNonceSize {
+		t.Errorf("expected %v, got %v", errNonceSize, err)
+		t.Fail()
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Seal accepted a short nonce")
+			t.Fail()
+		}
+	}()
+	a.Seal(nil, nil, plaintext, ad)
+}
+
+func testSyntheticNonce(t *testing.T) {
+	macKey := key[:blockSize]
+	block, err := aes.NewCipher(key[blockSize:])
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	aad := [][]byte{ad}
+	nonce, err := SyntheticNonce(macKey, gcm.NonceSize(), plaintext, aad)
+	if err != nil || len(nonce) != gcm.NonceSize() {
+		t.Errorf("nonce %x: %v", nonce, err)
+		t.Fail()
+		return
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, ad)
+	if pt, err := gcm.Open(nil, sealed[:len(nonce)], sealed[len(nonce):], ad); err != nil || subtle.ConstantTimeCompare(pt, plaintext) != 1 {
+		t.Errorf("doesn't round trip: %v", err)
+		t.Fail()
+	}
+
+	again, _ := SyntheticNonce(macKey, gcm.NonceSize(), plaintext, aad)
+	otherMessage, _ := SyntheticNonce(macKey, gcm.NonceSize(), []byte("other"), aad)
+	otherAAD, _ := SyntheticNonce(macKey, gcm.NonceSize(), plaintext, [][]byte{ad, ad})
+	if subtle.ConstantTimeCompare(nonce, again) != 1 {
+		t.Error("nonce isn't deterministic")
+		t.Fail()
+	}
+	if subtle.ConstantTimeCompare(nonce, otherMessage) == 1 || subtle.ConstantTimeCompare(nonce, otherAAD) == 1 {
+		t.Error("nonce doesn't depend on the message")
+		t.Fail()
+	}
+
+	// separated from the synthetic IV of AES-SIV under the same CMAC key
+	full, _ := SyntheticNonce(macKey, blockSize, plaintext, aad)
+	mac, _ := prf.CMAC(macKey)
+	if v := s2vPRF(mac, aad, plaintext); subtle.ConstantTimeCompare(full, v) == 1 {
+		t.Error("nonce equals the AES-SIV synthetic IV")
+		t.Fail()
+	}
+
+	if _, err := SyntheticNonce(macKey, 17, plaintext, aad); err != errSyntheticNonceSize {
+		t.Errorf("expected %v, got %v", errSyntheticNonceSize, err)
+		t.Fail()
+	}
+	if _, err := SyntheticNonce(macKey[:5], 12, plaintext, aad); err == nil {
+		t.Error("invalid key accepted")
+		t.Fail()
+	}
+}
+
+/*
+The constructors reject invalid keys, a value built without them must still fail
+with errors wherever the API can return one
+*/
+func testInvalidKeyErrors(t *testing.T) {
+	a := aessiv{key: make([]byte, 20)}
+	ct := make([]byte, 2*blockSize)
+
+	if _, err := a.SealContext(context.Background(), plaintext, nil); err == nil {
+		t.Error("SealContext: no error")
+		t.Fail()
+	}
+	if _, err := a.SealTo(make([]byte, 64), plaintext, nil); err == nil {
+		t.Error("SealTo: no error")
+		t.Fail()
+	}
+	if _, err := a.SealRandom(nil, plaintext, nil); err == nil {
+		t.Error("SealRandom: no error")
+		t.Fail()
+	}
+	if _, err := a.SealHedged(nil, plaintext, nil); err == nil {
+		t.Error("SealHedged: no error")
+		t.Fail()
+	}
+	if _, err := a.OpenWithMultipleAAD(nil, ct, nil); err == nil || err == errIntegrityError {
+		t.Errorf("Open: unexpected error %v", err)
+		t.Fail()
+	}
+
+	tr := truncatedSIV{key: a.key, tagSize: 8}
+	if _, err := tr.SealContext(context.Background(), plaintext, nil); err == nil {
+		t.Error("truncated SealContext: no error")
+		t.Fail()
+	}
+	if _, err := tr.OpenWithMultipleAAD(nil, ct, nil); err == nil || err == errIntegrityError {
+		t.Errorf("truncated Open: unexpected error %v", err)
+		t.Fail()
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("SealWithMultipleAAD didn't panic")
+			t.Fail()
+		}
+	}()
+	a.SealWithMultipleAAD(nil, plaintext, nil)
+}
+
+/*
+The block by block CTR of short messages must match crypto/cipher, including the
+carry out of the low 64 bits of the counter
+*/
+func testInlineCTR(t *testing.T) {
+	s, err := newScratch(key, nil, nil)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	ivs := [][]byte{
+		make([]byte, blockSize),
+		{0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe},
+		{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	}
+	for _, iv := range ivs {
+		for _, size := range []int{1, blockSize, 3*blockSize + 5, inlineCTRSize} {
+			expected := make([]byte, size)
+			cipher.NewCTR(s.ctr, iv).XORKeyStream(expected, expected)
+
+			buf := make([]byte, size)
+			copy(s.iv[:], iv)
+			s.xorKeyStream(buf)
+			if subtle.ConstantTimeCompare(buf, expected) != 1 {
+				t.Errorf("IV %x, %d bytes: keystream differs", iv, size)
+				t.Fail()
+			}
+		}
+	}
+}
+
+func testSealOpenAllocs(t *testing.T) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	msg := make([]byte, 64)
+	aad := [][]byte{ad, ad}
+	sealed := make([]byte, 0, len(msg)+blockSize)
+	opened := make([]byte, 0, len(msg))
+	ct := s.SealWithMultipleAAD(nil, msg, aad)
+
+	if n := testing.AllocsPerRun(100, func() {
+		s.SealWithMultipleAAD(sealed, msg, aad)
+	}); n != 0 {
+		t.Errorf("Seal: %v allocs", n)
+		t.Fail()
+	}
+	if n := testing.AllocsPerRun(100, func() {
+		if _, err := s.OpenWithMultipleAAD(opened, ct, aad); err != nil {
+			panic(err)
+		}
+	}); n != 0 {
+		t.Errorf("Open: %v allocs", n)
+		t.Fail()
+	}
+}
+
+func benchmarkSeal(b *testing.B, size int) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	msg := make([]byte, size)
+	aad := [][]byte{ad}
+	dst := make([]byte, 0, size+blockSize)
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.SealWithMultipleAAD(dst, msg, aad)
+	}
+}
+
+func benchmarkOpen(b *testing.B, size int) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	aad := [][]byte{ad}
+	ct := s.SealWithMultipleAAD(nil, make([]byte, size), aad)
+	dst := make([]byte, 0, size)
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.OpenWithMultipleAAD(dst, ct, aad); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSeal16(b *testing.B)  { benchmarkSeal(b, 16) }
+func BenchmarkSeal256(b *testing.B) { benchmarkSeal(b, 256) }
+func BenchmarkSeal4K(b *testing.B)  { benchmarkSeal(b, 4096) }
+func BenchmarkOpen16(b *testing.B)  { benchmarkOpen(b, 16) }
+func BenchmarkOpen256(b *testing.B) { benchmarkOpen(b, 256) }
+func BenchmarkOpen4K(b *testing.B)  { benchmarkOpen(b, 4096) }
+
+func testConstructionState(t *testing.T) {
+	k := append([]byte{}, key...)
+	s, err := NewAesSIV(k)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+	if s.ctr == nil || s.mac == nil || s.scratch == nil {
+		t.Error("CTR cipher, CMAC key or scratch pool missing")
+		t.Fail()
+	}
+
+	// the caller may clear its key
+	clear(k)
+	expected, _ := NewAesSIV(key)
+	if subtle.ConstantTimeCompare(s.Seal(nil, nil, plaintext, ad), expected.Seal(nil, nil, plaintext, ad)) != 1 {
+		t.Error("clearing the caller's key changed the AEAD")
+		t.Fail()
+	}
+}
+
+func testAADLimit(t *testing.T) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	aad := make([][]byte, MaxAssociatedData+1)
+	ct, err := s.SealContext(context.Background(), plaintext, aad[:MaxAssociatedData])
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+	if _, err := s.OpenWithMultipleAAD(nil, ct, aad[:MaxAssociatedData]); err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+
+	if _, err := s.SealContext(context.Background(), plaintext, aad); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Seal: expected %v, got %v", errTooManyAAD, err)
+		t.Fail()
+	}
+	if _, err := s.OpenWithMultipleAAD(nil, ct, aad); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Open: expected %v, got %v", errTooManyAAD, err)
+		t.Fail()
+	}
+	if _, err := s.SealHedged(nil, plaintext, aad[:MaxAssociatedData-1]); err != errTooManyAAD {
+		t.Errorf("SealHedged: expected %v, got %v", errTooManyAAD, err)
+		t.Fail()
+	}
+	if _, err := SyntheticNonce(key[:blockSize], 12, plaintext, aad[:MaxAssociatedData]); err != errTooManyAAD {
+		t.Errorf("SyntheticNonce: expected %v, got %v", errTooManyAAD, err)
+		t.Fail()
+	}
+
+	tr, _ := NewTruncatedAesSIV(key, testTagSize(8))
+	if _, err := tr.OpenWithMultipleAAD(nil, ct, aad); err != errTooManyAAD {
+		t.Errorf("truncated Open: expected %v, got %v", errTooManyAAD, err)
+		t.Fail()
+	}
+}
+
+func testDetached(t *testing.T) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	aad := [][]byte{ad}
+	sealed := s.SealWithMultipleAAD(nil, plaintext, aad)
+
+	ct, tag, err := s.SealDetached([]byte("prefix"), plaintext, aad)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+	if string(ct[:6]) != "prefix" || subtle.ConstantTimeCompare(tag, sealed[:blockSize]) != 1 ||
+		subtle.ConstantTimeCompare(ct[6:], sealed[blockSize:]) != 1 {
+		t.Error("detached output differs from Seal")
+		t.Fail()
+	}
+
+	pt, err := s.OpenDetached(nil, ct[6:], tag, aad)
+	if err != nil || subtle.ConstantTimeCompare(pt, plaintext) != 1 {
+		t.Errorf("OpenDetached: %v", err)
+		t.Fail()
+	}
+
+	// in place
+	buf := append([]byte{}, plaintext...)
+	ct, tag, err = s.SealDetached(buf[:0], buf, aad)
+	if err != nil || &ct[0] != &buf[0] || subtle.ConstantTimeCompare(ct, sealed[blockSize:]) != 1 {
+		t.Errorf("in-place SealDetached: %v", err)
+		t.Fail()
+	}
+	if pt, err := s.OpenDetached(ct[:0], ct, tag, aad); err != nil || subtle.ConstantTimeCompare(pt, plaintext) != 1 {
+		t.Errorf("in-place OpenDetached: %v", err)
+		t.Fail()
+	}
+
+	tag[0] ^= 1
+	if _, err := s.OpenDetached(nil, sealed[blockSize:], tag, aad); err != errIntegrityError {
+		t.Errorf("expected %v, got %v", errIntegrityError, err)
+		t.Fail()
+	}
+	if _, err := s.OpenDetached(nil, sealed[blockSize:], tag[:8], aad); err != errInvalidTagLength {
+		t.Errorf("expected %v, got %v", errInvalidTagLength, err)
+		t.Fail()
+	}
+}
+
+/*
+RFC 5297 A.1 and A.2 list the S2V output V
+*/
+func testS2V(t *testing.T) {
+	decode := func(s string) []byte {
+		b, _ := hex.DecodeString(s)
+		return b
+	}
+
+	tests := []struct {
+		key     []byte
+		strings [][]byte
+		v       []byte
+	}{
+		{key[:blockSize], [][]byte{ad, {
+			0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88,
+			0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee,
+		}}, ciphertext[:blockSize]},
+		{
+			decode("7f7e7d7c7b7a79787776757473727170"),
+			[][]byte{
+				decode("00112233445566778899aabbccddeeffdeaddadadeaddadaffeeddccbbaa99887766554433221100"),
+				decode("102030405060708090a0"),
+				decode("09f911029d74e35bd84156c5635688c0"),
+				decode("7468697320697320736f6d6520706c61696e7465787420746f20656e6372797074207573696e67205349562d414553"),
+			},
+			decode("7bdb6e3b432667eb06f4d14bff2fbd0f"),
+		},
+		{key[:blockSize], nil, cmac.Sum(key[:blockSize], one)},
+	}
+
+	for i, test := range tests {
+		v, err := S2V(test.key, test.strings)
+		if err != nil || subtle.ConstantTimeCompare(v[:], test.v) != 1 {
+			t.Errorf("vector %d: got %x, %v", i, v, err)
+			t.Fail()
+		}
+	}
+
+	if _, err := S2V(key[:5], nil); err == nil {
+		t.Error("invalid key accepted")
+		t.Fail()
+	}
+	if _, err := S2V(key[:blockSize], make([][]byte, MaxAssociatedData+2)); err != errTooManyStrings {
+		t.Errorf("expected %v, got %v", errTooManyStrings, err)
+		t.Fail()
+	}
+}
+
+func testS2VWriter(t *testing.T) {
+	macKey := key[:blockSize]
+	aad := [][]byte{ad, nil, []byte("header")}
+	msg := make([]byte, 3*blockSize+7)
+	rand.Read(msg)
+
+	for size := 0; size <= len(msg); size++ {
+		expected, _ := S2V(macKey, append(append([][]byte{}, aad...), msg[:size]))
+
+		// pieces of 1, 2, ... bytes cross the buffered tail in every position
+		for piece := 1; piece <= blockSize+1; piece += 4 {
+			w, err := NewS2VWriter(macKey, aad)
+			if err != nil {
+				t.Error(err)
+				t.Fail()
+				return
+			}
+			for p := msg[:size]; len(p) > 0; {
+				n := min(piece, len(p))
+				w.Write(p[:n])
+				p = p[n:]
+			}
+			if v := w.Sum(); v != expected {
+				t.Errorf("%d bytes in pieces of %d: got %x, expected %x", size, piece, v, expected)
+				t.Fail()
+				return
+			}
+			if v := w.Sum(); v != expected {
+				t.Error("second Sum differs")
+				t.Fail()
+			}
+			if _, err := w.Write([]byte{1}); err != errS2VFinished {
+				t.Errorf("expected %v, got %v", errS2VFinished, err)
+				t.Fail()
+			}
+		}
+	}
+
+	if _, err := NewS2VWriter(macKey[:5], nil); err == nil {
+		t.Error("invalid key accepted")
+		t.Fail()
+	}
+	if _, err := NewS2VWriter(macKey, make([][]byte, MaxAssociatedData+1)); err != errTooManyAAD {
+		t.Errorf("expected %v, got %v", errTooManyAAD, err)
+		t.Fail()
+	}
+}
+
+func testStreaming(t *testing.T) {
+	aad := [][]byte{ad}
+	seal := func(msg []byte) []byte {
+		var out bytes.Buffer
+		w, err := NewEncryptingWriter(key, &out, aad)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+			return nil
+		}
+		// uneven writes cross the chunk boundaries
+		for p := msg; len(p) > 0; {
+			n := min(1000, len(p))
+			w.Write(p[:n])
+			p = p[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		return out.Bytes()
+	}
+	open := func(stream []byte) ([]byte, error) {
+		r, err := NewDecryptingReader(key, bytes.NewReader(stream), aad)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	}
+
+	msg := make([]byte, 2*StreamChunkSize+100)
+	rand.Read(msg)
+	for _, size := range []int{0, 1, StreamChunkSize, len(msg)} {
+		stream := seal(msg[:size])
+		chunks := size/StreamChunkSize + 1
+		if len(stream) != streamHeaderSize+size+chunks*blockSize {
+			t.Errorf("%d bytes: stream of %d bytes", size, len(stream))
+			t.Fail()
+		}
+		if pt, err := open(stream); err != nil || !bytes.Equal(pt, msg[:size]) {
+			t.Errorf("%d bytes: %v", size, err)
+			t.Fail()
+		}
+	}
+
+	stream := seal(msg)
+	chunk := blockSize + StreamChunkSize
+	first := stream[streamHeaderSize : streamHeaderSize+chunk]
+	second := stream[streamHeaderSize+chunk : streamHeaderSize+2*chunk]
+	tests := []struct {
+		name   string
+		stream []byte
+		class  error
+	}{
+		{"truncated at a chunk boundary", stream[:streamHeaderSize+2*chunk], ErrMalformed},
+		{"truncated in the last chunk", stream[:len(stream)-1], ErrAuthentication},
+		{"reordered chunks", append(append(append([]byte{}, stream[:streamHeaderSize]...), second...), first...), ErrAuthentication},
+		{"trailing data", append(append([]byte{}, stream...), 0), ErrAuthentication},
+		{"other stream", append(seal(msg)[:streamHeaderSize], stream[streamHeaderSize:]...), ErrAuthentication},
+		{"unknown version", append([]byte{3}, stream[1:]...), ErrUnsupportedVersion},
+		{"short header", stream[:streamHeaderSize-1], ErrMalformed},
+	}
+	for _, test := range tests {
+		if _, err := open(test.stream); !errors.Is(err, test.class) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.class, err)
+			t.Fail()
+		}
+	}
+
+	w, _ := NewEncryptingWriter(key, io.Discard, aad)
+	w.Close()
+	if _, err := w.Write(msg); err != errStreamClosed {
+		t.Errorf("expected %v, got %v", errStreamClosed, err)
+		t.Fail()
+	}
+}
+
+func testStreamingCopy(t *testing.T) {
+	aad := [][]byte{ad}
+	msg := make([]byte, 3*StreamChunkSize+100)
+	rand.Read(msg)
+
+	for _, size := range []int{0, 100, StreamChunkSize, len(msg)} {
+		var stream bytes.Buffer
+		w, err := NewEncryptingWriter(key, &stream, aad)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+			return
+		}
+		if _, ok := w.(io.ReaderFrom); !ok {
+			t.Error("encrypting writer isn't an io.ReaderFrom")
+			t.Fail()
+		}
+		// hide bytes.Reader.WriteTo, so io.Copy calls ReadFrom
+		n, err := io.Copy(w, struct{ io.Reader }{bytes.NewReader(msg[:size])})
+		if err != nil || n != int64(size) {
+			t.Errorf("%d bytes: ReadFrom returned %d, %v", size, n, err)
+			t.Fail()
+		}
+		if err := w.Close(); err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		if stream.Len() != streamHeaderSize+size+(size/StreamChunkSize+1)*blockSize {
+			t.Errorf("%d bytes: stream of %d bytes", size, stream.Len())
+			t.Fail()
+		}
+
+		r, err := NewDecryptingReader(key, &stream, aad)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+			return
+		}
+		if _, ok := r.(io.WriterTo); !ok {
+			t.Error("decrypting reader isn't an io.WriterTo")
+			t.Fail()
+		}
+		var pt bytes.Buffer
+		n, err = io.Copy(&pt, r)
+		if err != nil || n != int64(size) || !bytes.Equal(pt.Bytes(), msg[:size]) {
+			t.Errorf("%d bytes: WriteTo returned %d, %v", size, n, err)
+			t.Fail()
+		}
+	}
+
+	// a failed chunk stops WriteTo after the authenticated chunks
+	var stream bytes.Buffer
+	w, _ := NewEncryptingWriter(key, &stream, aad)
+	io.Copy(w, struct{ io.Reader }{bytes.NewReader(msg)})
+	w.Close()
+	tampered := stream.Bytes()
+	tampered[len(tampered)-1] ^= 1
+	r, _ := NewDecryptingReader(key, bytes.NewReader(tampered), aad)
+	n, err := io.Copy(io.Discard, r)
+	if !errors.Is(err, ErrAuthentication) || n != 3*StreamChunkSize {
+		t.Errorf("tampered last chunk: %d, %v", n, err)
+		t.Fail()
+	}
+
+	// ReadFrom keeps the first write error, like Write
+	f := &failingWriter{n: 1}
+	w, _ = NewEncryptingWriter(key, f, nil)
+	if _, err := io.Copy(w, struct{ io.Reader }{bytes.NewReader(msg)}); err != errFailingWriter {
+		t.Errorf("expected %v, got %v", errFailingWriter, err)
+		t.Fail()
+	}
+	if err := w.Close(); err != errFailingWriter {
+		t.Errorf("Close after a failure: %v", err)
+		t.Fail()
+	}
+}
+
+func testStreamingFlush(t *testing.T) {
+	aad := [][]byte{ad}
+	var stream bytes.Buffer
+	w, err := NewFlushingWriter(key, &stream, aad)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	r, err := NewDecryptingReader(key, &stream, aad)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	// every flushed message reads back before the stream is closed
+	for _, msg := range []string{"hello", "", "world"} {
+		w.Write([]byte(msg))
+		if err := w.Flush(); err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		if msg == "" {
+			continue
+		}
+		got := make([]byte, len(msg))
+		if _, err := io.ReadFull(r, got); err != nil || string(got) != msg {
+			t.Errorf("flushed %q, read %q, %v", msg, got, err)
+			t.Fail()
+		}
+	}
+
+	big := make([]byte, StreamChunkSize+10)
+	rand.Read(big)
+	w.Write(big)
+	if err := w.Close(); err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	if err := w.Flush(); err != errStreamClosed {
+		t.Errorf("Flush after Close: %v", err)
+		t.Fail()
+	}
+	if rest, err := io.ReadAll(r); err != nil || !bytes.Equal(rest, big) {
+		t.Errorf("rest of the stream: %v", err)
+		t.Fail()
+	}
+
+	seal := func(parts ...string) []byte {
+		var out bytes.Buffer
+		w, _ := NewFlushingWriter(key, &out, aad)
+		for _, p := range parts {
+			w.Write([]byte(p))
+			w.Flush()
+		}
+		w.Close()
+		return out.Bytes()
+	}
+	open := func(stream []byte) ([]byte, error) {
+		r, err := NewDecryptingReader(key, bytes.NewReader(stream), aad)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	}
+
+	framed := seal("first", "second")
+	// header, "first" and "second" frames, empty last frame
+	first := streamHeaderSize + streamFrameHeaderSize + blockSize + 5
+	second := first + streamFrameHeaderSize + blockSize + 6
+	if len(framed) != second+streamFrameHeaderSize+blockSize {
+		t.Errorf("framed stream of %d bytes", len(framed))
+		t.Fail()
+	}
+	lastFlag := append([]byte{}, framed...)
+	lastFlag[first] = 1
+	badLength := append([]byte{}, framed...)
+	badLength[first+1] = 0xff
+
+	tests := []struct {
+		name   string
+		stream []byte
+		class  error
+	}{
+		{"truncated at a frame boundary", framed[:second], ErrMalformed},
+		{"truncated in a frame", framed[:len(framed)-1], ErrMalformed},
+		{"flushed frame marked last", lastFlag, ErrAuthentication},
+		{"frame too large", badLength, ErrMalformed},
+		{"trailing data", append(append([]byte{}, framed...), 0), ErrMalformed},
+		{"version 1 header", append([]byte{streamVersion}, framed[1:]...), ErrAuthentication},
+	}
+	for _, test := range tests {
+		if _, err := open(test.stream); !errors.Is(err, test.class) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.class, err)
+			t.Fail()
+		}
+	}
+
+	plain, _ := NewEncryptingWriter(key, io.Discard, aad)
+	if err := plain.(FlushingWriter).Flush(); err != errStreamNoFlush {
+		t.Errorf("Flush of a version 1 stream: %v", err)
+		t.Fail()
+	}
+}
+
+func testStreamingCompression(t *testing.T) {
+	aad := [][]byte{ad}
+	msg := bytes.Repeat([]byte("compressible "), 2*StreamChunkSize/13)
+	seal := func(msg []byte, opts ...StreamOption) []byte {
+		var out bytes.Buffer
+		w, err := NewEncryptingWriter(key, &out, aad, opts...)
+		if err != nil {
+			t.Error(err)
+			t.Fail()
+			return nil
+		}
+		w.Write(msg)
+		if err := w.Close(); err != nil {
+			t.Error(err)
+			t.Fail()
+		}
+		return out.Bytes()
+	}
+	open := func(stream []byte, opts ...StreamOption) ([]byte, error) {
+		r, err := NewDecryptingReader(key, bytes.NewReader(stream), aad, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	}
+
+	compressed := seal(msg, WithCompression(CompressionFlate))
+	if len(compressed) >= len(msg)/10 {
+		t.Errorf("%d bytes compressed to %d", len(msg), len(compressed))
+		t.Fail()
+	}
+	if pt, err := open(compressed, WithAllowedCompression(CompressionFlate)); err != nil || !bytes.Equal(pt, msg) {
+		t.Errorf("compressed stream: %v", err)
+		t.Fail()
+	}
+	if pt, err := open(seal(msg), WithAllowedCompression(CompressionFlate)); err != nil || !bytes.Equal(pt, msg) {
+		t.Errorf("uncompressed stream with compression allowed: %v", err)
+		t.Fail()
+	}
+
+	uncompressedFlag := append([]byte{streamVersion}, compressed[1:]...)
+	unknownFlag := append([]byte{0x20 | streamVersion}, compressed[1:]...)
+	tests := []struct {
+		name   string
+		stream []byte
+		opts   []StreamOption
+		class  error
+	}{
+		{"compression not allowed", compressed, nil, ErrUnsupportedVersion},
+		{"compression flag cleared", uncompressedFlag, nil, ErrAuthentication},
+		{"unknown compression", unknownFlag, []StreamOption{WithAllowedCompression(CompressionFlate)}, ErrUnsupportedVersion},
+	}
+	for _, test := range tests {
+		if _, err := open(test.stream, test.opts...); !errors.Is(err, test.class) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.class, err)
+			t.Fail()
+		}
+	}
+
+	if _, err := NewEncryptingWriter(key, io.Discard, aad, WithCompression("zstd")); err != errUnknownCompression {
+		t.Errorf("expected %v, got %v", errUnknownCompression, err)
+		t.Fail()
+	}
+	if _, err := NewDecryptingReader(key, bytes.NewReader(compressed), aad, WithAllowedCompression("zstd")); err != errUnknownCompression {
+		t.Errorf("expected %v, got %v", errUnknownCompression, err)
+		t.Fail()
+	}
+
+	// a flushed message inflates before the stream is closed
+	var stream bytes.Buffer
+	w, _ := NewFlushingWriter(key, &stream, aad, WithCompression(CompressionFlate))
+	r, err := NewDecryptingReader(key, &stream, aad, WithAllowedCompression(CompressionFlate))
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+	w.Write([]byte("hello"))
+	if err := w.Flush(); err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	got := make([]byte, 5)
+	if _, err := io.ReadFull(r, got); err != nil || string(got) != "hello" {
+		t.Errorf("flushed %q, %v", got, err)
+		t.Fail()
+	}
+	w.Close()
+	if rest, err := io.ReadAll(r); err != nil || len(rest) != 0 {
+		t.Errorf("end of the stream: %q, %v", rest, err)
+		t.Fail()
+	}
+}
+
+func testStreamingTracing(t *testing.T) {
+	var started []string
+	var traces []StreamTrace
+	tracer := func(op, keyID string) func(StreamTrace) {
+		started = append(started, op+" "+keyID)
+		return func(trace StreamTrace) {
+			traces = append(traces, trace)
+		}
+	}
+
+	msg := make([]byte, 2*StreamChunkSize+100)
+	var stream bytes.Buffer
+	w, _ := NewEncryptingWriter(key, &stream, nil, WithTracing(tracer, "7"))
+	w.Write(msg)
+	if len(traces) != 0 {
+		t.Error("span ended before Close")
+		t.Fail()
+	}
+	w.Close()
+	w.Close()
+
+	sealed := append([]byte{}, stream.Bytes()...)
+	r, _ := NewDecryptingReader(key, &stream, nil, WithTracing(tracer, "7"))
+	io.Copy(io.Discard, r)
+
+	sealed[len(sealed)-1] ^= 1
+	r, _ = NewDecryptingReader(key, bytes.NewReader(sealed), nil, WithTracing(tracer, "7"))
+	io.ReadAll(r)
+	r.Read(msg)
+
+	f := &failingWriter{n: 2}
+	w, _ = NewEncryptingWriter(key, f, nil, WithTracing(tracer, "8"))
+	w.Write(msg)
+	w.Close()
+
+	expected := []struct {
+		op     string
+		chunks uint64
+		bytes  int64
+		class  error
+	}{
+		{OpSeal, 3, int64(len(msg)), nil},
+		{OpOpen, 3, int64(len(msg)), nil},
+		{OpOpen, 2, 2 * StreamChunkSize, ErrAuthentication},
+		{OpSeal, 1, StreamChunkSize, errFailingWriter},
+	}
+	if strings.Join(started, ",") != "seal 7,open 7,open 7,seal 8" {
+		t.Errorf("started spans %q", started)
+		t.Fail()
+	}
+	if len(traces) != len(expected) {
+		t.Errorf("%d spans ended, expected %d", len(traces), len(expected))
+		t.Fail()
+		return
+	}
+	for i, e := range expected {
+		got := traces[i]
+		if got.Operation != e.op || got.Chunks != e.chunks || got.Bytes != e.bytes || !errors.Is(got.Err, e.class) ||
+			(e.class == nil) != (got.Err == nil) {
+			t.Errorf("span %d: %+v", i, got)
+			t.Fail()
+		}
+	}
+}
+
+func testDestroy(t *testing.T) {
+	s, err := NewAesSIV(key)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+	aad := [][]byte{ad}
+	sealed := s.SealWithMultipleAAD(nil, plaintext, aad)
+	n := &nonceSIV{s}
+	tr, _ := NewTruncatedAesSIV(key, testTagSize(8))
+
+	s.Destroy()
+	tr.Destroy()
+	if subtle.ConstantTimeCompare(s.key, make([]byte, len(key))) != 1 || subtle.ConstantTimeCompare(tr.key, make([]byte, len(key))) != 1 {
+		t.Error("key isn't wiped")
+		t.Fail()
+	}
+
+	if _, err := s.OpenWithMultipleAAD(nil, sealed, aad); err != errKeyDestroyed {
+		t.Errorf("Open: expected %v, got %v", errKeyDestroyed, err)
+		t.Fail()
+	}
+	if _, err := s.SealContext(context.Background(), plaintext, aad); err != errKeyDestroyed {
+		t.Errorf("SealContext: expected %v, got %v", errKeyDestroyed, err)
+		t.Fail()
+	}
+	if _, err := s.SealHedged(nil, plaintext, aad); err != errKeyDestroyed {
+		t.Errorf("SealHedged: expected %v, got %v", errKeyDestroyed, err)
+		t.Fail()
+	}
+	if _, err := n.Open(nil, make([]byte, NonceSize), sealed, ad); err != errKeyDestroyed {
+		t.Errorf("nonce-based Open: expected %v, got %v", errKeyDestroyed, err)
+		t.Fail()
+	}
+	if _, err := tr.SealContext(context.Background(), plaintext, aad); err != errKeyDestroyed {
+		t.Errorf("truncated SealContext: expected %v, got %v", errKeyDestroyed, err)
+		t.Fail()
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("SealWithMultipleAAD didn't panic")
+			t.Fail()
+		}
+	}()
+	s.SealWithMultipleAAD(nil, plaintext, aad)
+}
+
+func testGenerateKey(t *testing.T) {
+	for _, bits := range []int{256, 384, 512} {
+		k, err := GenerateKey(nil, bits)
+		if err != nil || k.Bits() != bits {
+			t.Errorf("%d bits: %d bits, %v", bits, k.Bits(), err)
+			t.Fail()
+			continue
+		}
+		a, err := k.AEAD()
+		if err != nil || a.KeySize()*8 != bits {
+			t.Errorf("%d bits: AEAD: %v", bits, err)
+			t.Fail()
+		}
+	}
+
+	if _, err := GenerateKey(nil, 128); err != errKeyBits {
+		t.Errorf("expected %v, got %v", errKeyBits, err)
+		t.Fail()
+	}
+	if _, err := GenerateKey(iotest.ErrReader(errors.New("no entropy")), 256); err == nil {
+		t.Error("read error ignored")
+		t.Fail()
+	}
+	if _, err := GenerateKey(bytes.NewReader(make([]byte, 16)), 256); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("short read: %v", err)
+		t.Fail()
+	}
+	if _, err := GenerateKey(bytes.NewReader(make([]byte, 32)), 256); err != errDegenerateKey {
+		t.Errorf("expected %v, got %v", errDegenerateKey, err)
+		t.Fail()
+	}
+
+	k, _ := GenerateKey(nil, 256)
+	if s := fmt.Sprintf("%v %x %s %#v", k, k, k, k); strings.Contains(s, fmt.Sprintf("%x", []byte(k))) {
+		t.Error("key is printed")
+		t.Fail()
+	}
+}
+
+/*
+reversed is AES with the output bytes reversed, a 128-bit block cipher that isn't AES
+*/
+type reversed struct {
+	cipher.Block
+}
+
+func (r reversed) Encrypt(dst, src []byte) {
+	r.Block.Encrypt(dst, src)
+	for i, j := 0, len(dst[:blockSize])-1; i < j; i, j = i+1, j-1 {
+		dst[i], dst[j] = dst[j], dst[i]
+	}
+}
+
+func testOptions(t *testing.T) {
+	aad := [][]byte{ad}
+	plain, _ := NewAesSIV(key)
+	expected := plain.SealWithMultipleAAD(nil, plaintext, aad)
+
+	newReversed := func(k []byte) (cipher.Block, error) {
+		b, err := aes.NewCipher(k)
+		return reversed{b}, err
+	}
+	custom, err := NewAesSIV(key, WithBlockCipher(newReversed))
+	if FIPSMode() {
+		if err != errFIPSCipher {
+			t.Errorf("FIPS mode: expected %v, got %v", errFIPSCipher, err)
+			t.Fail()
+		}
+	} else if err != nil {
+		t.Error(err)
+		t.Fail()
+	} else {
+		sealed := custom.SealWithMultipleAAD(nil, plaintext, aad)
+		if subtle.ConstantTimeCompare(sealed, expected) == 1 {
+			t.Error("the block cipher isn't used")
+			t.Fail()
+		}
+		if pt, err := custom.OpenWithMultipleAAD(nil, sealed, aad); err != nil || subtle.ConstantTimeCompare(pt, plaintext) != 1 {
+			t.Errorf("custom cipher: %v", err)
+			t.Fail()
+		}
+		if custom.Algorithm() != "SIV-CMAC-256" {
+			t.Errorf("unexpected algorithm %s", custom.Algorithm())
+			t.Fail()
+		}
+	}
+
+	nonce := []byte("twelve bytes")
+	n, err := NewAesSIV(key, WithNonceSize(len(nonce)))
+	if err != nil || n.NonceSize() != len(nonce) {
+		t.Errorf("nonce size: %v", err)
+		t.Fail()
+		return
+	}
+	sealed := n.Seal(nil, nonce, plaintext, ad)
+	if subtle.ConstantTimeCompare(sealed, plain.SealWithMultipleAAD(nil, plaintext, [][]byte{ad, nonce})) != 1 {
+		t.Error("the nonce isn't the last associated data string")
+		t.Fail()
+	}
+	if _, err := n.Open(nil, nonce[:8], sealed, ad); err != errNonceSize {
+		t.Errorf("expected %v, got %v", errNonceSize, err)
+		t.Fail()
+	}
+
+	limited, _ := NewAesSIV(key, WithMaxAAD(1))
+	if _, err := limited.SealContext(context.Background(), plaintext, [][]byte{ad, ad}); err != errTooManyAAD {
+		t.Errorf("expected %v, got %v", errTooManyAAD, err)
+		t.Fail()
+	}
+	if _, err := limited.SealContext(context.Background(), plaintext, aad); err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+
+	invalid := []struct {
+		opt Option
+		err error
+	}{
+		{WithBlockCipher(nil), errNilBlockCipher},
+		{WithNonceSize(-1), errOptionNonce},
+		{WithMaxAAD(0), errOptionMaxAAD},
+		{WithMaxAAD(MaxAssociatedData + 1), errOptionMaxAAD},
+	}
+	for _, test := range invalid {
+		if _, err := NewAesSIV(key, test.opt); err != test.err {
+			t.Errorf("expected %v, got %v", test.err, err)
+			t.Fail()
+		}
+	}
+	if !FIPSMode() {
+		_, err := NewAesSIV(key, WithBlockCipher(func(k []byte) (cipher.Block, error) { return des.NewCipher(k[:8]) }))
+		if !errors.Is(err, errBlockSize) {
+			t.Errorf("expected %v, got %v", errBlockSize, err)
+			t.Fail()
+		}
+	}
+}
+
+func testGenericSIV(t *testing.T) {
+	a, err := NewSIV(aes.NewCipher, key)
+	if FIPSMode() {
+		if err != errFIPSCipher {
+			t.Errorf("FIPS mode: expected %v, got %v", errFIPSCipher, err)
+			t.Fail()
+		}
+		return
+	}
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	// with AES it's AES-SIV, RFC 5297 A.1
+	rfcPlaintext := []byte{
+		0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88,
+		0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee,
+	}
+	if ct := a.Seal(nil, nil, rfcPlaintext, ad); subtle.ConstantTimeCompare(ct, ciphertext) != 1 {
+		t.Errorf("NewSIV with AES: got %x", ct)
+		t.Fail()
+	}
+
+	newReversed := func(k []byte) (cipher.Block, error) {
+		b, err := aes.NewCipher(k)
+		return reversed{b}, err
+	}
+	r, err := NewSIV(newReversed, key, WithNonceSize(8))
+	if err != nil || r.NonceSize() != 8 {
+		t.Errorf("options: %v", err)
+		t.Fail()
+		return
+	}
+	nonce := make([]byte, 8)
+	sealed := r.Seal(nil, nonce, rfcPlaintext, ad)
+	if subtle.ConstantTimeCompare(sealed[:blockSize], ciphertext[:blockSize]) == 1 {
+		t.Error("the block cipher isn't used")
+		t.Fail()
+	}
+	if pt, err := r.Open(nil, nonce, sealed, ad); err != nil || subtle.ConstantTimeCompare(pt, rfcPlaintext) != 1 {
+		t.Errorf("open: %v", err)
+		t.Fail()
+	}
+
+	if _, err := NewSIV(des.NewCipher, key[:16]); err != ErrKeySize {
+		t.Errorf("expected %v, got %v", ErrKeySize, err)
+		t.Fail()
+	}
+}
+
+func testSIVHMAC(t *testing.T) {
+	a, err := NewAesSIV(key, WithHMAC(sha256.New))
+	if FIPSMode() {
+		if err != errFIPSPRF {
+			t.Errorf("FIPS mode: expected %v, got %v", errFIPSPRF, err)
+			t.Fail()
+		}
+		return
+	}
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+	if a.Algorithm() != "AES-SIV-HMAC-256" {
+		t.Errorf("unexpected algorithm %s", a.Algorithm())
+		t.Fail()
+	}
+
+	// S2V over HMAC-SHA-256 cut to 128 bits, keyed with the first half
+	msg := []byte("SIV-HMAC message")
+	mac, _ := prf.Truncated(prf.HMAC(sha256.New), blockSize)(key[:len(key)/2])
+	v := s2vPRF(mac, [][]byte{ad}, msg)
+
+	sealed := a.Seal(nil, nil, msg, ad)
+	if subtle.ConstantTimeCompare(sealed[:blockSize], v) != 1 {
+		t.Errorf("got tag %x, expected %x", sealed[:blockSize], v)
+		t.Fail()
+	}
+	cmacSealed := aessiv{key: key}.SealWithMultipleAAD(nil, msg, [][]byte{ad})
+	if subtle.ConstantTimeCompare(sealed, cmacSealed) == 1 {
+		t.Error("CMAC is still used")
+		t.Fail()
+	}
+	if pt, err := a.Open(nil, nil, sealed, ad); err != nil || subtle.ConstantTimeCompare(pt, msg) != 1 {
+		t.Errorf("open: %v", err)
+		t.Fail()
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := a.Open(nil, nil, sealed, ad); !errors.Is(err, ErrAuthentication) {
+		t.Errorf("tampered ciphertext: %v", err)
+		t.Fail()
+	}
+
+	if _, err := NewAesSIV(key, WithPRF(prf.HMAC(sha256.New))); err != errPRFSize {
+		t.Errorf("expected %v, got %v", errPRFSize, err)
+		t.Fail()
+	}
+	if _, err := NewAesSIV(key, WithHMAC(nil)); err != errNilPRF {
+		t.Errorf("expected %v, got %v", errNilPRF, err)
+		t.Fail()
+	}
+}
+
+func testDAEAD(t *testing.T) {
+	a, _ := NewAesSIV(key)
+	tr, _ := NewTruncatedAesSIV(key, testTagSize(12))
+
+	for _, d := range []DAEAD{a, tr} {
+		sealed := d.SealDeterministic(nil, []byte("plaintext"), []byte("first"), []byte("second"))
+		if again := d.SealDeterministic(nil, []byte("plaintext"), []byte("first"), []byte("second")); !bytes.Equal(sealed, again) {
+			t.Errorf("%T: sealing isn't deterministic", d)
+			t.Fail()
+		}
+		if pt, err := d.OpenDeterministic(nil, sealed, []byte("first"), []byte("second")); err != nil || string(pt) != "plaintext" {
+			t.Errorf("%T: open: %v", d, err)
+			t.Fail()
+		}
+		// the strings are bound separately and in order
+		if _, err := d.OpenDeterministic(nil, sealed, []byte("firstsecond")); !errors.Is(err, ErrAuthentication) {
+			t.Errorf("%T: concatenated associated data: %v", d, err)
+			t.Fail()
+		}
+		if _, err := d.OpenDeterministic(nil, sealed, []byte("second"), []byte("first")); !errors.Is(err, ErrAuthentication) {
+			t.Errorf("%T: reordered associated data: %v", d, err)
+			t.Fail()
+		}
+	}
+
+	if !bytes.Equal(a.SealDeterministic(nil, []byte("pt"), ad), a.SealWithMultipleAAD(nil, []byte("pt"), [][]byte{ad})) {
+		t.Error("SealDeterministic differs from SealWithMultipleAAD")
+		t.Fail()
+	}
+}
+
+/*
+failingWriter accepts n writes, then fails every write
+*/
+type failingWriter struct {
+	n      int
+	writes [][]byte
+}
+
+var errFailingWriter = errors.New("write failed")
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if len(f.writes) == f.n {
+		return 0, errFailingWriter
+	}
+	f.writes = append(f.writes, append([]byte{}, p...))
+	return len(p), nil
+}
+
+func testStreamingWriteError(t *testing.T) {
+	// the header goes through, the first chunk fails
+	f := &failingWriter{n: 1}
+	w, err := NewEncryptingWriter(key, f, nil)
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+		return
+	}
+
+	chunk := bytes.Repeat([]byte{0x5a}, StreamChunkSize)
+	if _, err := w.Write(chunk); err != errFailingWriter {
+		t.Errorf("expected %v, got %v", errFailingWriter, err)
+		t.Fail()
+	}
+
+	// later calls return the first error, even once w works again
+	f.n = 10
+	if n, err := w.Write([]byte("more")); n != 0 || err != errFailingWriter {
+		t.Errorf("Write after a failure: %d, %v", n, err)
+		t.Fail()
+	}
+	for range 2 {
+		if err := w.Close(); err != errFailingWriter {
+			t.Errorf("Close after a failure: %v", err)
+			t.Fail()
+		}
+	}
+	if len(f.writes) != 1 {
+		t.Errorf("%d writes after the failure", len(f.writes)-1)
+		t.Fail()
+	}
+
+	// Close reports the failed last chunk, the stream reads as truncated
+	f = &failingWriter{n: 2}
+	w, _ = NewEncryptingWriter(key, f, nil)
+	w.Write(chunk)
+	if err := w.Close(); err != errFailingWriter {
+		t.Errorf("Close: expected %v, got %v", errFailingWriter, err)
+		t.Fail()
+	}
+	if len(f.writes) != 2 || len(f.writes[1]) != blockSize+StreamChunkSize {
+		t.Errorf("unexpected writes %d", len(f.writes))
+		t.Fail()
+	}
+	r, _ := NewDecryptingReader(key, bytes.NewReader(append(f.writes[0], f.writes[1]...)), nil)
+	if _, err := io.ReadAll(r); !errors.Is(err, ErrCiphertextTooShort) {
+		t.Errorf("stream without the last chunk: %v", err)
+		t.Fail()
+	}
+}
+
+func panics(f func()) (panicked bool) {
+	defer func() {
+		panicked = recover() != nil
+	}()
+	f()
+	return false
+}
@@ -0,0 +1,475 @@
+package siv
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+/*
+Streaming encryption of data too large to hold in memory. The plaintext is split
+into chunks of StreamChunkSize bytes and every chunk is sealed with AES-SIV on its
+own:
+
+	header   = version (1 byte) || stream nonce (16 random bytes)
+	chunk i  = SIV(K, AD1, ..., ADn, header, i (8 bytes, big endian) || last (1 byte), P_i)
+
+All chunks but the last hold exactly StreamChunkSize bytes, the last one is shorter
+and may be empty, so the end of the stream is always marked. Reordered or dropped
+chunks fail on the index, a truncated stream on the last flag, and the random
+stream nonce keeps chunks of one stream out of another one sealed with the same key.
+A failed chunk stops the reader, the plaintext returned before stays valid but is
+a prefix of the stream only.
+
+Streams of NewFlushingWriter have version 2 and frame every chunk, as Flush writes
+chunks shorter than StreamChunkSize before the end:
+
+	frame i  = last (1 byte) || length of chunk i (4 bytes, big endian) || chunk i
+
+The first byte of the frame tells the reader which last flag to authenticate the
+chunk with, so a stream cut after any frame but the last one is truncated.
+*/
+
+const (
+	StreamChunkSize = 64 * 1024
+
+	streamVersion         = 1
+	streamVersionFramed   = 2
+	streamNonceSize       = 16
+	streamHeaderSize      = 1 + streamNonceSize
+	streamFrameHeaderSize = 5
+)
+
+var (
+	errStreamVersion   = NewError(ErrUnsupportedVersion, "unknown stream version")
+	errStreamTruncated = NewError(ErrCiphertextTooShort, "stream is truncated")
+	errStreamClosed    = errors.New("siv: write to a closed stream")
+	errStreamFrame     = NewError(ErrMalformed, "stream frame is malformed")
+	errStreamTrailing  = NewError(ErrMalformed, "stream has data after the last chunk")
+	errStreamNoFlush   = errors.New("siv: only streams of NewFlushingWriter can be flushed")
+)
+
+/*
+FlushingWriter is an encrypting writer that can seal the buffered data before a
+chunk is full
+*/
+type FlushingWriter interface {
+	io.WriteCloser
+	// Flush seals and writes the buffered data as a chunk of its own, it does
+	// nothing if no data is buffered
+	Flush() error
+}
+
+type encryptingWriter struct {
+	aead   *aessiv
+	w      io.Writer
+	aad    [][]byte
+	buf    []byte
+	sealed []byte
+	index  uint64
+	framed bool
+	closed bool
+	err    error
+	span   streamSpan
+}
+
+/*
+NewEncryptingWriter writes the header to w and returns a writer sealing the data
+written to it in chunks. Close must be called to write the last chunk, it doesn't
+close w. The first error writing to w is sticky, every later Write and Close
+returns it, the stream is incomplete then. WithCompression compresses the stream,
+WithTracing reports it to a span.
+*/
+func NewEncryptingWriter(key []byte, w io.Writer, additionalData [][]byte, opts ...StreamOption) (io.WriteCloser, error) {
+	return newStreamWriter(key, w, additionalData, false, opts)
+}
+
+/*
+NewFlushingWriter is NewEncryptingWriter for interactive streams, e.g. chat or
+telemetry, whose data must reach the reader before a chunk is full. It writes the
+framed version 2 format, which NewDecryptingReader opens like the other one. Every
+Flush costs a tag and a frame header, 21 bytes.
+*/
+func NewFlushingWriter(key []byte, w io.Writer, additionalData [][]byte, opts ...StreamOption) (FlushingWriter, error) {
+	return newStreamWriter(key, w, additionalData, true, opts)
+}
+
+func newStreamWriter(key []byte, w io.Writer, additionalData [][]byte, framed bool, opts []StreamOption) (FlushingWriter, error) {
+	o, err := newStreamOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	e, err := newEncryptingWriter(key, w, additionalData, framed, o)
+	if err != nil {
+		return nil, err
+	}
+	if o.compression != 0 {
+		return newCompressingWriter(e), nil
+	}
+	return e, nil
+}
+
+func newEncryptingWriter(key []byte, w io.Writer, additionalData [][]byte, framed bool, o *streamOptions) (*encryptingWriter, error) {
+	if len(additionalData)+2 > MaxAssociatedData {
+		return nil, errTooManyAAD
+	}
+
+	aead, err := NewAesSIV(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, streamHeaderSize)
+	header[0] = streamVersion
+	if framed {
+		header[0] = streamVersionFramed
+	}
+	header[0] |= o.compression << 4
+	if err := aead.readRandom(header[1:]); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &encryptingWriter{
+		aead:   aead,
+		w:      w,
+		aad:    streamAAD(additionalData, header),
+		buf:    make([]byte, 0, StreamChunkSize),
+		sealed: make([]byte, 0, streamFrameHeaderSize+blockSize+StreamChunkSize),
+		framed: framed,
+		span:   o.startSpan(OpSeal),
+	}, nil
+}
+
+func (e *encryptingWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	if e.closed {
+		return 0, errStreamClosed
+	}
+
+	n := 0
+	for len(p) > 0 {
+		c := copy(e.buf[len(e.buf):StreamChunkSize], p)
+		e.buf = e.buf[:len(e.buf)+c]
+		p = p[c:]
+		n += c
+
+		// a full chunk is never the last one
+		if len(e.buf) == StreamChunkSize {
+			if err := e.flush(false); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+/*
+ReadFrom reads r until io.EOF straight into the chunk buffer, so io.Copy needs no
+buffer of its own. Like Write it doesn't write the last chunk, Close does.
+*/
+func (e *encryptingWriter) ReadFrom(r io.Reader) (int64, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	if e.closed {
+		return 0, errStreamClosed
+	}
+
+	var total int64
+	for {
+		n, err := r.Read(e.buf[len(e.buf):StreamChunkSize])
+		e.buf = e.buf[:len(e.buf)+n]
+		total += int64(n)
+
+		if len(e.buf) == StreamChunkSize {
+			if err := e.flush(false); err != nil {
+				return total, err
+			}
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+func (e *encryptingWriter) Flush() error {
+	if !e.framed {
+		return errStreamNoFlush
+	}
+	if e.err != nil {
+		return e.err
+	}
+	if e.closed {
+		return errStreamClosed
+	}
+	if len(e.buf) == 0 {
+		return nil
+	}
+	return e.flush(false)
+}
+
+func (e *encryptingWriter) Close() error {
+	if e.closed || e.err != nil {
+		return e.err
+	}
+	e.closed = true
+	return e.flush(true)
+}
+
+/*
+flush seals the buffered chunk into its own buffer, so the plaintext stays intact
+and a chunk is never sealed twice. Any failure is stored in e.err.
+*/
+func (e *encryptingWriter) flush(last bool) error {
+	setChunkAAD(e.aad, e.index, last)
+	sealed := e.sealed[:0]
+	if e.framed {
+		sealed = append(sealed, 0, 0, 0, 0, 0)
+		if last {
+			sealed[0] = 1
+		}
+	}
+	sealed, err := e.aead.sealWithMultipleAAD(sealed, e.buf, e.aad)
+	if err == nil && e.framed {
+		binary.BigEndian.PutUint32(sealed[1:streamFrameHeaderSize], uint32(len(sealed)-streamFrameHeaderSize))
+	}
+	if err == nil {
+		_, err = e.w.Write(sealed)
+	}
+	if err != nil {
+		e.err = err
+		e.span.finish(err)
+		return err
+	}
+	e.index++
+	e.span.chunk(len(e.buf))
+	e.buf = e.buf[:0]
+	if last {
+		e.span.finish(nil)
+	}
+	return nil
+}
+
+type decryptingReader struct {
+	aead      *aessiv
+	r         io.Reader
+	aad       [][]byte
+	buf       []byte
+	plaintext []byte
+	index     uint64
+	framed    bool
+	last      bool
+	err       error
+	span      streamSpan
+}
+
+/*
+NewDecryptingReader returns a reader opening the stream read from r, of
+NewEncryptingWriter or NewFlushingWriter. Read returns io.EOF only after the last
+chunk was authenticated, any other failure is sticky. Compressed streams are
+rejected unless WithAllowedCompression allows them, WithTracing reports the stream
+to a span.
+*/
+func NewDecryptingReader(key []byte, r io.Reader, additionalData [][]byte, opts ...StreamOption) (io.Reader, error) {
+	if len(additionalData)+2 > MaxAssociatedData {
+		return nil, errTooManyAAD
+	}
+	o, err := newStreamOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := NewAesSIV(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errStreamTruncated
+		}
+		return nil, err
+	}
+	version := header[0] & 0x0f
+	if version != streamVersion && version != streamVersionFramed {
+		return nil, errStreamVersion
+	}
+	compression := header[0] >> 4
+	if err := o.checkCompression(compression); err != nil {
+		return nil, err
+	}
+
+	d := &decryptingReader{
+		aead:   aead,
+		r:      r,
+		aad:    streamAAD(additionalData, header),
+		buf:    make([]byte, blockSize+StreamChunkSize),
+		framed: version == streamVersionFramed,
+		span:   o.startSpan(OpOpen),
+	}
+	if compression != 0 {
+		return newDecompressingReader(d), nil
+	}
+	return d, nil
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	for len(d.plaintext) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.err = d.next()
+	}
+
+	n := copy(p, d.plaintext)
+	d.plaintext = d.plaintext[n:]
+	return n, nil
+}
+
+/*
+WriteTo writes the opened chunks to w as they are authenticated, without copying
+them through an intermediate buffer. It returns nil once the last chunk was written.
+*/
+func (d *decryptingReader) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for {
+		if len(d.plaintext) > 0 {
+			n, err := w.Write(d.plaintext)
+			d.plaintext = d.plaintext[n:]
+			total += int64(n)
+			if err == nil && len(d.plaintext) > 0 {
+				err = io.ErrShortWrite
+			}
+			if err != nil {
+				return total, err
+			}
+		}
+
+		if d.err == io.EOF {
+			return total, nil
+		}
+		if d.err != nil {
+			return total, d.err
+		}
+		d.err = d.next()
+	}
+}
+
+/*
+next opens the following chunk into d.plaintext, the span ends with the first error
+*/
+func (d *decryptingReader) next() error {
+	err := d.open()
+	if err == io.EOF {
+		d.span.finish(nil)
+	} else if err != nil {
+		d.span.finish(err)
+	} else {
+		d.span.chunk(len(d.plaintext))
+	}
+	return err
+}
+
+func (d *decryptingReader) open() error {
+	if d.last {
+		return io.EOF
+	}
+
+	read := d.readChunk
+	if d.framed {
+		read = d.readFrame
+	}
+	n, err := read()
+	if err != nil {
+		return err
+	}
+
+	setChunkAAD(d.aad, d.index, d.last)
+	plaintext, err := d.aead.OpenWithMultipleAAD(d.buf[:0], d.buf[:n], d.aad)
+	if err != nil {
+		return err
+	}
+	if d.framed && d.last {
+		// nothing authenticates data after the last frame
+		var b [1]byte
+		if m, _ := io.ReadFull(d.r, b[:]); m != 0 {
+			return errStreamTrailing
+		}
+	}
+	d.index++
+	d.plaintext = plaintext
+	return nil
+}
+
+/*
+readChunk reads the next chunk of a version 1 stream into d.buf. The last chunk is
+the one ending before a full chunk was read, so data appended to the stream becomes
+part of it and fails to authenticate.
+*/
+func (d *decryptingReader) readChunk() (int, error) {
+	n, err := io.ReadFull(d.r, d.buf)
+	switch err {
+	case nil:
+	case io.ErrUnexpectedEOF:
+		d.last = true
+	case io.EOF:
+		return 0, errStreamTruncated
+	default:
+		return 0, err
+	}
+	return n, nil
+}
+
+/*
+readFrame reads the next frame of a version 2 stream into d.buf
+*/
+func (d *decryptingReader) readFrame() (int, error) {
+	var header [streamFrameHeaderSize]byte
+	if _, err := io.ReadFull(d.r, header[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, errStreamTruncated
+		}
+		return 0, err
+	}
+
+	n := binary.BigEndian.Uint32(header[1:])
+	if header[0] > 1 || n < blockSize || n > uint32(len(d.buf)) {
+		return 0, errStreamFrame
+	}
+	if _, err := io.ReadFull(d.r, d.buf[:n]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, errStreamTruncated
+		}
+		return 0, err
+	}
+
+	d.last = header[0] == 1
+	return int(n), nil
+}
+
+/*
+streamAAD appends the header and room for the chunk index and last flag
+*/
+func streamAAD(additionalData [][]byte, header []byte) [][]byte {
+	aad := make([][]byte, 0, len(additionalData)+2)
+	aad = append(aad, additionalData...)
+	return append(aad, header, make([]byte, 9))
+}
+
+func setChunkAAD(aad [][]byte, index uint64, last bool) {
+	chunk := aad[len(aad)-1]
+	binary.BigEndian.PutUint64(chunk, index)
+	chunk[8] = 0
+	if last {
+		chunk[8] = 1
+	}
+}
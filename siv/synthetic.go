@@ -0,0 +1,60 @@
+package siv
+
+import (
+	"errors"
+	"github.com/luc-lynx/siv/prf"
+)
+
+/*
+Synthetic nonces for other AEADs. Code that has to stay on AES-GCM or
+ChaCha20-Poly1305 can derive the nonce from the message instead of a counter or
+random source:
+
+	nonce, err := siv.SyntheticNonce(macKey, gcm.NonceSize(), plaintext, [][]byte{ad})
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, ad)
+
+	nonce = S2V(K, "siv synthetic nonce", AD1, ..., ADn, P) truncated to size
+
+A nonce then only repeats for the same plaintext and associated data, so reusing a
+nonce reveals that a message was sent twice but doesn't break the AEAD, like with
+AES-SIV. The nonce has to be sent with the ciphertext, the receiver can't derive it.
+The collision bound of the truncated nonce stays: with 12 byte nonces keep well
+below 2^48 distinct messages per key. K is a CMAC key of 16, 24 or 32 bytes and must
+be independent of the AEAD key.
+*/
+
+var (
+	errSyntheticNonceSize = errors.New("siv: synthetic nonces are 1 to 16 bytes long")
+	syntheticNonceLabel   = []byte("siv synthetic nonce")
+)
+
+func SyntheticNonce(key []byte, size int, plaintext []byte, additionalData [][]byte) ([]byte, error) {
+	if size < 1 || size > blockSize {
+		return nil, errSyntheticNonceSize
+	}
+
+	aad := withLabel(syntheticNonceLabel, additionalData)
+	if len(aad) > MaxAssociatedData {
+		return nil, errTooManyAAD
+	}
+
+	mac, err := prf.CMAC(key)
+	if err != nil {
+		return nil, err
+	}
+
+	v := s2vPRF(mac, aad, plaintext)
+	return v[:size], nil
+}
+
+/*
+withLabel prepends the label without touching the caller's slice
+*/
+func withLabel(label []byte, additionalData [][]byte) [][]byte {
+	aad := make([][]byte, 0, len(additionalData)+1)
+	aad = append(aad, label)
+	return append(aad, additionalData...)
+}
@@ -0,0 +1,84 @@
+package siv
+
+import (
+	"errors"
+	"time"
+)
+
+var errOptionQuantum = errors.New("siv: time quantum must not be negative")
+
+/*
+WithUniformFailureTiming makes Open do the CTR and S2V work even for ciphertexts
+that are too short, so a rejected malformed input takes about as long as a
+rejected forgery of the minimal length. The time still depends on the length of
+the input and of the associated data, which an attacker knows anyway.
+*/
+func WithUniformFailureTiming() Option {
+	return func(a *aessiv) error {
+		a.uniformTiming = true
+		return nil
+	}
+}
+
+/*
+SetUniformFailureTiming switches the behaviour of WithUniformFailureTiming on or off.
+
+Deprecated: use WithUniformFailureTiming, which configures the AEAD before it can
+be shared; this setter isn't synchronized with Open.
+*/
+func (a *aessiv) SetUniformFailureTiming(on bool) {
+	a.uniformTiming = on
+}
+
+/*
+dummyOpen opens the ciphertext padded to the minimal length and discards the result
+*/
+func (a aessiv) dummyOpen(ciphertext []byte, additionalData [][]byte) {
+	padded := make([]byte, blockSize)
+	copy(padded, ciphertext)
+	plaintext, _ := a.open(nil, padded, additionalData)
+	clear(plaintext)
+}
+
+/*
+WithTimeQuantum makes Seal and Open return only after a multiple of q has passed
+since the call, 0 switches it off. With a quantum above the time of the largest
+expected operation every call takes the same time, so neither the length of the
+plaintext nor the reason of a failure shows in the latency, at the price of
+throughput. Pick the quantum from measurements on the target machine, an operation
+that takes longer moves to the next multiple and becomes distinguishable again.
+
+The primitives are constant time already: AES and CTR come from crypto/aes, S2V
+doubling and the tag comparison from the ct and crypto/subtle packages. Combine
+with WithUniformFailureTiming so short inputs do the same work as forgeries.
+*/
+func WithTimeQuantum(q time.Duration) Option {
+	return func(a *aessiv) error {
+		if q < 0 {
+			return errOptionQuantum
+		}
+		a.quantum = q
+		return nil
+	}
+}
+
+/*
+SetTimeQuantum sets the quantum of WithTimeQuantum, a negative q switches it off.
+
+Deprecated: use WithTimeQuantum. Not safe to call concurrently with Seal and Open.
+*/
+func (a *aessiv) SetTimeQuantum(q time.Duration) {
+	if q < 0 {
+		q = 0
+	}
+	a.quantum = q
+}
+
+func (a aessiv) padTime(start time.Time) {
+	if a.quantum == 0 {
+		return
+	}
+	if r := time.Since(start) % a.quantum; r != 0 {
+		time.Sleep(a.quantum - r)
+	}
+}
@@ -0,0 +1,82 @@
+package siv
+
+/*
+StreamTrace describes a whole streaming seal or open, for a span around it. Like
+AuditEvent it holds sizes only.
+*/
+type StreamTrace struct {
+	Operation string
+	// KeyID is the one given to WithTracing
+	KeyID  string
+	Chunks uint64
+	// Bytes counts the plaintext of the chunks, the compressed data of a compressed stream
+	Bytes int64
+	// Err is nil for a stream sealed or opened up to the last chunk
+	Err error
+}
+
+/*
+StreamTracer starts a span when a stream writer or reader is created and returns
+the function ending it, which is called once with the totals: by the writer on
+Close or its first error, by the reader on io.EOF or its first error. A stream
+abandoned before never ends its span. With OpenTelemetry:
+
+	tracer := func(op, keyID string) func(siv.StreamTrace) {
+		_, span := otel.Tracer("siv").Start(ctx, "siv stream "+op)
+		return func(t siv.StreamTrace) {
+			span.SetAttributes(
+				attribute.String("siv.key_id", t.KeyID),
+				attribute.Int64("siv.chunks", int64(t.Chunks)),
+				attribute.Int64("siv.bytes", t.Bytes))
+			if t.Err != nil {
+				span.RecordError(t.Err)
+			}
+			span.End()
+		}
+	}
+*/
+type StreamTracer func(operation, keyID string) func(StreamTrace)
+
+/*
+WithTracing reports the stream to tracer, keyID is passed as is like the one of
+WithAudit. A nil tracer turns tracing off.
+*/
+func WithTracing(tracer StreamTracer, keyID string) StreamOption {
+	return func(o *streamOptions) error {
+		o.tracer = tracer
+		o.keyID = keyID
+		return nil
+	}
+}
+
+/*
+streamSpan accumulates the totals of a traced stream, the zero value doesn't trace
+*/
+type streamSpan struct {
+	trace StreamTrace
+	end   func(StreamTrace)
+}
+
+func (o *streamOptions) startSpan(operation string) streamSpan {
+	if o.tracer == nil {
+		return streamSpan{}
+	}
+	return streamSpan{
+		trace: StreamTrace{Operation: operation, KeyID: o.keyID},
+		end:   o.tracer(operation, o.keyID),
+	}
+}
+
+func (s *streamSpan) chunk(n int) {
+	s.trace.Chunks++
+	s.trace.Bytes += int64(n)
+}
+
+func (s *streamSpan) finish(err error) {
+	if s.end == nil {
+		return
+	}
+	s.trace.Err = err
+	s.end(s.trace)
+	s.end = nil
+}
@@ -0,0 +1,172 @@
+package siv
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/luc-lynx/siv/cmac"
+	"sync"
+)
+
+/*
+Truncated-tag AES-SIV for links that can't afford 16 bytes per message.
+It is NOT RFC 5297 and doesn't interoperate with other implementations.
+
+Only the first tagSize bytes of the synthetic IV are sent. The CTR IV is that
+prefix padded with zeros (and masked as in RFC 5297), so Open can rebuild it.
+The security is reduced accordingly:
+  - a forgery succeeds with probability 2^-(8*tagSize) per attempt
+  - two different messages get the same CTR IV, and leak the XOR of their
+    plaintexts, after about 2^(4*tagSize) messages; with 8 byte tags keep the
+    number of messages per key well below 2^32
+*/
+
+const (
+	MinTruncatedTagSize = 8
+	MaxTruncatedTagSize = blockSize
+)
+
+var (
+	errTagSizeNotSupported = errors.New("truncated tag size must be between 8 and 16 bytes")
+	errFIPSTagSize         = errors.New("siv: FIPS mode requires 16 byte tags")
+)
+
+type truncatedSIV struct {
+	key     []byte
+	tagSize int
+
+	ctr       cipher.Block
+	mac       *cmac.Keyed
+	scratch   *sync.Pool
+	destroyed bool
+}
+
+/*
+NewTruncatedAesSIV creates AES-SIV with tagSize byte tags, see the security
+notes above. Keys are the same as for NewAesSIV. The FIPS mode only accepts
+MaxTruncatedTagSize, tags are never shorter than 128 bits there.
+*/
+func NewTruncatedAesSIV(key []byte, tagSize int) (*truncatedSIV, error) {
+	if tagSize < MinTruncatedTagSize || tagSize > MaxTruncatedTagSize {
+		return nil, errTagSizeNotSupported
+	}
+	if FIPSMode() && tagSize != MaxTruncatedTagSize {
+		return nil, errFIPSTagSize
+	}
+
+	s, err := NewAesSIV(key)
+	if err != nil {
+		return nil, err
+	}
+	return &truncatedSIV{key: s.key, tagSize: tagSize, ctr: s.ctr, mac: s.mac, scratch: s.scratch}, nil
+}
+
+func (a truncatedSIV) NonceSize() int {
+	return 0
+}
+
+func (a truncatedSIV) Overhead() int {
+	return a.tagSize
+}
+
+func (a truncatedSIV) Algorithm() string {
+	return fmt.Sprintf("%s-T%d", aessiv{key: a.key}.Algorithm(), a.tagSize*8)
+}
+
+func (a truncatedSIV) String() string {
+	return fmt.Sprintf("%s (key %d bits, truncated tag %d bits)", a.Algorithm(), len(a.key)*8, a.tagSize*8)
+}
+
+func (a truncatedSIV) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	return a.SealWithMultipleAAD(dst, plaintext, [][]byte{additionalData})
+}
+
+func (a truncatedSIV) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	return a.OpenWithMultipleAAD(dst, ciphertext, [][]byte{additionalData})
+}
+
+/*
+SealWithMultipleAAD panics if the key is invalid like aessiv's, SealContext returns the error
+*/
+func (a truncatedSIV) SealWithMultipleAAD(dst, plaintext []byte, additionalData [][]byte) []byte {
+	ret, err := a.seal(dst, plaintext, additionalData)
+	if err != nil {
+		panic(err.Error())
+	}
+	return ret
+}
+
+/*
+seal and open operate in place like aessiv's and share its scratch state
+*/
+func (a truncatedSIV) seal(dst, plaintext []byte, additionalData [][]byte) ([]byte, error) {
+	if len(additionalData) > MaxAssociatedData {
+		return nil, errTooManyAAD
+	}
+
+	base := a.base()
+	s, err := base.getScratch()
+	if err != nil {
+		return nil, err
+	}
+	defer base.putScratch(s)
+
+	s2vInto(s.mac, s.d[:], s.block[:], additionalData, plaintext)
+
+	checkOverlap(dst, a.tagSize+len(plaintext), plaintext)
+	ret, out := sliceForAppend(dst, a.tagSize+len(plaintext))
+	c := out[a.tagSize:]
+	copy(c, plaintext)
+	a.counterInto(s.iv[:], s.d[:])
+	s.xorKeyStream(c)
+	copy(out, s.d[:a.tagSize])
+	return ret, nil
+}
+
+func (a truncatedSIV) OpenWithMultipleAAD(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error) {
+	if len(ciphertext) < a.tagSize {
+		return nil, ErrCiphertextTooShort
+	}
+	if len(additionalData) > MaxAssociatedData {
+		return nil, errTooManyAAD
+	}
+
+	base := a.base()
+	s, err := base.getScratch()
+	if err != nil {
+		return nil, err
+	}
+	defer base.putScratch(s)
+
+	// the output may overwrite the tag
+	tag := s.v[:a.tagSize]
+	copy(tag, ciphertext)
+
+	checkOverlap(dst, len(ciphertext)-a.tagSize, ciphertext)
+	ret, plaintext := sliceForAppend(dst, len(ciphertext)-a.tagSize)
+	copy(plaintext, ciphertext[a.tagSize:])
+	a.counterInto(s.iv[:], tag)
+	s.xorKeyStream(plaintext)
+
+	s2vInto(s.mac, s.d[:], s.block[:], additionalData, plaintext)
+	if subtle.ConstantTimeCompare(s.d[:a.tagSize], tag) == 1 {
+		return ret, nil
+	}
+
+	clear(plaintext)
+	return nil, errIntegrityError
+}
+
+/*
+counterInto pads the tag with zeros and applies the RFC 5297 mask
+*/
+func (a truncatedSIV) counterInto(iv, tag []byte) {
+	clear(iv)
+	copy(iv, tag[:a.tagSize])
+	maskInto(iv, iv, mask)
+}
+
+func (a truncatedSIV) base() aessiv {
+	return aessiv{key: a.key, ctr: a.ctr, mac: a.mac, scratch: a.scratch, destroyed: a.destroyed}
+}
@@ -0,0 +1,332 @@
+package sivcheck
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+	"strings"
+)
+
+const doc = `check for misuse of the siv and cmac packages
+
+The analyzer reports
+  - keys hardcoded as literals (directly or through a variable initialized once)
+    outside of test files,
+  - one key used both for the deterministic AEAD and for CMAC tokens/MACs,
+  - non-nil nonces passed to Seal/Open, AES-SIV ignores them,
+  - nil nonces passed to Seal/Open of nonce-based AES-SIV,
+  - Seal/Open calls without associated data.`
+
+const (
+	sivPackage    = "github.com/luc-lynx/siv/siv"
+	cmacPackage   = "github.com/luc-lynx/siv/cmac"
+	keysetPackage = "github.com/luc-lynx/siv/keyset"
+
+	purposeAEAD = "deterministic encryption"
+	purposeMAC  = "MAC/token generation"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "sivcheck",
+	Doc:      doc,
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+/*
+Functions taking a key as the first argument and the purpose the key is used for
+*/
+var keyFunctions = map[string]string{
+	sivPackage + ".NewAesSIV":      purposeAEAD,
+	keysetPackage + ".NewSIVKEK":   purposeAEAD,
+	cmacPackage + ".NewCmac":       purposeMAC,
+	cmacPackage + ".NewKeyed":      purposeMAC,
+	cmacPackage + ".Sum":           purposeMAC,
+	sivPackage + ".SyntheticNonce": purposeMAC,
+	sivPackage + ".S2V":            purposeMAC,
+	sivPackage + ".NewS2VWriter":   purposeMAC,
+}
+
+/*
+Methods of the AEAD type with positions of the nonce and associated data arguments,
+-1 if there is no such argument
+*/
+var aeadMethods = map[string][2]int{
+	"Seal":                {1, 3},
+	"Open":                {1, 3},
+	"SealWithMultipleAAD": {-1, 2},
+	"OpenWithMultipleAAD": {-1, 2},
+	"SealDetached":        {-1, 2},
+	"OpenDetached":        {-1, 3},
+	"SealDeterministic":   {-1, 2},
+	"OpenDeterministic":   {-1, 2},
+}
+
+type keyUse struct {
+	purpose string
+	pos     token.Pos
+}
+
+type checker struct {
+	pass *analysis.Pass
+	// initializers of variables assigned exactly once
+	inits       map[types.Object]ast.Expr
+	assignments map[types.Object]int
+	keyUses     map[types.Object]keyUse
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	c := &checker{
+		pass:        pass,
+		inits:       make(map[types.Object]ast.Expr),
+		assignments: make(map[types.Object]int),
+		keyUses:     make(map[types.Object]keyUse),
+	}
+
+	inspect.Preorder([]ast.Node{(*ast.ValueSpec)(nil), (*ast.AssignStmt)(nil)}, c.collectAssignments)
+	inspect.Preorder([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node) {
+		c.checkCall(n.(*ast.CallExpr))
+	})
+	return nil, nil
+}
+
+func (c *checker) collectAssignments(n ast.Node) {
+	switch n := n.(type) {
+	case *ast.ValueSpec:
+		for i, name := range n.Names {
+			obj := c.pass.TypesInfo.Defs[name]
+			if obj == nil {
+				continue
+			}
+			if len(n.Values) == len(n.Names) {
+				c.inits[obj] = n.Values[i]
+			} else if len(n.Values) == 1 && i == 0 {
+				// key, err := hex.DecodeString("...")
+				c.inits[obj] = n.Values[0]
+			}
+			c.assignments[obj]++
+		}
+	case *ast.AssignStmt:
+		for i, lhs := range n.Lhs {
+			id, ok := lhs.(*ast.Ident)
+			if !ok {
+				continue
+			}
+
+			obj := c.pass.TypesInfo.ObjectOf(id)
+			if obj == nil {
+				continue
+			}
+			c.assignments[obj]++
+
+			if n.Tok != token.DEFINE || c.pass.TypesInfo.Defs[id] == nil {
+				continue
+			}
+			if len(n.Rhs) == len(n.Lhs) {
+				c.inits[obj] = n.Rhs[i]
+			} else if len(n.Rhs) == 1 && i == 0 {
+				c.inits[obj] = n.Rhs[0]
+			}
+		}
+	}
+}
+
+func (c *checker) checkCall(call *ast.CallExpr) {
+	fn, ok := typeutil.Callee(c.pass.TypesInfo, call).(*types.Func)
+	if !ok || fn.Pkg() == nil {
+		return
+	}
+
+	if purpose, ok := keyFunctions[fn.Pkg().Path()+"."+fn.Name()]; ok && isPackageFunc(fn) && len(call.Args) > 0 {
+		c.checkKey(fn, call.Args[0], purpose)
+		return
+	}
+
+	positions, ok := aeadMethods[fn.Name()]
+	if !ok {
+		return
+	}
+	aead := aeadType(fn)
+	if aead == "aessiv" {
+		aead = c.constructedAs(call)
+	}
+	if aead == "" {
+		return
+	}
+
+	if nonce := positions[0]; nonce >= 0 && nonce < len(call.Args) {
+		switch noNonce := c.isNil(call.Args[nonce]); {
+		case aead == "aessiv" && !noNonce:
+			c.pass.Reportf(call.Args[nonce].Pos(), "nonce passed to %s is ignored by AES-SIV, pass the value as associated data or use siv.NewNonceAesSIV", fn.Name())
+		case aead == "nonceSIV" && noNonce:
+			c.pass.Reportf(call.Args[nonce].Pos(), "nil nonce passed to %s of nonce-based AES-SIV", fn.Name())
+		}
+	}
+
+	// the associated data of SealDeterministic and OpenDeterministic is variadic
+	aad := positions[1]
+	omitted := aad == len(call.Args) && fn.Type().(*types.Signature).Variadic()
+	if omitted || aad < len(call.Args) && c.isEmpty(call.Args[aad]) {
+		c.pass.Reportf(call.Pos(), "%s is called without associated data, bind the context of the message to the ciphertext", fn.Name())
+	}
+}
+
+func (c *checker) checkKey(fn *types.Func, key ast.Expr, purpose string) {
+	key = ast.Unparen(key)
+	if c.isConstantKey(key, 0) && !c.inTestFile(key) {
+		c.pass.Reportf(key.Pos(), "hardcoded key passed to %s.%s", fn.Pkg().Name(), fn.Name())
+	}
+
+	id, ok := key.(*ast.Ident)
+	if !ok {
+		return
+	}
+
+	obj := c.pass.TypesInfo.ObjectOf(id)
+	if obj == nil {
+		return
+	}
+
+	if use, ok := c.keyUses[obj]; ok && use.purpose != purpose {
+		c.pass.Reportf(key.Pos(), "key %s is used for %s and for %s at %s, derive separate keys instead",
+			id.Name, purpose, use.purpose, c.pass.Fset.Position(use.pos))
+		return
+	}
+	c.keyUses[obj] = keyUse{purpose: purpose, pos: key.Pos()}
+}
+
+/*
+isConstantKey reports whether the expression is a byte slice literal of constants,
+a conversion or decoding of a constant string or a variable initialized with one of those.
+*/
+func (c *checker) isConstantKey(e ast.Expr, depth int) bool {
+	if depth > 4 {
+		return false
+	}
+
+	switch e := ast.Unparen(e).(type) {
+	case *ast.CompositeLit:
+		if len(e.Elts) == 0 {
+			return false
+		}
+		for _, elt := range e.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				elt = kv.Value
+			}
+			if c.pass.TypesInfo.Types[elt].Value == nil {
+				return false
+			}
+		}
+		return true
+	case *ast.CallExpr:
+		if len(e.Args) != 1 || c.pass.TypesInfo.Types[e.Args[0]].Value == nil {
+			return false
+		}
+		if c.pass.TypesInfo.Types[e.Fun].IsType() {
+			return true
+		}
+		fn, ok := typeutil.Callee(c.pass.TypesInfo, e).(*types.Func)
+		if !ok || fn.Pkg() == nil {
+			return false
+		}
+		name := fn.Pkg().Path() + "." + fn.Name()
+		return name == "encoding/hex.DecodeString" || fn.Name() == "DecodeString" && fn.Pkg().Path() == "encoding/base64"
+	case *ast.Ident:
+		obj := c.pass.TypesInfo.ObjectOf(e)
+		init, ok := c.inits[obj]
+		if !ok || c.assignments[obj] != 1 {
+			return false
+		}
+		return c.isConstantKey(init, depth+1)
+	}
+	return false
+}
+
+/*
+Known answer tests legitimately use hardcoded keys
+*/
+func (c *checker) inTestFile(e ast.Expr) bool {
+	return strings.HasSuffix(c.pass.Fset.Position(e.Pos()).Filename, "_test.go")
+}
+
+func (c *checker) isNil(e ast.Expr) bool {
+	return c.pass.TypesInfo.Types[ast.Unparen(e)].IsNil()
+}
+
+func (c *checker) isEmpty(e ast.Expr) bool {
+	if c.isNil(e) {
+		return true
+	}
+	lit, ok := ast.Unparen(e).(*ast.CompositeLit)
+	return ok && len(lit.Elts) == 0
+}
+
+func isPackageFunc(fn *types.Func) bool {
+	return fn.Type().(*types.Signature).Recv() == nil
+}
+
+/*
+constructedAs looks at the siv.NewAesSIV call the receiver of an aessiv method was
+assigned from: with a WithNonceSize option the AEAD is nonce-based, with options
+passed as a slice its nonce handling is unknown and only the associated data is checked
+*/
+func (c *checker) constructedAs(call *ast.CallExpr) string {
+	sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr)
+	if !ok {
+		return "aessiv"
+	}
+	id, ok := ast.Unparen(sel.X).(*ast.Ident)
+	if !ok {
+		return "aessiv"
+	}
+	obj := c.pass.TypesInfo.ObjectOf(id)
+	init, ok := c.inits[obj].(*ast.CallExpr)
+	if !ok || c.assignments[obj] != 1 || !c.isSivFunc(init, "NewAesSIV") {
+		return "aessiv"
+	}
+
+	if init.Ellipsis.IsValid() {
+		return "unknown"
+	}
+	for _, arg := range init.Args[1:] {
+		if opt, ok := ast.Unparen(arg).(*ast.CallExpr); ok && c.isSivFunc(opt, "WithNonceSize") {
+			return "nonceSIV"
+		}
+	}
+	return "aessiv"
+}
+
+func (c *checker) isSivFunc(call *ast.CallExpr, name string) bool {
+	fn, ok := typeutil.Callee(c.pass.TypesInfo, call).(*types.Func)
+	return ok && fn.Pkg() != nil && fn.Pkg().Path() == sivPackage && fn.Name() == name
+}
+
+/*
+aeadType returns the name of the siv AEAD type the method belongs to, "aessiv" or
+"nonceSIV", or an empty string for other methods
+*/
+func aeadType(fn *types.Func) string {
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil || fn.Pkg().Path() != sivPackage {
+		return ""
+	}
+
+	t := recv.Type()
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	named, ok := t.(*types.Named)
+	if !ok {
+		return ""
+	}
+	switch name := named.Obj().Name(); name {
+	case "aessiv", "nonceSIV":
+		return name
+	}
+	return ""
+}
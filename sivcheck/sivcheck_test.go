@@ -0,0 +1,10 @@
+package sivcheck
+
+import (
+	"golang.org/x/tools/go/analysis/analysistest"
+	"testing"
+)
+
+func TestAnalyzer(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "a")
+}
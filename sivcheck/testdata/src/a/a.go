@@ -0,0 +1,86 @@
+package a
+
+import (
+	"encoding/hex"
+	"github.com/luc-lynx/siv/cmac"
+	"github.com/luc-lynx/siv/siv"
+	"os"
+)
+
+var packageKey = []byte{0x01, 0x02, 0x03, 0x04}
+
+func hardcoded() {
+	siv.NewAesSIV([]byte{0x00, 0x01})             // want `hardcoded key passed to siv.NewAesSIV`
+	siv.NewAesSIV([]byte("0123456789abcdef0123")) // want `hardcoded key passed to siv.NewAesSIV`
+	cmac.Sum(packageKey, nil)                     // want `hardcoded key passed to cmac.Sum`
+
+	key, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	cmac.NewCmac(key)  // want `hardcoded key passed to cmac.NewCmac`
+	cmac.NewKeyed(key) // want `hardcoded key passed to cmac.NewKeyed`
+
+	loaded, _ := os.ReadFile("key")
+	cmac.NewCmac(loaded)
+
+	reassigned := []byte{0x01}
+	reassigned, _ = os.ReadFile("key")
+	cmac.NewCmac(reassigned)
+}
+
+func reuse(key []byte) {
+	s, _ := siv.NewAesSIV(key)
+	_ = s
+	cmac.Sum(key, []byte("token")) // want `key key is used for MAC/token generation and for deterministic encryption`
+}
+
+func separateKeys(encKey, macKey []byte) {
+	siv.NewAesSIV(encKey)
+	cmac.Sum(macKey, nil)
+	cmac.NewCmac(macKey)
+}
+
+func calls(key, nonce, ad []byte) {
+	s, _ := siv.NewAesSIV(key)
+
+	s.Seal(nil, nonce, []byte("pt"), ad) // want `nonce passed to Seal is ignored by AES-SIV`
+	s.Open(nil, nil, []byte("ct"), nil)  // want `Open is called without associated data`
+	s.Seal(nil, nil, []byte("pt"), ad)
+
+	s.SealWithMultipleAAD(nil, []byte("pt"), [][]byte{}) // want `SealWithMultipleAAD is called without associated data`
+	s.OpenWithMultipleAAD(nil, []byte("ct"), nil)        // want `OpenWithMultipleAAD is called without associated data`
+	s.SealWithMultipleAAD(nil, []byte("pt"), [][]byte{ad})
+
+	s.SealDetached(nil, []byte("pt"), nil)                // want `SealDetached is called without associated data`
+	s.OpenDetached(nil, []byte("ct"), []byte("tag"), nil) // want `OpenDetached is called without associated data`
+	s.OpenDetached(nil, []byte("ct"), []byte("tag"), [][]byte{ad})
+
+	s.SealDeterministic(nil, []byte("pt"))                // want `SealDeterministic is called without associated data`
+	s.OpenDeterministic(nil, []byte("ct"), [][]byte{}...) // want `OpenDeterministic is called without associated data`
+	s.SealDeterministic(nil, []byte("pt"), ad, ad)
+}
+
+func nonceBased(key, nonce, ad []byte) {
+	s, _ := siv.NewNonceAesSIV(key)
+
+	s.Seal(nil, nonce, []byte("pt"), ad)
+	s.Seal(nil, nil, []byte("pt"), ad) // want `nil nonce passed to Seal of nonce-based AES-SIV`
+	s.Open(nil, nonce, []byte("ct"), ad)
+}
+
+func syntheticNonce(key, ad []byte) {
+	siv.NewAesSIV(key)
+	siv.SyntheticNonce(key, 12, nil, [][]byte{ad}) // want `key key is used for MAC/token generation and for deterministic encryption`
+}
+
+func options(key, nonce, ad []byte, opts []siv.Option) {
+	n, _ := siv.NewAesSIV(key, siv.WithNonceSize(12))
+	n.Seal(nil, nonce, []byte("pt"), ad)
+	n.Seal(nil, nil, []byte("pt"), ad) // want `nil nonce passed to Seal of nonce-based AES-SIV`
+
+	d, _ := siv.NewAesSIV(key, siv.WithMaxAAD(4))
+	d.Seal(nil, nonce, []byte("pt"), ad) // want `nonce passed to Seal is ignored by AES-SIV`
+
+	u, _ := siv.NewAesSIV(key, opts...)
+	u.Seal(nil, nonce, []byte("pt"), ad)
+	u.Seal(nil, nil, []byte("pt"), ad)
+	u.Open(nil, nil, []byte("ct"), nil) // want `Open is called without associated data`
+}
@@ -0,0 +1,11 @@
+package cmac
+
+import "hash"
+
+func NewCmac(key []byte) (hash.Hash, error) { return nil, nil }
+
+func Sum(key, data []byte) []byte { return nil }
+
+type Keyed struct{}
+
+func NewKeyed(key []byte) (*Keyed, error) { return &Keyed{}, nil }
@@ -0,0 +1,53 @@
+package siv
+
+type aessiv struct{}
+
+func (a aessiv) Seal(dst, nonce, plaintext, additionalData []byte) []byte { return nil }
+
+func (a aessiv) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) { return nil, nil }
+
+func (a aessiv) SealWithMultipleAAD(dst, plaintext []byte, additionalData [][]byte) []byte {
+	return nil
+}
+
+func (a aessiv) OpenWithMultipleAAD(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error) {
+	return nil, nil
+}
+
+func (a aessiv) SealDetached(dst, plaintext []byte, additionalData [][]byte) ([]byte, []byte, error) {
+	return nil, nil, nil
+}
+
+func (a aessiv) OpenDetached(dst, ciphertext, tag []byte, additionalData [][]byte) ([]byte, error) {
+	return nil, nil
+}
+
+func (a aessiv) SealDeterministic(dst, plaintext []byte, additionalData ...[]byte) []byte {
+	return nil
+}
+
+func (a aessiv) OpenDeterministic(dst, ciphertext []byte, additionalData ...[]byte) ([]byte, error) {
+	return nil, nil
+}
+
+type Option func(*aessiv) error
+
+func WithNonceSize(n int) Option { return nil }
+
+func WithMaxAAD(n int) Option { return nil }
+
+func NewAesSIV(key []byte, opts ...Option) (*aessiv, error) { return &aessiv{}, nil }
+
+type nonceSIV struct{ *aessiv }
+
+func (a nonceSIV) Seal(dst, nonce, plaintext, additionalData []byte) []byte { return nil }
+
+func (a nonceSIV) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	return nil, nil
+}
+
+func NewNonceAesSIV(key []byte) (*nonceSIV, error) { return &nonceSIV{}, nil }
+
+func SyntheticNonce(key []byte, size int, plaintext []byte, additionalData [][]byte) ([]byte, error) {
+	return nil, nil
+}
@@ -0,0 +1,174 @@
+package sivrpc
+
+import (
+	"crypto/rand"
+	"io"
+	"net/rpc"
+)
+
+/*
+Every connection starts with a handshake: the client sends sessionRandomSize random
+bytes and the server answers with its own. The session ID, client random || server
+random, is appended to the labels of both directions, so frames recorded on one
+connection don't open on another: each peer only accepts frames bound to the fresh
+random value it sent itself. The handshake isn't authenticated, a tampered random
+value makes the first frame fail.
+*/
+
+const sessionRandomSize = 16
+
+var (
+	requestLabel  = []byte("net/rpc request")
+	responseLabel = []byte("net/rpc response")
+)
+
+/*
+handshake exchanges the random values, the client writes first
+*/
+func handshake(conn io.ReadWriter, client bool) ([]byte, error) {
+	session := make([]byte, 2*sessionRandomSize)
+	own, peer := session[:sessionRandomSize], session[sessionRandomSize:]
+	if !client {
+		own, peer = peer, own
+	}
+	if _, err := rand.Read(own); err != nil {
+		return nil, err
+	}
+
+	if client {
+		if _, err := conn.Write(own); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := io.ReadFull(conn, peer); err != nil {
+		return nil, err
+	}
+	if !client {
+		if _, err := conn.Write(own); err != nil {
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+func sessionLabel(label, session []byte) []byte {
+	return append(append([]byte{}, label...), session...)
+}
+
+type clientCodec struct {
+	rwc io.ReadWriteCloser
+	enc *Encoder
+	dec *Decoder
+}
+
+/*
+NewClientCodec runs the handshake, it blocks until the server answers
+*/
+func NewClientCodec(conn io.ReadWriteCloser, key []byte) (rpc.ClientCodec, error) {
+	session, err := handshake(conn, true)
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := NewEncoder(conn, key, sessionLabel(requestLabel, session))
+	if err != nil {
+		return nil, err
+	}
+
+	dec, err := NewDecoder(conn, key, sessionLabel(responseLabel, session))
+	if err != nil {
+		return nil, err
+	}
+
+	return &clientCodec{rwc: conn, enc: enc, dec: dec}, nil
+}
+
+func (c *clientCodec) WriteRequest(r *rpc.Request, body interface{}) error {
+	return c.enc.Encode(r, body)
+}
+
+func (c *clientCodec) ReadResponseHeader(r *rpc.Response) error {
+	return c.dec.Decode(r)
+}
+
+func (c *clientCodec) ReadResponseBody(body interface{}) error {
+	return c.dec.Decode(body)
+}
+
+func (c *clientCodec) Close() error {
+	return c.rwc.Close()
+}
+
+type serverCodec struct {
+	rwc    io.ReadWriteCloser
+	enc    *Encoder
+	dec    *Decoder
+	closed bool
+}
+
+/*
+NewServerCodec runs the handshake, it blocks until the client sends its random value
+*/
+func NewServerCodec(conn io.ReadWriteCloser, key []byte) (rpc.ServerCodec, error) {
+	session, err := handshake(conn, false)
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := NewEncoder(conn, key, sessionLabel(responseLabel, session))
+	if err != nil {
+		return nil, err
+	}
+
+	dec, err := NewDecoder(conn, key, sessionLabel(requestLabel, session))
+	if err != nil {
+		return nil, err
+	}
+
+	return &serverCodec{rwc: conn, enc: enc, dec: dec}, nil
+}
+
+func (c *serverCodec) ReadRequestHeader(r *rpc.Request) error {
+	return c.dec.Decode(r)
+}
+
+func (c *serverCodec) ReadRequestBody(body interface{}) error {
+	return c.dec.Decode(body)
+}
+
+func (c *serverCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	if err := c.enc.Encode(r, body); err != nil {
+		// the stream is out of sync after a failed write, same as the gob codec in net/rpc does
+		c.Close()
+		return err
+	}
+	return nil
+}
+
+func (c *serverCodec) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.rwc.Close()
+}
+
+func NewClient(conn io.ReadWriteCloser, key []byte) (*rpc.Client, error) {
+	codec, err := NewClientCodec(conn, key)
+	if err != nil {
+		return nil, err
+	}
+	return rpc.NewClientWithCodec(codec), nil
+}
+
+/*
+ServeConn runs the server on a single connection and blocks until the client hangs up.
+*/
+func ServeConn(server *rpc.Server, conn io.ReadWriteCloser, key []byte) error {
+	codec, err := NewServerCodec(conn, key)
+	if err != nil {
+		return err
+	}
+	server.ServeCodec(codec)
+	return nil
+}
@@ -0,0 +1,236 @@
+package sivrpc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"github.com/luc-lynx/siv/siv"
+	"io"
+	"net"
+	"net/rpc"
+	"testing"
+)
+
+type Args struct {
+	A, B int
+}
+
+type Arith int
+
+func (t *Arith) Multiply(args *Args, reply *int) error {
+	*reply = args.A * args.B
+	return nil
+}
+
+func newKey(t *testing.T) []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestGob(t *testing.T) {
+	t.Run("encode/decode", testEncodeDecode)
+	t.Run("reordered frames", testReorderedFrames)
+	t.Run("wrong label", testWrongLabel)
+}
+
+func testEncodeDecode(t *testing.T) {
+	key := newKey(t)
+	label := []byte("test")
+
+	var stream bytes.Buffer
+	enc, err := NewEncoder(&stream, key, label)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := enc.Encode(Args{A: 1, B: 2}, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(Args{A: 3, B: 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	dec, err := NewDecoder(&stream, key, label)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var a Args
+	var s string
+	if err := dec.Decode(&a); err != nil || a.A != 1 || a.B != 2 {
+		t.Fatal("first value mismatch", err)
+	}
+	if err := dec.Decode(&s); err != nil || s != "hello" {
+		t.Fatal("second value mismatch", err)
+	}
+	if err := dec.Decode(&a); err != nil || a.A != 3 || a.B != 4 {
+		t.Fatal("third value mismatch", err)
+	}
+}
+
+func testReorderedFrames(t *testing.T) {
+	key := newKey(t)
+	label := []byte("test")
+
+	var first, second bytes.Buffer
+	enc, err := NewEncoder(&first, key, label)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := enc.Encode(Args{A: 1, B: 2}); err != nil {
+		t.Fatal(err)
+	}
+	enc.w = &second
+	if err := enc.Encode(Args{A: 3, B: 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	dec, err := NewDecoder(bytes.NewReader(append(second.Bytes(), first.Bytes()...)), key, label)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var a Args
+	if err := dec.Decode(&a); err == nil {
+		t.Fail()
+	}
+}
+
+func testWrongLabel(t *testing.T) {
+	key := newKey(t)
+
+	var stream bytes.Buffer
+	enc, err := NewEncoder(&stream, key, requestLabel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(Args{A: 1, B: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	dec, err := NewDecoder(&stream, key, responseLabel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var a Args
+	if err := dec.Decode(&a); err == nil {
+		t.Fail()
+	}
+}
+
+func TestRpc(t *testing.T) {
+	key := newKey(t)
+
+	server := rpc.NewServer()
+	if err := server.Register(new(Arith)); err != nil {
+		t.Fatal(err)
+	}
+
+	clientConn, serverConn := net.Pipe()
+	go ServeConn(server, serverConn, key)
+
+	client, err := NewClient(clientConn, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	for i := 0; i < 10; i++ {
+		var reply int
+		if err := client.Call("Arith.Multiply", &Args{A: i, B: 7}, &reply); err != nil {
+			t.Fatal(err)
+		}
+		if reply != i*7 {
+			t.Fatalf("unexpected reply %d", reply)
+		}
+	}
+
+	var reply int
+	if err := client.Call("Arith.Divide", &Args{A: 1, B: 7}, &reply); err == nil {
+		t.Error("call of unknown method succeeded")
+	}
+}
+
+func TestRpcWrongKey(t *testing.T) {
+	server := rpc.NewServer()
+	if err := server.Register(new(Arith)); err != nil {
+		t.Fatal(err)
+	}
+
+	clientConn, serverConn := net.Pipe()
+	go ServeConn(server, serverConn, newKey(t))
+
+	client, err := NewClient(clientConn, newKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var reply int
+	if err := client.Call("Arith.Multiply", &Args{A: 2, B: 7}, &reply); err == nil {
+		t.Fail()
+	}
+}
+
+type recordingConn struct {
+	net.Conn
+	written bytes.Buffer
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	c.written.Write(p)
+	return c.Conn.Write(p)
+}
+
+type replayConn struct {
+	io.Reader
+}
+
+func (replayConn) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (replayConn) Close() error {
+	return nil
+}
+
+/*
+The requests a client sent on one connection don't open on another one with the same key
+*/
+func TestRpcReplay(t *testing.T) {
+	key := newKey(t)
+
+	server := rpc.NewServer()
+	if err := server.Register(new(Arith)); err != nil {
+		t.Fatal(err)
+	}
+
+	clientConn, serverConn := net.Pipe()
+	go ServeConn(server, serverConn, key)
+
+	recorded := &recordingConn{Conn: clientConn}
+	client, err := NewClient(recorded, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reply int
+	if err := client.Call("Arith.Multiply", &Args{A: 2, B: 7}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	codec, err := NewServerCodec(replayConn{bytes.NewReader(recorded.written.Bytes())}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r rpc.Request
+	if err := codec.ReadRequestHeader(&r); !errors.Is(err, siv.ErrAuthentication) {
+		t.Errorf("replayed request: %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+/*
+Package stream implements the STREAM construction of Hoang, Reyhanitabar, Rogaway
+and Vizár ("Online Authenticated-Encryption and its Nonce-Reuse Misuse-Resistance")
+over AES-SIV, with the nonce layout of Miscreant. A message is sealed as a sequence
+of segments, every segment is AES-SIV with its own nonce passed as the last
+associated data string:
+
+	nonce i = prefix (8 bytes) || i (4 bytes, big endian) || last (1 byte, 0 or 1)
+	segment i = AES-SIV(K, AD_i, nonce i, P_i)
+
+Segments are opened in order as they arrive, a reordered, dropped or repeated
+segment fails, and so does a message that ends before the segment sealed as last.
+Reusing a prefix with the same key only reveals which segments at the same
+position are equal, the misuse resistance of AES-SIV carries over.
+*/
+package stream
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/luc-lynx/siv/siv"
+	"math"
+)
+
+const (
+	// NoncePrefixSize is the size of the nonce given to NewEncryptor and NewDecryptor
+	NoncePrefixSize = 8
+
+	nonceSize = NoncePrefixSize + 4 + 1
+)
+
+var (
+	errNoncePrefixSize = errors.New("stream: nonce prefix must be 8 bytes")
+	errFinished        = errors.New("stream: the last segment was already processed")
+	errTooManySegments = errors.New("stream: segment counter overflow")
+	errNotFinished     = siv.NewError(siv.ErrCiphertextTooShort, "stream: the last segment is missing")
+)
+
+type multipleAAD interface {
+	SealWithMultipleAAD(dst, plaintext []byte, additionalData [][]byte) []byte
+	OpenWithMultipleAAD(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error)
+}
+
+/*
+segments holds the state shared by Encryptor and Decryptor, the nonce of the next
+segment
+*/
+type segments struct {
+	aead     multipleAAD
+	nonce    [nonceSize]byte
+	counter  uint64
+	finished bool
+}
+
+func newSegments(key, prefix []byte) (*segments, error) {
+	if len(prefix) != NoncePrefixSize {
+		return nil, errNoncePrefixSize
+	}
+	aead, err := siv.NewAesSIV(key)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &segments{aead: aead}
+	copy(s.nonce[:], prefix)
+	return s, nil
+}
+
+/*
+next returns the associated data of the following segment
+*/
+func (s *segments) next(additionalData []byte, last bool) ([][]byte, error) {
+	if s.finished {
+		return nil, errFinished
+	}
+	if s.counter > math.MaxUint32 {
+		return nil, errTooManySegments
+	}
+
+	binary.BigEndian.PutUint32(s.nonce[NoncePrefixSize:], uint32(s.counter))
+	s.nonce[nonceSize-1] = 0
+	if last {
+		s.nonce[nonceSize-1] = 1
+	}
+	return [][]byte{additionalData, s.nonce[:]}, nil
+}
+
+func (s *segments) advance(last bool) {
+	s.counter++
+	s.finished = last
+}
+
+/*
+Encryptor seals the segments of one message, it's not safe for concurrent use
+*/
+type Encryptor struct {
+	s *segments
+}
+
+/*
+NewEncryptor takes an AES-SIV key of 32, 48 or 64 bytes and a nonce prefix of
+NoncePrefixSize bytes, which should be unique per message
+*/
+func NewEncryptor(key, prefix []byte) (*Encryptor, error) {
+	s, err := newSegments(key, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return &Encryptor{s: s}, nil
+}
+
+/*
+Seal appends the next segment to dst, last marks the final segment of the message.
+After it no more segments can be sealed.
+*/
+func (e *Encryptor) Seal(dst, plaintext, additionalData []byte, last bool) ([]byte, error) {
+	aad, err := e.s.next(additionalData, last)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := e.s.aead.SealWithMultipleAAD(dst, plaintext, aad)
+	e.s.advance(last)
+	return ret, nil
+}
+
+/*
+Decryptor opens the segments of one message in order, it's not safe for
+concurrent use
+*/
+type Decryptor struct {
+	s *segments
+}
+
+func NewDecryptor(key, prefix []byte) (*Decryptor, error) {
+	s, err := newSegments(key, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return &Decryptor{s: s}, nil
+}
+
+/*
+Open appends the plaintext of the next segment to dst. A failed segment doesn't
+advance the counter, so the caller can't skip it.
+*/
+func (d *Decryptor) Open(dst, ciphertext, additionalData []byte, last bool) ([]byte, error) {
+	aad, err := d.s.next(additionalData, last)
+	if err != nil {
+		return nil, err
+	}
+
+	ret, err := d.s.aead.OpenWithMultipleAAD(dst, ciphertext, aad)
+	if err != nil {
+		return nil, err
+	}
+	d.s.advance(last)
+	return ret, nil
+}
+
+/*
+Finish reports whether the last segment was opened, a message whose transport
+ended before that is truncated
+*/
+func (d *Decryptor) Finish() error {
+	if !d.s.finished {
+		return errNotFinished
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"github.com/luc-lynx/siv/siv"
+	"testing"
+)
+
+var (
+	key    = append(bytes.Repeat([]byte{0x11}, 16), bytes.Repeat([]byte{0x12}, 16)...)
+	prefix = []byte("prefix01")
+	ad     = []byte("header")
+)
+
+func seal(t *testing.T, segments [][]byte) [][]byte {
+	e, err := NewEncryptor(key, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed := make([][]byte, len(segments))
+	for i, p := range segments {
+		if sealed[i], err = e.Seal(nil, p, ad, i == len(segments)-1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := e.Seal(nil, nil, ad, true); err != errFinished {
+		t.Errorf("expected %v, got %v", errFinished, err)
+	}
+	return sealed
+}
+
+func TestRoundTrip(t *testing.T) {
+	segments := [][]byte{[]byte("first segment"), nil, bytes.Repeat([]byte{0xaa}, 100)}
+	sealed := seal(t, segments)
+
+	d, err := NewDecryptor(key, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range sealed {
+		p, err := d.Open(nil, c, ad, i == len(sealed)-1)
+		if err != nil || !bytes.Equal(p, segments[i]) {
+			t.Fatalf("segment %d: %v", i, err)
+		}
+	}
+	if err := d.Finish(); err != nil {
+		t.Error(err)
+	}
+
+	// equal segments at different positions are sealed differently
+	if again := seal(t, [][]byte{segments[0], segments[0]}); bytes.Equal(again[0], again[1]) {
+		t.Error("the segment position isn't bound")
+	}
+}
+
+/*
+The segment nonce is the last associated data string of AES-SIV, as in Miscreant
+*/
+func TestNonceLayout(t *testing.T) {
+	sealed := seal(t, [][]byte{[]byte("only segment")})
+
+	aead, _ := siv.NewAesSIV(key)
+	nonce := append(append([]byte{}, prefix...), 0, 0, 0, 0, 1)
+	expected := aead.SealWithMultipleAAD(nil, []byte("only segment"), [][]byte{ad, nonce})
+	if !bytes.Equal(sealed[0], expected) {
+		t.Errorf("got %x, expected %x", sealed[0], expected)
+	}
+}
+
+func TestTampering(t *testing.T) {
+	sealed := seal(t, [][]byte{[]byte("one"), []byte("two"), []byte("three")})
+
+	open := func(segments [][]byte, lasts []bool) error {
+		d, err := NewDecryptor(key, prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, c := range segments {
+			if _, err := d.Open(nil, c, ad, lasts[i]); err != nil {
+				return err
+			}
+		}
+		return d.Finish()
+	}
+
+	tests := []struct {
+		name     string
+		segments [][]byte
+		lasts    []bool
+		class    error
+	}{
+		{"reordered", [][]byte{sealed[1], sealed[0], sealed[2]}, []bool{false, false, true}, siv.ErrAuthentication},
+		{"dropped", [][]byte{sealed[0], sealed[2]}, []bool{false, true}, siv.ErrAuthentication},
+		{"truncated", sealed[:2], []bool{false, false}, siv.ErrMalformed},
+		{"early last flag", sealed[:2], []bool{false, true}, siv.ErrAuthentication},
+	}
+	for _, test := range tests {
+		if err := open(test.segments, test.lasts); !errors.Is(err, test.class) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.class, err)
+		}
+	}
+
+	d, _ := NewDecryptor([]byte("0123456789abcdefFEDCBA9876543210"), prefix)
+	if _, err := d.Open(nil, sealed[0], ad, false); !errors.Is(err, siv.ErrAuthentication) {
+		t.Errorf("wrong key: %v", err)
+	}
+}
+
+func TestInvalidParameters(t *testing.T) {
+	if _, err := NewEncryptor(key, prefix[:7]); err != errNoncePrefixSize {
+		t.Errorf("expected %v, got %v", errNoncePrefixSize, err)
+	}
+	if _, err := NewDecryptor(key[:20], prefix); err == nil {
+		t.Error("invalid key accepted")
+	}
+
+	e, _ := NewEncryptor(key, prefix)
+	e.s.counter = 1 << 32
+	if _, err := e.Seal(nil, nil, ad, false); err != errTooManySegments {
+		t.Errorf("expected %v, got %v", errTooManySegments, err)
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Package tenant hands out AEADs bound to the tenant found in a context, so a
+multi-tenant service never picks a key itself.
+
+Every tenant gets its own AES-SIV key derived from the master key with
+HKDF-SHA256, and its identity (tenant and workload, as aad.Builder strings) is
+prepended to the associated data of every Seal and Open. Data of one tenant
+therefore can't be opened as another tenant's, even if a ciphertext is moved.
+*/
+package tenant
+
+import (
+	"context"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"errors"
+	"github.com/luc-lynx/siv/aad"
+	"github.com/luc-lynx/siv/siv"
+	"slices"
+	"sync"
+)
+
+const keyInfo = "siv tenant key\x00"
+
+var (
+	errNoIdentity  = errors.New("tenant: context doesn't carry a tenant identity")
+	errEmptyTenant = errors.New("tenant: tenant name is empty")
+)
+
+type contextKey struct{}
+
+/*
+Identity names the tenant and, optionally, the workload acting for it
+*/
+type Identity struct {
+	Tenant   string
+	Workload string
+}
+
+/*
+NewContext returns a copy of ctx carrying the identity
+*/
+func NewContext(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+/*
+FromContext returns the identity stored by NewContext
+*/
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(Identity)
+	return id, ok
+}
+
+/*
+multipleAAD seals with SealTo, SealWithMultipleAAD panics on too many associated data strings
+*/
+type multipleAAD interface {
+	SealTo(dst, plaintext []byte, additionalData [][]byte) (int, error)
+	OpenWithMultipleAAD(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error)
+	Overhead() int
+}
+
+/*
+Factory derives per-tenant AEADs from a master key, they are cached after the first use
+*/
+type Factory struct {
+	master []byte
+	aeads  sync.Map // tenant name -> multipleAAD
+}
+
+/*
+NewFactory returns a factory deriving tenant keys of the master key's size,
+which must be 32, 48 or 64 bytes
+*/
+func NewFactory(masterKey []byte) (*Factory, error) {
+	if _, err := siv.NewAesSIV(masterKey); err != nil {
+		return nil, err
+	}
+	return &Factory{master: append([]byte{}, masterKey...)}, nil
+}
+
+/*
+AEAD returns the AEAD of the identity carried by ctx
+*/
+func (f *Factory) AEAD(ctx context.Context) (*AEAD, error) {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return nil, errNoIdentity
+	}
+	return f.ForIdentity(id)
+}
+
+/*
+ForIdentity returns the AEAD of the identity, for code that doesn't have a context
+*/
+func (f *Factory) ForIdentity(id Identity) (*AEAD, error) {
+	if id.Tenant == "" {
+		return nil, errEmptyTenant
+	}
+
+	a, ok := f.aeads.Load(id.Tenant)
+	if !ok {
+		key, err := hkdf.Key(sha256.New, f.master, nil, keyInfo+id.Tenant, len(f.master))
+		if err != nil {
+			return nil, err
+		}
+
+		aead, err := siv.NewAesSIV(key)
+		clear(key)
+		if err != nil {
+			return nil, err
+		}
+		a, _ = f.aeads.LoadOrStore(id.Tenant, aead)
+	}
+
+	return &AEAD{
+		id:   id,
+		aead: a.(multipleAAD),
+		aad:  aad.NewBuilder().String(id.Tenant).String(id.Workload).Build(),
+	}, nil
+}
+
+/*
+AEAD seals and opens data of one tenant
+*/
+type AEAD struct {
+	id   Identity
+	aead multipleAAD
+	aad  [][]byte
+}
+
+func (a *AEAD) Identity() Identity {
+	return a.id
+}
+
+/*
+Seal seals plaintext with the tenant key, the identity comes before additionalData.
+The identity takes two of the siv.MaxAssociatedData strings, more than 124 in
+additionalData is an error.
+*/
+func (a *AEAD) Seal(dst, plaintext []byte, additionalData [][]byte) ([]byte, error) {
+	dst = slices.Grow(dst, len(plaintext)+a.aead.Overhead())
+	n, err := a.aead.SealTo(dst[len(dst):cap(dst)], plaintext, a.additionalData(additionalData))
+	if err != nil {
+		return nil, err
+	}
+	return dst[:len(dst)+n], nil
+}
+
+func (a *AEAD) Open(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error) {
+	return a.aead.OpenWithMultipleAAD(dst, ciphertext, a.additionalData(additionalData))
+}
+
+func (a *AEAD) additionalData(additionalData [][]byte) [][]byte {
+	return append(a.aad[:len(a.aad):len(a.aad)], additionalData...)
+}
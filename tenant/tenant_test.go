@@ -0,0 +1,110 @@
+package tenant
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/luc-lynx/siv/siv"
+	"testing"
+)
+
+var master = append(bytes.Repeat([]byte{0x5a}, 32), bytes.Repeat([]byte{0xa5}, 32)...)
+
+func TestFactory(t *testing.T) {
+	t.Run("seal and open", testSealOpen)
+	t.Run("tenants are isolated", testIsolation)
+	t.Run("missing identity", testMissingIdentity)
+	t.Run("too many associated data strings", testTooManyAAD)
+}
+
+func aeadFor(t *testing.T, f *Factory, id Identity) *AEAD {
+	a, err := f.AEAD(NewContext(context.Background(), id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func testSealOpen(t *testing.T) {
+	f, err := NewFactory(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aad := [][]byte{[]byte("record 1")}
+	a := aeadFor(t, f, Identity{Tenant: "acme", Workload: "billing"})
+	sealed, err := a.Seal(nil, []byte("invoice"), aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a new AEAD for the same identity, the key comes from the cache
+	opened, err := aeadFor(t, f, Identity{Tenant: "acme", Workload: "billing"}).Open(nil, sealed, aad)
+	if err != nil || string(opened) != "invoice" {
+		t.Fatal("can't open", err)
+	}
+
+	// a factory with the same master key derives the same keys
+	other, err := NewFactory(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := aeadFor(t, other, a.Identity()).Open(nil, sealed, aad); err != nil {
+		t.Error("another factory can't open", err)
+	}
+}
+
+func testIsolation(t *testing.T) {
+	f, err := NewFactory(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := aeadFor(t, f, Identity{Tenant: "acme", Workload: "billing"}).Seal(nil, []byte("invoice"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []Identity{
+		{Tenant: "globex", Workload: "billing"},
+		{Tenant: "acme", Workload: "reports"},
+		{Tenant: "acmebilling"},
+	} {
+		if _, err := aeadFor(t, f, id).Open(nil, sealed, nil); err == nil {
+			t.Errorf("%+v opened data of another identity", id)
+		}
+	}
+}
+
+func testMissingIdentity(t *testing.T) {
+	f, err := NewFactory(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.AEAD(context.Background()); err != errNoIdentity {
+		t.Errorf("expected %v, got %v", errNoIdentity, err)
+	}
+	if _, err := f.AEAD(NewContext(context.Background(), Identity{Workload: "billing"})); err != errEmptyTenant {
+		t.Errorf("expected %v, got %v", errEmptyTenant, err)
+	}
+	if _, err := NewFactory(master[:20]); err == nil {
+		t.Error("short master key accepted")
+	}
+}
+
+func testTooManyAAD(t *testing.T) {
+	f, err := NewFactory(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := aeadFor(t, f, Identity{Tenant: "acme", Workload: "billing"})
+
+	// the identity takes two strings
+	if _, err := a.Seal(nil, []byte("invoice"), make([][]byte, siv.MaxAssociatedData-2)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Seal(nil, []byte("invoice"), make([][]byte, siv.MaxAssociatedData-1)); !errors.Is(err, siv.ErrMalformed) {
+		t.Errorf("expected %v, got %v", siv.ErrMalformed, err)
+	}
+}
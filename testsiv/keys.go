@@ -0,0 +1,29 @@
+package testsiv
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"strconv"
+)
+
+const keyInfo = "testsiv test key "
+
+/*
+Key derives a key of size bytes (32, 48 or 64 for AES-SIV, 16, 24 or 32 for CMAC)
+from a readable seed with HKDF-SHA256, so fixtures are reproducible without raw key
+bytes in the repository. Everybody who knows the seed knows the key: TEST ONLY.
+It panics on other sizes.
+*/
+func Key(seed string, size int) []byte {
+	switch size {
+	case 16, 24, 32, 48, 64:
+	default:
+		panic("testsiv: unsupported key size " + strconv.Itoa(size))
+	}
+
+	key, err := hkdf.Key(sha256.New, []byte(seed), nil, keyInfo+strconv.Itoa(size), size)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
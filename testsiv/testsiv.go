@@ -0,0 +1,134 @@
+package testsiv
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/hex"
+	"github.com/luc-lynx/siv/siv"
+	"strings"
+	"sync"
+)
+
+/*
+AEAD is a fake of the siv AEAD for unit tests of applications. It has the same methods
+but doesn't encrypt anything, "ciphertexts" are human-readable and reversible:
+
+	fakesiv|<key name>|<hex of aad 1>,<hex of aad 2>|<plaintext>
+
+Open fails the way the real implementation does for a different key name, different
+associated data or a modified ciphertext, and can be scripted to fail with arbitrary errors.
+Never use it outside of tests.
+*/
+
+const (
+	prefix    = "fakesiv"
+	separator = "|"
+	overhead  = 16
+)
+
+var (
+	// they wrap the siv failure classes, so errors.Is works as with the real implementation
+	ErrAuthentication = siv.NewError(siv.ErrAuthentication, "testsiv: message authentication failed")
+	ErrMalformed      = siv.NewError(siv.ErrMalformed, "testsiv: malformed ciphertext")
+)
+
+type AEAD struct {
+	keyName string
+
+	mu     sync.Mutex
+	script []error
+	seals  int
+	opens  int
+}
+
+var _ cipher.AEAD = (*AEAD)(nil)
+
+/*
+New returns a fake keyed with the name, the name must not contain "|".
+*/
+func New(keyName string) *AEAD {
+	if strings.Contains(keyName, separator) {
+		panic("testsiv: key name must not contain " + separator)
+	}
+	return &AEAD{keyName: keyName}
+}
+
+/*
+FailOpen makes the next Open calls return the errors in order,
+a nil entry lets the corresponding call proceed normally.
+*/
+func (a *AEAD) FailOpen(errs ...error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.script = append(a.script, errs...)
+}
+
+/*
+Calls returns the number of Seal and Open calls made so far.
+*/
+func (a *AEAD) Calls() (seals, opens int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.seals, a.opens
+}
+
+func (a *AEAD) NonceSize() int {
+	return 0
+}
+
+/*
+Overhead is the one of the real AEAD, fake ciphertexts are longer.
+*/
+func (a *AEAD) Overhead() int {
+	return overhead
+}
+
+func (a *AEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	return a.SealWithMultipleAAD(dst, plaintext, [][]byte{additionalData})
+}
+
+func (a *AEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	return a.OpenWithMultipleAAD(dst, ciphertext, [][]byte{additionalData})
+}
+
+func (a *AEAD) SealWithMultipleAAD(dst, plaintext []byte, additionalData [][]byte) []byte {
+	a.mu.Lock()
+	a.seals++
+	a.mu.Unlock()
+
+	return append(dst, a.header(additionalData)+string(plaintext)...)
+}
+
+func (a *AEAD) OpenWithMultipleAAD(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error) {
+	a.mu.Lock()
+	a.opens++
+	var scripted error
+	if len(a.script) > 0 {
+		scripted, a.script = a.script[0], a.script[1:]
+	}
+	a.mu.Unlock()
+
+	if scripted != nil {
+		return nil, scripted
+	}
+
+	if !bytes.HasPrefix(ciphertext, []byte(prefix+separator)) || bytes.Count(ciphertext, []byte(separator)) < 3 {
+		return nil, ErrMalformed
+	}
+
+	header := a.header(additionalData)
+	if !bytes.HasPrefix(ciphertext, []byte(header)) {
+		// wrong key, associated data mismatch or modified ciphertext
+		return nil, ErrAuthentication
+	}
+
+	return append(dst, ciphertext[len(header):]...), nil
+}
+
+func (a *AEAD) header(additionalData [][]byte) string {
+	aad := make([]string, len(additionalData))
+	for i := range additionalData {
+		aad[i] = hex.EncodeToString(additionalData[i])
+	}
+	return prefix + separator + a.keyName + separator + strings.Join(aad, ",") + separator
+}
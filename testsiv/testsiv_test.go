@@ -0,0 +1,88 @@
+package testsiv
+
+import (
+	"bytes"
+	"errors"
+	"github.com/luc-lynx/siv/siv"
+	"testing"
+)
+
+func TestFake(t *testing.T) {
+	a := New("key-1")
+	ct := a.SealWithMultipleAAD([]byte("prefix:"), []byte("hello"), [][]byte{[]byte("ab"), {}})
+	if string(ct) != "prefix:fakesiv|key-1|6162,|hello" {
+		t.Fatalf("unexpected ciphertext %q", ct)
+	}
+
+	pt, err := a.OpenWithMultipleAAD(nil, ct[len("prefix:"):], [][]byte{[]byte("ab"), {}})
+	if err != nil || !bytes.Equal(pt, []byte("hello")) {
+		t.Fatal("failed to open", err)
+	}
+
+	sealed := a.Seal(nil, nil, []byte("data"), []byte("ad"))
+	if _, err := a.Open(nil, nil, sealed, []byte("other")); err != ErrAuthentication {
+		t.Error("associated data mismatch isn't detected", err)
+	}
+	if _, err := New("key-2").Open(nil, nil, sealed, []byte("ad")); err != ErrAuthentication {
+		t.Error("wrong key isn't detected", err)
+	}
+	if _, err := a.Open(nil, nil, []byte("garbage"), []byte("ad")); err != ErrMalformed {
+		t.Error("malformed ciphertext isn't detected", err)
+	}
+
+	seals, opens := a.Calls()
+	if seals != 2 || opens != 3 {
+		t.Errorf("unexpected number of calls %d/%d", seals, opens)
+	}
+}
+
+func TestScriptedFailures(t *testing.T) {
+	a := New("key")
+	ct := a.Seal(nil, nil, []byte("data"), nil)
+
+	custom := errors.New("backend unavailable")
+	a.FailOpen(custom, nil, ErrAuthentication)
+
+	if _, err := a.Open(nil, nil, ct, nil); err != custom {
+		t.Error("unexpected error", err)
+	}
+	if _, err := a.Open(nil, nil, ct, nil); err != nil {
+		t.Error("unexpected error", err)
+	}
+	if _, err := a.Open(nil, nil, ct, nil); err != ErrAuthentication {
+		t.Error("unexpected error", err)
+	}
+	if _, err := a.Open(nil, nil, ct, nil); err != nil {
+		t.Error("script isn't exhausted", err)
+	}
+}
+
+func TestKey(t *testing.T) {
+	for _, size := range []int{32, 48, 64} {
+		key := Key("fixture", size)
+		if len(key) != size || !bytes.Equal(key, Key("fixture", size)) {
+			t.Fatalf("%d: key isn't reproducible", size)
+		}
+		if bytes.Equal(key, Key("other fixture", size)) {
+			t.Errorf("%d: different seeds give the same key", size)
+		}
+		if bytes.Equal(key[:size/2], key[size/2:]) {
+			t.Errorf("%d: key halves are equal", size)
+		}
+		if _, err := siv.NewAesSIV(key); err != nil {
+			t.Errorf("%d: %v", size, err)
+		}
+	}
+
+	// a shorter key isn't a prefix of a longer one
+	if bytes.Equal(Key("fixture", 32), Key("fixture", 64)[:32]) {
+		t.Error("key sizes aren't separated")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("unsupported size didn't panic")
+		}
+	}()
+	Key("fixture", 20)
+}
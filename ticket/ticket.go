@@ -0,0 +1,142 @@
+/*
+Package ticket seals self-contained tokens the way TLS servers seal session
+tickets: the ticket-encryption key (STEK) rotates, every ticket starts with the
+name of the key that sealed it, and the previous key is still accepted so tickets
+issued just before a rotation keep working.
+
+	ticket = key name (16 bytes) || AES-SIV(state, associated data = key name)
+
+The state is sealed deterministically, equal states give equal tickets. Put an
+issue time or a random value into the state if tickets mustn't be linkable.
+Key names and sealing keys are derived from the configured keys with HKDF-SHA256,
+so a name never reveals anything about the key.
+*/
+package ticket
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"crypto/subtle"
+	"github.com/luc-lynx/siv/siv"
+	"sync"
+)
+
+const NameSize = 16
+
+const (
+	nameInfo = "siv ticket key name"
+	keyInfo  = "siv ticket key"
+)
+
+var (
+	errUnknownKey = siv.NewError(siv.ErrAuthentication, "ticket: ticket key is unknown or expired")
+	errShort      = siv.NewError(siv.ErrCiphertextTooShort, "ticket: ticket is too short")
+)
+
+type multipleAAD interface {
+	SealWithMultipleAAD(dst, plaintext []byte, additionalData [][]byte) []byte
+	OpenWithMultipleAAD(dst, ciphertext []byte, additionalData [][]byte) ([]byte, error)
+}
+
+type generation struct {
+	name []byte
+	aead multipleAAD
+}
+
+/*
+Keys holds the current and the previous ticket key, it's safe for concurrent use
+*/
+type Keys struct {
+	mu       sync.RWMutex
+	current  *generation
+	previous *generation
+}
+
+/*
+NewKeys starts with a single key of 32, 48 or 64 bytes
+*/
+func NewKeys(key []byte) (*Keys, error) {
+	g, err := newGeneration(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Keys{current: g}, nil
+}
+
+/*
+Rotate makes key current, the current key becomes previous and the previous one is
+dropped, tickets sealed with it are rejected from now on
+*/
+func (k *Keys) Rotate(key []byte) error {
+	g, err := newGeneration(key)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.previous, k.current = k.current, g
+	return nil
+}
+
+/*
+Seal appends the ticket of state to dst
+*/
+func (k *Keys) Seal(dst, state []byte) []byte {
+	k.mu.RLock()
+	g := k.current
+	k.mu.RUnlock()
+
+	dst = append(dst, g.name...)
+	return g.aead.SealWithMultipleAAD(dst, state, [][]byte{g.name})
+}
+
+/*
+Open returns the state of a ticket. reissue is set if the ticket was sealed with
+the previous key, the caller should send a fresh ticket then.
+*/
+func (k *Keys) Open(ticket []byte) (state []byte, reissue bool, err error) {
+	if len(ticket) < NameSize {
+		return nil, false, errShort
+	}
+	name := ticket[:NameSize]
+
+	k.mu.RLock()
+	current, previous := k.current, k.previous
+	k.mu.RUnlock()
+
+	g := current
+	if subtle.ConstantTimeCompare(name, current.name) != 1 {
+		if previous == nil || subtle.ConstantTimeCompare(name, previous.name) != 1 {
+			return nil, false, errUnknownKey
+		}
+		g, reissue = previous, true
+	}
+
+	state, err = g.aead.OpenWithMultipleAAD(nil, ticket[NameSize:], [][]byte{g.name})
+	if err != nil {
+		return nil, false, err
+	}
+	return state, reissue, nil
+}
+
+func newGeneration(key []byte) (*generation, error) {
+	if _, err := siv.NewAesSIV(key); err != nil {
+		return nil, err
+	}
+
+	name, err := hkdf.Key(sha256.New, key, nil, nameInfo, NameSize)
+	if err != nil {
+		return nil, err
+	}
+	sealKey, err := hkdf.Key(sha256.New, key, nil, keyInfo, len(key))
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := siv.NewAesSIV(sealKey)
+	if err != nil {
+		return nil, err
+	}
+	return &generation{name: name, aead: aead}, nil
+}
@@ -0,0 +1,79 @@
+package ticket
+
+import (
+	"bytes"
+	"github.com/luc-lynx/siv/siv"
+	"testing"
+)
+
+var (
+	key1 = append(bytes.Repeat([]byte{0x11}, 16), bytes.Repeat([]byte{0x12}, 16)...)
+	key2 = append(bytes.Repeat([]byte{0x21}, 16), bytes.Repeat([]byte{0x22}, 16)...)
+	key3 = append(bytes.Repeat([]byte{0x31}, 16), bytes.Repeat([]byte{0x32}, 16)...)
+)
+
+func TestRotation(t *testing.T) {
+	keys, err := NewKeys(key1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := []byte("session state")
+	t1 := keys.Seal(nil, state)
+	if !bytes.Equal(t1, keys.Seal(nil, state)) {
+		t.Error("sealing isn't deterministic")
+	}
+	if got, reissue, err := keys.Open(t1); err != nil || reissue || !bytes.Equal(got, state) {
+		t.Fatal("can't open", err)
+	}
+
+	if err := keys.Rotate(key2); err != nil {
+		t.Fatal(err)
+	}
+	t2 := keys.Seal(nil, state)
+	if bytes.Equal(t1[:NameSize], t2[:NameSize]) {
+		t.Error("key names didn't change")
+	}
+	if got, reissue, err := keys.Open(t1); err != nil || !reissue || !bytes.Equal(got, state) {
+		t.Error("previous key isn't accepted", err)
+	}
+	if _, reissue, err := keys.Open(t2); err != nil || reissue {
+		t.Error("current key", reissue, err)
+	}
+
+	if err := keys.Rotate(key3); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := keys.Open(t1); err != errUnknownKey || siv.FailureClass(err) != "authentication" {
+		t.Error("dropped key accepted", err)
+	}
+}
+
+func TestRejects(t *testing.T) {
+	keys, err := NewKeys(key1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket := keys.Seal(nil, []byte("state"))
+
+	ticket[len(ticket)-1] ^= 1
+	if _, _, err := keys.Open(ticket); err == nil {
+		t.Error("modified ticket accepted")
+	}
+	if _, _, err := keys.Open(ticket[:5]); err != errShort {
+		t.Errorf("expected %v, got %v", errShort, err)
+	}
+	if err := keys.Rotate(key1[:7]); err == nil {
+		t.Error("invalid key accepted")
+	}
+	if _, err := NewKeys(nil); err == nil {
+		t.Error("missing key accepted")
+	}
+
+	// the name is authenticated, moving the body under another name fails
+	other, _ := NewKeys(key2)
+	forged := append(other.Seal(nil, nil)[:NameSize], keys.Seal(nil, []byte("state"))[NameSize:]...)
+	if _, _, err := other.Open(forged); err == nil {
+		t.Error("ticket accepted under another key name")
+	}
+}
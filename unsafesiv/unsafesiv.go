@@ -0,0 +1,116 @@
+/*
+Package unsafesiv decrypts AES-SIV ciphertexts WITHOUT AUTHENTICATING THEM.
+
+It exists for incident response and data recovery only: looking at a damaged
+or tampered ciphertext, finding out which associated data a message was sealed
+with, recovering the readable part of a corrupted backup. The returned
+plaintext is attacker controlled whenever the tags don't match. It must never
+be parsed, trusted, acted upon or passed to code that assumes it's been
+authenticated. Regular applications must use siv.Open.
+
+OpenUnauthenticated refuses to work unless AcknowledgeUnauthenticated is passed.
+*/
+package unsafesiv
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+	"github.com/luc-lynx/siv/siv"
+)
+
+const blockSize = 16
+
+var (
+	errNotAcknowledged         = errors.New("unsafesiv: unauthenticated decryption must be acknowledged with AcknowledgeUnauthenticated")
+	errKeySizeNotSupported     = siv.NewError(siv.ErrKeySize, "unsafesiv: key size not supported")
+	errInvalidCiphertextLength = siv.NewError(siv.ErrCiphertextTooShort, "unsafesiv: invalid ciphertext length")
+
+	mask = []byte{
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0x7f, 0xff, 0xff, 0xff, 0x7f, 0xff, 0xff, 0xff,
+	}
+)
+
+type options struct {
+	acknowledged bool
+}
+
+type Option func(*options)
+
+/*
+AcknowledgeUnauthenticated states that the caller understands the plaintext
+returned by OpenUnauthenticated may be forged
+*/
+func AcknowledgeUnauthenticated() Option {
+	return func(o *options) {
+		o.acknowledged = true
+	}
+}
+
+/*
+Result of an unauthenticated decryption. Plaintext is only genuine when
+Authentic is true.
+*/
+type Result struct {
+	Plaintext []byte
+	// ExpectedTag is the synthetic IV carried by the ciphertext
+	ExpectedTag []byte
+	// ComputedTag is S2V over the associated data and the decrypted bytes
+	ComputedTag []byte
+	Authentic   bool
+}
+
+/*
+OpenUnauthenticated CTR-decrypts an AES-SIV ciphertext and returns the
+decrypted bytes along with the expected and the computed tags, even if they
+differ.
+*/
+func OpenUnauthenticated(key, ciphertext []byte, additionalData [][]byte, opts ...Option) (*Result, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if !o.acknowledged {
+		return nil, errNotAcknowledged
+	}
+
+	switch len(key) {
+	case 32, 48, 64:
+	default:
+		return nil, errKeySizeNotSupported
+	}
+
+	if len(ciphertext) < blockSize {
+		return nil, errInvalidCiphertextLength
+	}
+
+	macKey := key[:len(key)/2]
+	encKey := key[len(key)/2:]
+	v := ciphertext[:blockSize]
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, blockSize)
+	for i := range iv {
+		iv[i] = v[i] & mask[i]
+	}
+
+	plaintext := make([]byte, len(ciphertext)-blockSize)
+	cipher.NewCTR(block, iv).XORKeyStream(plaintext, ciphertext[blockSize:])
+
+	computed, err := siv.S2V(macKey, append(append([][]byte{}, additionalData...), plaintext))
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		Plaintext:   plaintext,
+		ExpectedTag: append([]byte{}, v...),
+		ComputedTag: computed[:],
+		Authentic:   subtle.ConstantTimeCompare(computed[:], v) == 1,
+	}, nil
+}
@@ -0,0 +1,64 @@
+package unsafesiv
+
+import (
+	"bytes"
+	"github.com/luc-lynx/siv/siv"
+	"testing"
+)
+
+var (
+	key = []byte("0123456789abcdef0123456789ABCDEF")
+	aad = [][]byte{[]byte("header")}
+)
+
+func TestOpenUnauthenticated(t *testing.T) {
+	t.Run("acknowledgement is required", testAcknowledgement)
+	t.Run("authentic ciphertext", testAuthentic)
+	t.Run("tampered ciphertext", testTampered)
+}
+
+func seal(t *testing.T, plaintext []byte) []byte {
+	s, err := siv.NewAesSIV(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.SealWithMultipleAAD(nil, plaintext, aad)
+}
+
+func testAcknowledgement(t *testing.T) {
+	if _, err := OpenUnauthenticated(key, seal(t, []byte("message")), aad); err != errNotAcknowledged {
+		t.Errorf("expected %v, got %v", errNotAcknowledged, err)
+	}
+}
+
+func testAuthentic(t *testing.T) {
+	for _, plaintext := range []string{"", "short", "a message longer than one block"} {
+		ct := seal(t, []byte(plaintext))
+		r, err := OpenUnauthenticated(key, ct, aad, AcknowledgeUnauthenticated())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !r.Authentic || string(r.Plaintext) != plaintext || !bytes.Equal(r.ComputedTag, r.ExpectedTag) {
+			t.Errorf("unexpected result for %q: %+v", plaintext, r)
+		}
+	}
+}
+
+func testTampered(t *testing.T) {
+	plaintext := []byte("a message longer than one block")
+	ct := seal(t, plaintext)
+	ct[len(ct)-1] ^= 0x01
+
+	r, err := OpenUnauthenticated(key, ct, aad, AcknowledgeUnauthenticated())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Authentic || bytes.Equal(r.ComputedTag, r.ExpectedTag) {
+		t.Error("tampered ciphertext reported as authentic")
+	}
+	if !bytes.Equal(r.Plaintext[:len(plaintext)-1], plaintext[:len(plaintext)-1]) {
+		t.Error("untouched bytes weren't recovered")
+	}
+}